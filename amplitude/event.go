@@ -0,0 +1,100 @@
+// Package amplitude includes a sink for uploading the events we would send to
+// Segment directly into an Amplitude project via the Amplitude Batch or HTTP V2
+// API
+package amplitude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+)
+
+// GroupType is the Amplitude group type workspaces are set as
+const GroupType = "workspace"
+
+// IdentifyEventType is the event type of the events that only update the
+// properties or groups of a user
+const IdentifyEventType = "$identify"
+
+// ErrUnsupportedEvent is returned (wrapped in an EventError) for Segment calls
+// that have no Amplitude equivalent
+var ErrUnsupportedEvent = errors.New("event type is not supported by Amplitude")
+
+// Event is an event record as sent to the Amplitude upload APIs
+type Event struct {
+	UserID          string         `json:"user_id"`
+	EventType       string         `json:"event_type"`
+	Time            int64          `json:"time,omitempty"`
+	InsertID        string         `json:"insert_id,omitempty"`
+	EventProperties map[string]any `json:"event_properties,omitempty"`
+	UserProperties  map[string]any `json:"user_properties,omitempty"`
+	Groups          map[string]any `json:"groups,omitempty"`
+	UserAgent       string         `json:"user_agent,omitempty"`
+}
+
+// segmentEvent includes the fields of the Segment track, identify and group
+// calls we map into Amplitude events
+type segmentEvent struct {
+	MessageID  string         `json:"messageId"`
+	Timestamp  time.Time      `json:"timestamp"`
+	Type       string         `json:"type"`
+	UserID     string         `json:"userId"`
+	Event      string         `json:"event"`
+	GroupID    string         `json:"groupId"`
+	Properties map[string]any `json:"properties"`
+	Traits     map[string]any `json:"traits"`
+	Context    struct {
+		UserAgent string `json:"userAgent"`
+		GroupID   string `json:"groupId"`
+	} `json:"context"`
+}
+
+// FromSegment converts the given Segment call record into an Amplitude event:
+//   - Track calls become events of the same name, with the message ID as the
+//     insert ID Amplitude deduplicates events by, and the workspace given via
+//     context.groupId as the workspace group of the event.
+//   - Identify calls become $identify events setting the traits as user
+//     properties.
+//   - Group calls become $identify events adding the user to the workspace
+//     group. The group traits are not sent, since Amplitude only accepts
+//     group properties via its separate Group Identify API.
+func FromSegment(data []byte) (Event, error) {
+	var se segmentEvent
+	if err := json.Unmarshal(data, &se); err != nil {
+		return Event{}, sink.ErrInvalidEvent
+	}
+	if se.UserID == "" {
+		return Event{}, fmt.Errorf("%w: missing userId", sink.ErrInvalidEvent)
+	}
+	event := Event{UserID: se.UserID, InsertID: se.MessageID}
+	if !se.Timestamp.IsZero() {
+		event.Time = se.Timestamp.UnixMilli()
+	}
+	switch se.Type {
+	case "track":
+		if se.Event == "" {
+			return Event{}, fmt.Errorf("%w: missing event name", sink.ErrInvalidEvent)
+		}
+		event.EventType = se.Event
+		event.EventProperties = se.Properties
+		event.UserAgent = se.Context.UserAgent
+		if se.Context.GroupID != "" {
+			event.Groups = map[string]any{GroupType: se.Context.GroupID}
+		}
+	case "identify":
+		event.EventType = IdentifyEventType
+		event.UserProperties = map[string]any{"$set": se.Traits}
+	case "group":
+		if se.GroupID == "" {
+			return Event{}, fmt.Errorf("%w: missing groupId", sink.ErrInvalidEvent)
+		}
+		event.EventType = IdentifyEventType
+		event.Groups = map[string]any{GroupType: se.GroupID}
+	default:
+		return Event{}, fmt.Errorf("%w: %q", ErrUnsupportedEvent, se.Type)
+	}
+	return event, nil
+}
@@ -0,0 +1,88 @@
+package amplitude
+
+import (
+	"testing"
+
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromSegment(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   string
+		want    Event
+		wantErr error
+	}{
+		{
+			name: "Track",
+			event: `{"messageId":"m1","timestamp":"2024-05-01T10:00:00.123Z","type":"track",
+				"userId":"user-1","event":"Build Started","namespace":"ns1",
+				"properties":{"kind":"PipelineRun"},
+				"context":{"userAgent":"Mozilla/5.0","groupId":"ws-1"}}`,
+			want: Event{
+				UserID:          "user-1",
+				EventType:       "Build Started",
+				Time:            1714557600123,
+				InsertID:        "m1",
+				EventProperties: map[string]any{"kind": "PipelineRun"},
+				Groups:          map[string]any{GroupType: "ws-1"},
+				UserAgent:       "Mozilla/5.0",
+			},
+		},
+		{
+			name: "Identify",
+			event: `{"messageId":"m2","timestamp":"2024-05-01T10:00:00Z","type":"identify",
+				"userId":"user-1","traits":{"company":"Acme"}}`,
+			want: Event{
+				UserID:         "user-1",
+				EventType:      IdentifyEventType,
+				Time:           1714557600000,
+				InsertID:       "m2",
+				UserProperties: map[string]any{"$set": map[string]any{"company": "Acme"}},
+			},
+		},
+		{
+			name: "Group",
+			event: `{"messageId":"m3","type":"group","userId":"user-1","groupId":"ws-1",
+				"traits":{"name":"ws1"}}`,
+			want: Event{
+				UserID:    "user-1",
+				EventType: IdentifyEventType,
+				InsertID:  "m3",
+				Groups:    map[string]any{GroupType: "ws-1"},
+			},
+		},
+		{
+			name:    "Missing user",
+			event:   `{"type":"track","event":"Build Started"}`,
+			wantErr: sink.ErrInvalidEvent,
+		},
+		{
+			name:    "Missing event name",
+			event:   `{"type":"track","userId":"user-1"}`,
+			wantErr: sink.ErrInvalidEvent,
+		},
+		{
+			name:    "Unsupported type",
+			event:   `{"type":"page","userId":"user-1"}`,
+			wantErr: ErrUnsupportedEvent,
+		},
+		{
+			name:    "Not an object",
+			event:   `["foo"]`,
+			wantErr: sink.ErrInvalidEvent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := FromSegment([]byte(tt.event))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, event)
+		})
+	}
+}
@@ -0,0 +1,373 @@
+package amplitude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+)
+
+const (
+	// DefaultBatchAPI is the URL of the Amplitude Batch API of the US data
+	// center. The HTTP V2 API (https://api2.amplitude.com/2/httpapi) and the
+	// EU data center (https://api.eu.amplitude.com/batch) accept the same
+	// payloads.
+	DefaultBatchAPI = "https://api2.amplitude.com/batch"
+	// MaxBatchSize is the maximum request size the Amplitude Batch API
+	// accepts
+	MaxBatchSize = 20 * 1024 * 1024
+	// MinBatchSize is the size of the smallest upload payload, with an empty
+	// API key and event
+	MinBatchSize = len(`{"api_key":"","events":[`) + len("{}") + len(payloadSuffix)
+	// DefaultBatchDataSize is the default size of an upload payload we send.
+	// It stays below the 1MB the HTTP V2 API accepts, so either API can be
+	// used.
+	DefaultBatchDataSize = 1000 * 1024
+	// MaxBatchEvents is the maximum number of events the Amplitude APIs
+	// accept in a single upload
+	MaxBatchEvents = 2000
+	// DefaultRetries is how many times we retry a failed upload by default
+	DefaultRetries = httpretry.DefaultRetries
+	// DefaultThrottleWait is how long Amplitude asks to wait before retrying
+	// an upload that was throttled
+	DefaultThrottleWait = 30 * time.Second
+)
+
+var (
+	// ErrEventTooLarge is returned (wrapped in an EventError) for events that
+	// are too large to be uploaded
+	ErrEventTooLarge = errors.New("event is larger than the allowed size")
+	// ErrEventRefused is returned (wrapped in an EventError) for events
+	// Amplitude refused as invalid
+	ErrEventRefused = errors.New("event was refused by Amplitude")
+	// ErrDailyQuotaExceeded is returned (wrapped in an EventError) for the
+	// events of users that exceeded the Amplitude daily event quota
+	ErrDailyQuotaExceeded = errors.New("user exceeded the Amplitude daily event quota")
+)
+
+// Uploader is a sink.Sink that converts Segment call records into Amplitude
+// events and uploads them in batches
+type Uploader struct {
+	apiURL       string
+	client       *http.Client
+	apiKey       string
+	batchSize    int
+	batchEvents  int
+	policy       *httpretry.Policy
+	prefixLength int
+}
+
+// NewUploader constructs a default Uploader that uploads events to the given
+// Amplitude API URL
+func NewUploader(apiURL string) *Uploader {
+	return (&Uploader{
+		apiURL:      apiURL,
+		client:      http.DefaultClient,
+		batchSize:   DefaultBatchDataSize,
+		batchEvents: MaxBatchEvents,
+		policy:      NewRetryPolicy(),
+	}).WithAPIKey("")
+}
+
+// NewRetryPolicy returns the default policy for retrying failed uploads, which
+// waits as long as Amplitude asks for before retrying throttled uploads
+func NewRetryPolicy() *httpretry.Policy {
+	return httpretry.NewPolicy().WithThrottleWait(DefaultThrottleWait)
+}
+
+// WithClient sets the HTTP client used for making the API calls
+func (u *Uploader) WithClient(client *http.Client) *Uploader {
+	u.client = client
+	return u
+}
+
+// WithAPIKey sets the API key of the Amplitude project to upload events to
+func (u *Uploader) WithAPIKey(apiKey string) *Uploader {
+	u.apiKey = apiKey
+	u.prefixLength = len(u.payloadPrefix())
+	return u
+}
+
+// WithBatchSize sets the maximum size in bytes of each upload payload. Values
+// outside of MinBatchSize and MaxBatchSize are clamped.
+func (u *Uploader) WithBatchSize(size int) *Uploader {
+	u.batchSize = min(max(size, MinBatchSize), MaxBatchSize)
+	return u
+}
+
+// WithBatchEvents sets the maximum number of events in each upload. Values
+// outside of 1 and MaxBatchEvents are clamped.
+func (u *Uploader) WithBatchEvents(events int) *Uploader {
+	u.batchEvents = min(max(events, 1), MaxBatchEvents)
+	return u
+}
+
+// WithRetryPolicy sets the policy for retrying failed uploads
+func (u *Uploader) WithRetryPolicy(policy *httpretry.Policy) *Uploader {
+	u.policy = policy
+	return u
+}
+
+func (u *Uploader) Open(ctx context.Context) sink.Writer {
+	return &writer{ctx: ctx, uploader: u}
+}
+
+// payloadPrefix returns the beginning of the upload payloads, up to the
+// opening of the events array
+func (u *Uploader) payloadPrefix() []byte {
+	key, _ := json.Marshal(u.apiKey)
+	return append(append([]byte(`{"api_key":`), key...), `,"events":[`...)
+}
+
+const payloadSuffix = `]}`
+
+// pendingEvent is an encoded event waiting to be uploaded
+type pendingEvent struct {
+	userID string
+	data   []byte
+	// source is the Segment call record the event was converted from
+	source []byte
+}
+
+type writer struct {
+	ctx      context.Context
+	uploader *Uploader
+	pending  []pendingEvent
+	// size is the size of the current upload payload without the suffix
+	size  int
+	stats sink.Stats
+}
+
+func (w *writer) WriteEvent(data []byte) error {
+	event, err := FromSegment(data)
+	if err != nil {
+		return w.reject(len(data), err, nil)
+	}
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return w.reject(len(data), fmt.Errorf("%w: %w", sink.ErrInvalidEvent, err), nil)
+	}
+	if w.uploader.prefixLength+len(encoded)+len(payloadSuffix) > w.uploader.batchSize {
+		return w.reject(len(encoded), ErrEventTooLarge, nil)
+	}
+	if len(w.pending) > 0 &&
+		(w.size+1+len(encoded)+len(payloadSuffix) > w.uploader.batchSize ||
+			len(w.pending) >= w.uploader.batchEvents) {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(w.pending) == 0 {
+		w.size = w.uploader.prefixLength
+	} else {
+		w.size++
+	}
+	w.pending = append(w.pending, pendingEvent{userID: event.UserID, data: encoded, source: data})
+	w.size += len(encoded)
+	return nil
+}
+
+func (w *writer) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	if w.stats.Statuses == nil {
+		w.stats.Statuses = map[int]int{}
+	}
+	if err := w.upload(w.pending); err != nil {
+		return err
+	}
+	w.pending = nil
+	return nil
+}
+
+func (w *writer) Close() error {
+	return w.Flush()
+}
+
+func (w *writer) Stats() sink.Stats {
+	return w.stats
+}
+
+// reject records a rejected event. The Segment call record of the event is
+// kept if it was refused after being accepted into an upload, so it can be
+// told apart from the events that were uploaded.
+func (w *writer) reject(size int, reason error, source []byte) error {
+	err := &sink.EventError{Size: size, Err: reason, Event: source}
+	w.stats.Rejected = append(w.stats.Rejected, err)
+	return err
+}
+
+// upload uploads the given events. The events Amplitude refuses as invalid,
+// and those of users that exceeded their daily quota, are rejected and the
+// rest are uploaded again. Uploads Amplitude refuses as too large are split in
+// halves.
+func (w *writer) upload(events []pendingEvent) error {
+	payload := bytes.NewBuffer(w.uploader.payloadPrefix())
+	for i, event := range events {
+		if i > 0 {
+			payload.WriteByte(',')
+		}
+		payload.Write(event.data)
+	}
+	payload.WriteString(payloadSuffix)
+	status, failed, err := w.uploader.send(w.ctx, payload.Bytes(), w.stats.Statuses)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusOK:
+		w.stats.Events += len(events)
+		w.stats.Batches++
+		w.stats.Bytes += payload.Len()
+		return nil
+	case http.StatusBadRequest:
+		return w.uploadValid(events, failed.refusedEvents(len(events)), ErrEventRefused)
+	case http.StatusRequestEntityTooLarge:
+		return w.split(events, ErrEventTooLarge)
+	case http.StatusTooManyRequests:
+		if quota := failed.quotaEvents(events); len(quota) > 0 {
+			return w.uploadValid(events, quota, ErrDailyQuotaExceeded)
+		}
+	}
+	return fmt.Errorf("amplitude upload failed with HTTP status %d: %s", status, failed.Error)
+}
+
+// uploadValid rejects the given invalid events for the given reason and
+// uploads the rest. If the invalid events are not known, the events are split
+// instead.
+func (w *writer) uploadValid(events []pendingEvent, invalid map[int]bool, reason error) error {
+	if len(invalid) == 0 {
+		return w.split(events, reason)
+	}
+	var valid []pendingEvent
+	for i, event := range events {
+		if invalid[i] {
+			_ = w.reject(len(event.data), reason, event.source)
+		} else {
+			valid = append(valid, event)
+		}
+	}
+	if len(valid) == 0 {
+		return nil
+	}
+	return w.upload(valid)
+}
+
+// split uploads the given events in halves, so the events Amplitude refuses
+// end up being uploaded on their own and are rejected for the given reason
+func (w *writer) split(events []pendingEvent, reason error) error {
+	if len(events) == 1 {
+		_ = w.reject(len(events[0].data), reason, events[0].source)
+		return nil
+	}
+	half := len(events) / 2
+	if err := w.upload(events[:half]); err != nil {
+		return err
+	}
+	return w.upload(events[half:])
+}
+
+// failure is the body of the responses to failed uploads
+type failure struct {
+	Error                     string           `json:"error"`
+	EventsWithInvalidFields   map[string][]int `json:"events_with_invalid_fields"`
+	EventsWithMissingFields   map[string][]int `json:"events_with_missing_fields"`
+	SilencedEvents            []int            `json:"silenced_events"`
+	ExceededDailyQuotaUsers   map[string]int   `json:"exceeded_daily_quota_users"`
+	ExceededDailyQuotaDevices map[string]int   `json:"exceeded_daily_quota_devices"`
+}
+
+// quotaExceeded returns whether Amplitude throttled an upload because users or
+// devices exceeded their daily quota, rather than for sending too many
+// requests, so retrying the upload cannot help
+func (f failure) quotaExceeded() bool {
+	return len(f.ExceededDailyQuotaUsers) > 0 || len(f.ExceededDailyQuotaDevices) > 0
+}
+
+// refusedEvents returns the indices of the events Amplitude reported as
+// invalid, out of the given number of uploaded events
+func (f failure) refusedEvents(count int) map[int]bool {
+	refused := map[int]bool{}
+	add := func(indices []int) {
+		for _, i := range indices {
+			if i >= 0 && i < count {
+				refused[i] = true
+			}
+		}
+	}
+	for _, indices := range f.EventsWithInvalidFields {
+		add(indices)
+	}
+	for _, indices := range f.EventsWithMissingFields {
+		add(indices)
+	}
+	add(f.SilencedEvents)
+	return refused
+}
+
+// quotaEvents returns the indices of the given events that belong to users
+// that exceeded their daily quota
+func (f failure) quotaEvents(events []pendingEvent) map[int]bool {
+	quota := map[int]bool{}
+	for i, event := range events {
+		if _, ok := f.ExceededDailyQuotaUsers[event.userID]; ok {
+			quota[i] = true
+		}
+	}
+	return quota
+}
+
+// send POSTs the given payload to the upload API, retrying failed calls
+// according to the retry policy, and counts the HTTP status codes of the
+// responses. Uploads throttled for exceeding a daily quota are not retried.
+// The status of the last response is returned, along with its body if the
+// upload failed.
+func (u *Uploader) send(ctx context.Context, payload []byte, statuses map[int]int) (int, failure, error) {
+	var f failure
+	retryable := func(ctx context.Context, resp *http.Response, err error) bool {
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests && f.quotaExceeded() {
+			return false
+		}
+		return httpretry.Retryable(ctx, resp, err)
+	}
+	resp, err := u.policy.DoWith(ctx, retryable, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.apiURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := u.client.Do(req)
+		if err == nil {
+			statuses[resp.StatusCode]++
+			f = readFailure(resp)
+		}
+		return resp, err
+	})
+	if err != nil {
+		return 0, failure{}, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, f, nil
+}
+
+// readFailure reads the body of the given response if the upload failed
+func readFailure(resp *http.Response) failure {
+	var f failure
+	if resp.StatusCode == http.StatusOK {
+		return f
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if json.Unmarshal(body, &f) != nil || f.Error == "" {
+		f.Error = http.StatusText(resp.StatusCode)
+	}
+	return f
+}
@@ -0,0 +1,285 @@
+package amplitude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uploadRequest is the body of an upload call - for decoding JSON
+type uploadRequest struct {
+	APIKey string  `json:"api_key"`
+	Events []Event `json:"events"`
+}
+
+// testServer starts an Amplitude API stand-in that responds to uploads with
+// the status and body returned by the given function, and records the number
+// of events in each upload
+func testServer(t *testing.T, respond func(events []Event) (int, string)) (*httptest.Server, *[]int) {
+	var batchSizes []int
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req uploadRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "some-key", req.APIKey)
+		batchSizes = append(batchSizes, len(req.Events))
+		status, body := respond(req.Events)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(svr.Close)
+	return svr, &batchSizes
+}
+
+func testUploader(svr *httptest.Server) *Uploader {
+	return NewUploader(svr.URL).
+		WithClient(svr.Client()).
+		WithAPIKey("some-key").
+		WithRetryPolicy(
+			httpretry.NewPolicy().
+				WithRetries(1).
+				WithBackoff(time.Millisecond, time.Millisecond).
+				WithThrottleWait(time.Millisecond),
+		)
+}
+
+func trackEvent(user, name string) []byte {
+	return fmt.Appendf(nil,
+		`{"messageId":"%s-%s","timestamp":"2024-05-01T10:00:00Z","type":"track","userId":"%s","event":"%s"}`,
+		user, name, user, name,
+	)
+}
+
+func writeEvents(t *testing.T, uploader *Uploader, events ...[]byte) (*writer, error) {
+	w := uploader.Open(context.Background()).(*writer)
+	for _, event := range events {
+		if err := w.WriteEvent(event); err != nil {
+			return w, err
+		}
+	}
+	return w, w.Close()
+}
+
+func TestUploader_batches(t *testing.T) {
+	var uploaded []Event
+	svr, batchSizes := testServer(t, func(events []Event) (int, string) {
+		uploaded = append(uploaded, events...)
+		return http.StatusOK, `{"code":200}`
+	})
+	eventSize := len(`{"user_id":"user-1","event_type":"e1","time":1714557600000,"insert_id":"user-1-e1"}`)
+	prefixSize := len(`{"api_key":"some-key","events":[`)
+
+	w, err := writeEvents(t,
+		testUploader(svr).WithBatchEvents(3).WithBatchSize(prefixSize+2*eventSize+3),
+		trackEvent("user-1", "e1"), trackEvent("user-1", "e2"), trackEvent("user-1", "e3"),
+		trackEvent("user-1", "e4"), trackEvent("user-1", "e5"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 2, 1}, *batchSizes)
+	assert.Equal(t, 5, w.Stats().Events)
+	assert.Equal(t, 3, w.Stats().Batches)
+	assert.Equal(t, map[int]int{http.StatusOK: 3}, w.Stats().Statuses)
+	require.Len(t, uploaded, 5)
+	assert.Equal(t, "user-1-e1", uploaded[0].InsertID)
+	assert.Equal(t, int64(1714557600000), uploaded[0].Time)
+
+	*batchSizes = nil
+	w, err = writeEvents(t,
+		testUploader(svr).WithBatchEvents(2),
+		trackEvent("user-1", "e1"), trackEvent("user-1", "e2"), trackEvent("user-1", "e3"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 1}, *batchSizes)
+
+	_, err = writeEvents(t,
+		testUploader(svr).WithBatchSize(prefixSize+eventSize),
+		trackEvent("user-1", "e1"),
+	)
+	assert.ErrorIs(t, err, ErrEventTooLarge)
+}
+
+func TestUploader_WithBatchEvents(t *testing.T) {
+	for _, events := range []int{-1, 0, 1} {
+		assert.Equal(t, 1, NewUploader("").WithBatchEvents(events).batchEvents)
+	}
+	assert.Equal(t, MaxBatchEvents, NewUploader("").WithBatchEvents(MaxBatchEvents+1).batchEvents)
+	for _, size := range []int{-1, 0, 1} {
+		assert.Equal(t, MinBatchSize, NewUploader("").WithBatchSize(size).batchSize)
+	}
+	assert.Equal(t, MaxBatchSize, NewUploader("").WithBatchSize(MaxBatchSize+1).batchSize)
+
+	svr, batchSizes := testServer(t, func(events []Event) (int, string) {
+		return http.StatusOK, `{"code":200}`
+	})
+	w, err := writeEvents(t,
+		testUploader(svr).WithBatchEvents(0),
+		trackEvent("user-1", "e1"), trackEvent("user-1", "e2"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1}, *batchSizes)
+	assert.Equal(t, 2, w.Stats().Events)
+}
+
+func TestUploader_failures(t *testing.T) {
+	hasEvent := func(events []Event, name string) []int {
+		var indices []int
+		for i, event := range events {
+			if event.EventType == name || event.UserID == name {
+				indices = append(indices, i)
+			}
+		}
+		return indices
+	}
+	tests := []struct {
+		name           string
+		respond        func(events []Event) (int, string)
+		wantBatchSizes []int
+		wantEvents     int
+		wantStatuses   map[int]int
+		wantRejected   []error
+		wantErr        bool
+	}{
+		{
+			name: "Invalid events",
+			respond: func(events []Event) (int, string) {
+				if bad := hasEvent(events, "bad"); len(bad) > 0 {
+					indices, _ := json.Marshal(bad)
+					return http.StatusBadRequest, fmt.Sprintf(
+						`{"code":400,"error":"Request missing required field","events_with_invalid_fields":{"event_type":%s}}`,
+						indices,
+					)
+				}
+				return http.StatusOK, `{"code":200}`
+			},
+			wantBatchSizes: []int{4, 3},
+			wantEvents:     3,
+			wantStatuses:   map[int]int{400: 1, 200: 1},
+			wantRejected:   []error{ErrEventRefused},
+		},
+		{
+			name: "Invalid events not reported",
+			respond: func(events []Event) (int, string) {
+				if len(hasEvent(events, "bad")) > 0 {
+					return http.StatusBadRequest, `{"code":400,"error":"Invalid request"}`
+				}
+				return http.StatusOK, `{"code":200}`
+			},
+			wantBatchSizes: []int{4, 2, 1, 1, 2},
+			wantEvents:     3,
+			wantStatuses:   map[int]int{400: 3, 200: 2},
+			wantRejected:   []error{ErrEventRefused},
+		},
+		{
+			name: "Payload too large",
+			respond: func(events []Event) (int, string) {
+				if len(events) > 2 {
+					return http.StatusRequestEntityTooLarge, `{"code":413,"error":"Payload too large"}`
+				}
+				return http.StatusOK, `{"code":200}`
+			},
+			wantBatchSizes: []int{4, 2, 2},
+			wantEvents:     4,
+			wantStatuses:   map[int]int{413: 1, 200: 2},
+		},
+		{
+			name: "Throttled",
+			respond: func() func(events []Event) (int, string) {
+				calls := 0
+				return func(events []Event) (int, string) {
+					if calls++; calls == 1 {
+						return http.StatusTooManyRequests, `{"code":429,"error":"Too many requests for some devices and users","throttled_users":{"user-2":20}}`
+					}
+					return http.StatusOK, `{"code":200}`
+				}
+			}(),
+			wantBatchSizes: []int{4, 4},
+			wantEvents:     4,
+			wantStatuses:   map[int]int{429: 1, 200: 1},
+		},
+		{
+			name: "Daily quota exceeded",
+			respond: func(events []Event) (int, string) {
+				if len(hasEvent(events, "user-2")) > 0 {
+					return http.StatusTooManyRequests, `{"code":429,"error":"Too many requests for some devices and users","exceeded_daily_quota_users":{"user-2":500001}}`
+				}
+				return http.StatusOK, `{"code":200}`
+			},
+			wantBatchSizes: []int{4, 2},
+			wantEvents:     2,
+			wantStatuses:   map[int]int{429: 1, 200: 1},
+			wantRejected:   []error{ErrDailyQuotaExceeded, ErrDailyQuotaExceeded},
+		},
+		{
+			name: "Daily quota of devices exceeded",
+			respond: func(events []Event) (int, string) {
+				return http.StatusTooManyRequests, `{"code":429,"error":"Too many requests for some devices and users","exceeded_daily_quota_devices":{"device-2":500001}}`
+			},
+			wantBatchSizes: []int{4},
+			wantStatuses:   map[int]int{429: 1},
+			wantErr:        true,
+		},
+		{
+			name: "Throttled beyond retries",
+			respond: func(events []Event) (int, string) {
+				return http.StatusTooManyRequests, `{"code":429,"error":"Too many requests for some devices and users"}`
+			},
+			wantBatchSizes: []int{4, 4},
+			wantStatuses:   map[int]int{429: 2},
+			wantErr:        true,
+		},
+		{
+			name: "Unauthorized",
+			respond: func(events []Event) (int, string) {
+				return http.StatusUnauthorized, `{"code":401,"error":"Invalid API key"}`
+			},
+			wantBatchSizes: []int{4},
+			wantStatuses:   map[int]int{401: 1},
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svr, batchSizes := testServer(t, tt.respond)
+			w, err := writeEvents(t, testUploader(svr),
+				trackEvent("user-1", "a"), trackEvent("user-2", "bad"),
+				trackEvent("user-1", "c"), trackEvent("user-2", "d"),
+			)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			stats := w.Stats()
+			assert.Equal(t, tt.wantBatchSizes, *batchSizes)
+			assert.Equal(t, tt.wantEvents, stats.Events)
+			assert.Equal(t, tt.wantStatuses, stats.Statuses)
+			require.Len(t, stats.Rejected, len(tt.wantRejected))
+			for i, reason := range tt.wantRejected {
+				assert.ErrorIs(t, stats.Rejected[i], reason)
+				assert.Contains(t, string(stats.Rejected[i].Event), `"userId":"user-2"`)
+			}
+		})
+	}
+}
+
+func TestUploader_rejectedEvents(t *testing.T) {
+	svr, batchSizes := testServer(t, func(events []Event) (int, string) {
+		return http.StatusOK, `{"code":200}`
+	})
+	w := testUploader(svr).Open(context.Background())
+	for _, event := range []string{`{"type":"page","userId":"user-1"}`, `not json`} {
+		assert.Error(t, w.WriteEvent([]byte(event)))
+	}
+	require.NoError(t, w.WriteEvent(trackEvent("user-1", "a")))
+	require.NoError(t, w.Close())
+	assert.Equal(t, []int{1}, *batchSizes)
+	assert.Len(t, w.Stats().Rejected, 2)
+	assert.ErrorIs(t, w.Stats().Rejected[0], ErrUnsupportedEvent)
+}
@@ -0,0 +1,272 @@
+// Package archive implements a sink that keeps a durable record of the
+// delivered events as gzip-compressed NDJSON objects in an S3-compatible
+// bucket, and replays archived events into other sinks
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+)
+
+const (
+	// DefaultBatchSize is how many bytes of uncompressed events are written
+	// into each object by default
+	DefaultBatchSize = 16 * 1024 * 1024
+
+	manifestsDir = "manifests"
+)
+
+// Object describes an archived object holding a batch of events
+type Object struct {
+	// Key is the key of the object in the bucket
+	Key string `json:"key"`
+	// Query is the title of the query the events were produced by
+	Query string `json:"query"`
+	// Date is the date of the events, as YYYY-MM-DD
+	Date string `json:"date"`
+	// Events is the number of events in the object
+	Events int `json:"events"`
+	// Size is the compressed size of the object in bytes
+	Size int `json:"size"`
+}
+
+// Manifest lists the objects archived by a run
+type Manifest struct {
+	RunID    string    `json:"runId"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Objects  []Object  `json:"objects"`
+}
+
+// Archive is a sink.Sink that writes each batch of events into a bucket as a
+// gzip-compressed NDJSON object, with keys partitioned by event date and
+// query title:
+//
+//	PREFIX/date=YYYY-MM-DD/query=QUERY/RUN-SEQ.ndjson.gz
+//
+// Close must be called at the end of a run to write the manifest listing the
+// objects of the run into PREFIX/manifests/RUN.json.
+type Archive struct {
+	client    *Client
+	prefix    string
+	batchSize int
+	now       func() time.Time
+
+	mu       sync.Mutex
+	manifest Manifest
+	// seq is the sequence number of the next object
+	seq int
+}
+
+// NewArchive constructs a default Archive writing objects with the given key
+// prefix via the given client
+func NewArchive(client *Client, prefix string) *Archive {
+	return &Archive{
+		client:    client,
+		prefix:    strings.Trim(prefix, "/"),
+		batchSize: DefaultBatchSize,
+		now:       time.Now,
+		manifest:  Manifest{RunID: newRunID(time.Now()), Started: time.Now().UTC()},
+	}
+}
+
+// WithBatchSize sets how many bytes of uncompressed events are written into
+// each object
+func (a *Archive) WithBatchSize(size int) *Archive {
+	a.batchSize = size
+	return a
+}
+
+// WithRunID sets the ID of the current run, which the names of its objects
+// and its manifest start with
+func (a *Archive) WithRunID(runID string) *Archive {
+	a.manifest.RunID = runID
+	return a
+}
+
+// RunID returns the ID of the current run
+func (a *Archive) RunID() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.manifest.RunID
+}
+
+// newRunID returns a run ID made of the given time and a random suffix, so
+// the objects of runs sort by time and concurrent runs do not clash
+func newRunID(now time.Time) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return now.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+}
+
+func (a *Archive) Open(ctx context.Context) sink.Writer {
+	return &writer{
+		ctx:     ctx,
+		archive: a,
+		query:   sink.Query(ctx),
+		pending: map[string]*batch{},
+	}
+}
+
+// Close writes the manifest of the run, and starts a new run with a new ID
+// for the events written afterwards, e.g. by the next iteration of a long
+// running process
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	manifest := a.manifest
+	manifest.Finished = a.now().UTC()
+	a.manifest = Manifest{RunID: newRunID(a.now()), Started: a.now().UTC()}
+	a.seq = 0
+	a.mu.Unlock()
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	key := path.Join(a.prefix, manifestsDir, manifest.RunID+".json")
+	if err := a.client.PutObject(context.Background(), key, data, "application/json"); err != nil {
+		return fmt.Errorf("failed to write the archive manifest: %w", err)
+	}
+	return nil
+}
+
+// put writes the given events of the given query and date into a new object,
+// and adds it to the manifest
+func (a *Archive) put(ctx context.Context, query, date string, events *batch) (Object, error) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(events.data.Bytes()); err != nil {
+		return Object{}, err
+	}
+	if err := gz.Close(); err != nil {
+		return Object{}, err
+	}
+
+	a.mu.Lock()
+	name := fmt.Sprintf("%s-%04d.ndjson.gz", a.manifest.RunID, a.seq)
+	a.seq++
+	a.mu.Unlock()
+	object := Object{
+		Key:    path.Join(a.prefix, "date="+date, "query="+slug(query), name),
+		Query:  query,
+		Date:   date,
+		Events: events.count,
+		Size:   compressed.Len(),
+	}
+	err := a.client.PutObject(ctx, object.Key, compressed.Bytes(), "application/gzip")
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to archive events: %w", err)
+	}
+	a.mu.Lock()
+	a.manifest.Objects = append(a.manifest.Objects, object)
+	a.mu.Unlock()
+	return object, nil
+}
+
+// slug turns the given query title into a key path segment
+func slug(title string) string {
+	var s strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			if dash && s.Len() > 0 {
+				s.WriteByte('-')
+			}
+			s.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if s.Len() == 0 {
+		return "unknown"
+	}
+	return s.String()
+}
+
+// batch holds the NDJSON lines of the events of a single date
+type batch struct {
+	data  bytes.Buffer
+	count int
+}
+
+type writer struct {
+	ctx     context.Context
+	archive *Archive
+	query   string
+	// pending holds the events of the current batch by date
+	pending map[string]*batch
+	size    int
+	stats   sink.Stats
+}
+
+func (w *writer) WriteEvent(event []byte) error {
+	compact, err := sink.Compact(event)
+	if err != nil {
+		eventErr := &sink.EventError{Size: len(event), Err: err}
+		w.stats.Rejected = append(w.stats.Rejected, eventErr)
+		return eventErr
+	}
+	var fields struct {
+		Timestamp time.Time `json:"timestamp"`
+	}
+	timestamp := w.archive.now()
+	if json.Unmarshal(compact, &fields) == nil && !fields.Timestamp.IsZero() {
+		timestamp = fields.Timestamp
+	}
+	date := timestamp.UTC().Format(time.DateOnly)
+	pending, ok := w.pending[date]
+	if !ok {
+		pending = &batch{}
+		w.pending[date] = pending
+	}
+	pending.data.Write(compact)
+	pending.data.WriteByte('\n')
+	pending.count++
+	w.size += len(compact) + 1
+	if w.size >= w.archive.batchSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush writes an object for each date of the pending events
+func (w *writer) Flush() error {
+	dates := make([]string, 0, len(w.pending))
+	for date := range w.pending {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		object, err := w.archive.put(w.ctx, w.query, date, w.pending[date])
+		if err != nil {
+			return err
+		}
+		delete(w.pending, date)
+		w.stats.Events += object.Events
+		w.stats.Batches++
+		w.stats.Bytes += object.Size
+	}
+	w.size = 0
+	return nil
+}
+
+func (w *writer) Close() error {
+	return w.Flush()
+}
+
+func (w *writer) Stats() sink.Stats {
+	return w.stats
+}
@@ -0,0 +1,188 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent(id, timestamp string) []byte {
+	return fmt.Appendf(nil, `{"messageId":"%s","timestamp":"%s","event":"e"}`, id, timestamp)
+}
+
+// archiveEvents writes the given events of each query into the archive and
+// closes it
+func archiveEvents(t *testing.T, archive *Archive, events map[string][][]byte) {
+	for query, queryEvents := range events {
+		w := archive.Open(sink.WithQuery(context.Background(), query))
+		for _, event := range queryEvents {
+			require.NoError(t, w.WriteEvent(event))
+		}
+		require.NoError(t, w.Close())
+	}
+	require.NoError(t, archive.Close())
+}
+
+func gunzip(t *testing.T, data []byte) string {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	lines, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	return string(lines)
+}
+
+func TestArchive(t *testing.T) {
+	s3, svr := newFakeS3(t, "archive")
+	archive := NewArchive(testClient(svr, "archive"), "/uj/").
+		WithRunID("run1").
+		WithBatchSize(2 * len(testEvent("m1", "2024-05-01T10:00:00Z")))
+	archive.now = func() time.Time { return time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC) }
+
+	w := archive.Open(sink.WithQuery(context.Background(), "Build Pipeline runs"))
+	for _, event := range [][]byte{
+		testEvent("m1", "2024-05-01T10:00:00Z"),
+		testEvent("m2", "2024-05-01T23:00:00-02:00"),
+		testEvent("m3", "2024-05-01T11:00:00Z"),
+		[]byte(`{"messageId":"m4"}`),
+	} {
+		require.NoError(t, w.WriteEvent(event))
+	}
+	assert.Error(t, w.WriteEvent([]byte(`not json`)))
+	require.NoError(t, w.Close())
+	require.NoError(t, archive.Close())
+
+	stats := w.Stats()
+	assert.Equal(t, 4, stats.Events)
+	assert.Equal(t, 4, stats.Batches)
+	assert.Len(t, stats.Rejected, 1)
+	assert.Equal(t, []string{
+		"uj/date=2024-05-01/query=build-pipeline-runs/run1-0000.ndjson.gz",
+		"uj/date=2024-05-01/query=build-pipeline-runs/run1-0002.ndjson.gz",
+		"uj/date=2024-05-02/query=build-pipeline-runs/run1-0001.ndjson.gz",
+		"uj/date=2024-05-03/query=build-pipeline-runs/run1-0003.ndjson.gz",
+		"uj/manifests/run1.json",
+	}, s3.keys())
+	assert.Equal(t,
+		`{"messageId":"m1","timestamp":"2024-05-01T10:00:00Z","event":"e"}`+"\n",
+		gunzip(t, s3.objects["uj/date=2024-05-01/query=build-pipeline-runs/run1-0000.ndjson.gz"]),
+	)
+
+	var manifest Manifest
+	require.NoError(t, json.Unmarshal(s3.objects["uj/manifests/run1.json"], &manifest))
+	assert.Equal(t, "run1", manifest.RunID)
+	require.Len(t, manifest.Objects, 4)
+	assert.Equal(t, Object{
+		Key:    "uj/date=2024-05-02/query=build-pipeline-runs/run1-0001.ndjson.gz",
+		Query:  "Build Pipeline runs",
+		Date:   "2024-05-02",
+		Events: 1,
+		Size:   len(s3.objects["uj/date=2024-05-02/query=build-pipeline-runs/run1-0001.ndjson.gz"]),
+	}, manifest.Objects[1])
+}
+
+func TestArchive_Replay(t *testing.T) {
+	_, svr := newFakeS3(t, "archive")
+	client := testClient(svr, "archive")
+	archiveEvents(t, NewArchive(client, "uj").WithRunID("run1"), map[string][][]byte{
+		"Builds": {testEvent("b1", "2024-05-01T10:00:00Z"), testEvent("b2", "2024-05-02T10:00:00Z")},
+	})
+	archiveEvents(t, NewArchive(client, "uj").WithRunID("run2"), map[string][][]byte{
+		"Builds":  {testEvent("b3", "2024-05-03T10:00:00Z")},
+		"Deploys": {testEvent("d1", "2024-05-02T10:00:00Z")},
+	})
+
+	tests := []struct {
+		name        string
+		filter      Filter
+		wantQueries []string
+		wantEvents  []string
+	}{
+		{
+			name:        "All",
+			wantQueries: []string{"Builds", "Deploys"},
+			wantEvents:  []string{"b1", "b2", "b3", "d1"},
+		},
+		{
+			name:        "Dates",
+			filter:      Filter{Since: "2024-05-02", Until: "2024-05-02"},
+			wantQueries: []string{"Builds", "Deploys"},
+			wantEvents:  []string{"b2", "d1"},
+		},
+		{
+			name:        "Query",
+			filter:      Filter{Query: "Builds"},
+			wantQueries: []string{"Builds"},
+			wantEvents:  []string{"b1", "b2", "b3"},
+		},
+		{
+			name:        "Run",
+			filter:      Filter{RunID: "run2"},
+			wantQueries: []string{"Builds", "Deploys"},
+			wantEvents:  []string{"b3", "d1"},
+		},
+		{
+			name:   "Nothing",
+			filter: Filter{Since: "2024-06-01"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			results, err := NewArchive(client, "uj").Replay(context.Background(), sink.NewNDJSONSink(&out), tt.filter)
+			require.NoError(t, err)
+
+			var queries []string
+			total := 0
+			for _, result := range results {
+				require.NoError(t, result.Err)
+				assert.Equal(t, result.Events, result.Stats.Events)
+				queries = append(queries, result.Query)
+				total += result.Events
+			}
+			assert.Equal(t, tt.wantQueries, queries)
+			assert.Equal(t, len(tt.wantEvents), total)
+
+			var ids []string
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				var event struct{ MessageID string }
+				if line != "" {
+					require.NoError(t, json.Unmarshal([]byte(line), &event))
+					ids = append(ids, event.MessageID)
+				}
+			}
+			assert.ElementsMatch(t, tt.wantEvents, ids)
+		})
+	}
+}
+
+func TestSlug(t *testing.T) {
+	assert.Equal(t, "build-pipeline-runs", slug("Build Pipeline  runs!"))
+	assert.Equal(t, "dead-letters", slug("Dead letters"))
+	assert.Equal(t, "unknown", slug(""))
+}
+
+func TestArchive_Close(t *testing.T) {
+	s3, svr := newFakeS3(t, "archive")
+	archive := NewArchive(testClient(svr, "archive"), "uj").WithRunID("run1")
+	archiveEvents(t, archive, map[string][][]byte{"Builds": {testEvent("b1", "2024-05-01T10:00:00Z")}})
+	assert.NotEqual(t, "run1", archive.RunID())
+	archiveEvents(t, archive, map[string][][]byte{"Builds": {testEvent("b2", "2024-05-01T10:00:00Z")}})
+
+	manifests, err := archive.Manifests(context.Background())
+	require.NoError(t, err)
+	require.Len(t, manifests, 2)
+	assert.Equal(t, "run1", manifests[1].RunID, "Random run IDs sort before named ones")
+	assert.Len(t, manifests[0].Objects, 1)
+	assert.Len(t, manifests[1].Objects, 1)
+	assert.Len(t, s3.keys(), 4)
+}
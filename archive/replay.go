@@ -0,0 +1,164 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+)
+
+// Filter selects the archived objects to replay. Empty fields match all
+// objects.
+type Filter struct {
+	// Since is the earliest event date to replay, as YYYY-MM-DD
+	Since string
+	// Until is the latest event date to replay, as YYYY-MM-DD
+	Until string
+	// Query is the title of the query to replay the events of
+	Query string
+	// RunID is the ID of the run to replay the events of
+	RunID string
+}
+
+func (f Filter) matches(runID string, object Object) bool {
+	return (f.Since == "" || object.Date >= f.Since) &&
+		(f.Until == "" || object.Date <= f.Until) &&
+		(f.Query == "" || object.Query == f.Query) &&
+		(f.RunID == "" || runID == f.RunID)
+}
+
+// ReplayResult summarizes the replay of the archived events of a query
+type ReplayResult struct {
+	// Query is the title of the query
+	Query string
+	// Objects is the number of objects read
+	Objects int
+	// Events is the number of events read from the objects
+	Events int
+	// Stats reports the outcome of writing the events into the sink
+	Stats sink.Stats
+	// Err is set if replaying the events failed
+	Err error
+}
+
+// Manifests reads the manifests of all the archived runs, ordered by run ID
+func (a *Archive) Manifests(ctx context.Context) ([]Manifest, error) {
+	keys, err := a.client.ListObjects(ctx, path.Join(a.prefix, manifestsDir)+"/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the archive manifests: %w", err)
+	}
+	var manifests []Manifest
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".json") {
+			continue
+		}
+		data, err := a.client.GetObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		var manifest Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse the archive manifest %s: %w", key, err)
+		}
+		manifests = append(manifests, manifest)
+	}
+	return manifests, nil
+}
+
+// Replay writes the events of the archived objects that match the given filter
+// into the given sink, using a Writer for each query. Runs are found via their
+// manifests, so objects of runs that ended before writing a manifest are not
+// replayed.
+func (a *Archive) Replay(ctx context.Context, destination sink.Sink, filter Filter) ([]ReplayResult, error) {
+	manifests, err := a.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var queries []string
+	objects := map[string][]Object{}
+	for _, manifest := range manifests {
+		for _, object := range manifest.Objects {
+			if !filter.matches(manifest.RunID, object) {
+				continue
+			}
+			if _, ok := objects[object.Query]; !ok {
+				queries = append(queries, object.Query)
+			}
+			objects[object.Query] = append(objects[object.Query], object)
+		}
+	}
+	results := make([]ReplayResult, 0, len(queries))
+	for _, query := range queries {
+		results = append(results, a.replayQuery(ctx, destination, query, objects[query]))
+	}
+	return results, nil
+}
+
+// replayQuery writes the events of the given objects of a query into the
+// given sink
+func (a *Archive) replayQuery(
+	ctx context.Context, destination sink.Sink, query string, objects []Object,
+) ReplayResult {
+	result := ReplayResult{Query: query}
+	writer := destination.Open(sink.WithQuery(ctx, query))
+	for _, object := range objects {
+		events, err := a.readObject(ctx, object.Key)
+		if err != nil {
+			result.Err = err
+			break
+		}
+		result.Objects++
+		for _, event := range events {
+			result.Events++
+			var eventErr *sink.EventError
+			if err = writer.WriteEvent(event); err != nil && !errors.As(err, &eventErr) {
+				result.Err = fmt.Errorf("replay failed: %w", err)
+				break
+			}
+		}
+		if result.Err != nil {
+			break
+		}
+	}
+	if result.Err == nil {
+		if err := writer.Close(); err != nil {
+			result.Err = fmt.Errorf("replay failed: %w", err)
+		}
+	}
+	result.Stats = writer.Stats()
+	return result
+}
+
+// readObject returns the events of an archived object
+func (a *Archive) readObject(ctx context.Context, key string) ([][]byte, error) {
+	data, err := a.client.GetObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s: %w", key, err)
+	}
+	var events [][]byte
+	reader := bufio.NewReader(gz)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			events = append(events, line)
+		}
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", key, err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+)
+
+const (
+	// DefaultEndpoint is the URL of the AWS S3 API
+	DefaultEndpoint = "https://s3.amazonaws.com"
+	// DefaultRegion is the region requests are signed for by default
+	DefaultRegion = "us-east-1"
+
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+)
+
+// Client is a minimal client of the S3 API for storing, listing and reading
+// the objects of a bucket, using path-style URLs so it works with S3
+// compatible stores such as MinIO
+type Client struct {
+	endpoint     string
+	bucket       string
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+	policy       *httpretry.Policy
+	// now returns the time requests are signed at
+	now func() time.Time
+}
+
+// NewClient constructs a default Client for the given bucket at the given S3
+// API endpoint. Requests are not signed unless credentials are set.
+func NewClient(endpoint, bucket string) *Client {
+	return &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		bucket:   bucket,
+		region:   DefaultRegion,
+		client:   http.DefaultClient,
+		policy:   httpretry.NewPolicy(),
+		now:      time.Now,
+	}
+}
+
+// WithCredentials sets the credentials requests are signed with. The session
+// token is only needed for temporary credentials.
+func (c *Client) WithCredentials(accessKey, secretKey, sessionToken string) *Client {
+	c.accessKey = accessKey
+	c.secretKey = secretKey
+	c.sessionToken = sessionToken
+	return c
+}
+
+// WithRegion sets the region requests are signed for
+func (c *Client) WithRegion(region string) *Client {
+	c.region = region
+	return c
+}
+
+// WithHTTPClient sets the HTTP client used for making the API calls
+func (c *Client) WithHTTPClient(client *http.Client) *Client {
+	c.client = client
+	return c
+}
+
+// WithRetryPolicy sets the policy for retrying failed API calls
+func (c *Client) WithRetryPolicy(policy *httpretry.Policy) *Client {
+	c.policy = policy
+	return c
+}
+
+// PutObject stores the given data as the object with the given key
+func (c *Client) PutObject(ctx context.Context, key string, data []byte, contentType string) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	_, err := c.do(ctx, http.MethodPut, key, nil, header, data)
+	return err
+}
+
+// GetObject returns the data of the object with the given key
+func (c *Client) GetObject(ctx context.Context, key string) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, key, nil, nil, nil)
+}
+
+// listResult is the body of the ListObjectsV2 responses
+type listResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+}
+
+// ListObjects returns the keys of the objects whose keys start with the given
+// prefix, in lexicographical order
+func (c *Client) ListObjects(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		data, err := c.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result listResult
+		if err := xml.Unmarshal(data, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse the object list: %w", err)
+		}
+		for _, content := range result.Contents {
+			keys = append(keys, content.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// s3Error is the body of the responses to failed calls
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// do makes a call to the object with the given key, or to the bucket if the
+// key is empty, retrying failed calls according to the retry policy, and
+// returns the response body
+func (c *Client) do(
+	ctx context.Context, method, key string, query url.Values, header http.Header, body []byte,
+) ([]byte, error) {
+	target, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	target = target.JoinPath(c.bucket, key)
+	target.RawQuery = query.Encode()
+	resp, err := c.policy.Do(ctx, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		c.sign(req, body)
+		return c.client.Do(req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var s3Err s3Error
+		if xml.Unmarshal(data, &s3Err) != nil || s3Err.Code == "" {
+			s3Err.Code = http.StatusText(resp.StatusCode)
+		}
+		return nil, fmt.Errorf(
+			"S3 %s call for %q failed with HTTP status %d: %s %s",
+			method, target.Path, resp.StatusCode, s3Err.Code, s3Err.Message,
+		)
+	}
+	return data, nil
+}
+
+// sign signs the given request with AWS Signature Version 4, covering the
+// host, the payload and all the headers already set on the request
+func (c *Client) sign(req *http.Request, body []byte) {
+	if c.accessKey == "" {
+		return
+	}
+	now := c.now().UTC()
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+	signature, signedHeaders, scope := c.signature(req, now)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, c.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+// signature returns the signature of the given request, the list of headers
+// it covers and the credential scope
+func (c *Client) signature(req *http.Request, now time.Time) (string, string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	date := now.Format("20060102")
+	scope := strings.Join([]string{date, c.region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		signingAlgorithm, now.Format(amzDateFormat), scope, hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + c.secretKey)
+	for _, part := range []string{date, c.region, "s3", "aws4_request", stringToSign} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(key), signedHeaders, scope
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery returns the given query parameters encoded and sorted as
+// required for signing
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for name, values := range query {
+		for _, value := range values {
+			params = append(params, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode percent-encodes all the characters of the given string except the
+// unreserved ones and, unless encodeSlash is set, slashes
+func uriEncode(s string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
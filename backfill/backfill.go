@@ -0,0 +1,121 @@
+package backfill
+
+import (
+	"context"
+
+	"github.com/redhat-appstudio/segment-bridge.git/bridge"
+	"github.com/redhat-appstudio/segment-bridge.git/checkpoint"
+	"github.com/redhat-appstudio/segment-bridge.git/queryprint"
+)
+
+const (
+	// DefaultGapRadius is the default number of windows on each side of a
+	// window that it is compared with when looking for gaps
+	DefaultGapRadius = 3
+	// DefaultGapRatio is the default fraction of the neighbouring windows
+	// median record count below which a window is reported as a gap
+	DefaultGapRatio = 0.25
+)
+
+// JobRunner runs bridge jobs. It is implemented by bridge.Runner.
+type JobRunner interface {
+	RunJobs(ctx context.Context, jobs []bridge.Job) bridge.Summary
+}
+
+// Backfiller runs a set of queries over a sequence of time windows
+type Backfiller struct {
+	runner       JobRunner
+	queries      []queryprint.QueryDesc
+	progress     *Progress
+	progressFile string
+	gapRadius    int
+	gapRatio     float64
+}
+
+// NewBackfiller constructs a default Backfiller that runs the given queries
+// with the given runner
+func NewBackfiller(runner JobRunner, queries []queryprint.QueryDesc) *Backfiller {
+	return &Backfiller{
+		runner:    runner,
+		queries:   queries,
+		progress:  NewProgress(),
+		gapRadius: DefaultGapRadius,
+		gapRatio:  DefaultGapRatio,
+	}
+}
+
+// WithProgressFile makes the Backfiller resume from the progress recorded in
+// the given file and save its progress there after each window
+func (b *Backfiller) WithProgressFile(path string) (*Backfiller, error) {
+	progress, err := LoadProgress(path)
+	if err != nil {
+		return nil, err
+	}
+	b.progress = progress
+	b.progressFile = path
+	return b, nil
+}
+
+// WithGapDetection sets how many windows on each side of a window it is
+// compared to and the fraction of their median record count below which the
+// window is reported as a gap
+func (b *Backfiller) WithGapDetection(radius int, ratio float64) *Backfiller {
+	b.gapRadius = radius
+	b.gapRatio = ratio
+	return b
+}
+
+// Run processes the windows in order. For each window, the queries that were
+// not completed by a previous attempt are run concurrently by the JobRunner.
+// Queries that fail are reported and left to be retried by the next attempt.
+// An error is returned if the progress could not be saved or the context was
+// cancelled, in which case the report covers the windows processed so far.
+func (b *Backfiller) Run(ctx context.Context, windows []Window) (Report, error) {
+	var report Report
+	for _, window := range windows {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		result := b.runWindow(ctx, window)
+		report.Windows = append(report.Windows, result)
+		if b.progressFile != "" {
+			if err := b.progress.Save(b.progressFile); err != nil {
+				return report, err
+			}
+		}
+	}
+	report.Gaps = findGaps(report.Windows, b.gapRadius, b.gapRatio)
+	return report, nil
+}
+
+func (b *Backfiller) runWindow(ctx context.Context, window Window) WindowResult {
+	result := WindowResult{Window: window}
+	var jobs []bridge.Job
+	for _, query := range b.queries {
+		if b.progress.IsDone(window, query.Title) {
+			result.Resumed++
+			continue
+		}
+		jobs = append(jobs, bridge.Job{
+			QueryDesc:    query,
+			EarliestTime: checkpoint.FormatSplunkTime(window.Start),
+			LatestTime:   checkpoint.FormatSplunkTime(window.End),
+		})
+	}
+	if len(jobs) > 0 {
+		result.Summary = b.runner.RunJobs(ctx, jobs)
+	}
+	for _, query := range result.Summary.Queries {
+		if query.Err == nil {
+			b.progress.MarkDone(window, query.Title, query.Fetched)
+		}
+	}
+	for _, query := range b.queries {
+		if fetched, ok := b.progress.Completed[window.String()][query.Title]; ok {
+			result.Fetched += fetched
+		} else {
+			result.Incomplete = true
+		}
+	}
+	return result
+}
@@ -0,0 +1,167 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/redhat-appstudio/segment-bridge.git/bridge"
+	"github.com/redhat-appstudio/segment-bridge.git/queryprint"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRunner is a JobRunner that returns a fixed number of records for every
+// job, except for the jobs listed in counts or failing
+type fakeRunner struct {
+	counts  map[string]int
+	failing map[string]bool
+	ran     []string
+	// bounds records the Splunk time bounds of every job that ran
+	bounds []string
+}
+
+func fakeJobKey(query, earliestTime string) string {
+	return query + "@" + earliestTime
+}
+
+func (r *fakeRunner) RunJobs(_ context.Context, jobs []bridge.Job) (summary bridge.Summary) {
+	for _, job := range jobs {
+		key := fakeJobKey(job.Query, job.EarliestTime)
+		r.ran = append(r.ran, key)
+		r.bounds = append(r.bounds, job.EarliestTime+"/"+job.LatestTime)
+		result := bridge.QueryResult{Title: job.Title, Fetched: 10, Sent: 10}
+		if count, ok := r.counts[key]; ok {
+			result.Fetched, result.Sent = count, count
+		}
+		if r.failing[key] {
+			result.Sent = 0
+			result.Err = errors.New("fetch failed: boom")
+		}
+		summary.Queries = append(summary.Queries, result)
+	}
+	return
+}
+
+var testQueries = []queryprint.QueryDesc{
+	{Title: "Query 1", Query: "q1"},
+	{Title: "Query 2", Query: "q2"},
+}
+
+func TestBackfiller_Run(t *testing.T) {
+	from := time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)
+	windows, err := SplitRange(from, from.Add(5*time.Hour), time.Hour)
+	require.NoError(t, err)
+	progressFile := filepath.Join(t.TempDir(), "progress.json")
+
+	runner := &fakeRunner{
+		counts:  map[string]int{fakeJobKey("q1", "2023-11-20T01:00:00.000+00:00"): 0},
+		failing: map[string]bool{fakeJobKey("q2", "2023-11-20T03:00:00.000+00:00"): true},
+	}
+	backfiller, err := NewBackfiller(runner, testQueries).WithProgressFile(progressFile)
+	require.NoError(t, err)
+	report, err := backfiller.Run(context.Background(), windows)
+	require.NoError(t, err)
+
+	assert.Len(t, runner.ran, 10)
+	assert.True(t, report.Failed())
+	var out strings.Builder
+	require.NoError(t, report.Write(&out))
+	assert.Equal(t, strings.TrimLeft(dedent.Dedent(`
+		  Fetched  Dropped  Sent  Resumed        Window
+		       20        0    20        0      ok  2023-11-20T00:00:00Z/2023-11-20T01:00:00Z
+		       10        0    10        0      ok  2023-11-20T01:00:00Z/2023-11-20T02:00:00Z
+		       20        0    20        0      ok  2023-11-20T02:00:00Z/2023-11-20T03:00:00Z
+		       10        0    10        0  FAILED  2023-11-20T03:00:00Z/2023-11-20T04:00:00Z
+		       20        0    20        0      ok  2023-11-20T04:00:00Z/2023-11-20T05:00:00Z
+		Query "Query 2" failed for 2023-11-20T03:00:00Z/2023-11-20T04:00:00Z: fetch failed: boom
+	`), "\n"), out.String())
+
+	// Resuming only re-runs the failed query
+	runner = &fakeRunner{}
+	backfiller, err = NewBackfiller(runner, testQueries).WithProgressFile(progressFile)
+	require.NoError(t, err)
+	report, err = backfiller.Run(context.Background(), windows)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{fakeJobKey("q2", "2023-11-20T03:00:00.000+00:00")}, runner.ran)
+	assert.False(t, report.Failed())
+	require.Len(t, report.Windows, 5)
+	assert.Equal(t, 20, report.Windows[3].Fetched)
+	assert.Equal(t, 1, report.Windows[3].Resumed)
+}
+
+func TestBackfiller_RunWindowBounds(t *testing.T) {
+	from := time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)
+	windows, err := SplitRange(from, from.Add(90*time.Minute), time.Hour)
+	require.NoError(t, err)
+
+	runner := &fakeRunner{}
+	_, err = NewBackfiller(runner, testQueries[:1]).Run(context.Background(), windows)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"2023-11-20T00:00:00.000+00:00/2023-11-20T01:00:00.000+00:00",
+		"2023-11-20T01:00:00.000+00:00/2023-11-20T01:30:00.000+00:00",
+	}, runner.bounds)
+}
+
+func TestBackfiller_RunCancelled(t *testing.T) {
+	from := time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)
+	windows, err := SplitRange(from, from.Add(2*time.Hour), time.Hour)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	runner := &fakeRunner{}
+	report, err := NewBackfiller(runner, testQueries).Run(ctx, windows)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, report.Windows)
+	assert.Empty(t, runner.ran)
+}
+
+func TestFindGaps(t *testing.T) {
+	mkWindows := func(counts ...int) []WindowResult {
+		start := time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)
+		windows := make([]WindowResult, len(counts))
+		for i, count := range counts {
+			windows[i] = WindowResult{
+				Window:  Window{start.Add(time.Duration(i) * time.Hour), start.Add(time.Duration(i+1) * time.Hour)},
+				Fetched: count,
+			}
+			if count < 0 {
+				windows[i].Incomplete = true
+			}
+		}
+		return windows
+	}
+
+	tests := []struct {
+		name   string
+		counts []int
+		want   map[int]float64
+	}{
+		{"No gaps", []int{100, 90, 110, 95}, map[int]float64{}},
+		{"Empty window", []int{100, 90, 0, 110, 95}, map[int]float64{2: 97.5}},
+		{"Low window at edge", []int{10, 100, 90, 110}, map[int]float64{0: 95}},
+		{"Quiet period", []int{0, 0, 0, 0}, map[int]float64{}},
+		{"Incomplete windows ignored", []int{100, -1, 0, -1, 100}, map[int]float64{2: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows := mkWindows(tt.counts...)
+			got := map[int]float64{}
+			for _, gap := range findGaps(windows, 2, DefaultGapRatio) {
+				for i, window := range windows {
+					if window.Window == gap.Window {
+						got[i] = gap.NeighbourMedian
+					}
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package backfill
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Progress records which queries completed for which windows, along with the
+// number of records each fetched. It allows resuming an interrupted backfill
+// and reporting on windows that were completed by previous attempts.
+type Progress struct {
+	// Completed maps window strings to the titles of the queries completed
+	// for the window and the number of records they fetched
+	Completed map[string]map[string]int `json:"completed"`
+}
+
+// NewProgress returns an empty Progress
+func NewProgress() *Progress {
+	return &Progress{Completed: map[string]map[string]int{}}
+}
+
+// LoadProgress reads progress from the given file. An empty Progress is
+// returned if the file does not exist.
+func LoadProgress(path string) (*Progress, error) {
+	progress := NewProgress()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return progress, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, progress); err != nil {
+		return nil, err
+	}
+	if progress.Completed == nil {
+		progress.Completed = map[string]map[string]int{}
+	}
+	return progress, nil
+}
+
+// Save writes the progress into the given file. The data is written into a
+// temporary file which is then renamed over the target file, so a crash while
+// saving does not lose the progress recorded so far.
+func (p *Progress) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// IsDone returns true if the given query was completed for the window
+func (p *Progress) IsDone(window Window, title string) bool {
+	_, ok := p.Completed[window.String()][title]
+	return ok
+}
+
+// MarkDone records that the query was completed for the window, having fetched
+// the given number of records
+func (p *Progress) MarkDone(window Window, title string, fetched int) {
+	key := window.String()
+	if p.Completed[key] == nil {
+		p.Completed[key] = map[string]int{}
+	}
+	p.Completed[key][title] = fetched
+}
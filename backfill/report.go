@@ -0,0 +1,126 @@
+package backfill
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/redhat-appstudio/segment-bridge.git/bridge"
+)
+
+// WindowResult summarizes the processing of a single window
+type WindowResult struct {
+	Window Window
+	// Summary summarizes the queries run for the window by this attempt
+	Summary bridge.Summary
+	// Resumed is the number of queries skipped because a previous attempt
+	// completed them
+	Resumed int
+	// Fetched is the total number of records fetched for the window by all
+	// the queries completed so far, including by previous attempts
+	Fetched int
+	// Incomplete is set if some queries have yet to complete for the window
+	Incomplete bool
+}
+
+// Gap is a window that returned suspiciously few records compared to the
+// windows around it
+type Gap struct {
+	Window  Window
+	Fetched int
+	// NeighbourMedian is the median number of records fetched by the
+	// windows around the gap
+	NeighbourMedian float64
+}
+
+// Report summarizes the results of a backfill
+type Report struct {
+	Windows []WindowResult
+	Gaps    []Gap
+}
+
+// Failed returns true if any of the windows is incomplete
+func (r Report) Failed() bool {
+	for _, window := range r.Windows {
+		if window.Incomplete {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints a human-readable report into the given writer
+func (r Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Fetched\tDropped\tSent\tResumed\t\tWindow")
+	for _, window := range r.Windows {
+		var dropped, sent int
+		for _, query := range window.Summary.Queries {
+			dropped += query.TotalDropped()
+			sent += query.Sent
+		}
+		status := "ok"
+		if window.Incomplete {
+			status = "FAILED"
+		}
+		fmt.Fprintf(
+			tw, "%d\t%d\t%d\t%d\t%s\t  %s\n",
+			window.Fetched, dropped, sent, window.Resumed, status, window.Window,
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, window := range r.Windows {
+		for _, query := range window.Summary.Queries {
+			if query.Err != nil {
+				fmt.Fprintf(w, "Query %q failed for %s: %v\n", query.Title, window.Window, query.Err)
+			}
+		}
+	}
+	for _, gap := range r.Gaps {
+		fmt.Fprintf(
+			w, "Possible gap in %s: %d records fetched, neighbouring windows median %.1f\n",
+			gap.Window, gap.Fetched, gap.NeighbourMedian,
+		)
+	}
+	return nil
+}
+
+// findGaps returns the complete windows that fetched fewer records than the
+// given ratio of the median of the complete windows within radius windows
+// from them
+func findGaps(windows []WindowResult, radius int, ratio float64) []Gap {
+	var gaps []Gap
+	for i, window := range windows {
+		if window.Incomplete {
+			continue
+		}
+		var neighbours []int
+		for j := max(0, i-radius); j <= min(len(windows)-1, i+radius); j++ {
+			if j != i && !windows[j].Incomplete {
+				neighbours = append(neighbours, windows[j].Fetched)
+			}
+		}
+		if len(neighbours) == 0 {
+			continue
+		}
+		m := median(neighbours)
+		if m > 0 && float64(window.Fetched) < ratio*m {
+			gaps = append(gaps, Gap{Window: window.Window, Fetched: window.Fetched, NeighbourMedian: m})
+		}
+	}
+	return gaps
+}
+
+func median(values []int) float64 {
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return float64(sorted[mid-1]+sorted[mid]) / 2
+	}
+	return float64(sorted[mid])
+}
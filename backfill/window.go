@@ -0,0 +1,56 @@
+// Package backfill re-sends user journey events for a past time range by
+// splitting the range into windows and processing each window separately, so
+// that no single Splunk export grows large enough to time out.
+package backfill
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Window is a time range starting at Start (inclusive) and ending at End
+// (exclusive)
+type Window struct {
+	Start time.Time
+	End   time.Time
+}
+
+// String returns the window as an ISO 8601 time interval
+func (w Window) String() string {
+	return fmt.Sprintf("%s/%s", w.Start.UTC().Format(time.RFC3339), w.End.UTC().Format(time.RFC3339))
+}
+
+// SplitRange splits the time range between from and to into consecutive
+// windows of the given size. The last window is shortened if needed so that
+// it ends at to.
+func SplitRange(from, to time.Time, chunk time.Duration) ([]Window, error) {
+	if chunk <= 0 {
+		return nil, errors.New("chunk size must be positive")
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("invalid time range: %s is not before %s", from, to)
+	}
+	var windows []Window
+	for start := from; start.Before(to); start = start.Add(chunk) {
+		end := start.Add(chunk)
+		if end.After(to) {
+			end = to
+		}
+		windows = append(windows, Window{Start: start, End: end})
+	}
+	return windows, nil
+}
+
+// ParseTime parses a backfill range boundary given either as an RFC 3339 time
+// or as a UTC date in the YYYY-MM-DD format
+func ParseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC 3339 time or YYYY-MM-DD date", value)
+	}
+	return t, nil
+}
@@ -0,0 +1,76 @@
+package backfill
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitRange(t *testing.T) {
+	from := time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		to      time.Time
+		chunk   time.Duration
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "Exact chunks",
+			to:    from.Add(3 * time.Hour),
+			chunk: time.Hour,
+			want: []string{
+				"2023-11-20T00:00:00Z/2023-11-20T01:00:00Z",
+				"2023-11-20T01:00:00Z/2023-11-20T02:00:00Z",
+				"2023-11-20T02:00:00Z/2023-11-20T03:00:00Z",
+			},
+		},
+		{
+			name:  "Short last chunk",
+			to:    from.Add(90 * time.Minute),
+			chunk: time.Hour,
+			want: []string{
+				"2023-11-20T00:00:00Z/2023-11-20T01:00:00Z",
+				"2023-11-20T01:00:00Z/2023-11-20T01:30:00Z",
+			},
+		},
+		{
+			name:  "Chunk larger than range",
+			to:    from.Add(time.Minute),
+			chunk: time.Hour,
+			want:  []string{"2023-11-20T00:00:00Z/2023-11-20T00:01:00Z"},
+		},
+		{name: "Empty range", to: from, chunk: time.Hour, wantErr: true},
+		{name: "Zero chunk", to: from.Add(time.Hour), chunk: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := SplitRange(from, tt.to, tt.chunk)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, window := range windows {
+				got = append(got, window.String())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	got, err := ParseTime("2023-11-20")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC), got)
+
+	got, err = ParseTime("2023-11-20T07:30:00+02:00")
+	require.NoError(t, err)
+	assert.True(t, time.Date(2023, 11, 20, 5, 30, 0, 0, time.UTC).Equal(got))
+
+	_, err = ParseTime("-4hours")
+	assert.Error(t, err)
+}
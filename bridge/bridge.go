@@ -0,0 +1,318 @@
+// Package bridge wires together the different stages of moving user journey
+// events from Splunk to Segment: fetching, transforming and uploading to a
+// sink, which is Segment unless configured otherwise.
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/dlq"
+	"github.com/redhat-appstudio/segment-bridge.git/queryprint"
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/redhat-appstudio/segment-bridge.git/splunk"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+)
+
+const (
+	// DefaultBufferSize is the default capacity of the channels connecting the
+	// pipeline stages
+	DefaultBufferSize = 256
+	// DefaultParallelism is the default number of queries processed
+	// concurrently
+	DefaultParallelism = 4
+)
+
+// Fetcher runs Splunk searches and streams back their results. It is
+// implemented by splunk.Client.
+type Fetcher interface {
+	Export(ctx context.Context, search splunk.Search) iter.Seq2[splunk.ExportRow, error]
+}
+
+// Runner runs user journey queries through the fetch, transform and upload
+// stages. Each query is processed by its own set of concurrent stages
+// connected by bounded channels, so a failure processing one query does not
+// affect the others.
+type Runner struct {
+	fetcher      Fetcher
+	transformer  *transform.Transformer
+	sink         sink.Sink
+	deadLetters  dlq.Queue
+	earliestTime string
+	latestTime   string
+	bufferSize   int
+	parallelism  int
+}
+
+// NewRunner constructs a default Runner that delivers events to the given
+// sink, such as a segment.BatchUploader
+func NewRunner(
+	fetcher Fetcher, transformer *transform.Transformer, destination sink.Sink,
+) *Runner {
+	return &Runner{
+		fetcher:     fetcher,
+		transformer: transformer,
+		sink:        destination,
+		bufferSize:  DefaultBufferSize,
+		parallelism: DefaultParallelism,
+	}
+}
+
+// WithTimeRange sets the time range to query records from as Splunk time
+// strings
+func (r *Runner) WithTimeRange(earliestTime, latestTime string) *Runner {
+	r.earliestTime = earliestTime
+	r.latestTime = latestTime
+	return r
+}
+
+// WithDeadLetters sets a queue to write the records dropped by the transformer
+// to, along with the reason they were dropped, so they can be replayed later
+func (r *Runner) WithDeadLetters(queue dlq.Queue) *Runner {
+	r.deadLetters = queue
+	return r
+}
+
+// WithBufferSize sets the capacity of the channels connecting the stages
+func (r *Runner) WithBufferSize(size int) *Runner {
+	r.bufferSize = size
+	return r
+}
+
+// WithParallelism sets how many queries are processed concurrently
+func (r *Runner) WithParallelism(parallelism int) *Runner {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	r.parallelism = parallelism
+	return r
+}
+
+// Job is a query to run over a specific time range
+type Job struct {
+	queryprint.QueryDesc
+	// EarliestTime and LatestTime are Splunk time strings specifying the time
+	// range to query records from
+	EarliestTime string
+	LatestTime   string
+}
+
+// Run processes the given queries over the time range configured for the
+// Runner and returns a summary of the results. Failures are reported
+// per-query in the summary.
+func (r *Runner) Run(ctx context.Context, queries []queryprint.QueryDesc) Summary {
+	jobs := make([]Job, len(queries))
+	for i, query := range queries {
+		jobs[i] = Job{QueryDesc: query, EarliestTime: r.earliestTime, LatestTime: r.latestTime}
+	}
+	return r.RunJobs(ctx, jobs)
+}
+
+// RunJobs processes the given jobs, each over its own time range, and returns
+// a summary of the results
+func (r *Runner) RunJobs(ctx context.Context, jobs []Job) Summary {
+	results := make([]QueryResult, len(jobs))
+	semaphore := make(chan struct{}, r.parallelism)
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func(i int, job Job) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			results[i] = r.runJob(ctx, job)
+		}(i, job)
+	}
+	wg.Wait()
+	return Summary{Queries: results}
+}
+
+func (r *Runner) runJob(ctx context.Context, job Job) QueryResult {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	result := QueryResult{
+		Title:     job.Title,
+		Dropped:   map[transform.DropReason]int{},
+		Durations: map[Stage]time.Duration{},
+	}
+	// The stages run concurrently, so each is timed from the query start
+	start := time.Now()
+	var fetchDuration, transformDuration time.Duration
+	records := make(chan fetchedRecord, r.bufferSize)
+	events := make(chan transform.SegmentTrackEvent, r.bufferSize)
+	var unparsable, dropped []dlq.Entry
+	var fetchErr, uploadErr error
+	var wg sync.WaitGroup
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(records)
+		result.Fetched, unparsable, fetchErr = r.fetch(ctx, job, records)
+		fetchDuration = time.Since(start)
+	}()
+	go func() {
+		defer wg.Done()
+		defer close(events)
+		dropped = r.transform(ctx, job.Title, records, events, result.Dropped)
+		transformDuration = time.Since(start)
+	}()
+
+	writer := r.sink.Open(sink.WithQuery(ctx, job.Title))
+	for event := range events {
+		if uploadErr != nil {
+			continue // Drain the channel so the other stages can finish
+		}
+		if uploadErr = writeEvent(writer, event); uploadErr != nil {
+			cancel()
+			continue
+		}
+		if event.Timestamp.After(result.LatestTimestamp) {
+			result.LatestTimestamp = event.Timestamp
+		}
+	}
+	if uploadErr == nil {
+		uploadErr = writer.Close()
+	}
+	wg.Wait()
+	result.Durations[StageFetch] = fetchDuration
+	result.Durations[StageTransform] = transformDuration
+	result.Durations[StageUpload] = time.Since(start)
+
+	stats := writer.Stats()
+	result.Sent = stats.Events
+	result.Rejected = len(stats.Rejected)
+	result.Batches = stats.Batches
+	result.Bytes = stats.Bytes
+	result.Statuses = stats.Statuses
+	if len(unparsable) > 0 {
+		result.Dropped[transform.DropInvalidRecord] += len(unparsable)
+	}
+	if fetchErr != nil && !(uploadErr != nil && errors.Is(fetchErr, context.Canceled)) {
+		result.Err = fmt.Errorf("fetch failed: %w", fetchErr)
+	}
+	if uploadErr != nil {
+		result.Err = errors.Join(result.Err, fmt.Errorf("upload failed: %w", uploadErr))
+	}
+	// Failed queries are fetched again on the next run, so their dropped
+	// records are only kept once the query succeeds. A failure to keep them
+	// fails the query so they are not lost, while older entries evicted to
+	// make room for them are only counted.
+	if r.deadLetters != nil && result.Err == nil {
+		entries := append(unparsable, dropped...)
+		entries = append(entries, rejectedEntries(job.Title, stats)...)
+		err := r.deadLetters.Append(ctx, entries)
+		var evicted *dlq.EvictedError
+		if errors.As(err, &evicted) {
+			result.Evicted = evicted.Count
+		} else if err != nil {
+			result.Err = fmt.Errorf("dead-lettering failed: %w", err)
+		}
+	}
+	return result
+}
+
+// fetchedRecord is a record fetched from Splunk along with the original
+// search result it was parsed from
+type fetchedRecord struct {
+	transform.SplunkUJRecord
+	result json.RawMessage
+}
+
+// fetch runs the job query in Splunk and sends the returned records to the
+// given channel. It returns the number of records fetched and dead-letter
+// entries for the records that could not be parsed.
+func (r *Runner) fetch(
+	ctx context.Context, job Job, records chan<- fetchedRecord,
+) (fetched int, unparsable []dlq.Entry, err error) {
+	rows := r.fetcher.Export(ctx, splunk.Search{
+		Query:        job.Query,
+		EarliestTime: job.EarliestTime,
+		LatestTime:   job.LatestTime,
+	})
+	for row, err := range rows {
+		if err != nil {
+			return fetched, unparsable, err
+		}
+		fetched++
+		record, parseErr := transform.ParseSplunkUJRecord(row.Result)
+		if parseErr != nil {
+			unparsable = append(unparsable, dlq.NewEntry(job.Title, row.Result, parseErr))
+			continue
+		}
+		select {
+		case records <- fetchedRecord{record, row.Result}:
+		case <-ctx.Done():
+			return fetched, unparsable, ctx.Err()
+		}
+	}
+	return fetched, unparsable, nil
+}
+
+// transform converts the records read from the given channel into events and
+// sends them to the events channel while counting the dropped records. It
+// returns dead-letter entries for the dropped records if a dead-letter queue
+// is configured.
+func (r *Runner) transform(
+	ctx context.Context,
+	query string,
+	records <-chan fetchedRecord,
+	events chan<- transform.SegmentTrackEvent,
+	dropped map[transform.DropReason]int,
+) (deadLetters []dlq.Entry) {
+	for record := range records {
+		event, err := r.transformer.Transform(record.SplunkUJRecord)
+		if err != nil {
+			entry := dlq.NewEntry(query, record.result, err)
+			dropped[entry.Reason]++
+			if r.deadLetters != nil {
+				deadLetters = append(deadLetters, entry)
+			}
+			continue
+		}
+		select {
+		case events <- event:
+		case <-ctx.Done():
+		}
+	}
+	return deadLetters
+}
+
+// writeEvent writes the given event to the sink writer. Events the writer
+// rejects are not considered to be errors since they are counted by the writer.
+func writeEvent(writer sink.Writer, event transform.SegmentTrackEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return writeData(writer, data)
+}
+
+// writeData writes the given encoded event to the sink writer like writeEvent
+func writeData(writer sink.Writer, data []byte) error {
+	var eventErr *sink.EventError
+	err := writer.WriteEvent(data)
+	if errors.As(err, &eventErr) {
+		return nil
+	}
+	return err
+}
+
+// rejectedEntries returns dead-letter entries for the rejected events the
+// sink writer kept, so they can be replayed e.g. once the sink configuration
+// is fixed
+func rejectedEntries(query string, stats sink.Stats) []dlq.Entry {
+	var entries []dlq.Entry
+	for _, rejected := range stats.Rejected {
+		if rejected.Event != nil {
+			entries = append(entries, dlq.NewRejectedEntry(query, rejected))
+		}
+	}
+	return entries
+}
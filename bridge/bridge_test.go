@@ -0,0 +1,411 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/dlq"
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+	"github.com/redhat-appstudio/segment-bridge.git/queryprint"
+	"github.com/redhat-appstudio/segment-bridge.git/segment"
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/redhat-appstudio/segment-bridge.git/splunk"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	"github.com/redhat-appstudio/segment-bridge.git/webfixture"
+	"github.com/redhat-appstudio/segment-bridge.git/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var testMaps = &transform.StaticMaps{
+	UIDs:       map[string]string{"user1": "1001", "user2": "1002"},
+	Workspaces: map[string]string{"user1-tenant": "user1", "user2-tenant": "user2"},
+}
+
+// mkExportRow generates a row of a Splunk export API response
+func mkExportRow(t *testing.T, messageID, namespace, userID string) string {
+	return mkExportRowAt(t, messageID, namespace, userID, "2023-11-20T07:59:03.061790Z")
+}
+
+// mkExportRowAt generates a row of a Splunk export API response for a record
+// with the given timestamp
+func mkExportRowAt(t *testing.T, messageID, namespace, userID, timestamp string) string {
+	result, err := json.Marshal(map[string]string{
+		"messageId":     messageID,
+		"timestamp":     timestamp,
+		"namespace":     namespace,
+		"type":          "track",
+		"userId":        userID,
+		"event_verb":    "create",
+		"event_subject": "applications",
+		"properties":    `{"kind":"applications"}`,
+		"context":       `{"userAgent":"test"}`,
+	})
+	require.NoError(t, err)
+	return fmt.Sprintf(`{"preview":false,"offset":0,"lastrow":true,"result":%s}`, result)
+}
+
+// splunkStandIn runs a fake Splunk export API which returns the response
+// registered for each query string. A missing response causes an HTTP error.
+func splunkStandIn(t *testing.T, responses map[string][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		rows, ok := responses[r.PostForm.Get("search")]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(strings.Join(rows, "\n")))
+	}))
+}
+
+// splunkClient returns a client for the given Splunk stand-in which retries
+// failed calls without waiting
+func splunkClient(svr *httptest.Server) *splunk.Client {
+	return splunk.NewClient(svr.URL).WithHTTPClient(svr.Client()).WithRetryPolicy(noBackoff())
+}
+
+// noBackoff returns a retry policy that does not wait between retries
+func noBackoff() *httpretry.Policy {
+	return httpretry.NewPolicy().WithBackoff(0, 0)
+}
+
+func TestRunner_Run(t *testing.T) {
+	splunkSvr := splunkStandIn(t, map[string][]string{
+		"good query": {
+			mkExportRow(t, "m1", "user1-tenant", "user1"),
+			mkExportRow(t, "m2", "user2-tenant", ""),
+			mkExportRow(t, "m3", "no-such-tenant", "user1"),
+			mkExportRow(t, "m4", "user1-tenant", "system:admin"),
+			`{"preview":false,"offset":0,"lastrow":true,"result":{"messageId":1}}`,
+		},
+		"empty query": {`{"preview":false,"lastrow":true}`},
+		"broken stream": {
+			mkExportRow(t, "m5", "user1-tenant", "user1"),
+			`{"preview":false,"messages":[{"type":"FATAL","text":"search failed"}]}`,
+		},
+	})
+	defer splunkSvr.Close()
+
+	queries := []queryprint.QueryDesc{
+		{Title: "Good", Query: "good query"},
+		{Title: "Empty", Query: "empty query"},
+		{Title: "Failing", Query: "failing query"},
+		{Title: "Broken", Query: "broken stream"},
+	}
+	var summary Summary
+	reqs := webfixture.TraceRequestsFrom(func(url string, c *http.Client) {
+		summary = NewRunner(
+			splunkClient(splunkSvr),
+			transform.NewTransformer(testMaps),
+			segment.NewBatchUploader(url).WithClient(c),
+		).
+			WithBufferSize(1).
+			WithParallelism(2).
+			Run(context.Background(), queries)
+	})
+
+	require.Len(t, summary.Queries, 4)
+	good := summary.Queries[0]
+	assert.Equal(t, "Good", good.Title)
+	assert.Equal(t, 5, good.Fetched)
+	assert.Equal(t, 2, good.Sent)
+	assert.Equal(t, map[transform.DropReason]int{
+		transform.DropMissingWorkspace: 1,
+		transform.DropMissingUID:       1,
+		transform.DropInvalidRecord:    1,
+	}, good.Dropped)
+	assert.NoError(t, good.Err)
+
+	empty := summary.Queries[1]
+	assert.Equal(t, 0, empty.Fetched)
+	assert.Equal(t, 0, empty.Sent)
+	assert.NoError(t, empty.Err)
+
+	assert.Error(t, summary.Queries[2].Err)
+
+	broken := summary.Queries[3]
+	assert.Equal(t, 1, broken.Fetched)
+	assert.Equal(t, 1, broken.Sent)
+	assert.Error(t, broken.Err)
+
+	assert.True(t, summary.Failed())
+
+	var sentIDs []string
+	for _, req := range reqs {
+		var batch struct{ Batch []transform.SegmentTrackEvent }
+		require.NoError(t, json.Unmarshal([]byte(req.Body), &batch))
+		for _, event := range batch.Batch {
+			sentIDs = append(sentIDs, event.MessageID)
+		}
+	}
+	assert.ElementsMatch(t, []string{"m1", "m2", "m5"}, sentIDs)
+}
+
+// rejectingSink is an NDJSONSink that rejects the events with the given
+// message IDs, keeping them like sinks that support dead-lettering do
+type rejectingSink struct {
+	*sink.NDJSONSink
+	ids map[string]bool
+}
+
+func (s rejectingSink) Open(ctx context.Context) sink.Writer {
+	return &rejectingWriter{Writer: s.NDJSONSink.Open(ctx), ids: s.ids}
+}
+
+type rejectingWriter struct {
+	sink.Writer
+	ids      map[string]bool
+	rejected []*sink.EventError
+}
+
+func (w *rejectingWriter) WriteEvent(event []byte) error {
+	var fields struct {
+		MessageID string `json:"messageId"`
+	}
+	if json.Unmarshal(event, &fields) == nil && w.ids[fields.MessageID] {
+		err := &sink.EventError{Size: len(event), Err: errors.New("event was refused"), Event: event}
+		w.rejected = append(w.rejected, err)
+		return err
+	}
+	return w.Writer.WriteEvent(event)
+}
+
+func (w *rejectingWriter) Stats() sink.Stats {
+	stats := w.Writer.Stats()
+	stats.Rejected = append(stats.Rejected, w.rejected...)
+	return stats
+}
+
+func TestRunner_NDJSONSink(t *testing.T) {
+	splunkSvr := splunkStandIn(t, map[string][]string{
+		"query": {
+			mkExportRow(t, "m1", "user1-tenant", "user1"),
+			mkExportRow(t, "m2", "user2-tenant", "user2"),
+		},
+	})
+	defer splunkSvr.Close()
+
+	var out strings.Builder
+	summary := NewRunner(
+		splunkClient(splunkSvr),
+		transform.NewTransformer(testMaps),
+		sink.NewNDJSONSink(&out),
+	).Run(context.Background(), []queryprint.QueryDesc{{Title: "Query", Query: "query"}})
+
+	require.Len(t, summary.Queries, 1)
+	assert.NoError(t, summary.Queries[0].Err)
+	assert.Equal(t, 2, summary.Queries[0].Sent)
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		var event transform.SegmentTrackEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		ids = append(ids, event.MessageID)
+	}
+	assert.Equal(t, []string{"m1", "m2"}, ids)
+}
+
+func TestRunner_UploadFailure(t *testing.T) {
+	splunkSvr := splunkStandIn(t, map[string][]string{
+		"query": {
+			mkExportRow(t, "m1", "user1-tenant", "user1"),
+			mkExportRow(t, "m2", "user1-tenant", "user1"),
+		},
+	})
+	defer splunkSvr.Close()
+	// A 400 Bad Request would make the uploader refuse the events rather
+	// than fail, as covered by TestBatchUploader_BadBatch
+	segmentSvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer segmentSvr.Close()
+
+	summary := NewRunner(
+		splunkClient(splunkSvr),
+		transform.NewTransformer(testMaps),
+		segment.NewBatchUploader(segmentSvr.URL).WithClient(segmentSvr.Client()),
+	).Run(context.Background(), []queryprint.QueryDesc{{Title: "Query", Query: "query"}})
+
+	require.Len(t, summary.Queries, 1)
+	assert.Equal(t, 0, summary.Queries[0].Sent)
+	assert.ErrorContains(t, summary.Queries[0].Err, "upload failed")
+	assert.True(t, summary.Failed())
+}
+
+func TestRunner_RunJobs(t *testing.T) {
+	var mu sync.Mutex
+	timeRanges := map[string][2]string{}
+	splunkSvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		mu.Lock()
+		timeRanges[r.PostForm.Get("search")] = [2]string{
+			r.PostForm.Get("earliest_time"), r.PostForm.Get("latest_time"),
+		}
+		mu.Unlock()
+		if r.PostForm.Get("search") != "query1" {
+			return
+		}
+		_, _ = w.Write([]byte(strings.Join([]string{
+			mkExportRowAt(t, "m1", "user1-tenant", "user1", "2023-11-20T07:00:00Z"),
+			mkExportRowAt(t, "m2", "user1-tenant", "user1", "2023-11-20T09:30:00Z"),
+			mkExportRowAt(t, "m3", "user1-tenant", "user1", "2023-11-20T08:00:00Z"),
+			mkExportRowAt(t, "m4", "no-such-tenant", "user1", "2023-11-20T10:00:00Z"),
+		}, "\n")))
+	}))
+	defer splunkSvr.Close()
+
+	var summary Summary
+	webfixture.TraceRequestsFrom(func(url string, c *http.Client) {
+		summary = NewRunner(
+			splunkClient(splunkSvr),
+			transform.NewTransformer(testMaps),
+			segment.NewBatchUploader(url).WithClient(c),
+		).RunJobs(context.Background(), []Job{
+			{
+				QueryDesc:    queryprint.QueryDesc{Title: "Query 1", Query: "query1"},
+				EarliestTime: "2023-11-20T06:30:00Z",
+				LatestTime:   "-0hours",
+			},
+			{
+				QueryDesc:    queryprint.QueryDesc{Title: "Query 2", Query: "query2"},
+				EarliestTime: "-4hours",
+				LatestTime:   "-0hours",
+			},
+		})
+	})
+
+	assert.Equal(t, map[string][2]string{
+		"query1": {"2023-11-20T06:30:00Z", "-0hours"},
+		"query2": {"-4hours", "-0hours"},
+	}, timeRanges)
+	require.Len(t, summary.Queries, 2)
+	assert.Equal(t, 3, summary.Queries[0].Sent)
+	assert.Equal(
+		t, time.Date(2023, 11, 20, 9, 30, 0, 0, time.UTC),
+		summary.Queries[0].LatestTimestamp.UTC(),
+	)
+	assert.True(t, summary.Queries[1].LatestTimestamp.IsZero())
+	assert.False(t, summary.Failed())
+}
+
+func TestRunner_DeadLetters(t *testing.T) {
+	splunkSvr := splunkStandIn(t, map[string][]string{
+		"query": {
+			mkExportRow(t, "m1", "user1-tenant", "user1"),
+			mkExportRow(t, "m2", "no-such-tenant", "user1"),
+			`{"preview":false,"offset":0,"lastrow":true,"result":{"messageId":1}}`,
+		},
+		"broken stream": {
+			mkExportRow(t, "m3", "no-such-tenant", "user1"),
+			`{"preview":false,"messages":[{"type":"FATAL","text":"search failed"}]}`,
+		},
+	})
+	defer splunkSvr.Close()
+
+	queue := dlq.NewFileQueue(filepath.Join(t.TempDir(), "dlq.ndjson"))
+	webfixture.TraceRequestsFrom(func(url string, c *http.Client) {
+		NewRunner(
+			splunkClient(splunkSvr),
+			transform.NewTransformer(testMaps),
+			segment.NewBatchUploader(url).WithClient(c),
+		).
+			WithDeadLetters(queue).
+			Run(context.Background(), []queryprint.QueryDesc{
+				{Title: "Query", Query: "query"},
+				{Title: "Broken", Query: "broken stream"},
+			})
+	})
+
+	entries, err := queue.Load(context.Background())
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "records of failed queries are not dead-lettered")
+	byReason := map[transform.DropReason]dlq.Entry{}
+	for _, entry := range entries {
+		assert.Equal(t, "Query", entry.Query)
+		byReason[entry.Reason] = entry
+	}
+	assert.Equal(t, "no-such-tenant", byReason[transform.DropMissingWorkspace].Detail)
+	assert.Contains(t, string(byReason[transform.DropMissingWorkspace].Result), `"messageId":"m2"`)
+	assert.JSONEq(t, `{"messageId":1}`, string(byReason[transform.DropInvalidRecord].Result))
+}
+
+func TestRunner_DeadLettersEvicted(t *testing.T) {
+	splunkSvr := splunkStandIn(t, map[string][]string{
+		"query": {
+			mkExportRow(t, "m1", "no-such-tenant", "user1"),
+			mkExportRow(t, "m2", "no-such-tenant", "user1"),
+		},
+	})
+	defer splunkSvr.Close()
+
+	client := fake.NewClientset()
+	var summary Summary
+	webfixture.TraceRequestsFrom(func(url string, c *http.Client) {
+		summary = NewRunner(
+			splunkClient(splunkSvr),
+			transform.NewTransformer(testMaps),
+			segment.NewBatchUploader(url).WithClient(c),
+		).
+			WithDeadLetters(dlq.NewConfigMapQueue(client, "ns", "dlq").WithMaxSize(1)).
+			Run(context.Background(), []queryprint.QueryDesc{{Title: "Query", Query: "query"}})
+	})
+
+	require.Len(t, summary.Queries, 1)
+	assert.NoError(t, summary.Queries[0].Err, "evicting entries does not fail the query")
+	assert.Equal(t, 2, summary.Queries[0].Evicted)
+}
+
+func TestRunner_WebhookRejections(t *testing.T) {
+	ctx := context.Background()
+	splunkSvr := splunkStandIn(t, map[string][]string{
+		"query": {
+			mkExportRow(t, "m1", "user1-tenant", "user1"),
+			mkExportRow(t, "m2", "user2-tenant", "user2"),
+		},
+	})
+	defer splunkSvr.Close()
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhook.CloudEvent
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		if event.ID == "m2" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer endpoint.Close()
+
+	var archive strings.Builder
+	queue := dlq.NewFileQueue(filepath.Join(t.TempDir(), "dlq.ndjson"))
+	summary := NewRunner(
+		splunkClient(splunkSvr),
+		transform.NewTransformer(testMaps),
+		sink.NewTee(
+			webhook.NewSink(webhook.Endpoint{URL: endpoint.URL, Mode: webhook.ModeStructured}),
+			sink.NewNDJSONSink(&archive),
+		),
+	).
+		WithDeadLetters(queue).
+		Run(ctx, []queryprint.QueryDesc{{Title: "Query", Query: "query"}})
+
+	require.Len(t, summary.Queries, 1)
+	require.NoError(t, summary.Queries[0].Err)
+	assert.Equal(t, 1, summary.Queries[0].Sent)
+	assert.Equal(t, 1, summary.Queries[0].Rejected)
+	assert.Contains(t, archive.String(), `"messageId":"m1"`)
+	assert.NotContains(t, archive.String(), `"messageId":"m2"`, "refused events are not archived")
+	entries, err := queue.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "refused events are dead-lettered")
+	assert.Equal(t, dlq.ReasonRejected, entries[0].Reason)
+	assert.Contains(t, entries[0].Detail, endpoint.URL)
+	assert.Contains(t, string(entries[0].Event), `"messageId":"m2"`)
+}
@@ -0,0 +1,165 @@
+package bridge
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics records the results of bridge runs as Prometheus metrics
+type Metrics struct {
+	fetched       *prometheus.CounterVec
+	dropped       *prometheus.CounterVec
+	rejected      *prometheus.CounterVec
+	evicted       *prometheus.CounterVec
+	sent          *prometheus.CounterVec
+	batches       *prometheus.CounterVec
+	bytes         *prometheus.CounterVec
+	responses     *prometheus.CounterVec
+	queryFailures *prometheus.CounterVec
+	stageDuration *prometheus.GaugeVec
+	windowEnd     *prometheus.GaugeVec
+	// lastResult has no labels, but is a vector so it is only exposed once
+	// a run finished
+	lastResult *prometheus.GaugeVec
+	// runs counts runs by result. It is only kept in long-running mode, see
+	// WithRunCounts, since a process that runs once would always push 0 or 1.
+	runs *prometheus.CounterVec
+	// lastSuccess has no labels, but is a vector so it is only exposed once
+	// a run succeeded. Pushing it along with the metrics of a failed run
+	// would otherwise reset the time of the last success kept by the
+	// Pushgateway.
+	lastSuccess *prometheus.GaugeVec
+}
+
+// NewMetrics registers the bridge metrics in the given registerer
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		c := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+		registerer.MustRegister(c)
+		return c
+	}
+	gauge := func(name, help string, labels ...string) *prometheus.GaugeVec {
+		g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help}, labels)
+		registerer.MustRegister(g)
+		return g
+	}
+	return &Metrics{
+		fetched: counter(
+			"segment_bridge_records_fetched_total",
+			"Records fetched from Splunk", "query",
+		),
+		dropped: counter(
+			"segment_bridge_records_dropped_total",
+			"Records dropped by the transformer", "query", "reason",
+		),
+		rejected: counter(
+			"segment_bridge_events_rejected_total",
+			"Events the Segment uploader refused to send", "query",
+		),
+		evicted: counter(
+			"segment_bridge_dead_letters_evicted_total",
+			"Dead-letter queue entries discarded to make room for newer ones", "query",
+		),
+		sent: counter(
+			"segment_bridge_events_sent_total",
+			"Events sent to Segment", "query",
+		),
+		batches: counter(
+			"segment_bridge_batches_sent_total",
+			"Segment batch calls made", "query",
+		),
+		bytes: counter(
+			"segment_bridge_uploaded_bytes_total",
+			"Size of the Segment batch call payloads", "query",
+		),
+		responses: counter(
+			"segment_bridge_segment_responses_total",
+			"Segment batch call responses by HTTP status code", "code",
+		),
+		queryFailures: counter(
+			"segment_bridge_query_failures_total",
+			"Queries that failed to be processed", "query",
+		),
+		stageDuration: gauge(
+			"segment_bridge_stage_duration_seconds",
+			"How long after the query started each stage finished in the last run",
+			"query", "stage",
+		),
+		windowEnd: gauge(
+			"segment_bridge_last_success_window_end_timestamp_seconds",
+			"End of the latest time window the query was successfully processed up to", "query",
+		),
+		lastResult: gauge(
+			"segment_bridge_last_run_success",
+			"Whether the last run succeeded (1) or failed (0)",
+		),
+		lastSuccess: gauge(
+			"segment_bridge_last_success_timestamp_seconds",
+			"Time the last successful run finished",
+		),
+	}
+}
+
+// WithRunCounts makes the Metrics count runs by result, registering the
+// counter in the given registerer. This is meant for long-running mode, where
+// the counter keeps growing over many runs.
+func (m *Metrics) WithRunCounts(registerer prometheus.Registerer) *Metrics {
+	m.runs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "segment_bridge_runs_total",
+		Help: "Bridge runs by result",
+	}, []string{"result"})
+	registerer.MustRegister(m.runs)
+	return m
+}
+
+// ObserveSummary records the per-query results of a run
+func (m *Metrics) ObserveSummary(summary Summary) {
+	for _, query := range summary.Queries {
+		m.fetched.WithLabelValues(query.Title).Add(float64(query.Fetched))
+		for reason, count := range query.Dropped {
+			m.dropped.WithLabelValues(query.Title, string(reason)).Add(float64(count))
+		}
+		m.rejected.WithLabelValues(query.Title).Add(float64(query.Rejected))
+		m.evicted.WithLabelValues(query.Title).Add(float64(query.Evicted))
+		m.sent.WithLabelValues(query.Title).Add(float64(query.Sent))
+		m.batches.WithLabelValues(query.Title).Add(float64(query.Batches))
+		m.bytes.WithLabelValues(query.Title).Add(float64(query.Bytes))
+		for code, count := range query.Statuses {
+			m.responses.WithLabelValues(strconv.Itoa(code)).Add(float64(count))
+		}
+		if query.Err != nil {
+			m.queryFailures.WithLabelValues(query.Title).Inc()
+		}
+		for stage, duration := range query.Durations {
+			m.stageDuration.WithLabelValues(query.Title, string(stage)).Set(duration.Seconds())
+		}
+	}
+}
+
+// ObserveWindowEnd records that the given query was successfully processed up
+// to the given time
+func (m *Metrics) ObserveWindowEnd(query string, end time.Time) {
+	m.windowEnd.WithLabelValues(query).Set(unixSeconds(end))
+}
+
+// ObserveRun records that a run finished at the given time with the given
+// error, if any
+func (m *Metrics) ObserveRun(at time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+		m.lastResult.WithLabelValues().Set(0)
+	} else {
+		m.lastResult.WithLabelValues().Set(1)
+		m.lastSuccess.WithLabelValues().Set(unixSeconds(at))
+	}
+	if m.runs != nil {
+		m.runs.WithLabelValues(result).Inc()
+	}
+}
+
+func unixSeconds(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
@@ -0,0 +1,107 @@
+package bridge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	m := NewMetrics(registry).WithRunCounts(registry)
+	summary := Summary{Queries: []QueryResult{
+		{
+			Title:     "Build",
+			Fetched:   5,
+			Dropped:   map[transform.DropReason]int{transform.DropMissingUID: 2},
+			Sent:      3,
+			Evicted:   1,
+			Batches:   1,
+			Bytes:     1200,
+			Statuses:  map[int]int{200: 1, 503: 2},
+			Durations: map[Stage]time.Duration{StageFetch: time.Second, StageUpload: 1500 * time.Millisecond},
+		},
+		{Title: "Deploy", Fetched: 1, Rejected: 1, Err: errors.New("boom")},
+	}}
+	m.ObserveSummary(summary)
+	m.ObserveSummary(summary)
+	m.ObserveWindowEnd("Build", time.Unix(1700000000, 0))
+	m.ObserveRun(time.Unix(1700000100, 0), nil)
+	m.ObserveRun(time.Unix(1700000200, 0), errors.New("boom"))
+	m.ObserveRun(time.Unix(1700000300, 0), errors.New("boom"))
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(dedent.Dedent(`
+		# HELP segment_bridge_records_fetched_total Records fetched from Splunk
+		# TYPE segment_bridge_records_fetched_total counter
+		segment_bridge_records_fetched_total{query="Build"} 10
+		segment_bridge_records_fetched_total{query="Deploy"} 2
+		# HELP segment_bridge_records_dropped_total Records dropped by the transformer
+		# TYPE segment_bridge_records_dropped_total counter
+		segment_bridge_records_dropped_total{query="Build",reason="missing-uid"} 4
+		# HELP segment_bridge_events_rejected_total Events the Segment uploader refused to send
+		# TYPE segment_bridge_events_rejected_total counter
+		segment_bridge_events_rejected_total{query="Build"} 0
+		segment_bridge_events_rejected_total{query="Deploy"} 2
+		# HELP segment_bridge_dead_letters_evicted_total Dead-letter queue entries discarded to make room for newer ones
+		# TYPE segment_bridge_dead_letters_evicted_total counter
+		segment_bridge_dead_letters_evicted_total{query="Build"} 2
+		segment_bridge_dead_letters_evicted_total{query="Deploy"} 0
+		# HELP segment_bridge_events_sent_total Events sent to Segment
+		# TYPE segment_bridge_events_sent_total counter
+		segment_bridge_events_sent_total{query="Build"} 6
+		segment_bridge_events_sent_total{query="Deploy"} 0
+		# HELP segment_bridge_batches_sent_total Segment batch calls made
+		# TYPE segment_bridge_batches_sent_total counter
+		segment_bridge_batches_sent_total{query="Build"} 2
+		segment_bridge_batches_sent_total{query="Deploy"} 0
+		# HELP segment_bridge_uploaded_bytes_total Size of the Segment batch call payloads
+		# TYPE segment_bridge_uploaded_bytes_total counter
+		segment_bridge_uploaded_bytes_total{query="Build"} 2400
+		segment_bridge_uploaded_bytes_total{query="Deploy"} 0
+		# HELP segment_bridge_segment_responses_total Segment batch call responses by HTTP status code
+		# TYPE segment_bridge_segment_responses_total counter
+		segment_bridge_segment_responses_total{code="200"} 2
+		segment_bridge_segment_responses_total{code="503"} 4
+		# HELP segment_bridge_query_failures_total Queries that failed to be processed
+		# TYPE segment_bridge_query_failures_total counter
+		segment_bridge_query_failures_total{query="Deploy"} 2
+		# HELP segment_bridge_stage_duration_seconds How long after the query started each stage finished in the last run
+		# TYPE segment_bridge_stage_duration_seconds gauge
+		segment_bridge_stage_duration_seconds{query="Build",stage="fetch"} 1
+		segment_bridge_stage_duration_seconds{query="Build",stage="upload"} 1.5
+		# HELP segment_bridge_last_success_window_end_timestamp_seconds End of the latest time window the query was successfully processed up to
+		# TYPE segment_bridge_last_success_window_end_timestamp_seconds gauge
+		segment_bridge_last_success_window_end_timestamp_seconds{query="Build"} 1.7e+09
+		# HELP segment_bridge_runs_total Bridge runs by result
+		# TYPE segment_bridge_runs_total counter
+		segment_bridge_runs_total{result="failure"} 2
+		segment_bridge_runs_total{result="success"} 1
+		# HELP segment_bridge_last_run_success Whether the last run succeeded (1) or failed (0)
+		# TYPE segment_bridge_last_run_success gauge
+		segment_bridge_last_run_success 0
+		# HELP segment_bridge_last_success_timestamp_seconds Time the last successful run finished
+		# TYPE segment_bridge_last_success_timestamp_seconds gauge
+		segment_bridge_last_success_timestamp_seconds 1.7000001e+09
+	`))))
+}
+
+func TestMetrics_failedRun(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	NewMetrics(registry).ObserveRun(time.Unix(1700000000, 0), errors.New("boom"))
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(dedent.Dedent(`
+		# HELP segment_bridge_last_run_success Whether the last run succeeded (1) or failed (0)
+		# TYPE segment_bridge_last_run_success gauge
+		segment_bridge_last_run_success 0
+	`)),
+		"segment_bridge_runs_total",
+		"segment_bridge_last_run_success",
+		"segment_bridge_last_success_timestamp_seconds",
+	), "runs are not counted unless in long-running mode")
+}
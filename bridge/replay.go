@@ -0,0 +1,116 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/redhat-appstudio/segment-bridge.git/dlq"
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+)
+
+// ReplayTitle is the title of the QueryResult returned by Replay
+const ReplayTitle = "Dead letters"
+
+// Replay runs the records in the given dead-letter queue through the
+// transformer again, e.g. once the identity maps were refreshed, and uploads
+// the events of the records that now resolve along with the events the sink
+// rejected before. Those entries are removed from the queue, while the drop
+// reasons of the others are updated. If uploading fails the queue is left as
+// is, so the entries are replayed again next time.
+func (r *Runner) Replay(ctx context.Context, queue dlq.Queue) QueryResult {
+	result := QueryResult{Title: ReplayTitle, Dropped: map[transform.DropReason]int{}}
+	entries, err := queue.Load(ctx)
+	if err != nil {
+		result.Err = fmt.Errorf("failed to load dead letters: %w", err)
+		return result
+	}
+	result.Fetched = len(entries)
+
+	// Records are matched by key since more may be queued while replaying
+	resolved := map[string]bool{}
+	dropped := map[string]dlq.Entry{}
+	// Events are mapped back to their entries in case the sink rejects them
+	written := map[string]dlq.Entry{}
+	writer := r.sink.Open(sink.WithQuery(ctx, ReplayTitle))
+	for _, entry := range entries {
+		data := []byte(entry.Event)
+		if data == nil {
+			event, err := r.replayEntry(entry)
+			if err != nil {
+				again := dlq.NewEntry(entry.Query, entry.Result, err)
+				entry.Reason, entry.Detail = again.Reason, again.Detail
+				dropped[entry.Key()] = entry
+				result.Dropped[entry.Reason]++
+				continue
+			}
+			if data, err = json.Marshal(event); err != nil {
+				result.Err = fmt.Errorf("upload failed: %w", err)
+				return result
+			}
+			if event.Timestamp.After(result.LatestTimestamp) {
+				result.LatestTimestamp = event.Timestamp
+			}
+		}
+		if err = writeData(writer, data); err != nil {
+			result.Err = fmt.Errorf("upload failed: %w", err)
+			return result
+		}
+		resolved[entry.Key()] = true
+		written[string(data)] = entry
+	}
+	if err = writer.Close(); err != nil {
+		result.Err = fmt.Errorf("upload failed: %w", err)
+		return result
+	}
+	stats := writer.Stats()
+	// Events the sink rejects are kept in the queue if the sink kept them
+	// too. The others would be rejected again, so they are removed.
+	for _, rejected := range stats.Rejected {
+		entry, ok := written[string(rejected.Event)]
+		if !ok || rejected.Event == nil {
+			continue
+		}
+		delete(resolved, entry.Key())
+		again := dlq.NewRejectedEntry(entry.Query, rejected)
+		entry.Reason, entry.Detail = again.Reason, again.Detail
+		dropped[entry.Key()] = entry
+	}
+	result.Sent = stats.Events
+	result.Rejected = len(stats.Rejected)
+	result.Batches = stats.Batches
+	result.Bytes = stats.Bytes
+	result.Statuses = stats.Statuses
+
+	err = queue.Update(ctx, func(stored []dlq.Entry) []dlq.Entry {
+		var kept []dlq.Entry
+		for _, entry := range stored {
+			if resolved[entry.Key()] {
+				continue
+			}
+			if updated, ok := dropped[entry.Key()]; ok {
+				entry = updated
+			}
+			kept = append(kept, entry)
+		}
+		return kept
+	})
+	var evicted *dlq.EvictedError
+	if errors.As(err, &evicted) {
+		result.Evicted = evicted.Count
+	} else if err != nil {
+		result.Err = fmt.Errorf("failed to update dead letters: %w", err)
+	}
+	return result
+}
+
+// replayEntry parses and transforms the record of a dead-letter entry
+func (r *Runner) replayEntry(entry dlq.Entry) (transform.SegmentTrackEvent, error) {
+	record, err := transform.ParseSplunkUJRecord(entry.Result)
+	if err != nil {
+		return transform.SegmentTrackEvent{}, err
+	}
+	return r.transformer.Transform(record)
+}
@@ -0,0 +1,159 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/redhat-appstudio/segment-bridge.git/dlq"
+	"github.com/redhat-appstudio/segment-bridge.git/queryprint"
+	"github.com/redhat-appstudio/segment-bridge.git/segment"
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	"github.com/redhat-appstudio/segment-bridge.git/webfixture"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mkDeadLetter generates a dead-letter entry for a record that was dropped
+// because its namespace could not be mapped
+func mkDeadLetter(t *testing.T, messageID, namespace string) dlq.Entry {
+	var row struct{ Result json.RawMessage }
+	require.NoError(t, json.Unmarshal([]byte(mkExportRow(t, messageID, namespace, "user1")), &row))
+	return dlq.Entry{
+		Query:  "Query",
+		Reason: transform.DropMissingWorkspace,
+		Detail: namespace,
+		Result: row.Result,
+	}
+}
+
+func TestRunner_Replay(t *testing.T) {
+	ctx := context.Background()
+	queue := dlq.NewFileQueue(filepath.Join(t.TempDir(), "dlq.ndjson"))
+	require.NoError(t, queue.Append(ctx, []dlq.Entry{
+		mkDeadLetter(t, "m1", "user1-tenant"),
+		mkDeadLetter(t, "m2", "no-such-tenant"),
+		{Query: "Query", Reason: transform.DropInvalidRecord, Result: json.RawMessage(`{"messageId":1}`)},
+	}))
+	maps := &transform.StaticMaps{
+		UIDs:       map[string]string{},
+		Workspaces: testMaps.Workspaces,
+	}
+
+	var result QueryResult
+	webfixture.TraceRequestsFrom(func(url string, c *http.Client) {
+		result = NewRunner(
+			nil, transform.NewTransformer(maps), segment.NewBatchUploader(url).WithClient(c),
+		).Replay(ctx, queue)
+	})
+	require.NoError(t, result.Err)
+	assert.Equal(t, 3, result.Fetched)
+	assert.Equal(t, 0, result.Sent)
+	assert.Equal(t, map[transform.DropReason]int{
+		transform.DropMissingWorkspaceOwnerUID: 1,
+		transform.DropMissingWorkspace:         1,
+		transform.DropInvalidRecord:            1,
+	}, result.Dropped)
+	entries, err := queue.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, transform.DropMissingWorkspaceOwnerUID, entries[0].Reason, "drop reasons are updated")
+	assert.Equal(t, "user1", entries[0].Detail)
+
+	var reqs []webfixture.RequestTrace
+	reqs = webfixture.TraceRequestsFrom(func(url string, c *http.Client) {
+		result = NewRunner(
+			nil, transform.NewTransformer(testMaps), segment.NewBatchUploader(url).WithClient(c),
+		).Replay(ctx, queue)
+	})
+	require.NoError(t, result.Err)
+	assert.Equal(t, 1, result.Sent)
+	require.Len(t, reqs, 1)
+	assert.Contains(t, reqs[0].Body, `"messageId":"m1"`)
+	entries, err = queue.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, transform.DropMissingWorkspace, entries[0].Reason)
+	assert.Equal(t, transform.DropInvalidRecord, entries[1].Reason)
+}
+
+func TestRunner_ReplayUploadFailure(t *testing.T) {
+	ctx := context.Background()
+	queue := dlq.NewFileQueue(filepath.Join(t.TempDir(), "dlq.ndjson"))
+	entry := mkDeadLetter(t, "m1", "user1-tenant")
+	require.NoError(t, queue.Append(ctx, []dlq.Entry{entry}))
+	// A 400 Bad Request would make the uploader refuse the event rather than
+	// fail
+	segmentSvr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer segmentSvr.Close()
+
+	result := NewRunner(
+		nil,
+		transform.NewTransformer(testMaps),
+		segment.NewBatchUploader(segmentSvr.URL).WithClient(segmentSvr.Client()),
+	).Replay(ctx, queue)
+	assert.ErrorContains(t, result.Err, "upload failed")
+	entries, err := queue.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []dlq.Entry{entry}, entries)
+}
+
+func TestRunner_ReplayRejected(t *testing.T) {
+	ctx := context.Background()
+	splunkSvr := splunkStandIn(t, map[string][]string{
+		"query": {
+			mkExportRow(t, "m1", "user1-tenant", "user1"),
+			mkExportRow(t, "m2", "user2-tenant", "user2"),
+		},
+	})
+	defer splunkSvr.Close()
+	queue := dlq.NewFileQueue(filepath.Join(t.TempDir(), "dlq.ndjson"))
+	runner := func(out *strings.Builder, rejectedIDs ...string) *Runner {
+		ids := map[string]bool{}
+		for _, id := range rejectedIDs {
+			ids[id] = true
+		}
+		return NewRunner(
+			splunkClient(splunkSvr),
+			transform.NewTransformer(testMaps),
+			rejectingSink{sink.NewNDJSONSink(out), ids},
+		).WithDeadLetters(queue)
+	}
+
+	var out strings.Builder
+	summary := runner(&out, "m2").Run(ctx, []queryprint.QueryDesc{{Title: "Query", Query: "query"}})
+	require.NoError(t, summary.Queries[0].Err)
+	assert.Equal(t, 1, summary.Queries[0].Sent)
+	assert.Equal(t, 1, summary.Queries[0].Rejected)
+	entries, err := queue.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "rejected events are dead-lettered")
+	assert.Equal(t, "Query", entries[0].Query)
+	assert.Equal(t, dlq.ReasonRejected, entries[0].Reason)
+	assert.Equal(t, "event was refused", entries[0].Detail)
+	assert.Contains(t, string(entries[0].Event), `"messageId":"m2"`)
+
+	out.Reset()
+	result := runner(&out, "m2").Replay(ctx, queue)
+	require.NoError(t, result.Err)
+	assert.Equal(t, 1, result.Rejected)
+	entries, err = queue.Load(ctx)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "events rejected again stay in the queue")
+
+	out.Reset()
+	result = runner(&out).Replay(ctx, queue)
+	require.NoError(t, result.Err)
+	assert.Equal(t, 1, result.Sent)
+	assert.Contains(t, out.String(), `"messageId":"m2"`)
+	entries, err = queue.Load(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,128 @@
+package bridge
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/stats"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+)
+
+// QueryResult summarizes the processing of a single query
+type QueryResult struct {
+	// Title is the title of the query
+	Title string
+	// Fetched is the number of records fetched from Splunk
+	Fetched int
+	// Dropped counts the records dropped by the transformer by drop reason
+	Dropped map[transform.DropReason]int
+	// Rejected is the number of events the sink refused to deliver
+	Rejected int
+	// Sent is the number of events delivered to the sink
+	Sent int
+	// Evicted is the number of older dead-letter queue entries discarded to
+	// make room for the ones of the query
+	Evicted int
+	// Batches is the number of batches the events were delivered in, e.g.
+	// Segment batch calls
+	Batches int
+	// Bytes is the total size of the delivered batches
+	Bytes int
+	// Statuses counts the HTTP status codes of the sink API calls
+	Statuses map[int]int
+	// Durations holds how long after the query started each stage finished
+	Durations map[Stage]time.Duration
+	// LatestTimestamp is the timestamp of the latest event handed to the
+	// sink, or the zero time if no events were
+	LatestTimestamp time.Time
+	// Err is set if processing the query failed
+	Err error
+}
+
+// Stage is a stage of processing a query
+type Stage string
+
+const (
+	StageFetch     Stage = "fetch"
+	StageTransform Stage = "transform"
+	StageUpload    Stage = "upload"
+)
+
+// TotalDropped returns the total number of records dropped for the query
+func (qr QueryResult) TotalDropped() (total int) {
+	for _, count := range qr.Dropped {
+		total += count
+	}
+	return
+}
+
+// Summary summarizes the results of a Runner run
+type Summary struct {
+	Queries []QueryResult
+}
+
+// Failed returns true if processing any of the queries failed
+func (s Summary) Failed() bool {
+	for _, query := range s.Queries {
+		if query.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Write prints a human-readable summary into the given writer
+func (s Summary) Write(w io.Writer) error {
+	var fetched, dropped, sent stats.Series[int]
+	droppedByReason := map[transform.DropReason]int{}
+	evicted := 0
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "Fetched\tDropped\tRejected\tSent\t\tQuery")
+	for _, query := range s.Queries {
+		status := "ok"
+		if query.Err != nil {
+			status = "FAILED"
+		}
+		fmt.Fprintf(
+			tw, "%d\t%d\t%d\t%d\t%s\t  %s\n",
+			query.Fetched, query.TotalDropped(), query.Rejected, query.Sent, status, query.Title,
+		)
+		fetched.Add(query.Fetched)
+		dropped.Add(query.TotalDropped())
+		sent.Add(query.Sent)
+		evicted += query.Evicted
+		for reason, count := range query.Dropped {
+			droppedByReason[reason] += count
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nFetched: %5d total, per query %5d\n", fetched.Total(), fetched)
+	fmt.Fprintf(w, "Dropped: %5d total, per query %5d\n", dropped.Total(), dropped)
+	fmt.Fprintf(w, "Sent:    %5d total, per query %5d\n", sent.Total(), sent)
+
+	reasons := make([]string, 0, len(droppedByReason))
+	for reason := range droppedByReason {
+		reasons = append(reasons, string(reason))
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "Dropped due to %s: %d\n", reason, droppedByReason[transform.DropReason(reason)])
+	}
+	if evicted > 0 {
+		fmt.Fprintf(w, "Evicted from the full dead-letter queue: %d\n", evicted)
+	}
+
+	for _, query := range s.Queries {
+		if query.Err != nil {
+			fmt.Fprintf(w, "Query %q failed: %v\n", query.Title, query.Err)
+		}
+	}
+	return nil
+}
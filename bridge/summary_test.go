@@ -0,0 +1,55 @@
+package bridge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary_Write(t *testing.T) {
+	summary := Summary{Queries: []QueryResult{
+		{
+			Title:   "Application events",
+			Fetched: 10,
+			Dropped: map[transform.DropReason]int{
+				transform.DropMissingUID:       2,
+				transform.DropMissingWorkspace: 1,
+			},
+			Sent:    7,
+			Evicted: 2,
+		},
+		{
+			Title:   "Component events",
+			Fetched: 4,
+			Dropped: map[transform.DropReason]int{transform.DropMissingUID: 1},
+			Sent:    2,
+			Err:     errors.New("upload failed: boom"),
+		},
+	}}
+	var out strings.Builder
+	require.NoError(t, summary.Write(&out))
+	assert.Equal(t, strings.TrimLeft(dedent.Dedent(`
+		  Fetched  Dropped  Rejected  Sent        Query
+		       10        3         0     7      ok  Application events
+		        4        1         0     2  FAILED  Component events
+
+		Fetched:    14 total, per query min:     4 max:    10 avg:     7
+		Dropped:     4 total, per query min:     1 max:     3 avg:     2
+		Sent:        9 total, per query min:     2 max:     7 avg:     4
+		Dropped due to missing-uid: 3
+		Dropped due to missing-workspace: 1
+		Evicted from the full dead-letter queue: 2
+		Query "Component events" failed: upload failed: boom
+	`), "\n"), out.String())
+	assert.True(t, summary.Failed())
+}
+
+func TestSummary_Failed(t *testing.T) {
+	assert.False(t, Summary{}.Failed())
+	assert.False(t, Summary{Queries: []QueryResult{{Title: "q"}}}.Failed())
+}
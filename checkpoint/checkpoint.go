@@ -0,0 +1,134 @@
+// Package checkpoint keeps track of how far the records of each query were
+// delivered, so that each run of the bridge only needs to fetch records that
+// are newer than the ones it already sent.
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// DefaultOverlap is the default duration to re-fetch records from before each
+// checkpoint. Splunk may index audit records some time after they were
+// generated, so a run may not see all the records up to its checkpoint.
+const DefaultOverlap = time.Hour
+
+// Checkpoints maps query titles to the time up to which the records of that
+// query were delivered
+type Checkpoints map[string]time.Time
+
+// Advance records the given timestamp as the latest delivered for the query
+// unless a later timestamp was already recorded
+func (c Checkpoints) Advance(title string, timestamp time.Time) {
+	if timestamp.IsZero() {
+		return
+	}
+	if current, ok := c[title]; !ok || timestamp.After(current) {
+		c[title] = timestamp.UTC()
+	}
+}
+
+// Complete records that all the records of the query up to the given window
+// end were delivered, even if there were none. Since Splunk may index records
+// some time after they were generated, the checkpoint is only advanced to the
+// given lag before the window end. A zero window end is ignored.
+func (c Checkpoints) Complete(title string, windowEnd time.Time, lag time.Duration) {
+	if windowEnd.IsZero() {
+		return
+	}
+	c.Advance(title, windowEnd.Add(-lag))
+}
+
+// EarliestTime returns a Splunk time string for the earliest time to fetch
+// records from for the given query. The time is calculated by subtracting the
+// overlap from the query checkpoint, to allow for late-indexed records to be
+// picked up. If there is no checkpoint for the query, defaultTime is returned.
+func (c Checkpoints) EarliestTime(title string, overlap time.Duration, defaultTime string) string {
+	checkpoint, ok := c[title]
+	if !ok {
+		return defaultTime
+	}
+	return FormatSplunkTime(checkpoint.Add(-overlap))
+}
+
+// SplunkTimeFormat is the Go layout of the default Splunk time format,
+// %FT%T.%Q%:z, which Splunk parses search time bounds with
+const SplunkTimeFormat = "2006-01-02T15:04:05.000-07:00"
+
+// FormatSplunkTime formats the given time as a string Splunk can accept as a
+// search time bound
+func FormatSplunkTime(t time.Time) string {
+	return t.UTC().Format(SplunkTimeFormat)
+}
+
+// relativeTimeRx matches the Splunk relative time strings ResolveSplunkTime
+// supports, which are offsets without snapping
+var relativeTimeRx = regexp.MustCompile(`^([+-]?)(\d*)(s|secs?|seconds?|m|mins?|minutes?|h|hrs?|hours?|d|days?|w|weeks?)$`)
+
+// relativeTimeUnits maps the first letter of Splunk time units to durations
+var relativeTimeUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ResolveSplunkTime returns the time a Splunk time string refers to, given the
+// current time. It supports "now", times in the Splunk time format or RFC 3339,
+// and relative times without snapping such as "-4hours".
+func ResolveSplunkTime(value string, now time.Time) (time.Time, error) {
+	if value == "now" {
+		return now, nil
+	}
+	if t, err := time.Parse(SplunkTimeFormat, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	match := relativeTimeRx.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, fmt.Errorf("unsupported Splunk time: %q", value)
+	}
+	count := 1
+	if match[2] != "" {
+		var err error
+		if count, err = strconv.Atoi(match[2]); err != nil {
+			return time.Time{}, fmt.Errorf("unsupported Splunk time: %q", value)
+		}
+	}
+	offset := time.Duration(count) * relativeTimeUnits[match[3][0]]
+	if match[1] == "-" {
+		offset = -offset
+	}
+	return now.Add(offset), nil
+}
+
+// Store persists Checkpoints between runs
+type Store interface {
+	// Load returns the stored checkpoints, or empty checkpoints if none were
+	// stored yet
+	Load(ctx context.Context) (Checkpoints, error)
+	// Save stores the given checkpoints
+	Save(ctx context.Context, checkpoints Checkpoints) error
+}
+
+func decode(data []byte) (Checkpoints, error) {
+	checkpoints := Checkpoints{}
+	if len(data) == 0 {
+		return checkpoints, nil
+	}
+	if err := json.Unmarshal(data, &checkpoints); err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+func encode(checkpoints Checkpoints) ([]byte, error) {
+	return json.MarshalIndent(checkpoints, "", "  ")
+}
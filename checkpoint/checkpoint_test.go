@@ -0,0 +1,122 @@
+package checkpoint
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckpoints_Advance(t *testing.T) {
+	t1 := time.Date(2023, 11, 20, 7, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+	checkpoints := Checkpoints{}
+
+	checkpoints.Advance("q1", time.Time{})
+	assert.Empty(t, checkpoints)
+
+	checkpoints.Advance("q1", t1)
+	checkpoints.Advance("q1", t2)
+	checkpoints.Advance("q2", t2)
+	checkpoints.Advance("q2", t1)
+	assert.Equal(t, Checkpoints{"q1": t2, "q2": t2}, checkpoints)
+}
+
+func TestCheckpoints_Complete(t *testing.T) {
+	windowEnd := time.Date(2023, 11, 20, 8, 0, 0, 0, time.UTC)
+	checkpoints := Checkpoints{"q1": windowEnd.Add(-3 * time.Hour)}
+
+	checkpoints.Complete("q1", windowEnd, time.Hour)
+	checkpoints.Complete("quiet", windowEnd, time.Hour)
+	checkpoints.Complete("q2", time.Time{}, time.Hour)
+	assert.Equal(t, Checkpoints{"q1": windowEnd.Add(-time.Hour), "quiet": windowEnd.Add(-time.Hour)}, checkpoints)
+	assert.Equal(t,
+		"2023-11-20T06:00:00.000+00:00", checkpoints.EarliestTime("quiet", time.Hour, "-4hours"),
+		"quiet queries do not fetch from the same point again",
+	)
+
+	checkpoints.Complete("q1", windowEnd.Add(-time.Hour), time.Hour)
+	assert.Equal(t, windowEnd.Add(-time.Hour), checkpoints["q1"], "checkpoints do not move back")
+}
+
+func TestResolveSplunkTime(t *testing.T) {
+	now := time.Date(2023, 11, 20, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "now", want: now},
+		{value: "-0hours", want: now},
+		{value: "-4hours", want: now.Add(-4 * time.Hour)},
+		{value: "-15m", want: now.Add(-15 * time.Minute)},
+		{value: "-d", want: now.AddDate(0, 0, -1)},
+		{value: "+30s", want: now.Add(30 * time.Second)},
+		{value: "2023-11-20T07:59:03.061+00:00", want: time.Date(2023, 11, 20, 7, 59, 3, 61000000, time.UTC)},
+		{value: "2023-11-20T07:59:03Z", want: time.Date(2023, 11, 20, 7, 59, 3, 0, time.UTC)},
+		{value: "-1d@d", wantErr: true},
+		{value: "-1mon", wantErr: true},
+		{value: "yesterday", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ResolveSplunkTime(tt.value, now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.Equal(got), "got %s", got)
+		})
+	}
+}
+
+func TestCheckpoints_EarliestTime(t *testing.T) {
+	checkpoints := Checkpoints{
+		"q1": time.Date(2023, 11, 20, 7, 59, 3, 61790000, time.UTC),
+	}
+	assert.Equal(t, "2023-11-20T07:29:03.061+00:00", checkpoints.EarliestTime("q1", 30*time.Minute, "-4hours"))
+	assert.Equal(t, "2023-11-20T07:59:03.061+00:00", checkpoints.EarliestTime("q1", 0, "-4hours"))
+	assert.Equal(t, "-4hours", checkpoints.EarliestTime("q2", 30*time.Minute, "-4hours"))
+}
+
+func TestFormatSplunkTime(t *testing.T) {
+	ts := time.Date(2023, 11, 20, 9, 59, 3, 61790000, time.FixedZone("IST", 2*60*60))
+	assert.Equal(t, "2023-11-20T07:59:03.061+00:00", FormatSplunkTime(ts))
+	assert.Equal(t, "2023-11-20T07:00:00.000+00:00", FormatSplunkTime(ts.Truncate(time.Hour)))
+}
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	loaded, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, Checkpoints{}, loaded)
+
+	checkpoints := Checkpoints{
+		"Application events": time.Date(2023, 11, 20, 7, 59, 3, 61790000, time.UTC),
+	}
+	require.NoError(t, store.Save(ctx, checkpoints))
+	loaded, err = store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, checkpoints, loaded)
+
+	checkpoints["Component events"] = time.Date(2023, 11, 21, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Save(ctx, checkpoints))
+	loaded, err = store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, checkpoints, loaded)
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, NewFileStore(filepath.Join(t.TempDir(), "checkpoints.json")))
+}
+
+func TestConfigMapStore(t *testing.T) {
+	client := fake.NewClientset()
+	testStore(t, NewConfigMapStore(client, "segment-bridge", "checkpoints"))
+}
@@ -0,0 +1,41 @@
+package checkpoint
+
+import (
+	"context"
+
+	"github.com/redhat-appstudio/segment-bridge.git/configmap"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConfigMapKey is the ConfigMap data key checkpoints are stored under
+const ConfigMapKey = "checkpoints.json"
+
+// ConfigMapStore is a Store that keeps checkpoints in a K8s ConfigMap
+type ConfigMapStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewConfigMapStore constructs a ConfigMapStore that uses the ConfigMap with
+// the given namespace and name. The ConfigMap is created when checkpoints are
+// first saved.
+func NewConfigMapStore(client kubernetes.Interface, namespace, name string) *ConfigMapStore {
+	return &ConfigMapStore{client: client, namespace: namespace, name: name}
+}
+
+func (s *ConfigMapStore) Load(ctx context.Context) (Checkpoints, error) {
+	data, err := configmap.Read(ctx, s.client, s.namespace, s.name)
+	if err != nil {
+		return nil, err
+	}
+	return decode([]byte(data[ConfigMapKey]))
+}
+
+func (s *ConfigMapStore) Save(ctx context.Context, checkpoints Checkpoints) error {
+	data, err := encode(checkpoints)
+	if err != nil {
+		return err
+	}
+	return configmap.UpdateKeys(ctx, s.client, s.namespace, s.name, map[string]string{ConfigMapKey: string(data)})
+}
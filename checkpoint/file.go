@@ -0,0 +1,51 @@
+package checkpoint
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileStore is a Store that keeps checkpoints in a local JSON file
+type FileStore struct {
+	path string
+}
+
+// NewFileStore constructs a FileStore that uses the file in the given path
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Load(_ context.Context) (Checkpoints, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Checkpoints{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+// Save writes the checkpoints into a temporary file and then renames it over
+// the store file, so that a crash while saving does not corrupt the store
+func (s *FileStore) Save(_ context.Context, checkpoints Checkpoints) error {
+	data, err := encode(checkpoints)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -5,11 +5,20 @@ the RHTAP cluster audit logs stored in Splunk.
 Usage:
 
 	querygen [flags]
+	querygen lint [--events-file FILE]
+
+When invoked with "lint", QueryGen validates the event definitions instead of
+printing queries. It reports unknown fields, field name collisions, fields
+that depend on outputs of commands missing from the query and duplicate event
+names, and exits with a non-zero status if any problems are found.
 
 The flags are:
 
 	    --index INDEX
 		    Specify the Splunk index to query.
+	    --events-file FILE
+		    Generate queries for the events defined in the given YAML or JSON
+		    file instead of the built-in event definitions.
 		-0
 			Print in a format suitable for `xargs -0`
 */
@@ -18,6 +27,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
 
 	"github.com/redhat-appstudio/segment-bridge.git/querygen"
 	"github.com/redhat-appstudio/segment-bridge.git/queryprint"
@@ -28,6 +38,11 @@ var index = flag.String(
 	"federated:rh_rhtap_stage_audit",
 	"the Splunk index to query",
 )
+var eventsFile = flag.String(
+	"events-file",
+	os.Getenv("EVENTS_FILE"),
+	"a YAML or JSON file with the definitions of the events to generate queries for",
+)
 var machinePrint = flag.Bool(
 	"0",
 	false,
@@ -36,43 +51,41 @@ var machinePrint = flag.Bool(
 )
 
 func main() {
-	flag.Parse()
+	lint := len(os.Args) > 1 && os.Args[1] == "lint"
+	if lint {
+		_ = flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
+	defs, err := querygen.DefaultEventDefinitions()
+	if *eventsFile != "" {
+		defs, err = querygen.LoadEventDefinitions(*eventsFile)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if lint {
+		if err := defs.Validate(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// Generating the queries also catches errors Validate does not
+		if _, err := defs.Queries(*index); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	printFunc := queryprint.PrettyPrintQueries
 	if *machinePrint {
 		printFunc = queryprint.MachinePrintQueries
 	}
-	fmt.Println(printFunc([]queryprint.QueryDesc{
-		{
-			Title: "Application events",
-			Query: querygen.GenApplicationQuery(*index),
-		},
-		{
-			Title: "Component events",
-			Query: querygen.GenComponentQuery(*index),
-		},
-		{
-			Title: "Build PipelineRun creation events",
-			Query: querygen.GenBuildPipelineRunCreatedQuery(*index),
-		},
-		{
-			Title: "Build PipelineRun started events",
-			Query: querygen.GenBuildPipelineRunStartedQuery(*index),
-		},
-		{
-			Title: "Clair scan TaskRun completion events",
-			Query: querygen.GenClairScanCompletedQuery(*index),
-		},
-		{
-			Title: "Build PipelineRun Completed or Failed events",
-			Query: querygen.GenBuildPipelineRunCompletedQuery(*index),
-		},
-		{
-			Title: "Release Succeeded or Failed events",
-			Query: querygen.GenReleaseCompletedQuery(*index),
-		},
-		{
-			Title: "Pull Request created events",
-			Query: querygen.GenPullRequestCreatedQuery(*index),
-		},
-	}))
+	queries, err := defs.Queries(*index)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println(printFunc(queries))
 }
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/backfill"
+	"github.com/redhat-appstudio/segment-bridge.git/bridge"
+)
+
+func backfillCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	var splunkOpts splunkOptions
+	var segmentOpts segmentOptions
+	var sinkOpts sinkOptions
+	var mapOpts mapOptions
+	var dlqOpts dlqOptions
+	var metricsOpts metricsOptions
+	var retryOpts retryOptions
+	splunkOpts.register(fs)
+	segmentOpts.register(fs)
+	sinkOpts.register(fs)
+	mapOpts.register(fs)
+	dlqOpts.register(fs)
+	metricsOpts.register(fs)
+	retryOpts.register(fs)
+	from := fs.String(
+		"from", "",
+		"the start of the time range to backfill, as an RFC 3339 time or a YYYY-MM-DD date",
+	)
+	to := fs.String(
+		"to", "",
+		"the end of the time range to backfill, as an RFC 3339 time or a YYYY-MM-DD date "+
+			"(default now)",
+	)
+	chunk := fs.Duration("chunk", time.Hour, "the size of the windows to split the time range into")
+	parallelism := fs.Int(
+		"parallelism", bridge.DefaultParallelism,
+		"how many queries to process concurrently for each window",
+	)
+	progressFile := fs.String(
+		"progress-file", envOr("BACKFILL_PROGRESS_FILE", "backfill-progress.json"),
+		"a JSON file recording the completed windows, used for resuming an interrupted backfill",
+	)
+	gapRadius := fs.Int(
+		"gap-radius", backfill.DefaultGapRadius,
+		"how many windows on each side of a window to compare it to when looking for gaps",
+	)
+	gapRatio := fs.Float64(
+		"gap-ratio", backfill.DefaultGapRatio,
+		"report windows that fetched fewer records than this fraction of their neighbours median",
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	retryOpts.apply(&splunkOpts, &segmentOpts, &sinkOpts)
+
+	if *from == "" {
+		return errors.New("--from must be specified")
+	}
+	fromTime, err := backfill.ParseTime(*from)
+	if err != nil {
+		return err
+	}
+	toTime := time.Now()
+	if *to != "" {
+		if toTime, err = backfill.ParseTime(*to); err != nil {
+			return err
+		}
+	}
+	windows, err := backfill.SplitRange(fromTime, toTime, *chunk)
+	if err != nil {
+		return err
+	}
+
+	queries, err := splunkOpts.queries()
+	if err != nil {
+		return err
+	}
+	transformer, err := mapOpts.transformer(ctx)
+	if err != nil {
+		return err
+	}
+	destination, err := sinkOpts.sink(&segmentOpts)
+	if err != nil {
+		return err
+	}
+	runner, err := dlqOpts.withDeadLetters(
+		bridge.NewRunner(splunkOpts.client(), transformer, destination).
+			WithParallelism(*parallelism),
+	)
+	if err != nil {
+		return err
+	}
+	backfiller, err := backfill.NewBackfiller(runner, queries).
+		WithProgressFile(*progressFile)
+	if err != nil {
+		return err
+	}
+	report, runErr := backfiller.WithGapDetection(*gapRadius, *gapRatio).Run(ctx, windows)
+	if runErr == nil && report.Failed() {
+		runErr = errors.New("some windows are incomplete, run again to resume")
+	}
+	runErr = errors.Join(runErr, sinkOpts.close())
+	observeReport(metricsOpts.metrics(), report, runErr)
+	defer metricsOpts.push(ctx)
+	if err := report.Write(sinkOpts.summaryOutput()); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// observeReport records the results of a backfill in the metrics
+func observeReport(m *bridge.Metrics, report backfill.Report, err error) {
+	for _, window := range report.Windows {
+		m.ObserveSummary(window.Summary)
+		for _, query := range window.Summary.Queries {
+			if query.Err == nil {
+				m.ObserveWindowEnd(query.Title, window.Window.End)
+			}
+		}
+	}
+	m.ObserveRun(time.Now(), err)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/redhat-appstudio/segment-bridge.git/identity"
+)
+
+func exportHistoryCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export-history", flag.ExitOnError)
+	var historyOpts historyOptions
+	historyOpts.register(fs)
+	output := fs.String("output", "", "a file to write the history to (default the standard output)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := historyStore(&historyOpts)
+	if err != nil {
+		return err
+	}
+	history, err := store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return history.Write(os.Stdout)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := history.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func importHistoryCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import-history", flag.ExitOnError)
+	var historyOpts historyOptions
+	historyOpts.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: import-history [flags] [FILE]\n\n")
+		fmt.Fprintf(fs.Output(), "Merges the history in FILE, or the standard input, into the stored history.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var input io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	imported, err := identity.ReadHistory(input)
+	if err != nil {
+		return err
+	}
+	store, err := historyStore(&historyOpts)
+	if err != nil {
+		return err
+	}
+	return store.Update(ctx, func(history *identity.History) {
+		history.Merge(imported)
+	})
+}
+
+// historyStore returns the configured history store, failing if none is
+// configured
+func historyStore(opts *historyOptions) (identity.HistoryStore, error) {
+	store, err := opts.store()
+	if err == nil && store == nil {
+		err = errors.New("--history-file or --history-configmap must be specified")
+	}
+	return store, err
+}
@@ -0,0 +1,79 @@
+/*
+Segment-bridge moves user journey events from the RHTAP cluster audit logs
+stored in Splunk into Segment or another sink.
+
+Usage:
+
+	segment-bridge COMMAND [flags]
+
+The commands are:
+
+	run             fetch, transform and upload user journey events
+	backfill        re-send the events of a past time range in windows
+	uid-map         build the username to SSO user ID map from UserSignups
+	ws-map          build the namespace to workspace map from member clusters
+	space-map       build the workspace owner and member map from Spaces
+	watch           keep running periodically with live identity maps
+	export-history  export the identity history as JSON
+	import-history  merge exported identity history into the stored one
+	replay-dlq      replay dropped records from the dead-letter queue
+	replay          re-send archived events to the configured sink
+
+Run "segment-bridge COMMAND -help" for the flags each command accepts. The
+README describes the commands in detail.
+*/
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{"run", "Fetch, transform and upload user journey events", runCommand},
+	{"backfill", "Re-send the events of a past time range in windows", backfillCommand},
+	{"uid-map", "Build the username to SSO user ID map from UserSignups", uidMapCommand},
+	{"ws-map", "Build the namespace to workspace map from member clusters", wsMapCommand},
+	{"space-map", "Build the workspace owner and member map from Spaces", spaceMapCommand},
+	{"watch", "Keep running periodically with live identity maps", watchCommand},
+	{"export-history", "Export the identity history as JSON", exportHistoryCommand},
+	{"import-history", "Merge exported identity history into the stored one", importHistoryCommand},
+	{"replay-dlq", "Replay dropped records from the dead-letter queue", replayDLQCommand},
+	{"replay", "Re-send archived events to the configured sink", replayCommand},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(ctx, os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s COMMAND [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", cmd.name, cmd.summary)
+	}
+}
@@ -0,0 +1,895 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/redhat-appstudio/segment-bridge.git/amplitude"
+	"github.com/redhat-appstudio/segment-bridge.git/archive"
+	"github.com/redhat-appstudio/segment-bridge.git/bridge"
+	"github.com/redhat-appstudio/segment-bridge.git/checkpoint"
+	"github.com/redhat-appstudio/segment-bridge.git/dlq"
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+	"github.com/redhat-appstudio/segment-bridge.git/identity"
+	"github.com/redhat-appstudio/segment-bridge.git/kafka"
+	"github.com/redhat-appstudio/segment-bridge.git/querygen"
+	"github.com/redhat-appstudio/segment-bridge.git/queryprint"
+	"github.com/redhat-appstudio/segment-bridge.git/segment"
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/redhat-appstudio/segment-bridge.git/spaces"
+	"github.com/redhat-appstudio/segment-bridge.git/splunk"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	"github.com/redhat-appstudio/segment-bridge.git/webhook"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// splunkOptions includes the flags for connecting to Splunk and generating
+// the queries to run
+type splunkOptions struct {
+	apiURL     string
+	appName    string
+	index      string
+	eventsFile string
+	retries    int
+	budget     *httpretry.Budget
+}
+
+func (o *splunkOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.apiURL, "splunk-api-url",
+		envOr("SPLUNK_API_URL", "https://splunk-api.corp.redhat.com:8089"),
+		"the Splunk API URL",
+	)
+	fs.StringVar(
+		&o.appName, "splunk-app",
+		envOr("SPLUNK_APP_NAME", "rh_rhtap"),
+		"the Splunk app to run queries in",
+	)
+	fs.StringVar(
+		&o.index, "index",
+		envOr("SPLUNK_INDEX", "federated:rh_rhtap_stage_audit"),
+		"the Splunk index to query",
+	)
+	fs.StringVar(
+		&o.eventsFile, "events-file",
+		os.Getenv("EVENTS_FILE"),
+		"a YAML or JSON file with the definitions of the events to generate "+
+			"queries for (default the built-in event definitions)",
+	)
+	fs.IntVar(
+		&o.retries, "splunk-retries",
+		envIntOr("SPLUNK_RETRIES", httpretry.DefaultRetries),
+		"how many times to retry failed search submissions",
+	)
+}
+
+// queries returns the queries for the configured event definitions
+func (o *splunkOptions) queries() ([]queryprint.QueryDesc, error) {
+	if o.eventsFile == "" {
+		return querygen.GenAllQueries(o.index)
+	}
+	defs, err := querygen.LoadEventDefinitions(o.eventsFile)
+	if err != nil {
+		return nil, err
+	}
+	return defs.Queries(o.index)
+}
+
+// client returns a Splunk client. Credentials are taken from the SPLUNK_TOKEN
+// or the SPLUNK_USERNAME and SPLUNK_PASSWORD environment variables.
+func (o *splunkOptions) client() *splunk.Client {
+	return splunk.NewClient(splunk.GetSplunkAppAPIEndpointFromURL(o.apiURL, "nobody", o.appName)).
+		WithBasicAuth(os.Getenv("SPLUNK_USERNAME"), os.Getenv("SPLUNK_PASSWORD")).
+		WithToken(os.Getenv("SPLUNK_TOKEN")).
+		WithRetryPolicy(httpretry.NewPolicy().WithRetries(o.retries).WithBudget(o.budget))
+}
+
+// segmentOptions includes the flags for uploading to Segment
+type segmentOptions struct {
+	apiURL    string
+	batchSize int
+	retries   int
+	budget    *httpretry.Budget
+}
+
+func (o *segmentOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.apiURL, "segment-api",
+		envOr("SEGMENT_BATCH_API", segment.DefaultBatchAPI),
+		"the Segment batch API URL",
+	)
+	fs.IntVar(
+		&o.batchSize, "batch-size",
+		envIntOr("SEGMENT_BATCH_DATA_SIZE", segment.DefaultBatchDataSize),
+		"the maximum size in bytes of each batch call payload",
+	)
+	fs.IntVar(
+		&o.retries, "segment-retries",
+		envIntOr("SEGMENT_RETRIES", segment.DefaultRetries),
+		"how many times to retry failed batch calls",
+	)
+}
+
+// uploader returns a Segment uploader. The write key is taken from the
+// SEGMENT_WRITE_KEY environment variable.
+func (o *segmentOptions) uploader() *segment.BatchUploader {
+	return segment.NewBatchUploader(o.apiURL).
+		WithWriteKey(os.Getenv("SEGMENT_WRITE_KEY")).
+		WithBatchSize(o.batchSize).
+		WithRetryPolicy(httpretry.NewPolicy().WithRetries(o.retries).WithBudget(o.budget))
+}
+
+// amplitudeOptions includes the flags for uploading directly to Amplitude
+type amplitudeOptions struct {
+	apiURL    string
+	batchSize int
+	retries   int
+}
+
+func (o *amplitudeOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.apiURL, "amplitude-api",
+		envOr("AMPLITUDE_API", amplitude.DefaultBatchAPI),
+		"the Amplitude Batch or HTTP V2 API URL",
+	)
+	fs.IntVar(
+		&o.batchSize, "amplitude-batch-size",
+		envIntOr("AMPLITUDE_BATCH_DATA_SIZE", amplitude.DefaultBatchDataSize),
+		"the maximum size in bytes of each Amplitude upload payload",
+	)
+	fs.IntVar(
+		&o.retries, "amplitude-retries",
+		envIntOr("AMPLITUDE_RETRIES", amplitude.DefaultRetries),
+		"how many times to retry failed Amplitude uploads",
+	)
+}
+
+// uploader returns an Amplitude uploader. The API key is taken from the
+// AMPLITUDE_API_KEY environment variable.
+func (o *amplitudeOptions) uploader(budget *httpretry.Budget) *amplitude.Uploader {
+	return amplitude.NewUploader(o.apiURL).
+		WithAPIKey(os.Getenv("AMPLITUDE_API_KEY")).
+		WithBatchSize(o.batchSize).
+		WithRetryPolicy(amplitude.NewRetryPolicy().WithRetries(o.retries).WithBudget(budget))
+}
+
+// webhookOptions includes the flags for sending events to webhook endpoints
+type webhookOptions struct {
+	configFile string
+	source     string
+	retries    int
+}
+
+func (o *webhookOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.configFile, "webhook-config",
+		os.Getenv("WEBHOOK_CONFIG"),
+		"a YAML or JSON file listing the endpoints the webhook sink sends events to",
+	)
+	fs.StringVar(
+		&o.source, "webhook-source",
+		envOr("WEBHOOK_SOURCE", webhook.DefaultSource),
+		"the CloudEvents source of the events the webhook sink sends",
+	)
+	fs.IntVar(
+		&o.retries, "webhook-retries",
+		envIntOr("WEBHOOK_RETRIES", webhook.DefaultRetries),
+		"how many times to retry failed webhook calls",
+	)
+}
+
+// sink returns a webhook sink sending events to the configured endpoints
+func (o *webhookOptions) sink(budget *httpretry.Budget) (*webhook.Sink, error) {
+	if o.configFile == "" {
+		return nil, errors.New("--webhook-config must be specified for the webhook sink")
+	}
+	config, err := webhook.LoadConfig(o.configFile)
+	if err != nil {
+		return nil, err
+	}
+	return webhook.NewSink(config.Endpoints...).
+		WithSource(o.source).
+		WithRetryPolicy(httpretry.NewPolicy().WithRetries(o.retries).WithBudget(budget)), nil
+}
+
+// kafkaOptions includes the flags for producing events to Kafka
+type kafkaOptions struct {
+	brokers    string
+	topic      string
+	routeBy    string
+	routes     string
+	idempotent bool
+	tls        bool
+	tlsCA      string
+	tlsCert    string
+	tlsKey     string
+	sasl       string
+	retries    int
+}
+
+func (o *kafkaOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.brokers, "kafka-brokers",
+		os.Getenv("KAFKA_BROKERS"),
+		"a comma-separated list of the host:port addresses of the Kafka brokers to bootstrap from",
+	)
+	fs.StringVar(
+		&o.topic, "kafka-topic",
+		envOr("KAFKA_TOPIC", "user-journey"),
+		"the Kafka topic of the events no route matches. If empty, those events are rejected.",
+	)
+	fs.StringVar(
+		&o.routeBy, "kafka-route-by",
+		envOr("KAFKA_ROUTE_BY", string(kafka.RouteByEvent)),
+		"the event field Kafka routes match: event (the event name, or identify or group for "+
+			"other calls) or kind (properties.kind)",
+	)
+	fs.StringVar(
+		&o.routes, "kafka-routes",
+		os.Getenv("KAFKA_ROUTES"),
+		"a comma-separated list of PATTERN=TOPIC routes choosing the Kafka topic of events, "+
+			"e.g. 'Build *=builds,identify=users', where the first matching pattern wins",
+	)
+	fs.BoolVar(
+		&o.idempotent, "kafka-idempotent",
+		envBoolOr("KAFKA_IDEMPOTENT", true),
+		"whether to produce idempotently, so retried requests do not store events twice",
+	)
+	fs.BoolVar(
+		&o.tls, "kafka-tls",
+		envBoolOr("KAFKA_TLS", false),
+		"whether to connect to the Kafka brokers over TLS. Implied by the other --kafka-tls flags.",
+	)
+	fs.StringVar(
+		&o.tlsCA, "kafka-tls-ca",
+		os.Getenv("KAFKA_TLS_CA"),
+		"a PEM file of the CA certificates to verify the Kafka brokers with, instead of the system ones",
+	)
+	fs.StringVar(
+		&o.tlsCert, "kafka-tls-cert",
+		os.Getenv("KAFKA_TLS_CERT"),
+		"a PEM file of the client certificate to present to the Kafka brokers",
+	)
+	fs.StringVar(
+		&o.tlsKey, "kafka-tls-key",
+		os.Getenv("KAFKA_TLS_KEY"),
+		"a PEM file of the key of the client certificate",
+	)
+	fs.StringVar(
+		&o.sasl, "kafka-sasl-mechanism",
+		os.Getenv("KAFKA_SASL_MECHANISM"),
+		"the SASL mechanism to authenticate to the Kafka brokers with: "+
+			strings.Join(kafka.SASLMechanisms, ", ")+", or empty for none",
+	)
+	fs.IntVar(
+		&o.retries, "kafka-retries",
+		envIntOr("KAFKA_RETRIES", kafka.DefaultRetries),
+		"how many times to retry producing events to Kafka",
+	)
+}
+
+// producer returns a Kafka producer routing events as configured. SASL
+// credentials are taken from the KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD
+// environment variables.
+func (o *kafkaOptions) producer(budget *httpretry.Budget) (*kafka.Producer, error) {
+	var brokers []string
+	for _, broker := range strings.Split(o.brokers, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, errors.New("--kafka-brokers must be specified for the kafka sink")
+	}
+	routeBy := kafka.RouteBy(o.routeBy)
+	if routeBy != kafka.RouteByEvent && routeBy != kafka.RouteByKind {
+		return nil, fmt.Errorf("invalid --kafka-route-by value %q, expected event or kind", o.routeBy)
+	}
+	routes, err := kafka.ParseRoutes(o.routes)
+	if err != nil {
+		return nil, err
+	}
+	if (o.tlsCert == "") != (o.tlsKey == "") {
+		return nil, errors.New("--kafka-tls-cert and --kafka-tls-key must be specified together")
+	}
+	mechanism, err := kafka.SASLMechanism(
+		o.sasl, os.Getenv("KAFKA_SASL_USERNAME"), os.Getenv("KAFKA_SASL_PASSWORD"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	producer := kafka.NewProducer(brokers, kafka.NewRouter(o.topic).WithRoutes(routeBy, routes...)).
+		WithIdempotence(o.idempotent).
+		WithRetries(o.retries).
+		WithBudget(budget)
+	if mechanism != nil {
+		producer.WithSASL(mechanism)
+	}
+	if o.tls || o.tlsCA != "" || o.tlsCert != "" {
+		config, err := kafka.TLSConfig(o.tlsCA, o.tlsCert, o.tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		producer.WithTLS(config)
+	}
+	return producer, nil
+}
+
+// archiveOptions includes the flags for archiving events into S3-compatible
+// object storage
+type archiveOptions struct {
+	location string
+	endpoint string
+	region   string
+}
+
+func (o *archiveOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.location, "archive",
+		os.Getenv("ARCHIVE_URL"),
+		"an s3://BUCKET/PREFIX location to also archive every delivered batch of events "+
+			"into, as gzip-compressed NDJSON objects with a manifest per run",
+	)
+	fs.StringVar(
+		&o.endpoint, "archive-endpoint",
+		envOr("ARCHIVE_ENDPOINT", archive.DefaultEndpoint),
+		"the URL of the S3-compatible API of the archive, e.g. http://localhost:9000 for MinIO",
+	)
+	fs.StringVar(
+		&o.region, "archive-region",
+		envOr("ARCHIVE_REGION", envOr("AWS_REGION", archive.DefaultRegion)),
+		"the region of the archive bucket",
+	)
+}
+
+// archive returns an Archive at the given s3://BUCKET/PREFIX location.
+// Credentials are taken from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables.
+func (o *archiveOptions) archive(location string, budget *httpretry.Budget) (*archive.Archive, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid archive location %q, expected s3://BUCKET/PREFIX", location)
+	}
+	client := archive.NewClient(o.endpoint, u.Host).
+		WithRegion(o.region).
+		WithCredentials(
+			os.Getenv("AWS_ACCESS_KEY_ID"),
+			os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			os.Getenv("AWS_SESSION_TOKEN"),
+		).
+		WithRetryPolicy(httpretry.NewPolicy().WithBudget(budget))
+	return archive.NewArchive(client, u.Path), nil
+}
+
+// sinkOptions includes the flags for selecting where events are delivered
+type sinkOptions struct {
+	kind        string
+	file        string
+	maxFileSize int64
+	amplitude   amplitudeOptions
+	webhook     webhookOptions
+	kafka       kafkaOptions
+	archive     archiveOptions
+	budget      *httpretry.Budget
+	closers     []io.Closer
+}
+
+func (o *sinkOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.kind, "sink",
+		envOr("SINK", "segment"),
+		"where to deliver events: segment, amplitude, webhook (CloudEvents POSTed to "+
+			"the endpoints given via --webhook-config), kafka (records keyed by user ID "+
+			"produced to the topics chosen via --kafka-routes), file (NDJSON files, e.g. for a "+
+			"dry run) or stdout (NDJSON on the standard output, with summaries on the "+
+			"standard error)",
+	)
+	fs.StringVar(
+		&o.file, "sink-file",
+		envOr("SINK_FILE", "events.ndjson"),
+		"the NDJSON file the file sink writes to. Once it grows beyond the maximum size, "+
+			"the events go on in files with a sequence number before the extension.",
+	)
+	fs.Int64Var(
+		&o.maxFileSize, "sink-file-max-size",
+		int64(envIntOr("SINK_FILE_MAX_SIZE", sink.DefaultMaxFileSize)),
+		"the size in bytes beyond which the file sink moves on to the next file",
+	)
+	o.amplitude.register(fs)
+	o.webhook.register(fs)
+	o.kafka.register(fs)
+	o.archive.register(fs)
+}
+
+// sink returns the configured sink, which also archives the delivered events
+// if an archive is given. Events are uploaded to Segment using the given
+// options.
+func (o *sinkOptions) sink(segmentOpts *segmentOptions) (sink.Sink, error) {
+	destination, err := o.destination(segmentOpts)
+	if err != nil || o.archive.location == "" {
+		return destination, err
+	}
+	eventArchive, err := o.archive.archive(o.archive.location, o.budget)
+	if err != nil {
+		return nil, err
+	}
+	o.closers = append(o.closers, eventArchive)
+	return sink.NewTee(destination, eventArchive).WithErrorHandler(func(err error) {
+		fmt.Fprintf(os.Stderr, "Archiving events: %v\n", err)
+	}), nil
+}
+
+// destination returns the sink selected via --sink
+func (o *sinkOptions) destination(segmentOpts *segmentOptions) (sink.Sink, error) {
+	switch o.kind {
+	case "segment":
+		return segmentOpts.uploader(), nil
+	case "amplitude":
+		return o.amplitude.uploader(o.budget), nil
+	case "webhook":
+		webhookSink, err := o.webhook.sink(o.budget)
+		if err != nil {
+			return nil, err
+		}
+		return webhookSink, nil
+	case "kafka":
+		producer, err := o.kafka.producer(o.budget)
+		if err != nil {
+			return nil, err
+		}
+		o.closers = append(o.closers, producer)
+		return producer, nil
+	case "file":
+		file := sink.NewRotatingFile(o.file).WithMaxSize(o.maxFileSize)
+		o.closers = append(o.closers, file)
+		return sink.NewNDJSONSink(file), nil
+	case "stdout":
+		return sink.NewNDJSONSink(os.Stdout), nil
+	}
+	return nil, fmt.Errorf("unknown sink: %s", o.kind)
+}
+
+// close closes the files the sink wrote to and the Kafka connections, and
+// writes the archive manifest. The sink can be used again afterwards, writing
+// into new files and a new archive run.
+func (o *sinkOptions) close() error {
+	var errs []error
+	for _, closer := range o.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// summaryOutput returns where to write run summaries, which is the standard
+// error when the events go to the standard output
+func (o *sinkOptions) summaryOutput() io.Writer {
+	if o.kind == "stdout" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// retryOptions includes the flags for limiting the time spent on the Splunk
+// and Segment API calls of a run
+type retryOptions struct {
+	budget time.Duration
+}
+
+func (o *retryOptions) register(fs *flag.FlagSet) {
+	fs.DurationVar(
+		&o.budget, "retry-budget",
+		envDurationOr("RETRY_BUDGET", 0),
+		"the total time the run may take before failed Splunk API calls and calls delivering events "+
+			"stop being retried, Splunk searches are cut off and no new calls are made, "+
+			"e.g. 50m for an hourly CronJob "+
+			"(default unlimited)",
+	)
+}
+
+// apply makes the Splunk API calls and the calls made to deliver events share
+// the budget, which starts running out now
+func (o *retryOptions) apply(splunkOpts *splunkOptions, segmentOpts *segmentOptions, sinkOpts *sinkOptions) {
+	if o.budget <= 0 {
+		return
+	}
+	budget := httpretry.NewBudget(o.budget)
+	splunkOpts.budget = budget
+	segmentOpts.budget = budget
+	sinkOpts.budget = budget
+}
+
+// sendEvents sends the given events to Segment, such as identify or group
+// events, reports how many were sent, and returns the ones Segment rejected
+func sendEvents[E any](
+	ctx context.Context, uploader *segment.BatchUploader, kind string, events []E,
+) ([]*segment.EventError, error) {
+	writer := uploader.NewWriter(ctx)
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+		var eventErr *segment.EventError
+		if err = writer.WriteEvent(data); err != nil && !errors.As(err, &eventErr) {
+			return nil, fmt.Errorf("failed to send %s events: %w", kind, err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to send %s events: %w", kind, err)
+	}
+	stats := writer.Stats()
+	fmt.Fprintf(os.Stderr, "Sent %d %s events, rejected %d\n", stats.Events, kind, len(stats.Rejected))
+	return stats.Rejected, nil
+}
+
+// mapOptions includes the flags for loading the identity maps
+type mapOptions struct {
+	uidMapFile   string
+	wsMapFile    string
+	spaceMapFile string
+	history      historyOptions
+}
+
+func (o *mapOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.uidMapFile, "uid-map",
+		os.Getenv("UID_MAP_FILE"),
+		"a JSON file mapping cluster usernames to SSO user IDs",
+	)
+	fs.StringVar(
+		&o.wsMapFile, "ws-map",
+		os.Getenv("WS_MAP_FILE"),
+		"a JSON file mapping namespaces to workspaces",
+	)
+	fs.StringVar(
+		&o.spaceMapFile, "space-map",
+		os.Getenv("SPACE_MAP_FILE"),
+		"a JSON file describing the owners and members of workspaces, as written by "+
+			"the space-map command. When given, events in shared workspaces are attributed "+
+			"to the user who acted and record their role in the workspace.",
+	)
+	o.history.register(fs)
+}
+
+// transformer returns a Transformer using the identity maps. If an identity
+// history is configured, identities are resolved as of the record timestamps.
+func (o *mapOptions) transformer(ctx context.Context) (*transform.Transformer, error) {
+	maps, err := transform.LoadStaticMaps(o.uidMapFile, o.wsMapFile)
+	if err != nil {
+		return nil, err
+	}
+	var spaceMap spaces.Map
+	if o.spaceMapFile != "" {
+		if spaceMap, err = spaces.LoadMap(o.spaceMapFile); err != nil {
+			return nil, err
+		}
+		// Namespaces missing from the workspace map can still be resolved
+		// using the namespaces provisioned for the Spaces
+		for namespace, workspace := range spaceMap.Workspaces() {
+			if _, found := maps.Workspaces[namespace]; !found {
+				maps.Workspaces[namespace] = workspace
+			}
+		}
+	}
+	resolver, err := o.history.resolver(ctx, maps)
+	if err != nil {
+		return nil, err
+	}
+	transformer := transform.NewTransformer(resolver)
+	if spaceMap != nil {
+		transformer.WithMemberships(spaceMap)
+	}
+	return transformer, nil
+}
+
+// historyOptions includes the flags for keeping the identity history
+type historyOptions struct {
+	file      string
+	configMap string
+}
+
+func (o *historyOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.file, "history-file",
+		os.Getenv("IDENTITY_HISTORY_FILE"),
+		"a JSON file to keep the identity history in",
+	)
+	fs.StringVar(
+		&o.configMap, "history-configmap",
+		os.Getenv("IDENTITY_HISTORY_CONFIGMAP"),
+		"a ConfigMap to keep the identity history in, given as NAME or NAMESPACE/NAME",
+	)
+}
+
+// store returns the configured history store, or nil if no history is to be
+// kept
+func (o *historyOptions) store() (identity.HistoryStore, error) {
+	if o.file != "" && o.configMap != "" {
+		return nil, errors.New("only one of --history-file and --history-configmap may be given")
+	}
+	if o.file != "" {
+		return identity.NewFileHistoryStore(o.file), nil
+	}
+	if o.configMap == "" {
+		return nil, nil
+	}
+	client, namespace, name, err := configMapClient(o.configMap)
+	if err != nil {
+		return nil, err
+	}
+	return identity.NewConfigMapHistoryStore(client, namespace, name), nil
+}
+
+// resolver wraps the given resolver so it resolves identities as of a given
+// time using the configured history. If no history is configured the given
+// resolver is returned as is.
+func (o *historyOptions) resolver(
+	ctx context.Context, current transform.IdentityResolver,
+) (transform.IdentityResolver, error) {
+	store, err := o.store()
+	if err != nil || store == nil {
+		return current, err
+	}
+	history, err := store.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identity history: %w", err)
+	}
+	return identity.NewHistoricalResolver(history, current), nil
+}
+
+// record records the given maps, either of which may be nil, into the
+// configured history, if any
+func (o *historyOptions) record(ctx context.Context, uids, workspaces map[string]string) error {
+	store, err := o.store()
+	if err != nil || store == nil {
+		return err
+	}
+	now := time.Now()
+	err = store.Update(ctx, func(history *identity.History) {
+		history.UIDs.Record(now, uids)
+		history.Workspaces.Record(now, workspaces)
+	})
+	// The maps were recorded even if older spans were discarded to make room
+	var evicted *identity.EvictedError
+	if errors.As(err, &evicted) {
+		fmt.Fprintf(os.Stderr, "Recording identity history: %v\n", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record identity history: %w", err)
+	}
+	return nil
+}
+
+func envOr(name, defaultValue string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func envIntOr(name string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+// checkpointOptions includes the flags for storing query checkpoints
+type checkpointOptions struct {
+	file      string
+	configMap string
+	overlap   time.Duration
+}
+
+func (o *checkpointOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.file, "checkpoint-file",
+		os.Getenv("CHECKPOINT_FILE"),
+		"a JSON file to keep query checkpoints in",
+	)
+	fs.StringVar(
+		&o.configMap, "checkpoint-configmap",
+		os.Getenv("CHECKPOINT_CONFIGMAP"),
+		"a ConfigMap to keep query checkpoints in, given as NAME or NAMESPACE/NAME",
+	)
+	fs.DurationVar(
+		&o.overlap, "overlap",
+		envDurationOr("QUERY_OVERLAP", checkpoint.DefaultOverlap),
+		"how long Splunk may take to index records, allowed for when advancing "+
+			"the checkpoint of each query and when fetching records from it",
+	)
+}
+
+// store returns the configured checkpoint store, or nil if checkpoints are not
+// to be kept. The ConfigMap store connects to the cluster configured via
+// KUBECONFIG or the in-cluster configuration.
+func (o *checkpointOptions) store() (checkpoint.Store, error) {
+	if o.file != "" && o.configMap != "" {
+		return nil, errors.New("only one of --checkpoint-file and --checkpoint-configmap may be given")
+	}
+	if o.file != "" {
+		return checkpoint.NewFileStore(o.file), nil
+	}
+	if o.configMap == "" {
+		return nil, nil
+	}
+	client, namespace, name, err := configMapClient(o.configMap)
+	if err != nil {
+		return nil, err
+	}
+	return checkpoint.NewConfigMapStore(client, namespace, name), nil
+}
+
+// dlqOptions includes the flags for keeping dropped records in a dead-letter
+// queue
+type dlqOptions struct {
+	file      string
+	configMap string
+}
+
+func (o *dlqOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.file, "dlq-file",
+		os.Getenv("DLQ_FILE"),
+		"an NDJSON file to keep dropped records in, e.g. on a mounted PersistentVolume",
+	)
+	fs.StringVar(
+		&o.configMap, "dlq-configmap",
+		os.Getenv("DLQ_CONFIGMAP"),
+		"a ConfigMap to keep dropped records in, given as NAME or NAMESPACE/NAME. "+
+			"The oldest records are evicted when it is full, which is reported in the summary",
+	)
+}
+
+// queue returns the configured dead-letter queue, or nil if dropped records
+// are not to be kept
+func (o *dlqOptions) queue() (dlq.Queue, error) {
+	if o.file != "" && o.configMap != "" {
+		return nil, errors.New("only one of --dlq-file and --dlq-configmap may be given")
+	}
+	if o.file != "" {
+		return dlq.NewFileQueue(o.file), nil
+	}
+	if o.configMap == "" {
+		return nil, nil
+	}
+	client, namespace, name, err := configMapClient(o.configMap)
+	if err != nil {
+		return nil, err
+	}
+	return dlq.NewConfigMapQueue(client, namespace, name), nil
+}
+
+// withDeadLetters configures the runner to use the configured dead-letter
+// queue, if any
+func (o *dlqOptions) withDeadLetters(runner *bridge.Runner) (*bridge.Runner, error) {
+	queue, err := o.queue()
+	if err != nil || queue == nil {
+		return runner, err
+	}
+	return runner.WithDeadLetters(queue), nil
+}
+
+// metricsOptions includes the flags for pushing run metrics to a Prometheus
+// Pushgateway, and holds the metrics of the command
+type metricsOptions struct {
+	pushgateway string
+	job         string
+	registry    *prometheus.Registry
+	bridge      *bridge.Metrics
+}
+
+func (o *metricsOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(
+		&o.pushgateway, "pushgateway",
+		os.Getenv("PUSHGATEWAY_URL"),
+		"the URL of a Prometheus Pushgateway to push the run metrics to when done",
+	)
+	fs.StringVar(
+		&o.job, "metrics-job",
+		envOr("METRICS_JOB", "segment-bridge"),
+		"the job name to push the run metrics under",
+	)
+}
+
+// metrics returns the bridge metrics, registering them on first use
+func (o *metricsOptions) metrics() *bridge.Metrics {
+	if o.bridge == nil {
+		o.registry = prometheus.NewRegistry()
+		o.bridge = bridge.NewMetrics(o.registry)
+	}
+	return o.bridge
+}
+
+// push pushes the metrics to the configured Pushgateway, if any. Failures are
+// reported but do not fail the command, whose outcome is part of the metrics.
+// The metrics are added to the ones pushed before rather than replacing them,
+// so the time of the last successful run is kept when a run fails.
+func (o *metricsOptions) push(ctx context.Context) {
+	if o.pushgateway == "" {
+		return
+	}
+	o.metrics()
+	// Push even if the command was interrupted, so the failure is recorded
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	if err := push.New(o.pushgateway, o.job).Gatherer(o.registry).AddContext(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to push metrics: %v\n", err)
+	}
+}
+
+// serve serves the metrics over HTTP on the given address under /metrics
+// until the context is done
+func (o *metricsOptions) serve(ctx context.Context, addr string) error {
+	o.metrics()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(o.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// kubeClientConfig returns the configuration for connecting to a cluster
+// using the given kubeconfig file. If no file is given, KUBECONFIG or the
+// in-cluster configuration is used.
+func kubeClientConfig(kubeconfig string) clientcmd.ClientConfig {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+}
+
+// configMapClient resolves a ConfigMap reference given as NAME or
+// NAMESPACE/NAME and returns a client for the cluster configured via
+// KUBECONFIG or the in-cluster configuration. The namespace defaults to the
+// one of the current context.
+func configMapClient(ref string) (client kubernetes.Interface, namespace, name string, err error) {
+	clientConfig := kubeClientConfig("")
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found {
+		name = namespace
+		if namespace, _, err = clientConfig.Namespace(); err != nil {
+			return nil, "", "", err
+		}
+	}
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", "", err
+	}
+	client, err = kubernetes.NewForConfig(restConfig)
+	return client, namespace, name, err
+}
+
+func envBoolOr(name string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(name)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func envDurationOr(name string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return value
+	}
+	return defaultValue
+}
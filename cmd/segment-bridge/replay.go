@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/archive"
+	"github.com/redhat-appstudio/segment-bridge.git/bridge"
+)
+
+func replayCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var segmentOpts segmentOptions
+	var sinkOpts sinkOptions
+	var metricsOpts metricsOptions
+	segmentOpts.register(fs)
+	sinkOpts.register(fs)
+	metricsOpts.register(fs)
+	fromArchive := fs.String(
+		"from-archive", "",
+		"the s3://BUCKET/PREFIX location of the archive to re-send events from",
+	)
+	var filter archive.Filter
+	fs.StringVar(&filter.Since, "since", "", "the earliest event date to re-send, as YYYY-MM-DD")
+	fs.StringVar(&filter.Until, "until", "", "the latest event date to re-send, as YYYY-MM-DD")
+	fs.StringVar(&filter.Query, "query", "", "the title of the query to re-send the events of")
+	fs.StringVar(&filter.RunID, "run", "", "the ID of the archived run to re-send the events of")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *fromArchive == "" {
+		return errors.New("--from-archive must be specified")
+	}
+	for _, date := range []string{filter.Since, filter.Until} {
+		if _, err := time.Parse(time.DateOnly, date); date != "" && err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date)
+		}
+	}
+	source, err := sinkOpts.archive.archive(*fromArchive, nil)
+	if err != nil {
+		return err
+	}
+	// The replayed events are not archived again
+	destination, err := sinkOpts.destination(&segmentOpts)
+	if err != nil {
+		return err
+	}
+	results, err := source.Replay(ctx, destination, filter)
+	err = errors.Join(err, sinkOpts.close())
+
+	summary := bridge.Summary{}
+	for _, result := range results {
+		summary.Queries = append(summary.Queries, bridge.QueryResult{
+			Title:    result.Query,
+			Fetched:  result.Events,
+			Rejected: len(result.Stats.Rejected),
+			Sent:     result.Stats.Events,
+			Batches:  result.Stats.Batches,
+			Bytes:    result.Stats.Bytes,
+			Statuses: result.Stats.Statuses,
+			Err:      result.Err,
+		})
+		err = errors.Join(err, result.Err)
+	}
+	metricsOpts.metrics().ObserveSummary(summary)
+	metricsOpts.metrics().ObserveRun(time.Now(), err)
+	defer metricsOpts.push(ctx)
+	if writeErr := summary.Write(sinkOpts.summaryOutput()); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/bridge"
+)
+
+func replayDLQCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay-dlq", flag.ExitOnError)
+	var segmentOpts segmentOptions
+	var sinkOpts sinkOptions
+	var mapOpts mapOptions
+	var dlqOpts dlqOptions
+	var metricsOpts metricsOptions
+	segmentOpts.register(fs)
+	sinkOpts.register(fs)
+	mapOpts.register(fs)
+	dlqOpts.register(fs)
+	metricsOpts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	queue, err := dlqOpts.queue()
+	if err != nil {
+		return err
+	}
+	if queue == nil {
+		return errors.New("--dlq-file or --dlq-configmap must be specified")
+	}
+	transformer, err := mapOpts.transformer(ctx)
+	if err != nil {
+		return err
+	}
+	destination, err := sinkOpts.sink(&segmentOpts)
+	if err != nil {
+		return err
+	}
+	result := bridge.NewRunner(nil, transformer, destination).Replay(ctx, queue)
+	result.Err = errors.Join(result.Err, sinkOpts.close())
+	summary := bridge.Summary{Queries: []bridge.QueryResult{result}}
+	metricsOpts.metrics().ObserveSummary(summary)
+	metricsOpts.metrics().ObserveRun(time.Now(), result.Err)
+	defer metricsOpts.push(ctx)
+	if err := summary.Write(sinkOpts.summaryOutput()); err != nil {
+		return err
+	}
+	return result.Err
+}
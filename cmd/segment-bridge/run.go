@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/bridge"
+	"github.com/redhat-appstudio/segment-bridge.git/checkpoint"
+	"github.com/redhat-appstudio/segment-bridge.git/queryprint"
+)
+
+func runCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	var splunkOpts splunkOptions
+	var segmentOpts segmentOptions
+	var sinkOpts sinkOptions
+	var mapOpts mapOptions
+	var checkpointOpts checkpointOptions
+	var dlqOpts dlqOptions
+	var metricsOpts metricsOptions
+	var retryOpts retryOptions
+	splunkOpts.register(fs)
+	segmentOpts.register(fs)
+	sinkOpts.register(fs)
+	mapOpts.register(fs)
+	checkpointOpts.register(fs)
+	dlqOpts.register(fs)
+	metricsOpts.register(fs)
+	retryOpts.register(fs)
+	earliestTime := fs.String(
+		"earliest", envOr("QUERY_EARLIEST_TIME", "-4hours"),
+		"a Splunk time string specifying the earliest time to retrieve records "+
+			"from for queries that have no checkpoint",
+	)
+	latestTime := fs.String(
+		"latest", envOr("QUERY_LATEST_TIME", "-0hours"),
+		"a Splunk time string specifying the latest time to retrieve records from",
+	)
+	parallelism := fs.Int(
+		"parallelism", bridge.DefaultParallelism,
+		"how many queries to process concurrently",
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	retryOpts.apply(&splunkOpts, &segmentOpts, &sinkOpts)
+
+	transformer, err := mapOpts.transformer(ctx)
+	if err != nil {
+		return err
+	}
+	store, err := checkpointOpts.store()
+	if err != nil {
+		return err
+	}
+	queries, err := splunkOpts.queries()
+	if err != nil {
+		return err
+	}
+	destination, err := sinkOpts.sink(&segmentOpts)
+	if err != nil {
+		return err
+	}
+	runner, err := dlqOpts.withDeadLetters(
+		bridge.NewRunner(splunkOpts.client(), transformer, destination).
+			WithParallelism(*parallelism),
+	)
+	if err != nil {
+		return err
+	}
+	run := &incrementalRun{
+		runner:       runner,
+		store:        store,
+		queries:      queries,
+		overlap:      checkpointOpts.overlap,
+		earliestTime: *earliestTime,
+		latestTime:   *latestTime,
+		metrics:      metricsOpts.metrics(),
+	}
+	defer metricsOpts.push(ctx)
+	err = run.run(ctx, sinkOpts.summaryOutput())
+	return errors.Join(err, sinkOpts.close())
+}
+
+// incrementalRun runs the queries from their checkpoints, if a checkpoint
+// store is given, and advances the checkpoints when done
+type incrementalRun struct {
+	runner       *bridge.Runner
+	store        checkpoint.Store
+	queries      []queryprint.QueryDesc
+	overlap      time.Duration
+	earliestTime string
+	latestTime   string
+	metrics      *bridge.Metrics
+}
+
+// run runs the queries once, writes a summary to the given writer and records
+// the results in the metrics
+func (r *incrementalRun) run(ctx context.Context, out io.Writer) (err error) {
+	defer func() { r.metrics.ObserveRun(time.Now(), err) }()
+	return r.runOnce(ctx, out)
+}
+
+func (r *incrementalRun) runOnce(ctx context.Context, out io.Writer) error {
+	checkpoints := checkpoint.Checkpoints{}
+	if r.store != nil {
+		var err error
+		if checkpoints, err = r.store.Load(ctx); err != nil {
+			return fmt.Errorf("failed to load checkpoints: %w", err)
+		}
+	}
+	// The window end is pinned so the checkpoints of successful queries can
+	// be advanced to it even if they found no records. Latest times that
+	// cannot be resolved are passed on to Splunk as given.
+	latestTime := r.latestTime
+	windowEnd, err := checkpoint.ResolveSplunkTime(r.latestTime, time.Now())
+	if err == nil {
+		latestTime = checkpoint.FormatSplunkTime(windowEnd)
+	}
+	jobs := make([]bridge.Job, len(r.queries))
+	for i, query := range r.queries {
+		jobs[i] = bridge.Job{
+			QueryDesc:    query,
+			EarliestTime: checkpoints.EarliestTime(query.Title, r.overlap, r.earliestTime),
+			LatestTime:   latestTime,
+		}
+	}
+	summary := r.runner.RunJobs(ctx, jobs)
+	r.metrics.ObserveSummary(summary)
+	if err := summary.Write(out); err != nil {
+		return err
+	}
+
+	// Only advance the checkpoints of queries that were fully processed, so
+	// failed queries are retried from the same point on the next run. The
+	// events they handed to the sink may have been in a batch that failed,
+	// so their timestamps cannot be relied on. Successful queries advance to
+	// the window end, less the overlap allowed for indexing lag, or to their
+	// latest event if the window end is not known.
+	for _, query := range summary.Queries {
+		if query.Err == nil {
+			if windowEnd.IsZero() {
+				checkpoints.Advance(query.Title, query.LatestTimestamp)
+			} else {
+				checkpoints.Complete(query.Title, windowEnd, r.overlap)
+			}
+			if end, ok := checkpoints[query.Title]; ok {
+				r.metrics.ObserveWindowEnd(query.Title, end)
+			}
+		}
+	}
+	if r.store != nil {
+		if err := r.store.Save(ctx, checkpoints); err != nil {
+			return fmt.Errorf("failed to save checkpoints: %w", err)
+		}
+	}
+	if summary.Failed() {
+		return errors.New("some queries failed")
+	}
+	return nil
+}
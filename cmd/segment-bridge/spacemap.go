@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spaces"
+	"k8s.io/client-go/dynamic"
+)
+
+func spaceMapCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("space-map", flag.ExitOnError)
+	kubeconfig := fs.String(
+		"kubeconfig", os.Getenv("KUBECONFIG_SRC"),
+		"a kubeconfig file for connecting to the host cluster to read Spaces and "+
+			"SpaceBindings from (default KUBECONFIG or the in-cluster configuration)",
+	)
+	namespace := fs.String(
+		"namespace", envOr("SPACE_NAMESPACE", spaces.DefaultNamespace),
+		"the namespace to read Spaces and SpaceBindings from",
+	)
+	pageSize := fs.Int64(
+		"page-size", spaces.DefaultPageSize,
+		"how many objects to fetch per API call",
+	)
+	configMap := fs.String(
+		"configmap", os.Getenv("SPACE_MAP_CONFIGMAP"),
+		"a ConfigMap to write the map to, given as NAME or NAMESPACE/NAME, in the cluster "+
+			"configured via KUBECONFIG or the in-cluster configuration. If not given, "+
+			"the map is written to the standard output.",
+	)
+	var historyOpts historyOptions
+	historyOpts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	restConfig, err := kubeClientConfig(*kubeconfig).ClientConfig()
+	if err != nil {
+		return err
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	spaceMap, err := spaces.NewBuilder(client).
+		WithNamespace(*namespace).
+		WithPageSize(*pageSize).
+		Build(ctx)
+	if err != nil {
+		return err
+	}
+	if err := historyOpts.record(ctx, nil, spaceMap.Workspaces()); err != nil {
+		return err
+	}
+	if *configMap == "" {
+		return spaceMap.WriteJSON(os.Stdout)
+	}
+	cmClient, cmNamespace, cmName, err := configMapClient(*configMap)
+	if err != nil {
+		return err
+	}
+	return spaces.WriteConfigMap(ctx, cmClient, cmNamespace, cmName, spaceMap)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/segment"
+	uidmap "github.com/redhat-appstudio/segment-bridge.git/uid_map"
+	"k8s.io/client-go/dynamic"
+)
+
+func uidMapCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("uid-map", flag.ExitOnError)
+	kubeconfig := fs.String(
+		"kubeconfig", os.Getenv("KUBECONFIG_SRC"),
+		"a kubeconfig file for connecting to the host cluster to read UserSignups from "+
+			"(default KUBECONFIG or the in-cluster configuration)",
+	)
+	namespace := fs.String(
+		"namespace", envOr("USERSIGNUP_NAMESPACE", uidmap.DefaultNamespace),
+		"the namespace to read UserSignups from",
+	)
+	pageSize := fs.Int64(
+		"page-size", uidmap.DefaultPageSize,
+		"how many UserSignups to fetch per API call",
+	)
+	configMap := fs.String(
+		"configmap", os.Getenv("UID_MAP_CONFIGMAP"),
+		"a ConfigMap to write the map to, given as NAME or NAMESPACE/NAME, in the cluster "+
+			"configured via KUBECONFIG or the in-cluster configuration. If not given, "+
+			"the map is written to the standard output.",
+	)
+	identify := fs.Bool(
+		"identify", envBoolOr("SEGMENT_IDENTIFY", false),
+		"send Segment identify events for the users whose traits changed since the "+
+			"traits were last stored in the ConfigMap given with --configmap",
+	)
+	traits := fs.String(
+		"traits", envOr("UID_MAP_TRAITS", strings.Join(uidmap.DefaultTraits, ",")),
+		"the user traits to send with identify events, separated by spaces or commas. "+
+			"Known traits: "+strings.Join(knownTraits(), ", "),
+	)
+	var segmentOpts segmentOptions
+	var historyOpts historyOptions
+	segmentOpts.register(fs)
+	historyOpts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var traitNames []string
+	if *identify {
+		// The stored traits keep identify events from being sent for every
+		// user on every run
+		if *configMap == "" {
+			return errors.New("--configmap must be given with --identify")
+		}
+		traitNames = splitList(*traits)
+		if err := uidmap.CheckTraits(traitNames); err != nil {
+			return err
+		}
+	}
+
+	restConfig, err := kubeClientConfig(*kubeconfig).ClientConfig()
+	if err != nil {
+		return err
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	result, err := uidmap.NewBuilder(client).
+		WithNamespace(*namespace).
+		WithPageSize(*pageSize).
+		WithTraits(traitNames...).
+		Build(ctx)
+	if err != nil {
+		return err
+	}
+	result.WriteReport(os.Stderr)
+	if err := historyOpts.record(ctx, result.UIDs, nil); err != nil {
+		return err
+	}
+	if *configMap == "" {
+		return result.WriteJSON(os.Stdout)
+	}
+	cmClient, cmNamespace, cmName, err := configMapClient(*configMap)
+	if err != nil {
+		return err
+	}
+	if err := uidmap.WriteConfigMap(ctx, cmClient, cmNamespace, cmName, result.UIDs); err != nil {
+		return err
+	}
+	if !*identify {
+		return nil
+	}
+	previous, err := uidmap.ReadConfigMapTraits(ctx, cmClient, cmNamespace, cmName)
+	if err != nil {
+		return err
+	}
+	events := uidmap.IdentifyEvents(uidmap.ChangedTraits(result.Traits, previous), time.Now())
+	rejected, err := sendEvents(ctx, segmentOpts.uploader(), "identify", events)
+	if err != nil {
+		return err
+	}
+	// The traits are only stored once sent, so a failed run sends them again,
+	// and the users whose events were rejected keep their previous traits so
+	// they are sent again too
+	stored := uidmap.KeepPreviousTraits(result.Traits, previous, rejectedUserIDs(rejected))
+	return uidmap.WriteConfigMapTraits(ctx, cmClient, cmNamespace, cmName, stored)
+}
+
+// rejectedUserIDs returns the user IDs of the given rejected events
+func rejectedUserIDs(rejected []*segment.EventError) []string {
+	var uids []string
+	for _, eventErr := range rejected {
+		var event struct {
+			UserID string `json:"userId"`
+		}
+		if json.Unmarshal(eventErr.Event, &event) == nil && event.UserID != "" {
+			uids = append(uids, event.UserID)
+		}
+	}
+	return uids
+}
+
+// knownTraits returns the sorted names of the user traits uid-map can send
+func knownTraits() []string {
+	names := make([]string, 0, len(uidmap.Traits))
+	for name := range uidmap.Traits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/bridge"
+	"github.com/redhat-appstudio/segment-bridge.git/identity"
+	"github.com/redhat-appstudio/segment-bridge.git/spaces"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	uidmap "github.com/redhat-appstudio/segment-bridge.git/uid_map"
+	wsmap "github.com/redhat-appstudio/segment-bridge.git/ws_map"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func watchCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	var splunkOpts splunkOptions
+	var segmentOpts segmentOptions
+	var sinkOpts sinkOptions
+	var checkpointOpts checkpointOptions
+	var dlqOpts dlqOptions
+	var metricsOpts metricsOptions
+	splunkOpts.register(fs)
+	segmentOpts.register(fs)
+	sinkOpts.register(fs)
+	checkpointOpts.register(fs)
+	dlqOpts.register(fs)
+	earliestTime := fs.String(
+		"earliest", envOr("QUERY_EARLIEST_TIME", "-4hours"),
+		"a Splunk time string specifying the earliest time to retrieve records "+
+			"from for queries that have no checkpoint",
+	)
+	latestTime := fs.String(
+		"latest", envOr("QUERY_LATEST_TIME", "-0hours"),
+		"a Splunk time string specifying the latest time to retrieve records from",
+	)
+	parallelism := fs.Int(
+		"parallelism", bridge.DefaultParallelism,
+		"how many queries to process concurrently",
+	)
+	interval := fs.Duration(
+		"interval", envDurationOr("WATCH_INTERVAL", 15*time.Minute),
+		"how often to fetch, transform and upload user journey events",
+	)
+	kubeconfig := fs.String(
+		"kubeconfig", os.Getenv("KUBECONFIG_SRC"),
+		"a kubeconfig file for connecting to the host and member clusters (default KUBECONFIG)",
+	)
+	hostContext := fs.String(
+		"host-context", os.Getenv("HOST_CONTEXT"),
+		"the kubeconfig context of the host cluster to watch UserSignups in "+
+			"(default the current context)",
+	)
+	signupNamespace := fs.String(
+		"usersignup-namespace", envOr("USERSIGNUP_NAMESPACE", uidmap.DefaultNamespace),
+		"the namespace to watch UserSignups in",
+	)
+	watchSpaces := fs.Bool(
+		"spaces", envBoolOr("WATCH_SPACES", false),
+		"watch Spaces and SpaceBindings on the host cluster, so events in shared workspaces "+
+			"are attributed to the user who acted and record their role in the workspace",
+	)
+	spaceNamespace := fs.String(
+		"space-namespace", envOr("SPACE_NAMESPACE", spaces.DefaultNamespace),
+		"the namespace to watch Spaces and SpaceBindings in",
+	)
+	contexts := fs.String(
+		"contexts", os.Getenv("CONTEXTS"),
+		"the kubeconfig contexts of the member clusters to watch, separated by spaces or commas",
+	)
+	clusters := fs.String(
+		"clusters", os.Getenv("WS_MAP_CLUSTERS"),
+		"the URLs or kubeconfig cluster names of the member clusters to watch, separated by "+
+			"spaces or commas",
+	)
+	uidMapConfigMap := fs.String(
+		"uid-map-configmap", os.Getenv("UID_MAP_CONFIGMAP"),
+		"a ConfigMap to persist the UID map to, given as NAME or NAMESPACE/NAME",
+	)
+	wsMapConfigMap := fs.String(
+		"ws-map-configmap", os.Getenv("WS_MAP_CONFIGMAP"),
+		"a ConfigMap to persist the workspace map to, given as NAME or NAMESPACE/NAME",
+	)
+	spaceMapConfigMap := fs.String(
+		"space-map-configmap", os.Getenv("SPACE_MAP_CONFIGMAP"),
+		"a ConfigMap to persist the space map to, given as NAME or NAMESPACE/NAME, "+
+			"when watching Spaces",
+	)
+	metricsAddr := fs.String(
+		"metrics-addr", os.Getenv("METRICS_ADDR"),
+		"an address such as :8080 to serve Prometheus metrics about the runs on, under /metrics",
+	)
+	persistInterval := fs.Duration(
+		"persist-interval", identity.DefaultPersistInterval,
+		"how often to check whether the maps changed and need to be persisted",
+	)
+	var historyOpts historyOptions
+	historyOpts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if *persistInterval <= 0 {
+		return errors.New("--persist-interval must be positive")
+	}
+
+	contextNames, clusterURLs := splitList(*contexts), splitList(*clusters)
+	if len(contextNames) == 0 && len(clusterURLs) == 0 {
+		return fmt.Errorf("--contexts or --clusters must be specified")
+	}
+	rawConfig, err := kubeClientConfig(*kubeconfig).RawConfig()
+	if err != nil {
+		return err
+	}
+	members, err := wsmap.ClustersFromConfig(&rawConfig, contextNames, clusterURLs)
+	if err != nil {
+		return err
+	}
+	hostConfig, err := clientcmd.NewNonInteractiveClientConfig(
+		rawConfig, *hostContext, &clientcmd.ConfigOverrides{}, nil,
+	).ClientConfig()
+	if err != nil {
+		return err
+	}
+	signupClient, err := dynamic.NewForConfig(hostConfig)
+	if err != nil {
+		return err
+	}
+
+	maps := identity.NewLiveMaps()
+	watcher := identity.NewWatcher(maps).
+		WithUserSignups(signupClient, *signupNamespace).
+		WithClusters(members...).
+		WithLog(os.Stderr)
+	if *watchSpaces {
+		watcher.WithSpaces(signupClient, *spaceNamespace)
+		if *spaceMapConfigMap != "" {
+			client, namespace, name, err := configMapClient(*spaceMapConfigMap)
+			if err != nil {
+				return err
+			}
+			watcher.WithSpaceMapConfigMap(client, namespace, name)
+		}
+	}
+	if *uidMapConfigMap != "" {
+		client, namespace, name, err := configMapClient(*uidMapConfigMap)
+		if err != nil {
+			return err
+		}
+		watcher.WithUIDMapConfigMap(client, namespace, name)
+	}
+	if *wsMapConfigMap != "" {
+		client, namespace, name, err := configMapClient(*wsMapConfigMap)
+		if err != nil {
+			return err
+		}
+		watcher.WithWSMapConfigMap(client, namespace, name)
+	}
+
+	historyStore, err := historyOpts.store()
+	if err != nil {
+		return err
+	}
+	if historyStore != nil {
+		watcher.WithHistoryStore(historyStore)
+	}
+	resolver, err := historyOpts.resolver(ctx, maps)
+	if err != nil {
+		return err
+	}
+
+	store, err := checkpointOpts.store()
+	if err != nil {
+		return err
+	}
+	queries, err := splunkOpts.queries()
+	if err != nil {
+		return err
+	}
+	transformer := transform.NewTransformer(resolver)
+	if *watchSpaces {
+		transformer.WithMemberships(maps)
+	}
+	destination, err := sinkOpts.sink(&segmentOpts)
+	if err != nil {
+		return err
+	}
+	runner, err := dlqOpts.withDeadLetters(
+		bridge.NewRunner(splunkOpts.client(), transformer, destination).
+			WithParallelism(*parallelism),
+	)
+	if err != nil {
+		return err
+	}
+	run := &incrementalRun{
+		runner:       runner,
+		store:        store,
+		queries:      queries,
+		overlap:      checkpointOpts.overlap,
+		earliestTime: *earliestTime,
+		latestTime:   *latestTime,
+		metrics:      metricsOpts.metrics().WithRunCounts(metricsOpts.registry),
+	}
+
+	// Clusters that could not be listed in time keep being retried in the
+	// background, so we only report them
+	if err := watcher.Start(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Watching identities: %v\n", err)
+	}
+	if *metricsAddr != "" {
+		go func() {
+			if err := metricsOpts.serve(ctx, *metricsAddr); err != nil {
+				fmt.Fprintf(os.Stderr, "Serving metrics: %v\n", err)
+			}
+		}()
+	}
+	persisted := make(chan struct{})
+	go func() {
+		defer close(persisted)
+		watcher.Persist(ctx, *persistInterval)
+	}()
+	defer func() { <-persisted }()
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		if err := run.run(ctx, sinkOpts.summaryOutput()); err != nil {
+			fmt.Fprintf(os.Stderr, "Run failed: %v\n", err)
+		}
+		// Closing the sink ends the run in sinks that keep per run state,
+		// such as the archive manifests
+		if err := sinkOpts.close(); err != nil {
+			fmt.Fprintf(os.Stderr, "Closing the sink: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
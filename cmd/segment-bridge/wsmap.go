@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/segment"
+	"github.com/redhat-appstudio/segment-bridge.git/spaces"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	uidmap "github.com/redhat-appstudio/segment-bridge.git/uid_map"
+	wsmap "github.com/redhat-appstudio/segment-bridge.git/ws_map"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func wsMapCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("ws-map", flag.ExitOnError)
+	kubeconfig := fs.String(
+		"kubeconfig", os.Getenv("KUBECONFIG_SRC"),
+		"a kubeconfig file for connecting to the member clusters to read namespaces from "+
+			"(default KUBECONFIG)",
+	)
+	contexts := fs.String(
+		"contexts", os.Getenv("CONTEXTS"),
+		"the kubeconfig contexts of the member clusters to read, separated by spaces or commas",
+	)
+	clusters := fs.String(
+		"clusters", os.Getenv("WS_MAP_CLUSTERS"),
+		"the URLs or kubeconfig cluster names of the member clusters to read, separated by "+
+			"spaces or commas. The kubeconfig must include a context for each cluster.",
+	)
+	configMap := fs.String(
+		"configmap", os.Getenv("WS_MAP_CONFIGMAP"),
+		"a ConfigMap to write the map to, given as NAME or NAMESPACE/NAME, in the cluster "+
+			"configured via KUBECONFIG or the in-cluster configuration. If not given, "+
+			"the map is written to the standard output.",
+	)
+	group := fs.Bool(
+		"group", envBoolOr("SEGMENT_GROUP", false),
+		"send Segment group events associating users with their workspaces, for the "+
+			"workspaces whose traits or members changed since the groups were last stored "+
+			"in the ConfigMap",
+	)
+	hostContext := fs.String(
+		"host-context", os.Getenv("HOST_CONTEXT"),
+		"the kubeconfig context of the host cluster to read Spaces and SpaceBindings from "+
+			"for group events. If not given, workspace owners are the only group members.",
+	)
+	spaceNamespace := fs.String(
+		"space-namespace", envOr("SPACE_NAMESPACE", spaces.DefaultNamespace),
+		"the namespace to read Spaces and SpaceBindings from",
+	)
+	uidMapFile := fs.String(
+		"uid-map", os.Getenv("UID_MAP_FILE"),
+		"a JSON file mapping cluster usernames to SSO user IDs, for group events",
+	)
+	uidMapConfigMap := fs.String(
+		"uid-map-configmap", os.Getenv("UID_MAP_CONFIGMAP"),
+		"a ConfigMap to read the UID map from for group events, given as NAME or NAMESPACE/NAME",
+	)
+	var segmentOpts segmentOptions
+	var historyOpts historyOptions
+	segmentOpts.register(fs)
+	historyOpts.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	contextNames, clusterURLs := splitList(*contexts), splitList(*clusters)
+	if len(contextNames) == 0 && len(clusterURLs) == 0 {
+		return fmt.Errorf("--contexts or --clusters must be specified")
+	}
+	if *group && (*uidMapFile == "") == (*uidMapConfigMap == "") {
+		return errors.New("--group requires one of --uid-map and --uid-map-configmap")
+	}
+	rawConfig, err := kubeClientConfig(*kubeconfig).RawConfig()
+	if err != nil {
+		return err
+	}
+	sources, err := wsmap.ClustersFromConfig(&rawConfig, contextNames, clusterURLs)
+	if err != nil {
+		return err
+	}
+	result := wsmap.NewBuilder(sources...).Build(ctx)
+	result.WriteReport(os.Stderr)
+	// Record only the namespaces that were actually seen in this run
+	if err := historyOpts.record(ctx, nil, result.Workspaces()); err != nil {
+		return err
+	}
+	if *configMap == "" {
+		err = result.WriteJSON(os.Stdout)
+	} else {
+		err = writeWSMapConfigMap(ctx, *configMap, result)
+	}
+	if err != nil {
+		return err
+	}
+	if *group {
+		uids, err := loadUIDMap(ctx, *uidMapFile, *uidMapConfigMap)
+		if err != nil {
+			return err
+		}
+		var spaceList spaces.Map
+		if *hostContext != "" {
+			if spaceList, err = readSpaces(ctx, rawConfig, *hostContext, *spaceNamespace); err != nil {
+				return err
+			}
+		}
+		groups := spaces.Resolve(spaces.Groups(result.Entries, spaceList), uids)
+		if err := sendGroups(ctx, segmentOpts.uploader(), *configMap, groups, uids); err != nil {
+			return err
+		}
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("failed to read %d of %d clusters", len(result.Errors), len(sources))
+	}
+	return nil
+}
+
+// writeWSMapConfigMap writes the workspace map to the given ConfigMap,
+// keeping the entries previously read from clusters that failed this time
+func writeWSMapConfigMap(ctx context.Context, ref string, result *wsmap.Result) error {
+	client, namespace, name, err := configMapClient(ref)
+	if err != nil {
+		return err
+	}
+	previous, err := wsmap.ReadConfigMapEntries(ctx, client, namespace, name)
+	if err != nil {
+		return err
+	}
+	result.KeepPrevious(previous)
+	return wsmap.WriteConfigMap(ctx, client, namespace, name, result)
+}
+
+// loadUIDMap loads the UID map from the given file, or from the given
+// ConfigMap if no file is given
+func loadUIDMap(ctx context.Context, file, configMap string) (map[string]string, error) {
+	if file != "" {
+		maps, err := transform.LoadStaticMaps(file, "")
+		if err != nil {
+			return nil, err
+		}
+		return maps.UIDs, nil
+	}
+	client, namespace, name, err := configMapClient(configMap)
+	if err != nil {
+		return nil, err
+	}
+	return uidmap.ReadConfigMap(ctx, client, namespace, name)
+}
+
+// readSpaces reads the Spaces and SpaceBindings of the host cluster with the
+// given kubeconfig context
+func readSpaces(
+	ctx context.Context, rawConfig clientcmdapi.Config, hostContext, namespace string,
+) (spaces.Map, error) {
+	hostConfig, err := clientcmd.NewNonInteractiveClientConfig(
+		rawConfig, hostContext, &clientcmd.ConfigOverrides{}, nil,
+	).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(hostConfig)
+	if err != nil {
+		return nil, err
+	}
+	return spaces.NewBuilder(client).WithNamespace(namespace).Build(ctx)
+}
+
+// sendGroups sends Segment group events for the given resolved groups. When a
+// ConfigMap is given, only the groups that changed since they were last
+// stored in it are sent, and the groups are stored once sent.
+func sendGroups(
+	ctx context.Context, uploader *segment.BatchUploader, ref string,
+	groups map[string]spaces.Group, uids map[string]string,
+) error {
+	if ref == "" {
+		_, err := sendEvents(ctx, uploader, "group", spaces.GroupEvents(groups, uids, time.Now()))
+		return err
+	}
+	client, namespace, name, err := configMapClient(ref)
+	if err != nil {
+		return err
+	}
+	previous, err := spaces.ReadConfigMapGroups(ctx, client, namespace, name)
+	if err != nil {
+		return err
+	}
+	events := spaces.GroupEvents(spaces.ChangedGroups(groups, previous), uids, time.Now())
+	if _, err := sendEvents(ctx, uploader, "group", events); err != nil {
+		return err
+	}
+	return spaces.WriteConfigMapGroups(ctx, client, namespace, name, groups)
+}
+
+// splitList splits a list given as space or comma separated values
+func splitList(list string) []string {
+	return strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
@@ -0,0 +1,89 @@
+/*
+Segment-upload reads a stream of Segment event JSON records from STDIN (one
+per-line) and uploads them to the Segment batch API in batches that fit the API
+size limits. Events that are too large to be sent are reported to STDERR and
+skipped.
+
+Usage:
+
+	segment-upload [flags]
+
+The flags are:
+
+	--api URL
+		The Segment batch API URL to use. Defaults to $SEGMENT_BATCH_API
+		or to the public Segment API.
+	--batch-size BYTES
+		The maximum size of each batch call payload. Defaults to
+		$SEGMENT_BATCH_DATA_SIZE or to 490KB.
+	--retries N
+		How many times to retry failed batch calls. Defaults to
+		$SEGMENT_RETRIES or to 3.
+
+The Segment write key is read from the SEGMENT_WRITE_KEY environment variable.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/redhat-appstudio/segment-bridge.git/segment"
+)
+
+var apiURL = flag.String(
+	"api",
+	envOr("SEGMENT_BATCH_API", segment.DefaultBatchAPI),
+	"the Segment batch API URL",
+)
+var batchSize = flag.Int(
+	"batch-size",
+	envIntOr("SEGMENT_BATCH_DATA_SIZE", segment.DefaultBatchDataSize),
+	"the maximum size in bytes of each batch call payload",
+)
+var retries = flag.Int(
+	"retries",
+	envIntOr("SEGMENT_RETRIES", segment.DefaultRetries),
+	"how many times to retry failed batch calls",
+)
+
+func main() {
+	flag.Parse()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	uploader := segment.NewBatchUploader(*apiURL).
+		WithWriteKey(os.Getenv("SEGMENT_WRITE_KEY")).
+		WithBatchSize(*batchSize).
+		WithRetries(*retries)
+	stats, err := uploader.Upload(ctx, os.Stdin)
+	for _, rejected := range stats.Rejected {
+		fmt.Fprintf(os.Stderr, "Skipped %v\n", rejected)
+	}
+	fmt.Fprintf(
+		os.Stderr, "Sent %d events in %d batches (%d bytes), skipped %d events\n",
+		stats.Events, stats.Batches, stats.Bytes, len(stats.Rejected),
+	)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Upload failed: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func envOr(name, defaultValue string) string {
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func envIntOr(name string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,76 @@
+// Package configmap implements reading and updating the data of K8s
+// ConfigMaps the bridge keeps its state in
+package configmap
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// Read returns the data of the ConfigMap with the given namespace and name.
+// A missing ConfigMap yields empty data.
+func Read(ctx context.Context, client kubernetes.Interface, namespace, name string) (map[string]string, error) {
+	cm, err := client.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if cm.Data == nil {
+		return map[string]string{}, nil
+	}
+	return cm.Data, nil
+}
+
+// Update applies the given function to the data of the ConfigMap with the
+// given namespace and name, creating it if needed. Keys the function does not
+// set are left intact. Conflicting concurrent updates are retried by applying
+// the function again to the fresh data, so neither update is lost.
+func Update(
+	ctx context.Context, client kubernetes.Interface, namespace, name string,
+	update func(data map[string]string) error,
+) error {
+	configMaps := client.CoreV1().ConfigMaps(namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+		notFound := apierrors.IsNotFound(err)
+		if err != nil && !notFound {
+			return err
+		}
+		if notFound {
+			cm = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		if err = update(cm.Data); err != nil {
+			return err
+		}
+		if !notFound {
+			_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+			return err
+		}
+		_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			// Created concurrently, so retry as a conflicting update
+			return apierrors.NewConflict(corev1.Resource("configmaps"), name, err)
+		}
+		return err
+	})
+}
+
+// UpdateKeys stores the given values under their keys in the data of the
+// ConfigMap with the given namespace and name, creating it if needed
+func UpdateKeys(ctx context.Context, client kubernetes.Interface, namespace, name string, values map[string]string) error {
+	return Update(ctx, client, namespace, name, func(data map[string]string) error {
+		for key, value := range values {
+			data[key] = value
+		}
+		return nil
+	})
+}
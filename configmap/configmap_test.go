@@ -0,0 +1,61 @@
+package configmap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+
+	data, err := Read(ctx, client, "ns", "state")
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	require.NoError(t, UpdateKeys(ctx, client, "ns", "state", map[string]string{"a": "1"}))
+	require.NoError(t, UpdateKeys(ctx, client, "ns", "state", map[string]string{"b": "2"}))
+	data, err = Read(ctx, client, "ns", "state")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, data)
+}
+
+func TestUpdate_conflict(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+	require.NoError(t, UpdateKeys(ctx, client, "ns", "state", map[string]string{"count": "1"}))
+
+	conflicts := 1
+	client.PrependReactor("update", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			return false, nil, nil
+		}
+		conflicts--
+		// Simulate a concurrent update landing first
+		cm, err := client.Tracker().Get(corev1.SchemeGroupVersion.WithResource("configmaps"), "ns", "state")
+		require.NoError(t, err)
+		cm.(*corev1.ConfigMap).Data["count"] = "2"
+		require.NoError(t, client.Tracker().Update(corev1.SchemeGroupVersion.WithResource("configmaps"), cm, "ns"))
+		return true, nil, apierrors.NewConflict(corev1.Resource("configmaps"), "state", nil)
+	})
+
+	var seen []string
+	err := Update(ctx, client, "ns", "state", func(data map[string]string) error {
+		seen = append(seen, data["count"])
+		data["count"] += "+1"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, seen)
+	data, err := Read(ctx, client, "ns", "state")
+	require.NoError(t, err)
+	assert.Equal(t, "2+1", data["count"])
+}
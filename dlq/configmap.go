@@ -0,0 +1,102 @@
+package dlq
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/redhat-appstudio/segment-bridge.git/configmap"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ConfigMapKey is the ConfigMap data key entries are stored under
+	ConfigMapKey = "dlq.ndjson"
+	// DefaultMaxSize is the default maximum size in bytes of the entries
+	// stored in a ConfigMap, which keeps it below the 1MiB object size limit
+	DefaultMaxSize = 900 * 1024
+)
+
+// EvictedError is returned by ConfigMapQueue when it discarded the oldest
+// entries to make room for the updated ones. The update itself was stored.
+type EvictedError struct {
+	// Count is the number of discarded entries
+	Count int
+}
+
+func (e *EvictedError) Error() string {
+	return fmt.Sprintf("dead-letter queue is full, discarded the %d oldest entries", e.Count)
+}
+
+// ConfigMapQueue is a Queue that keeps entries in a K8s ConfigMap. Since
+// ConfigMaps are limited in size, the oldest entries are discarded when the
+// entries grow beyond the configured maximum size, which is reported with an
+// *EvictedError. Concurrent updates are retried so no entries are lost.
+type ConfigMapQueue struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	maxSize   int
+}
+
+// NewConfigMapQueue constructs a ConfigMapQueue that uses the ConfigMap with
+// the given namespace and name. The ConfigMap is created when entries are
+// first stored.
+func NewConfigMapQueue(client kubernetes.Interface, namespace, name string) *ConfigMapQueue {
+	return &ConfigMapQueue{client: client, namespace: namespace, name: name, maxSize: DefaultMaxSize}
+}
+
+// WithMaxSize sets the maximum size in bytes of the stored entries
+func (q *ConfigMapQueue) WithMaxSize(size int) *ConfigMapQueue {
+	q.maxSize = size
+	return q
+}
+
+func (q *ConfigMapQueue) Append(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return q.Update(ctx, func(stored []Entry) []Entry {
+		return appendNew(stored, entries)
+	})
+}
+
+func (q *ConfigMapQueue) Load(ctx context.Context) ([]Entry, error) {
+	data, err := configmap.Read(ctx, q.client, q.namespace, q.name)
+	if err != nil {
+		return nil, err
+	}
+	return ReadEntries(bytes.NewReader([]byte(data[ConfigMapKey])))
+}
+
+func (q *ConfigMapQueue) Update(ctx context.Context, update func([]Entry) []Entry) error {
+	var evicted int
+	err := configmap.Update(ctx, q.client, q.namespace, q.name, func(data map[string]string) error {
+		entries, err := ReadEntries(bytes.NewReader([]byte(data[ConfigMapKey])))
+		if err != nil {
+			return err
+		}
+		data[ConfigMapKey], evicted, err = q.encode(update(entries))
+		return err
+	})
+	if err == nil && evicted > 0 {
+		return &EvictedError{Count: evicted}
+	}
+	return err
+}
+
+// encode encodes the entries in NDJSON format, leaving out the oldest ones
+// as needed to fit in the maximum size, and returns how many it left out
+func (q *ConfigMapQueue) encode(entries []Entry) (string, int, error) {
+	var buf bytes.Buffer
+	if err := WriteEntries(&buf, entries); err != nil {
+		return "", 0, err
+	}
+	data := buf.Bytes()
+	evicted := 0
+	for len(data) > q.maxSize {
+		_, data, _ = bytes.Cut(data, []byte("\n"))
+		evicted++
+	}
+	return string(data), evicted, nil
+}
@@ -0,0 +1,135 @@
+// Package dlq implements a dead-letter queue for user journey records that
+// could not be turned into Segment events, and for events the sink rejected,
+// so they can be inspected and replayed once the cause of the failure is fixed
+package dlq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+)
+
+// ReasonRejected is the reason of entries for events the sink rejected
+const ReasonRejected transform.DropReason = "rejected-by-sink"
+
+// Entry is a dead-lettered record
+type Entry struct {
+	// DroppedAt is when the record was dropped
+	DroppedAt time.Time `json:"droppedAt"`
+	// Query is the title of the query that returned the record
+	Query string `json:"query,omitempty"`
+	// Reason is why the record was dropped
+	Reason transform.DropReason `json:"reason"`
+	// Detail includes more information about the specific record, such as
+	// the value that could not be mapped
+	Detail string `json:"detail,omitempty"`
+	// Result is the original Splunk search result, which is empty for
+	// events the sink rejected
+	Result json.RawMessage `json:"result,omitempty"`
+	// Event is the event the sink rejected, for records that were turned
+	// into events but could not be delivered
+	Event json.RawMessage `json:"event,omitempty"`
+}
+
+// NewEntry constructs an Entry for a record dropped due to the given error,
+// which is typically a *transform.DropError
+func NewEntry(query string, result json.RawMessage, err error) Entry {
+	entry := Entry{
+		DroppedAt: time.Now().UTC(),
+		Query:     query,
+		Reason:    transform.DropInvalidRecord,
+		Result:    result,
+	}
+	var dropErr *transform.DropError
+	if errors.As(err, &dropErr) {
+		entry.Reason = dropErr.Reason
+		entry.Detail = dropErr.Detail
+	} else if err != nil {
+		entry.Detail = err.Error()
+	}
+	return entry
+}
+
+// NewRejectedEntry constructs an Entry for an event the sink rejected, which
+// the sink Writer kept in the given error
+func NewRejectedEntry(query string, rejected *sink.EventError) Entry {
+	return Entry{
+		DroppedAt: time.Now().UTC(),
+		Query:     query,
+		Reason:    ReasonRejected,
+		Detail:    rejected.Err.Error(),
+		Event:     rejected.Event,
+	}
+}
+
+// Queue stores dead-lettered records
+type Queue interface {
+	// Append adds the given entries to the queue, skipping the ones whose
+	// record is already queued since overlapping query time ranges cause
+	// records to be fetched more than once
+	Append(ctx context.Context, entries []Entry) error
+	// Load returns all the entries in the queue
+	Load(ctx context.Context) ([]Entry, error)
+	// Update applies the given function to the entries in the queue and
+	// stores the entries it returns instead
+	Update(ctx context.Context, update func([]Entry) []Entry) error
+}
+
+// Key returns a key identifying the record or event of the entry, used for
+// matching replayed entries to the ones in the queue
+func (e Entry) Key() string {
+	return e.Query + "\x00" + string(e.Result) + "\x00" + string(e.Event)
+}
+
+// appendNew appends the entries whose key is not in the existing entries or
+// earlier in the appended ones
+func appendNew(existing, entries []Entry) []Entry {
+	seen := make(map[string]bool, len(existing))
+	for _, entry := range existing {
+		seen[entry.Key()] = true
+	}
+	for _, entry := range entries {
+		if !seen[entry.Key()] {
+			seen[entry.Key()] = true
+			existing = append(existing, entry)
+		}
+	}
+	return existing
+}
+
+// ReadEntries reads entries in NDJSON format
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid dead-letter entry in line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// WriteEntries writes entries in NDJSON format
+func WriteEntries(w io.Writer, entries []Entry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
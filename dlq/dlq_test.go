@@ -0,0 +1,146 @@
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func mkEntry(messageID string, reason transform.DropReason) Entry {
+	return Entry{
+		DroppedAt: time.Date(2023, 11, 20, 7, 59, 3, 0, time.UTC),
+		Query:     "Query",
+		Reason:    reason,
+		Result:    json.RawMessage(fmt.Sprintf(`{"messageId":%q}`, messageID)),
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantReason transform.DropReason
+		wantDetail string
+	}{
+		{
+			name:       "drop error",
+			err:        &transform.DropError{Reason: transform.DropMissingUID, Detail: "user1"},
+			wantReason: transform.DropMissingUID,
+			wantDetail: "user1",
+		},
+		{
+			name: "wrapped drop error",
+			err: fmt.Errorf(
+				"wrapped: %w", &transform.DropError{Reason: transform.DropMissingWorkspace, Detail: "ns"},
+			),
+			wantReason: transform.DropMissingWorkspace,
+			wantDetail: "ns",
+		},
+		{
+			name:       "other error",
+			err:        errors.New("unexpected end of JSON input"),
+			wantReason: transform.DropInvalidRecord,
+			wantDetail: "unexpected end of JSON input",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := NewEntry("Query", json.RawMessage(`{}`), tt.err)
+			assert.Equal(t, "Query", entry.Query)
+			assert.Equal(t, tt.wantReason, entry.Reason)
+			assert.Equal(t, tt.wantDetail, entry.Detail)
+			assert.JSONEq(t, `{}`, string(entry.Result))
+			assert.False(t, entry.DroppedAt.IsZero())
+		})
+	}
+}
+
+func TestNewRejectedEntry(t *testing.T) {
+	entry := NewRejectedEntry("Query", &sink.EventError{
+		Size:  16,
+		Err:   errors.New("event was refused"),
+		Event: []byte(`{"messageId":"m1"}`),
+	})
+	assert.Equal(t, "Query", entry.Query)
+	assert.Equal(t, ReasonRejected, entry.Reason)
+	assert.Equal(t, "event was refused", entry.Detail)
+	assert.Empty(t, entry.Result)
+	assert.JSONEq(t, `{"messageId":"m1"}`, string(entry.Event))
+	assert.NotEqual(t, mkEntry("m1", ReasonRejected).Key(), entry.Key())
+
+	var encoded strings.Builder
+	require.NoError(t, WriteEntries(&encoded, []Entry{entry}))
+	assert.NotContains(t, encoded.String(), `"result"`)
+	decoded, err := ReadEntries(strings.NewReader(encoded.String()))
+	require.NoError(t, err)
+	require.Len(t, decoded, 1)
+	assert.Equal(t, entry.Key(), decoded[0].Key())
+}
+
+func testQueue(t *testing.T, queue Queue) {
+	ctx := context.Background()
+	entries, err := queue.Load(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	m1 := mkEntry("m1", transform.DropMissingUID)
+	m2 := mkEntry("m2", transform.DropMissingWorkspace)
+	m3 := mkEntry("m3", transform.DropInvalidRecord)
+	require.NoError(t, queue.Append(ctx, []Entry{m1, m2}))
+	require.NoError(t, queue.Append(ctx, nil))
+	require.NoError(t, queue.Append(ctx, []Entry{m3, m1}))
+	entries, err = queue.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{m1, m2, m3}, entries, "already queued records are skipped")
+
+	require.NoError(t, queue.Update(ctx, func(entries []Entry) []Entry {
+		return entries[1:]
+	}))
+	entries, err = queue.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{m2, m3}, entries)
+}
+
+func TestFileQueue(t *testing.T) {
+	testQueue(t, NewFileQueue(filepath.Join(t.TempDir(), "dlq.ndjson")))
+}
+
+func TestConfigMapQueue(t *testing.T) {
+	testQueue(t, NewConfigMapQueue(fake.NewClientset(), "segment-bridge", "dlq"))
+}
+
+func TestConfigMapQueue_MaxSize(t *testing.T) {
+	ctx := context.Background()
+	m1 := mkEntry("m1", transform.DropMissingUID)
+	m2 := mkEntry("m2", transform.DropMissingUID)
+	m3 := mkEntry("m3", transform.DropMissingUID)
+	line, err := json.Marshal(m1)
+	require.NoError(t, err)
+
+	queue := NewConfigMapQueue(fake.NewClientset(), "segment-bridge", "dlq").
+		WithMaxSize(2 * (len(line) + 1))
+	require.NoError(t, queue.Append(ctx, []Entry{m1, m2}))
+	err = queue.Append(ctx, []Entry{m3})
+	var evicted *EvictedError
+	require.ErrorAs(t, err, &evicted)
+	assert.Equal(t, 1, evicted.Count)
+	entries, err := queue.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{m2, m3}, entries)
+}
+
+func TestReadEntries(t *testing.T) {
+	_, err := ReadEntries(strings.NewReader("{}\n\nnot json\n"))
+	assert.ErrorContains(t, err, "line 3")
+}
@@ -0,0 +1,88 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileQueue is a Queue that keeps entries in a local NDJSON file, such as a
+// file on a PersistentVolume when running in-cluster
+type FileQueue struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileQueue constructs a FileQueue that uses the file in the given path
+func NewFileQueue(path string) *FileQueue {
+	return &FileQueue{path: path}
+}
+
+func (q *FileQueue) Append(_ context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stored, err := q.load()
+	if err != nil {
+		return err
+	}
+	if entries = appendNew(stored, entries)[len(stored):]; len(entries) == 0 {
+		return nil
+	}
+	file, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := WriteEntries(file, entries); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (q *FileQueue) Load(_ context.Context) ([]Entry, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.load()
+}
+
+func (q *FileQueue) load() ([]Entry, error) {
+	file, err := os.Open(q.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadEntries(file)
+}
+
+// Update writes the updated entries into a temporary file and then renames it
+// over the queue file, so that a crash while writing does not lose entries
+func (q *FileQueue) Update(_ context.Context, update func([]Entry) []Entry) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	entries, err := q.load()
+	if err != nil {
+		return err
+	}
+	entries = update(entries)
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = WriteEntries(tmp, entries); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path)
+}
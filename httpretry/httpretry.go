@@ -0,0 +1,235 @@
+// Package httpretry implements the retry policy shared by the clients of the
+// Splunk and Segment APIs: exponential backoff with jitter, honouring
+// Retry-After, and a total time budget
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultRetries is how many times a failed call is retried by default
+	DefaultRetries = 3
+	// DefaultInitialBackoff is how long to wait before the first retry by
+	// default. The wait doubles with every retry.
+	DefaultInitialBackoff = time.Second
+	// DefaultMaxBackoff is the longest wait between retries by default,
+	// unless the server asks for a longer one via Retry-After
+	DefaultMaxBackoff = 30 * time.Second
+	// DefaultJitter is the fraction of each wait that is randomized by
+	// default, so clients that failed together do not retry together
+	DefaultJitter = 0.2
+)
+
+// ErrBudgetExhausted is returned for calls that are not made because the time
+// budget ran out
+var ErrBudgetExhausted = errors.New("retry time budget exhausted")
+
+// Budget limits the total time a set of calls may take, so a run that keeps
+// retrying cannot overlap the next one. Once the budget runs out no new calls
+// are made, and retries that would wait past its end are given up on. A
+// Budget can be shared by several policies and is safe for concurrent use.
+type Budget struct {
+	deadline time.Time
+}
+
+// NewBudget constructs a Budget that runs out after the given duration
+func NewBudget(d time.Duration) *Budget {
+	return &Budget{deadline: time.Now().Add(d)}
+}
+
+// Remaining returns how much time is left in the budget. A nil Budget is
+// unlimited.
+func (b *Budget) Remaining() time.Duration {
+	if b == nil {
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Until(b.deadline)
+}
+
+// Context returns a copy of the parent context that is done when the budget
+// runs out, for bounding calls that outlast their retries, such as streamed
+// responses. Its cause is then ErrBudgetExhausted. A nil Budget only makes
+// the copy cancelable.
+func (b *Budget) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	if b == nil {
+		return context.WithCancel(parent)
+	}
+	return context.WithDeadlineCause(parent, b.deadline, ErrBudgetExhausted)
+}
+
+// Policy decides which failed calls are retried and how long to wait before
+// each retry
+type Policy struct {
+	retries        int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	jitter         float64
+	throttleWait   time.Duration
+	budget         *Budget
+	// random returns a number in [0, 1) for randomizing waits
+	random func() float64
+	// sleep waits for the given duration or until the context is done
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewPolicy constructs a default Policy
+func NewPolicy() *Policy {
+	return &Policy{
+		retries:        DefaultRetries,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		jitter:         DefaultJitter,
+		random:         rand.Float64,
+		sleep:          sleep,
+	}
+}
+
+// WithRetries sets how many times a failed call is retried
+func (p *Policy) WithRetries(retries int) *Policy {
+	p.retries = retries
+	return p
+}
+
+// WithBackoff sets how long to wait before the first retry and the longest
+// wait between retries
+func (p *Policy) WithBackoff(initial, max time.Duration) *Policy {
+	p.initialBackoff = initial
+	p.maxBackoff = max
+	return p
+}
+
+// WithJitter sets the fraction of each wait, between 0 and 1, that is
+// randomized
+func (p *Policy) WithJitter(jitter float64) *Policy {
+	p.jitter = min(max(jitter, 0), 1)
+	return p
+}
+
+// WithThrottleWait sets how long to wait at least before retrying a call that
+// was rate limited with 429 Too Many Requests and no Retry-After header, for
+// APIs that document a wait rather than sending the header
+func (p *Policy) WithThrottleWait(wait time.Duration) *Policy {
+	p.throttleWait = wait
+	return p
+}
+
+// WithBudget sets a time budget shared with other calls
+func (p *Policy) WithBudget(budget *Budget) *Policy {
+	p.budget = budget
+	return p
+}
+
+// Context returns a copy of the parent context that is done when the time
+// budget of the policy runs out, as Budget.Context does
+func (p *Policy) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	return p.budget.Context(parent)
+}
+
+// Do makes a call by running the given attempt function, and runs it again
+// while it fails in a retryable way and retries are left. The response of the
+// last attempt is returned, and the caller must close its body. The bodies of
+// the responses of retried attempts are closed by Do.
+func (p *Policy) Do(ctx context.Context, attempt func() (*http.Response, error)) (*http.Response, error) {
+	return p.DoWith(ctx, Retryable, attempt)
+}
+
+// DoWith makes a call like Do, but decides which failed attempts are retried
+// with the given function rather than Retryable, for APIs whose response
+// bodies tell whether retrying can help
+func (p *Policy) DoWith(
+	ctx context.Context,
+	retryable func(context.Context, *http.Response, error) bool,
+	attempt func() (*http.Response, error),
+) (*http.Response, error) {
+	if p.budget.Remaining() <= 0 {
+		return nil, ErrBudgetExhausted
+	}
+	for retry := 0; ; retry++ {
+		resp, err := attempt()
+		if retry >= p.retries || !retryable(ctx, resp, err) {
+			return resp, err
+		}
+		wait := p.backoff(retry)
+		if resp != nil {
+			after, ok := retryAfter(resp)
+			if !ok && resp.StatusCode == http.StatusTooManyRequests {
+				after = p.throttleWait
+			}
+			wait = max(wait, after)
+		}
+		if wait >= p.budget.Remaining() {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := p.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backoff returns how long to wait before the given retry, counting from zero
+func (p *Policy) backoff(retry int) time.Duration {
+	wait := p.initialBackoff
+	for i := 0; i < retry && wait < p.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, p.maxBackoff)
+	return wait - time.Duration(p.jitter*p.random()*float64(wait))
+}
+
+// Retryable determines if a call that returned the given response or error
+// should be retried. Transport errors are retried unless the context is done,
+// and so are the HTTP statuses that indicate a transient failure or rate
+// limiting. Other statuses, such as 400 Bad Request, are permanent failures.
+func Retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	switch resp.StatusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter returns the wait the server asked for via the Retry-After
+// header, given either in seconds or as an HTTP date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
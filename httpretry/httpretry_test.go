@@ -0,0 +1,218 @@
+package httpretry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPolicy returns a policy that records its waits rather than sleeping
+func testPolicy(waits *[]time.Duration) *Policy {
+	policy := NewPolicy().WithBackoff(time.Second, 5*time.Second)
+	policy.random = func() float64 { return 0.5 }
+	policy.sleep = func(_ context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+	return policy
+}
+
+func TestPolicy_Do(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		retryAfter string
+		throttle   time.Duration
+		retries    int
+		budget     *Budget
+		wantStatus int
+		wantWaits  []time.Duration
+		wantErr    error
+	}{
+		{
+			name:       "Success",
+			statuses:   []int{200},
+			retries:    3,
+			wantStatus: 200,
+		},
+		{
+			name:       "Transient failures",
+			statuses:   []int{503, 500, 429, 200},
+			retries:    3,
+			wantStatus: 200,
+			wantWaits:  []time.Duration{900 * time.Millisecond, 1800 * time.Millisecond, 3600 * time.Millisecond},
+		},
+		{
+			name:       "Retries exhausted",
+			statuses:   []int{503, 503, 503, 503, 503, 503},
+			retries:    5,
+			wantStatus: 503,
+			wantWaits: []time.Duration{
+				900 * time.Millisecond, 1800 * time.Millisecond, 3600 * time.Millisecond,
+				4500 * time.Millisecond, 4500 * time.Millisecond,
+			},
+		},
+		{
+			name:       "Permanent failure",
+			statuses:   []int{400},
+			retries:    3,
+			wantStatus: 400,
+		},
+		{
+			name:       "Retry-After seconds",
+			statuses:   []int{429, 200},
+			retryAfter: "20",
+			retries:    3,
+			wantStatus: 200,
+			wantWaits:  []time.Duration{20 * time.Second},
+		},
+		{
+			name:       "Retry-After shorter than the backoff",
+			statuses:   []int{429, 200},
+			retryAfter: "0",
+			retries:    3,
+			wantStatus: 200,
+			wantWaits:  []time.Duration{900 * time.Millisecond},
+		},
+		{
+			name:       "Throttle wait",
+			statuses:   []int{429, 503, 200},
+			throttle:   30 * time.Second,
+			retries:    3,
+			wantStatus: 200,
+			wantWaits:  []time.Duration{30 * time.Second, 1800 * time.Millisecond},
+		},
+		{
+			name:       "Retry-After overrides the throttle wait",
+			statuses:   []int{429, 200},
+			retryAfter: "5",
+			throttle:   30 * time.Second,
+			retries:    3,
+			wantStatus: 200,
+			wantWaits:  []time.Duration{5 * time.Second},
+		},
+		{
+			name:       "Retry-After beyond the budget",
+			statuses:   []int{429, 200},
+			retryAfter: "120",
+			retries:    3,
+			budget:     NewBudget(time.Minute),
+			wantStatus: 429,
+		},
+		{
+			name:     "Budget exhausted",
+			statuses: []int{200},
+			retries:  3,
+			budget:   NewBudget(0),
+			wantErr:  ErrBudgetExhausted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.statuses[calls])
+				calls++
+			}))
+			defer server.Close()
+
+			var waits []time.Duration
+			policy := testPolicy(&waits).WithRetries(tt.retries).
+				WithThrottleWait(tt.throttle).
+				WithBudget(tt.budget)
+			resp, err := policy.Do(context.Background(), func() (*http.Response, error) {
+				return server.Client().Get(server.URL)
+			})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Equal(t, 0, calls)
+				return
+			}
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantWaits, waits)
+		})
+	}
+}
+
+func TestPolicy_Do_transportErrors(t *testing.T) {
+	var waits []time.Duration
+	calls := 0
+	errFailed := errors.New("connection refused")
+	_, err := testPolicy(&waits).WithRetries(2).Do(context.Background(), func() (*http.Response, error) {
+		calls++
+		return nil, errFailed
+	})
+	assert.ErrorIs(t, err, errFailed)
+	assert.Equal(t, 3, calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls = 0
+	_, err = testPolicy(&waits).Do(ctx, func() (*http.Response, error) {
+		calls++
+		return nil, ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+}
+
+func TestPolicy_DoWith(t *testing.T) {
+	var waits []time.Duration
+	statuses := []int{503, 429, 200}
+	calls := 0
+	notThrottled := func(ctx context.Context, resp *http.Response, err error) bool {
+		return resp.StatusCode != http.StatusTooManyRequests && Retryable(ctx, resp, err)
+	}
+	resp, err := testPolicy(&waits).DoWith(context.Background(), notThrottled, func() (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: statuses[calls-1], Body: http.NoBody}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, []time.Duration{900 * time.Millisecond}, waits)
+}
+
+func TestBudget_Context(t *testing.T) {
+	ctx, cancel := NewBudget(0).Context(context.Background())
+	defer cancel()
+	<-ctx.Done()
+	assert.ErrorIs(t, context.Cause(ctx), ErrBudgetExhausted)
+
+	ctx, cancel = (*Budget)(nil).Context(context.Background())
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	cancel()
+	assert.ErrorIs(t, context.Cause(ctx), context.Canceled)
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tt := range []struct {
+		value  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	} {
+		resp := &http.Response{Header: http.Header{}}
+		resp.Header.Set("Retry-After", tt.value)
+		wait, ok := retryAfter(resp)
+		assert.Equal(t, tt.want, wait, tt.value)
+		assert.Equal(t, tt.wantOk, ok, tt.value)
+	}
+}
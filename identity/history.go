@@ -0,0 +1,202 @@
+package identity
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+)
+
+// Span is a period of time during which a key was seen mapped to a value
+type Span struct {
+	Value     string    `json:"value"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// Timeline records the values the keys of a map had over time. The spans of
+// each key are ordered by time and do not overlap.
+type Timeline map[string][]Span
+
+// Record records that the keys of the given map were seen mapped to their
+// values at the given time. Keys missing from the map are left as they are,
+// so their last span ends when they were last seen.
+func (tl Timeline) Record(at time.Time, m map[string]string) {
+	at = at.UTC()
+	for key, value := range m {
+		spans := tl[key]
+		if n := len(spans); n > 0 && spans[n-1].Value == value && !at.Before(spans[n-1].FirstSeen) {
+			if at.After(spans[n-1].LastSeen) {
+				spans[n-1].LastSeen = at
+			}
+			continue
+		}
+		tl[key] = normalize(append(spans, Span{Value: value, FirstSeen: at, LastSeen: at}))
+	}
+}
+
+// At returns the value the given key had at the given time. That is the value
+// of the latest span that started at or before that time. Times before the
+// first span resolve to its value, since keys usually exist for a while before
+// being first seen.
+func (tl Timeline) At(key string, t time.Time) (string, bool) {
+	spans := tl[key]
+	if len(spans) == 0 {
+		return "", false
+	}
+	i := sort.Search(len(spans), func(i int) bool { return spans[i].FirstSeen.After(t) })
+	if i == 0 {
+		return spans[0].Value, true
+	}
+	return spans[i-1].Value, true
+}
+
+// Latest returns the value the given key had when it was last seen
+func (tl Timeline) Latest(key string) (string, bool) {
+	spans := tl[key]
+	if len(spans) == 0 {
+		return "", false
+	}
+	return spans[len(spans)-1].Value, true
+}
+
+// LastSeen returns when the given key was last seen, or the zero time if it
+// never was
+func (tl Timeline) LastSeen(key string) time.Time {
+	spans := tl[key]
+	if len(spans) == 0 {
+		return time.Time{}
+	}
+	return spans[len(spans)-1].LastSeen
+}
+
+// Merge adds the spans of another timeline to this one
+func (tl Timeline) Merge(other Timeline) {
+	for key, spans := range other {
+		tl[key] = normalize(append(append([]Span(nil), tl[key]...), spans...))
+	}
+}
+
+// normalize sorts spans by time and coalesces overlapping or consecutive
+// spans with the same value
+func normalize(spans []Span) []Span {
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].FirstSeen.Before(spans[j].FirstSeen)
+	})
+	var result []Span
+	for _, span := range spans {
+		if n := len(result); n > 0 && result[n-1].Value == span.Value {
+			if span.LastSeen.After(result[n-1].LastSeen) {
+				result[n-1].LastSeen = span.LastSeen
+			}
+			continue
+		}
+		result = append(result, span)
+	}
+	return result
+}
+
+// History records the identity maps over time, so events can be attributed
+// using the identities that were valid when they happened, even if the
+// UserSignups or namespaces involved were since deleted
+type History struct {
+	// UIDs records usernames mapped to SSO user IDs
+	UIDs Timeline `json:"uids"`
+	// Workspaces records namespaces mapped to workspaces
+	Workspaces Timeline `json:"workspaces"`
+}
+
+// NewHistory constructs an empty History
+func NewHistory() *History {
+	return &History{UIDs: Timeline{}, Workspaces: Timeline{}}
+}
+
+// Merge adds the spans of another history to this one
+func (h *History) Merge(other *History) {
+	h.UIDs.Merge(other.UIDs)
+	h.Workspaces.Merge(other.Workspaces)
+}
+
+// ReadHistory reads a History in JSON format. An empty input yields an empty
+// History.
+func ReadHistory(r io.Reader) (*History, error) {
+	history := NewHistory()
+	if err := json.NewDecoder(r).Decode(history); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if history.UIDs == nil {
+		history.UIDs = Timeline{}
+	}
+	if history.Workspaces == nil {
+		history.Workspaces = Timeline{}
+	}
+	return history, nil
+}
+
+// Write writes the History in JSON format
+func (h *History) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(h)
+}
+
+// HistoricalResolver is a transform.TimedIdentityResolver that resolves
+// identities as of a given time using a History, and falls back to another
+// resolver for identities the History does not know about. Since the History
+// may be a snapshot that falls behind the other resolver, times after a key
+// was last recorded are resolved with the other resolver first.
+type HistoricalResolver struct {
+	history *History
+	current transform.IdentityResolver
+}
+
+// NewHistoricalResolver constructs a HistoricalResolver using the given
+// History and fallback resolver
+func NewHistoricalResolver(history *History, current transform.IdentityResolver) *HistoricalResolver {
+	return &HistoricalResolver{history: history, current: current}
+}
+
+func (r *HistoricalResolver) Workspace(namespace string) (string, bool) {
+	if ws, ok := r.current.Workspace(namespace); ok {
+		return ws, true
+	}
+	return nonEmpty(r.history.Workspaces.Latest(namespace))
+}
+
+func (r *HistoricalResolver) UserID(username string) (string, bool) {
+	if uid, ok := r.current.UserID(username); ok {
+		return uid, true
+	}
+	return nonEmpty(r.history.UIDs.Latest(username))
+}
+
+func (r *HistoricalResolver) WorkspaceAt(namespace string, t time.Time) (string, bool) {
+	return resolveAt(r.history.Workspaces, namespace, t, r.current.Workspace)
+}
+
+func (r *HistoricalResolver) UserIDAt(username string, t time.Time) (string, bool) {
+	return resolveAt(r.history.UIDs, username, t, r.current.UserID)
+}
+
+// resolveAt resolves the given key as of the given time using the timeline,
+// unless the time is after the key was last recorded and the current
+// resolver knows the key
+func resolveAt(
+	tl Timeline, key string, t time.Time, current func(string) (string, bool),
+) (string, bool) {
+	if t.After(tl.LastSeen(key)) {
+		if value, ok := current(key); ok {
+			return value, true
+		}
+	}
+	if value, ok := nonEmpty(tl.At(key, t)); ok {
+		return value, true
+	}
+	return current(key)
+}
+
+func nonEmpty(value string, ok bool) (string, bool) {
+	return value, ok && value != ""
+}
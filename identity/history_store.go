@@ -0,0 +1,222 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/configmap"
+	"k8s.io/client-go/kubernetes"
+)
+
+// HistoryStore persists a History
+type HistoryStore interface {
+	// Load returns the stored History, or an empty one if none was stored
+	// yet
+	Load(ctx context.Context) (*History, error)
+	// Update applies the given function to the stored History and stores
+	// the result
+	Update(ctx context.Context, update func(*History)) error
+}
+
+// FileHistoryStore is a HistoryStore that keeps the History in a local JSON
+// file
+type FileHistoryStore struct {
+	path string
+}
+
+// NewFileHistoryStore constructs a FileHistoryStore that uses the file in the
+// given path
+func NewFileHistoryStore(path string) *FileHistoryStore {
+	return &FileHistoryStore{path: path}
+}
+
+func (s *FileHistoryStore) Load(_ context.Context) (*History, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NewHistory(), nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ReadHistory(bytes.NewReader(data))
+}
+
+// Update writes the updated History into a temporary file and then renames it
+// over the store file, so that a crash while saving does not corrupt the
+// store
+func (s *FileHistoryStore) Update(ctx context.Context, update func(*History)) error {
+	history, err := s.Load(ctx)
+	if err != nil {
+		return err
+	}
+	update(history)
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = history.Write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+const (
+	// HistoryConfigMapKey is the ConfigMap data key the History is stored
+	// under
+	HistoryConfigMapKey = "identity-history.json"
+	// DefaultHistoryMaxSize is the default maximum size in bytes of the
+	// History stored in a ConfigMap, which keeps it below the 1MiB object
+	// size limit
+	DefaultHistoryMaxSize = 900 * 1024
+)
+
+// EvictedError is returned by ConfigMapHistoryStore when it discarded the
+// spans that were last seen longest ago to make the History fit. The rest of
+// the updated History was stored.
+type EvictedError struct {
+	// Count is the number of discarded spans
+	Count int
+}
+
+func (e *EvictedError) Error() string {
+	return fmt.Sprintf("identity history is full, discarded the %d oldest spans", e.Count)
+}
+
+// ConfigMapHistoryStore is a HistoryStore that keeps the History in a K8s
+// ConfigMap. Concurrent updates, e.g. by the uid-map and ws-map jobs, are
+// retried so neither is lost. Since ConfigMaps are limited in size, the spans
+// that were last seen longest ago are discarded when the History grows beyond
+// the configured maximum size, which is reported with an *EvictedError.
+type ConfigMapHistoryStore struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	maxSize   int
+}
+
+// NewConfigMapHistoryStore constructs a ConfigMapHistoryStore that uses the
+// ConfigMap with the given namespace and name. The ConfigMap is created when
+// the History is first updated.
+func NewConfigMapHistoryStore(client kubernetes.Interface, namespace, name string) *ConfigMapHistoryStore {
+	return &ConfigMapHistoryStore{
+		client: client, namespace: namespace, name: name, maxSize: DefaultHistoryMaxSize,
+	}
+}
+
+// WithMaxSize sets the maximum size in bytes of the stored History
+func (s *ConfigMapHistoryStore) WithMaxSize(size int) *ConfigMapHistoryStore {
+	s.maxSize = size
+	return s
+}
+
+func (s *ConfigMapHistoryStore) Load(ctx context.Context) (*History, error) {
+	data, err := configmap.Read(ctx, s.client, s.namespace, s.name)
+	if err != nil {
+		return nil, err
+	}
+	return ReadHistory(bytes.NewReader([]byte(data[HistoryConfigMapKey])))
+}
+
+func (s *ConfigMapHistoryStore) Update(ctx context.Context, update func(*History)) error {
+	var evicted int
+	err := configmap.Update(ctx, s.client, s.namespace, s.name, func(data map[string]string) error {
+		history, err := ReadHistory(bytes.NewReader([]byte(data[HistoryConfigMapKey])))
+		if err != nil {
+			return err
+		}
+		update(history)
+		data[HistoryConfigMapKey], evicted, err = s.encode(history)
+		return err
+	})
+	if err == nil && evicted > 0 {
+		return &EvictedError{Count: evicted}
+	}
+	return err
+}
+
+// encode encodes the History in JSON format, leaving out the spans that were
+// last seen longest ago as needed to fit in the maximum size, and returns how
+// many it left out
+func (s *ConfigMapHistoryStore) encode(history *History) (string, int, error) {
+	encoded, err := json.Marshal(history)
+	if err != nil || len(encoded) <= s.maxSize {
+		return string(encoded), 0, err
+	}
+	spans := oldestSpans(history)
+	if len(spans) == 0 {
+		return string(encoded), 0, nil
+	}
+	// Leaving out more spans never makes the History larger, so we look for
+	// the fewest that make it fit
+	evicted := 1 + sort.Search(len(spans)-1, func(i int) bool {
+		encoded, err := json.Marshal(without(history, spans[:i+1]))
+		return err == nil && len(encoded) <= s.maxSize
+	})
+	encoded, err = json.Marshal(without(history, spans[:evicted]))
+	return string(encoded), evicted, err
+}
+
+// spanRef identifies a span of a History by its timeline, key and index
+type spanRef struct {
+	timeline int
+	key      string
+	index    int
+	lastSeen time.Time
+}
+
+// timelines returns the timelines of the given History
+func timelines(history *History) []Timeline {
+	return []Timeline{history.UIDs, history.Workspaces}
+}
+
+// oldestSpans returns references to all the spans of the given History, in
+// the order they were last seen
+func oldestSpans(history *History) []spanRef {
+	var spans []spanRef
+	for t, tl := range timelines(history) {
+		for key, keySpans := range tl {
+			for i, span := range keySpans {
+				spans = append(spans, spanRef{timeline: t, key: key, index: i, lastSeen: span.LastSeen})
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].lastSeen.Before(spans[j].lastSeen) })
+	return spans
+}
+
+// without returns a copy of the given History leaving out the given spans.
+// Keys left without spans are removed.
+func without(history *History, spans []spanRef) *History {
+	excluded := map[spanRef]bool{}
+	for _, span := range spans {
+		span.lastSeen = time.Time{}
+		excluded[span] = true
+	}
+	result := NewHistory()
+	for t, tl := range timelines(history) {
+		for key, keySpans := range tl {
+			var kept []Span
+			for i, span := range keySpans {
+				if !excluded[spanRef{timeline: t, key: key, index: i}] {
+					kept = append(kept, span)
+				}
+			}
+			if len(kept) > 0 {
+				timelines(result)[t][key] = kept
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,197 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var (
+	day1 = time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	day2 = day1.AddDate(0, 0, 1)
+	day3 = day1.AddDate(0, 0, 2)
+	day4 = day1.AddDate(0, 0, 3)
+)
+
+func TestTimeline_Record(t *testing.T) {
+	tl := Timeline{}
+	tl.Record(day1, map[string]string{"alice": "1", "bob": "2"})
+	tl.Record(day2, map[string]string{"alice": "1"})
+	tl.Record(day3, map[string]string{"alice": "10", "bob": "2"})
+	tl.Record(day4, map[string]string{"alice": "1"})
+
+	assert.Equal(t, Timeline{
+		"alice": {
+			{Value: "1", FirstSeen: day1, LastSeen: day2},
+			{Value: "10", FirstSeen: day3, LastSeen: day3},
+			{Value: "1", FirstSeen: day4, LastSeen: day4},
+		},
+		"bob": {{Value: "2", FirstSeen: day1, LastSeen: day3}},
+	}, tl)
+}
+
+func TestTimeline_At(t *testing.T) {
+	tl := Timeline{"alice": {
+		{Value: "1", FirstSeen: day2, LastSeen: day2},
+		{Value: "10", FirstSeen: day3, LastSeen: day3},
+	}}
+	tests := []struct {
+		name string
+		at   time.Time
+		want string
+	}{
+		{"Before first seen", day1, "1"},
+		{"Within first span", day2, "1"},
+		{"Between spans", day2.Add(12 * time.Hour), "1"},
+		{"Start of second span", day3, "10"},
+		{"After last seen", day4, "10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok := tl.At("alice", tt.at)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, value)
+		})
+	}
+	_, ok := tl.At("bob", day1)
+	assert.False(t, ok)
+}
+
+func TestTimeline_Merge(t *testing.T) {
+	tl := Timeline{"alice": {{Value: "1", FirstSeen: day2, LastSeen: day3}}}
+	tl.Merge(Timeline{
+		"alice": {
+			{Value: "1", FirstSeen: day1, LastSeen: day2},
+			{Value: "10", FirstSeen: day4, LastSeen: day4},
+		},
+		"bob": {{Value: "2", FirstSeen: day1, LastSeen: day1}},
+	})
+	assert.Equal(t, Timeline{
+		"alice": {
+			{Value: "1", FirstSeen: day1, LastSeen: day3},
+			{Value: "10", FirstSeen: day4, LastSeen: day4},
+		},
+		"bob": {{Value: "2", FirstSeen: day1, LastSeen: day1}},
+	}, tl)
+}
+
+func TestHistoricalResolver(t *testing.T) {
+	history := NewHistory()
+	history.UIDs.Record(day1, map[string]string{"alice": "1", "deleted": "3"})
+	history.UIDs.Record(day3, map[string]string{"alice": "10"})
+	history.Workspaces.Record(day1, map[string]string{"old-tenant": "old"})
+	current := &transform.StaticMaps{
+		UIDs:       map[string]string{"alice": "10", "new": "4", "deleted": "5"},
+		Workspaces: map[string]string{"new-tenant": "new"},
+	}
+	resolver := NewHistoricalResolver(history, current)
+
+	for _, tt := range []struct {
+		name    string
+		resolve func() (string, bool)
+		want    string
+		wantOk  bool
+	}{
+		{"Changed user before change", func() (string, bool) { return resolver.UserIDAt("alice", day2) }, "1", true},
+		{"Changed user after change", func() (string, bool) { return resolver.UserIDAt("alice", day4) }, "10", true},
+		{"Recreated user before snapshot", func() (string, bool) { return resolver.UserIDAt("deleted", day1) }, "3", true},
+		{"Recreated user after snapshot", func() (string, bool) { return resolver.UserIDAt("deleted", day4) }, "5", true},
+		{"Deleted namespace before snapshot", func() (string, bool) { return resolver.WorkspaceAt("old-tenant", day1) }, "old", true},
+		{"User not in history", func() (string, bool) { return resolver.UserIDAt("new", day1) }, "4", true},
+		{"Unknown user", func() (string, bool) { return resolver.UserIDAt("nobody", day1) }, "", false},
+		{"Current changed user", func() (string, bool) { return resolver.UserID("alice") }, "10", true},
+		{"Current recreated user", func() (string, bool) { return resolver.UserID("deleted") }, "5", true},
+		{"Deleted namespace", func() (string, bool) { return resolver.WorkspaceAt("old-tenant", day4) }, "old", true},
+		{"Namespace not in history", func() (string, bool) { return resolver.WorkspaceAt("new-tenant", day4) }, "new", true},
+		{"Current deleted namespace", func() (string, bool) { return resolver.Workspace("old-tenant") }, "old", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok := tt.resolve()
+			assert.Equal(t, tt.want, value)
+			assert.Equal(t, tt.wantOk, ok)
+		})
+	}
+}
+
+func TestReadHistory(t *testing.T) {
+	history, err := ReadHistory(strings.NewReader(""))
+	require.NoError(t, err)
+	assert.Equal(t, NewHistory(), history)
+
+	history, err = ReadHistory(strings.NewReader(`{"uids":{"alice":[
+		{"value":"1","firstSeen":"2023-11-01T00:00:00Z","lastSeen":"2023-11-02T00:00:00Z"}
+	]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, &History{
+		UIDs:       Timeline{"alice": {{Value: "1", FirstSeen: day1, LastSeen: day2}}},
+		Workspaces: Timeline{},
+	}, history)
+}
+
+func testHistoryStore(t *testing.T, store HistoryStore) {
+	ctx := context.Background()
+	history, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, NewHistory(), history)
+
+	require.NoError(t, store.Update(ctx, func(h *History) {
+		h.UIDs.Record(day1, map[string]string{"alice": "1"})
+	}))
+	require.NoError(t, store.Update(ctx, func(h *History) {
+		h.Workspaces.Record(day2, map[string]string{"alice-tenant": "alice"})
+	}))
+
+	history, err = store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, &History{
+		UIDs:       Timeline{"alice": {{Value: "1", FirstSeen: day1, LastSeen: day1}}},
+		Workspaces: Timeline{"alice-tenant": {{Value: "alice", FirstSeen: day2, LastSeen: day2}}},
+	}, history)
+}
+
+func TestFileHistoryStore(t *testing.T) {
+	testHistoryStore(t, NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+}
+
+func TestConfigMapHistoryStore(t *testing.T) {
+	testHistoryStore(t, NewConfigMapHistoryStore(fake.NewClientset(), "ns", "identity-history"))
+}
+
+func TestConfigMapHistoryStore_maxSize(t *testing.T) {
+	ctx := context.Background()
+	want := &History{
+		UIDs: Timeline{"bob": {{Value: "2", FirstSeen: day3, LastSeen: day4}}},
+		Workspaces: Timeline{"alice-tenant": {
+			{Value: "bob", FirstSeen: day3, LastSeen: day3},
+		}},
+	}
+	encoded, err := json.Marshal(want)
+	require.NoError(t, err)
+	store := NewConfigMapHistoryStore(fake.NewClientset(), "ns", "identity-history").
+		WithMaxSize(len(encoded))
+
+	require.NoError(t, store.Update(ctx, func(h *History) {
+		h.UIDs.Record(day1, map[string]string{"alice": "1"})
+	}), "the history fits")
+	err = store.Update(ctx, func(h *History) {
+		h.Workspaces.Record(day2, map[string]string{"alice-tenant": "alice"})
+		h.Workspaces.Record(day3, map[string]string{"alice-tenant": "bob"})
+		h.UIDs.Record(day3, map[string]string{"bob": "2"})
+		h.UIDs.Record(day4, map[string]string{"bob": "2"})
+	})
+	var evicted *EvictedError
+	require.ErrorAs(t, err, &evicted)
+	assert.Equal(t, 2, evicted.Count)
+
+	history, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, want, history, "the spans last seen longest ago are discarded")
+}
@@ -0,0 +1,341 @@
+// Package identity keeps track of the cluster identities needed for
+// attributing user journey events: the SSO user IDs of cluster usernames, the
+// workspaces namespaces belong to and the owners and members of workspaces.
+package identity
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spaces"
+	wsmap "github.com/redhat-appstudio/segment-bridge.git/ws_map"
+)
+
+// LiveMaps is a transform.IdentityResolver and transform.Memberships that is
+// kept up to date while it is being used, typically by a Watcher. It is safe
+// for concurrent use.
+//
+// Usernames mapped to different SSO user IDs by different UserSignups, and
+// namespaces claimed by different workspaces in different clusters, are not
+// resolved, like in the UID and workspace map builders. Namespaces not found
+// in any cluster are resolved using the namespaces provisioned for Spaces.
+type LiveMaps struct {
+	mu sync.RWMutex
+	// uids maps usernames to the SSO user IDs given by each UserSignup
+	uids map[string]map[string]string
+	// signups maps UserSignup names to the usernames they map
+	signups map[string]string
+	// workspaces maps namespaces to the workspaces given in each cluster
+	workspaces map[string]map[string]string
+	// spaces holds Spaces by name, without their bindings
+	spaces map[string]spaces.Space
+	// provisioned maps namespaces to the Spaces they were provisioned for,
+	// keyed by themselves so conflicts can be found with unique
+	provisioned map[string]map[string]string
+	// bindings holds the bindings of each Space by SpaceBinding name
+	bindings map[string]map[string]spaces.Binding
+	// bindingSpaces maps SpaceBinding names to the Spaces they bind to
+	bindingSpaces map[string]string
+	// generation is incremented whenever the maps change
+	generation uint64
+}
+
+// NewLiveMaps constructs empty LiveMaps
+func NewLiveMaps() *LiveMaps {
+	return &LiveMaps{
+		uids:          map[string]map[string]string{},
+		signups:       map[string]string{},
+		workspaces:    map[string]map[string]string{},
+		spaces:        map[string]spaces.Space{},
+		provisioned:   map[string]map[string]string{},
+		bindings:      map[string]map[string]spaces.Binding{},
+		bindingSpaces: map[string]string{},
+	}
+}
+
+func (m *LiveMaps) UserID(username string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return unique(m.uids[username])
+}
+
+func (m *LiveMaps) Workspace(namespace string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, found := m.workspaces[namespace]; found {
+		return unique(m.workspaces[namespace])
+	}
+	return unique(m.provisioned[namespace])
+}
+
+func (m *LiveMaps) WorkspaceOwner(workspace string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	space, ok := m.space(workspace)
+	if !ok {
+		return "", false
+	}
+	return space.Owner(), true
+}
+
+func (m *LiveMaps) MemberRole(workspace, username string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, binding := range m.bindings[workspace] {
+		if binding.Username == username {
+			return binding.Role, true
+		}
+	}
+	return "", false
+}
+
+// space returns the given Space along with its bindings. Spaces that only
+// have bindings are returned as well, like the space map builder does.
+func (m *LiveMaps) space(name string) (*spaces.Space, bool) {
+	space, ok := m.spaces[name]
+	if !ok && len(m.bindings[name]) == 0 {
+		return nil, false
+	}
+	space.Name = name
+	space.Bindings = nil
+	for _, binding := range m.bindings[name] {
+		space.Bindings = append(space.Bindings, binding)
+	}
+	sort.Slice(space.Bindings, func(i, j int) bool {
+		return space.Bindings[i].Username < space.Bindings[j].Username
+	})
+	return &space, true
+}
+
+// unique returns the value all the entries of the given map share, if any
+func unique(m map[string]string) (value string, ok bool) {
+	for _, v := range m {
+		if ok && v != value {
+			return "", false
+		}
+		value, ok = v, v != ""
+	}
+	return value, ok
+}
+
+// SetSignup records that the given UserSignup maps the given username to the
+// given SSO user ID
+func (m *LiveMaps) SetSignup(signup, username, uid string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.signups[signup] == username && m.uids[username][signup] == uid {
+		return
+	}
+	m.deleteSignup(signup)
+	m.signups[signup] = username
+	if m.uids[username] == nil {
+		m.uids[username] = map[string]string{}
+	}
+	m.uids[username][signup] = uid
+	m.generation++
+}
+
+// DeleteSignup removes the mapping given by the given UserSignup
+func (m *LiveMaps) DeleteSignup(signup string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteSignup(signup)
+}
+
+func (m *LiveMaps) deleteSignup(signup string) {
+	username, ok := m.signups[signup]
+	if !ok {
+		return
+	}
+	delete(m.signups, signup)
+	delete(m.uids[username], signup)
+	if len(m.uids[username]) == 0 {
+		delete(m.uids, username)
+	}
+	m.generation++
+}
+
+// SetNamespace records that the given namespace belongs to the given
+// workspace in the given cluster
+func (m *LiveMaps) SetNamespace(cluster, namespace, workspace string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ws, ok := m.workspaces[namespace][cluster]; ok && ws == workspace {
+		return
+	}
+	if m.workspaces[namespace] == nil {
+		m.workspaces[namespace] = map[string]string{}
+	}
+	m.workspaces[namespace][cluster] = workspace
+	m.generation++
+}
+
+// DeleteNamespace removes the given namespace of the given cluster
+func (m *LiveMaps) DeleteNamespace(cluster, namespace string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.workspaces[namespace][cluster]; !ok {
+		return
+	}
+	delete(m.workspaces[namespace], cluster)
+	if len(m.workspaces[namespace]) == 0 {
+		delete(m.workspaces, namespace)
+	}
+	m.generation++
+}
+
+// SetSpace records the given Space, whose bindings are ignored
+func (m *LiveMaps) SetSpace(space spaces.Space) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	space.Bindings = nil
+	if previous, ok := m.spaces[space.Name]; ok && reflect.DeepEqual(previous, space) {
+		return
+	}
+	m.deleteSpace(space.Name)
+	m.spaces[space.Name] = space
+	for _, namespace := range space.Namespaces {
+		if m.provisioned[namespace] == nil {
+			m.provisioned[namespace] = map[string]string{}
+		}
+		m.provisioned[namespace][space.Name] = space.Name
+	}
+	m.generation++
+}
+
+// DeleteSpace removes the given Space
+func (m *LiveMaps) DeleteSpace(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteSpace(name)
+}
+
+func (m *LiveMaps) deleteSpace(name string) {
+	space, ok := m.spaces[name]
+	if !ok {
+		return
+	}
+	delete(m.spaces, name)
+	for _, namespace := range space.Namespaces {
+		delete(m.provisioned[namespace], name)
+		if len(m.provisioned[namespace]) == 0 {
+			delete(m.provisioned, namespace)
+		}
+	}
+	m.generation++
+}
+
+// SetBinding records that the given SpaceBinding binds the given user to the
+// given Space
+func (m *LiveMaps) SetBinding(name, space string, binding spaces.Binding) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.bindingSpaces[name] == space && m.bindings[space][name] == binding {
+		return
+	}
+	m.deleteBinding(name)
+	m.bindingSpaces[name] = space
+	if m.bindings[space] == nil {
+		m.bindings[space] = map[string]spaces.Binding{}
+	}
+	m.bindings[space][name] = binding
+	m.generation++
+}
+
+// DeleteBinding removes the given SpaceBinding
+func (m *LiveMaps) DeleteBinding(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deleteBinding(name)
+}
+
+func (m *LiveMaps) deleteBinding(name string) {
+	space, ok := m.bindingSpaces[name]
+	if !ok {
+		return
+	}
+	delete(m.bindingSpaces, name)
+	delete(m.bindings[space], name)
+	if len(m.bindings[space]) == 0 {
+		delete(m.bindings, space)
+	}
+	m.generation++
+}
+
+// Generation returns a number that changes whenever the maps change
+func (m *LiveMaps) Generation() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.generation
+}
+
+// UIDs returns a snapshot of the resolvable usernames in the format of the
+// UID map
+func (m *LiveMaps) UIDs() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	uids := make(map[string]string, len(m.uids))
+	for username, signups := range m.uids {
+		if uid, ok := unique(signups); ok {
+			uids[username] = uid
+		}
+	}
+	return uids
+}
+
+// Workspaces returns a snapshot of the resolvable namespaces in the format of
+// the workspace map
+func (m *LiveMaps) Workspaces() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	workspaces := make(map[string]string, len(m.workspaces))
+	for namespace, spaceNames := range m.provisioned {
+		if _, found := m.workspaces[namespace]; !found {
+			if workspace, ok := unique(spaceNames); ok {
+				workspaces[namespace] = workspace
+			}
+		}
+	}
+	for namespace, clusters := range m.workspaces {
+		if workspace, ok := unique(clusters); ok {
+			workspaces[namespace] = workspace
+		}
+	}
+	return workspaces
+}
+
+// Spaces returns a snapshot of the Spaces in the format of the space map
+func (m *LiveMaps) Spaces() spaces.Map {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	spaceMap := spaces.Map{}
+	for name := range m.spaces {
+		spaceMap[name], _ = m.space(name)
+	}
+	for name := range m.bindings {
+		spaceMap[name], _ = m.space(name)
+	}
+	return spaceMap
+}
+
+// WorkspaceEntries returns a snapshot of the resolvable namespaces in the
+// format of the workspace map entries
+func (m *LiveMaps) WorkspaceEntries() map[string]wsmap.Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make(map[string]wsmap.Entry, len(m.workspaces))
+	for namespace, clusters := range m.workspaces {
+		workspace, ok := unique(clusters)
+		if !ok {
+			continue
+		}
+		entry := wsmap.Entry{Workspace: workspace}
+		for cluster := range clusters {
+			entry.Clusters = append(entry.Clusters, cluster)
+		}
+		sort.Strings(entry.Clusters)
+		entries[namespace] = entry
+	}
+	return entries
+}
@@ -0,0 +1,138 @@
+package identity
+
+import (
+	"testing"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spaces"
+	wsmap "github.com/redhat-appstudio/segment-bridge.git/ws_map"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveMaps_UserID(t *testing.T) {
+	maps := NewLiveMaps()
+	maps.SetSignup("user1", "user1", "111")
+	maps.SetSignup("user2", "user2", "222")
+	maps.SetSignup("user2-again", "user2", "222")
+	maps.SetSignup("user3", "user3", "333")
+	maps.SetSignup("user3-other", "user3", "334")
+	maps.SetSignup("renamed", "old-name", "555")
+	maps.SetSignup("renamed", "new-name", "555")
+
+	for _, tt := range []struct {
+		username string
+		want     string
+		wantOk   bool
+	}{
+		{"user1", "111", true},
+		{"user2", "222", true},
+		{"user3", "", false},
+		{"old-name", "", false},
+		{"new-name", "555", true},
+		{"unknown", "", false},
+	} {
+		uid, ok := maps.UserID(tt.username)
+		assert.Equal(t, tt.want, uid, tt.username)
+		assert.Equal(t, tt.wantOk, ok, tt.username)
+	}
+	assert.Equal(t, map[string]string{"user1": "111", "user2": "222", "new-name": "555"}, maps.UIDs())
+
+	maps.DeleteSignup("user3-other")
+	maps.DeleteSignup("user1")
+	assert.Equal(t, map[string]string{"user2": "222", "user3": "333", "new-name": "555"}, maps.UIDs())
+}
+
+func TestLiveMaps_Workspace(t *testing.T) {
+	maps := NewLiveMaps()
+	maps.SetNamespace("m01", "a-tenant", "a")
+	maps.SetNamespace("m01", "b-tenant", "b")
+	maps.SetNamespace("rh01", "b-tenant", "b")
+	maps.SetNamespace("m01", "c-tenant", "c")
+	maps.SetNamespace("rh01", "c-tenant", "other")
+
+	ws, ok := maps.Workspace("b-tenant")
+	assert.True(t, ok)
+	assert.Equal(t, "b", ws)
+	_, ok = maps.Workspace("c-tenant")
+	assert.False(t, ok)
+	assert.Equal(t, map[string]wsmap.Entry{
+		"a-tenant": {Workspace: "a", Clusters: []string{"m01"}},
+		"b-tenant": {Workspace: "b", Clusters: []string{"m01", "rh01"}},
+	}, maps.WorkspaceEntries())
+
+	maps.DeleteNamespace("rh01", "c-tenant")
+	maps.DeleteNamespace("m01", "a-tenant")
+	assert.Equal(t, map[string]wsmap.Entry{
+		"b-tenant": {Workspace: "b", Clusters: []string{"m01", "rh01"}},
+		"c-tenant": {Workspace: "c", Clusters: []string{"m01"}},
+	}, maps.WorkspaceEntries())
+}
+
+func TestLiveMaps_Spaces(t *testing.T) {
+	maps := NewLiveMaps()
+	maps.SetNamespace("m01", "a-tenant", "a")
+	maps.SetSpace(spaces.Space{Name: "a", Namespaces: []string{"a-tenant", "a-other"}})
+	maps.SetSpace(spaces.Space{Name: "team", Creator: "alice", Namespaces: []string{"team-tenant"}})
+	maps.SetBinding("team-alice", "team", spaces.Binding{Username: "alice", Role: "admin"})
+	maps.SetBinding("team-bob", "team", spaces.Binding{Username: "bob", Role: "contributor"})
+	maps.SetBinding("solo-carol", "solo", spaces.Binding{Username: "carol", Role: "admin"})
+
+	owner, ok := maps.WorkspaceOwner("team")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", owner)
+	owner, ok = maps.WorkspaceOwner("solo")
+	assert.True(t, ok)
+	assert.Equal(t, "carol", owner)
+	_, ok = maps.WorkspaceOwner("unknown")
+	assert.False(t, ok)
+	role, ok := maps.MemberRole("team", "bob")
+	assert.True(t, ok)
+	assert.Equal(t, "contributor", role)
+	_, ok = maps.MemberRole("team", "carol")
+	assert.False(t, ok)
+	assert.Equal(t, map[string]string{
+		"a-tenant": "a", "a-other": "a", "team-tenant": "team",
+	}, maps.Workspaces())
+
+	maps.SetSpace(spaces.Space{Name: "a", Namespaces: []string{"a-tenant"}})
+	maps.DeleteSpace("team")
+	maps.DeleteBinding("team-alice")
+	_, ok = maps.Workspace("a-other")
+	assert.False(t, ok)
+	assert.Equal(t, spaces.Map{
+		"a":    {Name: "a", Namespaces: []string{"a-tenant"}},
+		"team": {Name: "team", Bindings: []spaces.Binding{{Username: "bob", Role: "contributor"}}},
+		"solo": {Name: "solo", Bindings: []spaces.Binding{{Username: "carol", Role: "admin"}}},
+	}, maps.Spaces())
+}
+
+func TestLiveMaps_Generation(t *testing.T) {
+	maps := NewLiveMaps()
+	generation := maps.Generation()
+	steps := []struct {
+		name    string
+		update  func()
+		changes bool
+	}{
+		{"Add signup", func() { maps.SetSignup("u", "u", "1") }, true},
+		{"Same signup", func() { maps.SetSignup("u", "u", "1") }, false},
+		{"Changed signup", func() { maps.SetSignup("u", "u", "2") }, true},
+		{"Delete signup", func() { maps.DeleteSignup("u") }, true},
+		{"Delete missing signup", func() { maps.DeleteSignup("u") }, false},
+		{"Add namespace", func() { maps.SetNamespace("c", "ns", "ws") }, true},
+		{"Same namespace", func() { maps.SetNamespace("c", "ns", "ws") }, false},
+		{"Delete namespace", func() { maps.DeleteNamespace("c", "ns") }, true},
+		{"Delete missing namespace", func() { maps.DeleteNamespace("c", "ns") }, false},
+		{"Add space", func() { maps.SetSpace(spaces.Space{Name: "s"}) }, true},
+		{"Same space", func() { maps.SetSpace(spaces.Space{Name: "s"}) }, false},
+		{"Delete space", func() { maps.DeleteSpace("s") }, true},
+		{"Add binding", func() { maps.SetBinding("b", "s", spaces.Binding{Username: "u"}) }, true},
+		{"Same binding", func() { maps.SetBinding("b", "s", spaces.Binding{Username: "u"}) }, false},
+		{"Delete binding", func() { maps.DeleteBinding("b") }, true},
+		{"Delete missing binding", func() { maps.DeleteBinding("b") }, false},
+	}
+	for _, step := range steps {
+		step.update()
+		assert.Equal(t, step.changes, maps.Generation() != generation, step.name)
+		generation = maps.Generation()
+	}
+}
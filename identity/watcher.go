@@ -0,0 +1,395 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spaces"
+	uidmap "github.com/redhat-appstudio/segment-bridge.git/uid_map"
+	wsmap "github.com/redhat-appstudio/segment-bridge.git/ws_map"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DefaultSyncTimeout is how long Start waits for the initial listing of the
+// clusters
+const DefaultSyncTimeout = time.Minute
+
+// DefaultPersistInterval is how often Persist checks whether the maps changed
+// by default
+const DefaultPersistInterval = time.Minute
+
+// Watcher keeps LiveMaps up to date by watching the UserSignup, Space and
+// SpaceBinding objects of the host cluster and the tenant namespaces of the
+// member clusters, and optionally persists them into ConfigMaps in the same
+// format the uid-map, ws-map and space-map commands write
+type Watcher struct {
+	maps            *LiveMaps
+	signupClient    dynamic.Interface
+	signupNamespace string
+	spaceClient     dynamic.Interface
+	spaceNamespace  string
+	clusters        []wsmap.Cluster
+	syncTimeout     time.Duration
+	uidMap          configMapRef
+	wsMap           configMapRef
+	spaceMap        configMapRef
+	history         HistoryStore
+	log             io.Writer
+	// namespaceInformers holds the namespace informer of each cluster once
+	// started
+	namespaceInformers map[string]cache.SharedIndexInformer
+}
+
+type configMapRef struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// NewWatcher constructs a Watcher that updates the given maps
+func NewWatcher(maps *LiveMaps) *Watcher {
+	return &Watcher{
+		maps:               maps,
+		syncTimeout:        DefaultSyncTimeout,
+		log:                io.Discard,
+		namespaceInformers: map[string]cache.SharedIndexInformer{},
+	}
+}
+
+// WithUserSignups sets the client and namespace for watching UserSignups
+func (w *Watcher) WithUserSignups(client dynamic.Interface, namespace string) *Watcher {
+	w.signupClient = client
+	w.signupNamespace = namespace
+	return w
+}
+
+// WithSpaces sets the client and namespace for watching Spaces and
+// SpaceBindings
+func (w *Watcher) WithSpaces(client dynamic.Interface, namespace string) *Watcher {
+	w.spaceClient = client
+	w.spaceNamespace = namespace
+	return w
+}
+
+// WithClusters sets the member clusters to watch tenant namespaces in
+func (w *Watcher) WithClusters(clusters ...wsmap.Cluster) *Watcher {
+	w.clusters = clusters
+	return w
+}
+
+// WithSyncTimeout sets how long Start waits for the initial listing of the
+// clusters
+func (w *Watcher) WithSyncTimeout(timeout time.Duration) *Watcher {
+	w.syncTimeout = timeout
+	return w
+}
+
+// WithUIDMapConfigMap sets the ConfigMap Persist writes the UID map to
+func (w *Watcher) WithUIDMapConfigMap(client kubernetes.Interface, namespace, name string) *Watcher {
+	w.uidMap = configMapRef{client, namespace, name}
+	return w
+}
+
+// WithWSMapConfigMap sets the ConfigMap Persist writes the workspace map to
+func (w *Watcher) WithWSMapConfigMap(client kubernetes.Interface, namespace, name string) *Watcher {
+	w.wsMap = configMapRef{client, namespace, name}
+	return w
+}
+
+// WithSpaceMapConfigMap sets the ConfigMap Persist writes the space map to
+func (w *Watcher) WithSpaceMapConfigMap(client kubernetes.Interface, namespace, name string) *Watcher {
+	w.spaceMap = configMapRef{client, namespace, name}
+	return w
+}
+
+// WithHistoryStore sets a store Persist records the maps into, so their
+// history is kept
+func (w *Watcher) WithHistoryStore(store HistoryStore) *Watcher {
+	w.history = store
+	return w
+}
+
+// WithLog sets where to report errors that do not stop the Watcher
+func (w *Watcher) WithLog(log io.Writer) *Watcher {
+	w.log = log
+	return w
+}
+
+// Start starts watching and waits for the initial listing of all the
+// clusters. Watching stops when the context is done. Clusters that could not
+// be listed within the sync timeout are returned as errors, but keep being
+// retried in the background so their namespaces are mapped once they become
+// reachable.
+func (w *Watcher) Start(ctx context.Context) error {
+	// Start all the informers before waiting for any of them, so the clusters
+	// are listed concurrently
+	var signupInformer cache.SharedIndexInformer
+	if w.signupClient != nil {
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(
+			w.signupClient, 0, w.signupNamespace, nil,
+		)
+		signupInformer = factory.ForResource(uidmap.UserSignupResource).Informer()
+		if _, err := signupInformer.AddEventHandler(w.signupHandler()); err != nil {
+			return err
+		}
+		factory.Start(ctx.Done())
+	}
+	var spaceInformers []cache.SharedIndexInformer
+	if w.spaceClient != nil {
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(
+			w.spaceClient, 0, w.spaceNamespace, nil,
+		)
+		spaceInformer := factory.ForResource(spaces.SpaceResource).Informer()
+		if _, err := spaceInformer.AddEventHandler(w.spaceHandler()); err != nil {
+			return err
+		}
+		bindingInformer := factory.ForResource(spaces.SpaceBindingResource).Informer()
+		if _, err := bindingInformer.AddEventHandler(w.bindingHandler()); err != nil {
+			return err
+		}
+		spaceInformers = []cache.SharedIndexInformer{spaceInformer, bindingInformer}
+		factory.Start(ctx.Done())
+	}
+	for _, cluster := range w.clusters {
+		factory := informers.NewSharedInformerFactoryWithOptions(
+			cluster.Client, 0,
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = wsmap.TenantSelector
+			}),
+		)
+		informer := factory.Core().V1().Namespaces().Informer()
+		if _, err := informer.AddEventHandler(w.namespaceHandler(cluster.Name)); err != nil {
+			return err
+		}
+		w.namespaceInformers[cluster.Name] = informer
+		factory.Start(ctx.Done())
+	}
+
+	syncCtx, cancel := context.WithTimeout(ctx, w.syncTimeout)
+	defer cancel()
+	var errs []error
+	if signupInformer != nil && !waitForSync(syncCtx, signupInformer.HasSynced) {
+		errs = append(errs, errors.New("UserSignups were not listed in time"))
+	}
+	for _, informer := range spaceInformers {
+		if !waitForSync(syncCtx, informer.HasSynced) {
+			errs = append(errs, errors.New("Spaces were not listed in time"))
+			break
+		}
+	}
+	for _, cluster := range w.clusters {
+		if !waitForSync(syncCtx, w.namespaceInformers[cluster.Name].HasSynced) {
+			errs = append(errs, fmt.Errorf("namespaces of cluster %s were not listed in time", cluster.Name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncPollPeriod is how often waitForSync checks whether an informer synced.
+// It is shorter than the period of cache.WaitForCacheSync so short sync
+// timeouts are honoured accurately.
+const syncPollPeriod = 10 * time.Millisecond
+
+// waitForSync waits until the given informer synced or the context is done,
+// and returns whether it synced
+func waitForSync(ctx context.Context, hasSynced cache.InformerSynced) bool {
+	err := wait.PollUntilContextCancel(ctx, syncPollPeriod, true, func(context.Context) (bool, error) {
+		return hasSynced(), nil
+	})
+	return err == nil
+}
+
+func (w *Watcher) signupHandler() cache.ResourceEventHandler {
+	update := func(obj any) {
+		signup, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return
+		}
+		if username, uid, reason := uidmap.SignupIdentity(signup); reason == "" {
+			w.maps.SetSignup(signup.GetName(), username, uid)
+		} else {
+			w.maps.DeleteSignup(signup.GetName())
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj any) { update(obj) },
+		DeleteFunc: func(obj any) {
+			if name, ok := objectName(obj); ok {
+				w.maps.DeleteSignup(name)
+			}
+		},
+	}
+}
+
+func (w *Watcher) spaceHandler() cache.ResourceEventHandler {
+	update := func(obj any) {
+		if space, ok := obj.(*unstructured.Unstructured); ok {
+			w.maps.SetSpace(spaces.SpaceOf(space))
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj any) { update(obj) },
+		DeleteFunc: func(obj any) {
+			if name, ok := objectName(obj); ok {
+				w.maps.DeleteSpace(name)
+			}
+		},
+	}
+}
+
+func (w *Watcher) bindingHandler() cache.ResourceEventHandler {
+	update := func(obj any) {
+		binding, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return
+		}
+		if b, space, ok := spaces.BindingOf(binding); ok {
+			w.maps.SetBinding(binding.GetName(), space, b)
+		} else {
+			w.maps.DeleteBinding(binding.GetName())
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj any) { update(obj) },
+		DeleteFunc: func(obj any) {
+			if name, ok := objectName(obj); ok {
+				w.maps.DeleteBinding(name)
+			}
+		},
+	}
+}
+
+func (w *Watcher) namespaceHandler(cluster string) cache.ResourceEventHandler {
+	update := func(obj any) {
+		ns, ok := obj.(*corev1.Namespace)
+		if !ok {
+			return
+		}
+		if workspace := ns.Labels[wsmap.SpaceLabel]; workspace != "" {
+			w.maps.SetNamespace(cluster, ns.Name, workspace)
+		} else {
+			w.maps.DeleteNamespace(cluster, ns.Name)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    update,
+		UpdateFunc: func(_, obj any) { update(obj) },
+		DeleteFunc: func(obj any) {
+			if name, ok := objectName(obj); ok {
+				w.maps.DeleteNamespace(cluster, name)
+			}
+		},
+	}
+}
+
+// objectName returns the name of a deleted object, which may be wrapped in a
+// tombstone if the deletion was missed while disconnected
+func objectName(obj any) (string, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return "", false
+	}
+	return accessor.GetName(), true
+}
+
+// Persist writes the maps to the configured ConfigMaps and history store
+// whenever they changed, checking every given interval, until the context is
+// done. Write failures are reported to the log and retried on the next check.
+// The maps are written one last time before returning if they changed since
+// the last write. Non-positive intervals are replaced with
+// DefaultPersistInterval. Persist must be called after Start.
+func (w *Watcher) Persist(ctx context.Context, interval time.Duration) {
+	if w.uidMap.client == nil && w.wsMap.client == nil && w.spaceMap.client == nil && w.history == nil {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultPersistInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var written uint64
+	for {
+		if generation := w.maps.Generation(); generation != written {
+			// Use a separate context so the last write is not cancelled
+			// along with the Watcher
+			writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), interval)
+			if err := w.persist(writeCtx); err != nil {
+				fmt.Fprintf(w.log, "Failed to persist identity maps: %v\n", err)
+			} else {
+				written = generation
+			}
+			cancel()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// persist writes the maps to the configured ConfigMaps. The previous
+// workspace map entries of clusters that have not been listed yet are kept,
+// so an unreachable cluster does not drop its namespaces from the map.
+func (w *Watcher) persist(ctx context.Context) error {
+	if w.history != nil {
+		now := time.Now()
+		uids, workspaces := w.maps.UIDs(), w.maps.Workspaces()
+		err := w.history.Update(ctx, func(history *History) {
+			history.UIDs.Record(now, uids)
+			history.Workspaces.Record(now, workspaces)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if w.uidMap.client != nil {
+		err := uidmap.WriteConfigMap(ctx, w.uidMap.client, w.uidMap.namespace, w.uidMap.name, w.maps.UIDs())
+		if err != nil {
+			return err
+		}
+	}
+	if w.spaceMap.client != nil {
+		err := spaces.WriteConfigMap(ctx, w.spaceMap.client, w.spaceMap.namespace, w.spaceMap.name, w.maps.Spaces())
+		if err != nil {
+			return err
+		}
+	}
+	if w.wsMap.client == nil {
+		return nil
+	}
+	result := &wsmap.Result{Entries: w.maps.WorkspaceEntries()}
+	for _, cluster := range w.clusters {
+		if !w.namespaceInformers[cluster.Name].HasSynced() {
+			result.Errors = append(result.Errors, wsmap.ClusterError{
+				Cluster: cluster.Name, Err: errors.New("not listed yet"),
+			})
+		}
+	}
+	if len(result.Errors) > 0 {
+		previous, err := wsmap.ReadConfigMapEntries(ctx, w.wsMap.client, w.wsMap.namespace, w.wsMap.name)
+		if err != nil {
+			return err
+		}
+		result.KeepPrevious(previous)
+	}
+	return wsmap.WriteConfigMap(ctx, w.wsMap.client, w.wsMap.namespace, w.wsMap.name, result)
+}
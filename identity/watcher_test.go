@@ -0,0 +1,210 @@
+package identity
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spaces"
+	uidmap "github.com/redhat-appstudio/segment-bridge.git/uid_map"
+	wsmap "github.com/redhat-appstudio/segment-bridge.git/ws_map"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func mkSignup(name, uid, username string) *unstructured.Unstructured {
+	signup := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "toolchain.dev.openshift.com/v1alpha1",
+		"kind":       "UserSignup",
+		"metadata": map[string]any{
+			"name":        name,
+			"namespace":   uidmap.DefaultNamespace,
+			"annotations": map[string]any{uidmap.SSOUserIDAnnotation: uid},
+		},
+		"status": map[string]any{"compliantUsername": username},
+	}}
+	return signup
+}
+
+func mkNamespace(name, space string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name: name,
+		Labels: map[string]string{
+			"toolchain.dev.openshift.com/type": "tenant",
+			wsmap.SpaceLabel:                   space,
+		},
+	}}
+}
+
+func TestWatcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signups := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{uidmap.UserSignupResource: "UserSignupList"},
+		mkSignup("user1", "111", "user1"),
+	)
+	member := fake.NewClientset(mkNamespace("user1-tenant", "user1"))
+	local := fake.NewClientset()
+	maps := NewLiveMaps()
+	watcher := NewWatcher(maps).
+		WithUserSignups(signups, uidmap.DefaultNamespace).
+		WithClusters(wsmap.Cluster{Name: "m01", Client: member}).
+		WithUIDMapConfigMap(local, "ns", "uid-map").
+		WithWSMapConfigMap(local, "ns", "ws-map")
+
+	require.NoError(t, watcher.Start(ctx))
+	uid, ok := maps.UserID("user1")
+	assert.True(t, ok)
+	assert.Equal(t, "111", uid)
+	ws, ok := maps.Workspace("user1-tenant")
+	assert.True(t, ok)
+	assert.Equal(t, "user1", ws)
+
+	persisted := make(chan struct{})
+	go func() {
+		watcher.Persist(ctx, 10*time.Millisecond)
+		close(persisted)
+	}()
+
+	// A user who signs up and creates a workspace after the watcher started
+	_, err := signups.Resource(uidmap.UserSignupResource).Namespace(uidmap.DefaultNamespace).
+		Create(ctx, mkSignup("user2", "222", "user2"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = member.CoreV1().Namespaces().Create(ctx, mkNamespace("user2-tenant", "user2"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	require.NoError(t, member.CoreV1().Namespaces().Delete(ctx, "user1-tenant", metav1.DeleteOptions{}))
+
+	assert.Eventually(t, func() bool {
+		_, uidOk := maps.UserID("user2")
+		_, wsOk := maps.Workspace("user2-tenant")
+		_, oldWsOk := maps.Workspace("user1-tenant")
+		return uidOk && wsOk && !oldWsOk
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		uidMap, err := local.CoreV1().ConfigMaps("ns").Get(ctx, "uid-map", metav1.GetOptions{})
+		if err != nil {
+			return false
+		}
+		wsMap, err := local.CoreV1().ConfigMaps("ns").Get(ctx, "ws-map", metav1.GetOptions{})
+		if err != nil {
+			return false
+		}
+		return uidMap.Data[uidmap.ConfigMapKey] == `{"user1":"111","user2":"222"}` &&
+			wsMap.Data[wsmap.ConfigMapKey] == `{"user2-tenant":"user2"}`
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-persisted
+}
+
+func TestWatcher_persistNonPositiveInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	watcher := NewWatcher(NewLiveMaps()).
+		WithHistoryStore(NewFileHistoryStore(filepath.Join(t.TempDir(), "history.json")))
+	assert.NotPanics(t, func() { watcher.Persist(ctx, 0) })
+}
+
+func TestWatcher_persistKeepsUnlistedClusters(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	local := fake.NewClientset()
+	previous := &wsmap.Result{Entries: map[string]wsmap.Entry{
+		"a-tenant": {Workspace: "a", Clusters: []string{"m01"}},
+		"b-tenant": {Workspace: "b", Clusters: []string{"down"}},
+	}}
+	require.NoError(t, wsmap.WriteConfigMap(ctx, local, "ns", "ws-map", previous))
+	down := fake.NewClientset()
+	down.PrependReactor("list", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	watcher := NewWatcher(NewLiveMaps()).
+		WithClusters(
+			wsmap.Cluster{Name: "m01", Client: fake.NewClientset(mkNamespace("c-tenant", "c"))},
+			wsmap.Cluster{Name: "down", Client: down},
+		).
+		WithSyncTimeout(100*time.Millisecond).
+		WithWSMapConfigMap(local, "ns", "ws-map")
+
+	err := watcher.Start(ctx)
+	assert.EqualError(t, err, "namespaces of cluster down were not listed in time")
+	require.NoError(t, watcher.persist(ctx))
+
+	entries, err := wsmap.ReadConfigMapEntries(ctx, local, "ns", "ws-map")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]wsmap.Entry{
+		"b-tenant": {Workspace: "b", Clusters: []string{"down"}},
+		"c-tenant": {Workspace: "c", Clusters: []string{"m01"}},
+	}, entries)
+}
+
+func TestWatcher_spaces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	space := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "toolchain.dev.openshift.com/v1alpha1",
+		"kind":       "Space",
+		"metadata": map[string]any{
+			"name":      "team",
+			"namespace": spaces.DefaultNamespace,
+			"labels":    map[string]any{spaces.CreatorLabel: "alice"},
+		},
+		"status": map[string]any{
+			"provisionedNamespaces": []any{map[string]any{"name": "team-tenant"}},
+		},
+	}}
+	mkBinding := func(name, mur, role string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "toolchain.dev.openshift.com/v1alpha1",
+			"kind":       "SpaceBinding",
+			"metadata":   map[string]any{"name": name, "namespace": spaces.DefaultNamespace},
+			"spec":       map[string]any{"masterUserRecord": mur, "space": "team", "spaceRole": role},
+		}}
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			spaces.SpaceResource:        "SpaceList",
+			spaces.SpaceBindingResource: "SpaceBindingList",
+		},
+		space, mkBinding("team-alice", "alice", "admin"),
+	)
+	local := fake.NewClientset()
+	maps := NewLiveMaps()
+	watcher := NewWatcher(maps).
+		WithSpaces(client, spaces.DefaultNamespace).
+		WithSpaceMapConfigMap(local, "ns", "space-map")
+
+	require.NoError(t, watcher.Start(ctx))
+	ws, ok := maps.Workspace("team-tenant")
+	assert.True(t, ok)
+	assert.Equal(t, "team", ws)
+	owner, ok := maps.WorkspaceOwner("team")
+	assert.True(t, ok)
+	assert.Equal(t, "alice", owner)
+
+	// A user the workspace is shared with after the watcher started
+	_, err := client.Resource(spaces.SpaceBindingResource).Namespace(spaces.DefaultNamespace).
+		Create(ctx, mkBinding("team-bob", "bob", "contributor"), metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		role, ok := maps.MemberRole("team", "bob")
+		return ok && role == "contributor"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, watcher.persist(ctx))
+	cm, err := local.CoreV1().ConfigMaps("ns").Get(ctx, "space-map", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Contains(t, cm.Data[spaces.ConfigMapKey], `"username":"bob"`)
+}
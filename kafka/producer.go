@@ -0,0 +1,324 @@
+// Package kafka implements a sink producing user journey events to Kafka
+// topics, keyed by user so consumers see the events of each user in order.
+// It is built on the franz-go client.
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+)
+
+const (
+	// DefaultClientID is the client ID the Producer identifies itself with
+	// by default
+	DefaultClientID = "segment-bridge"
+	// DefaultBatchSize is the maximum size in bytes of each record batch by
+	// default, which stays well below the default limit of 1MB brokers place
+	// on them
+	DefaultBatchSize = 512 * 1024
+	// MinBatchSize is the smallest maximum size of record batches the client
+	// accepts
+	MinBatchSize = 512
+	// DefaultRetries is how many times we retry producing a record by default
+	DefaultRetries = 5
+)
+
+var (
+	// ErrNoTopic is returned (wrapped in an EventError) for events no route
+	// matches when there is no default topic
+	ErrNoTopic = errors.New("no topic is configured for the event")
+	// ErrEventRefused is returned (wrapped in an EventError) for events a
+	// broker refused to store, along with the error it returned
+	ErrEventRefused = errors.New("event was refused by the Kafka broker")
+)
+
+// Producer is a sink.Sink that produces events as records keyed by user ID to
+// the topics chosen by a Router. Records are partitioned by key with
+// Partition, like the Java client does. The Producer is idempotent by default,
+// so the records of a request that is retried after its response was lost are
+// not stored twice, and the records of each partition are stored in the order
+// they were written. Requests wait for all in-sync replicas to store the
+// records.
+type Producer struct {
+	brokers    []string
+	router     *Router
+	clientID   string
+	idempotent bool
+	batchSize  int
+	retries    int
+	tls        *tls.Config
+	sasl       sasl.Mechanism
+	budget     *httpretry.Budget
+
+	// mu guards the client, which is created when a Writer is first opened
+	mu     sync.Mutex
+	client *kgo.Client
+}
+
+// NewProducer constructs a default Producer connecting to the given bootstrap
+// brokers, given as host:port addresses, and sending events to the topics
+// chosen by the given router
+func NewProducer(brokers []string, router *Router) *Producer {
+	return &Producer{
+		brokers:    brokers,
+		router:     router,
+		clientID:   DefaultClientID,
+		idempotent: true,
+		batchSize:  DefaultBatchSize,
+		retries:    DefaultRetries,
+	}
+}
+
+// WithClientID sets the client ID the Producer identifies itself with
+func (p *Producer) WithClientID(clientID string) *Producer {
+	p.clientID = clientID
+	return p
+}
+
+// WithIdempotence sets whether the Producer is idempotent, which requires the
+// IDEMPOTENT_WRITE permission on the cluster when authorization is enabled
+func (p *Producer) WithIdempotence(idempotent bool) *Producer {
+	p.idempotent = idempotent
+	return p
+}
+
+// WithBatchSize sets the maximum size in bytes of each record batch. Events
+// that do not fit in a batch are rejected. Sizes below MinBatchSize are
+// raised to it.
+func (p *Producer) WithBatchSize(size int) *Producer {
+	p.batchSize = max(size, MinBatchSize)
+	return p
+}
+
+// WithRetries sets how many times producing a record is retried when it fails
+// in a transient way, such as while partition leadership moves
+func (p *Producer) WithRetries(retries int) *Producer {
+	p.retries = retries
+	return p
+}
+
+// WithTLS makes the Producer connect to brokers over TLS with the given
+// configuration, see TLSConfig
+func (p *Producer) WithTLS(config *tls.Config) *Producer {
+	p.tls = config
+	return p
+}
+
+// WithSASL makes the Producer authenticate to brokers with the given SASL
+// mechanism, see SASLMechanism
+func (p *Producer) WithSASL(mechanism sasl.Mechanism) *Producer {
+	p.sasl = mechanism
+	return p
+}
+
+// WithBudget sets a time budget shared with other calls. The records that are
+// not stored yet when it runs out fail. Without a budget, records wait for
+// unreachable brokers until the context of their Writer is done.
+func (p *Producer) WithBudget(budget *httpretry.Budget) *Producer {
+	p.budget = budget
+	return p
+}
+
+// Close closes the connections to the brokers. The Producer can be used again
+// afterwards, connecting again as needed.
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil {
+		p.client.Close()
+		p.client = nil
+	}
+	return nil
+}
+
+// connect returns the client, creating it if needed
+func (p *Producer) connect() (*kgo.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil {
+		return p.client, nil
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(p.brokers...),
+		kgo.ClientID(p.clientID),
+		kgo.RecordPartitioner(kgo.StickyKeyPartitioner(Partition)),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.ProducerBatchMaxBytes(int32(p.batchSize)),
+		kgo.RecordRetries(p.retries),
+	}
+	if !p.idempotent {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+	}
+	if p.tls != nil {
+		opts = append(opts, kgo.DialTLSConfig(p.tls))
+	}
+	if p.sasl != nil {
+		opts = append(opts, kgo.SASL(p.sasl))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure the Kafka client: %w", err)
+	}
+	p.client = client
+	return client, nil
+}
+
+func (p *Producer) Open(ctx context.Context) sink.Writer {
+	ctx, cancel := p.budget.Context(ctx)
+	client, err := p.connect()
+	return &writer{ctx: ctx, cancel: cancel, router: p.router, client: client, failure: err}
+}
+
+// writer produces events asynchronously and records their outcome as the
+// brokers report it
+type writer struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	router *Router
+	client *kgo.Client
+	// inFlight tracks the records whose outcome is not known yet
+	inFlight sync.WaitGroup
+
+	// mu guards the stats and the failure, which are updated as the outcomes
+	// of records are reported
+	mu    sync.Mutex
+	stats sink.Stats
+	// failure is the first error records failed with since the last Flush
+	failure error
+}
+
+// routingFields are the event fields used for choosing the topic, partition
+// and timestamp of records
+type routingFields struct {
+	Type       string         `json:"type"`
+	Event      string         `json:"event"`
+	UserID     string         `json:"userId"`
+	Timestamp  time.Time      `json:"timestamp"`
+	Properties map[string]any `json:"properties"`
+}
+
+func (w *writer) WriteEvent(data []byte) error {
+	if w.client == nil {
+		return w.failure
+	}
+	event, err := sink.Compact(data)
+	if err != nil {
+		return w.reject(data, err)
+	}
+	var fields routingFields
+	if err := json.Unmarshal(event, &fields); err != nil {
+		return w.reject(event, fmt.Errorf("%w: %w", sink.ErrInvalidEvent, err))
+	}
+	name := fields.Event
+	if fields.Type != "track" {
+		name = fields.Type
+	}
+	kind, _ := fields.Properties["kind"].(string)
+	topic := w.router.Topic(name, kind)
+	if topic == "" {
+		return w.reject(event, ErrNoTopic)
+	}
+	// Records without a key or timestamp are spread over the partitions and
+	// stamped with the current time by the client
+	record := &kgo.Record{Topic: topic, Value: event, Timestamp: fields.Timestamp}
+	if fields.UserID != "" {
+		record.Key = []byte(fields.UserID)
+	}
+	w.inFlight.Add(1)
+	w.client.Produce(w.ctx, record, w.delivered)
+	return nil
+}
+
+// delivered records the outcome of producing the given record. A failed
+// record fails the other records buffered for its partition with the same
+// error, so when a broker refuses a batch all of its records are rejected,
+// and only the first of other failures is kept.
+func (w *writer) delivered(record *kgo.Record, err error) {
+	defer w.inFlight.Done()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case err == nil:
+		w.stats.Events++
+		w.stats.Bytes += len(record.Key) + len(record.Value)
+	case refused(err):
+		w.rejectLocked(record.Value, fmt.Errorf("%w: %w", ErrEventRefused, err))
+	case w.failure == nil:
+		if cause := context.Cause(w.ctx); cause != nil && errors.Is(err, w.ctx.Err()) {
+			err = cause
+		}
+		w.failure = fmt.Errorf("producing to topic %s failed: %w", record.Topic, err)
+	}
+}
+
+// Flush waits for the brokers to store the events written so far, and returns
+// an error if any of them failed to be produced
+func (w *writer) Flush() error {
+	w.inFlight.Wait()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.failure
+	if w.client != nil {
+		w.failure = nil
+	}
+	return err
+}
+
+func (w *writer) Close() error {
+	err := w.Flush()
+	w.cancel()
+	return err
+}
+
+// Stats returns the outcome of the events written so far. Batches are not
+// counted, since the client batches records on its own.
+func (w *writer) Stats() sink.Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	stats := w.stats
+	stats.Rejected = append([]*sink.EventError(nil), w.stats.Rejected...)
+	return stats
+}
+
+// reject records the given event as rejected, keeping it so it can be
+// dead-lettered
+func (w *writer) reject(event []byte, reason error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rejectLocked(event, reason)
+}
+
+func (w *writer) rejectLocked(event []byte, reason error) error {
+	err := &sink.EventError{Size: len(event), Err: reason, Event: event}
+	w.stats.Rejected = append(w.stats.Rejected, err)
+	return err
+}
+
+// refused returns whether the given error means a broker refused to store a
+// record, so producing it again would fail again
+func refused(err error) bool {
+	for _, refusal := range []error{
+		kerr.MessageTooLarge,
+		kerr.RecordListTooLarge,
+		kerr.InvalidRecord,
+		kerr.CorruptMessage,
+		kerr.InvalidTimestamp,
+	} {
+		if errors.Is(err, refusal) {
+			return true
+		}
+	}
+	return false
+}
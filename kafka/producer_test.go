@@ -0,0 +1,361 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl"
+
+	"github.com/redhat-appstudio/segment-bridge.git/containerfixture"
+	"github.com/redhat-appstudio/segment-bridge.git/kafkabroker"
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func trackEvent(id, user, name, kind string) string {
+	return fmt.Sprintf(
+		`{"messageId":"%s","timestamp":"2024-05-01T10:00:00Z","type":"track","userId":"%s","event":"%s","properties":{"kind":"%s"}}`,
+		id, user, name, kind,
+	)
+}
+
+// testCluster starts a fake Kafka cluster with the given topics and numbers of
+// partitions
+func testCluster(t *testing.T, topics map[string]int32, opts ...kfake.Opt) *kfake.Cluster {
+	for topic, partitions := range topics {
+		opts = append(opts, kfake.SeedTopics(partitions, topic))
+	}
+	cluster, err := kfake.NewCluster(opts...)
+	require.NoError(t, err)
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+// storedRecord is a record read back from a topic
+type storedRecord struct {
+	partition int32
+	key       string
+	value     string
+}
+
+// consume reads the given number of records from the given topic
+func consume(t *testing.T, brokers []string, topic string, count int, opts ...kgo.Opt) []storedRecord {
+	opts = append(opts,
+		kgo.SeedBrokers(brokers...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	client, err := kgo.NewClient(opts...)
+	require.NoError(t, err)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var records []storedRecord
+	for len(records) < count {
+		fetches := client.PollFetches(ctx)
+		require.NoError(t, ctx.Err(), "timed out waiting for records in %s", topic)
+		fetches.EachRecord(func(r *kgo.Record) {
+			records = append(records, storedRecord{r.Partition, string(r.Key), string(r.Value)})
+		})
+	}
+	return records
+}
+
+// byPartition groups the values of the given records by partition
+func byPartition(records []storedRecord) map[int32][]string {
+	values := map[int32][]string{}
+	for _, r := range records {
+		values[r.partition] = append(values[r.partition], r.value)
+	}
+	return values
+}
+
+func TestProducer(t *testing.T) {
+	cluster := testCluster(t, map[string]int32{"builds": 3, "events": 1})
+	router := NewRouter("events").WithRoutes(RouteByEvent, Route{"Build *", "builds"})
+	producer := NewProducer(cluster.ListenAddrs(), router)
+
+	events := []string{
+		trackEvent("m1", "u1", "Build Started", "PipelineRun"),
+		trackEvent("m2", "u2", "Build Started", "PipelineRun"),
+		trackEvent("m3", "u1", "Deployment Created", "Deployment"),
+		trackEvent("m4", "u1", "Build Completed", "PipelineRun"),
+		trackEvent("m5", "u2", "Build Completed", "PipelineRun"),
+		`{"messageId":"m6","type":"identify","userId":"u1","traits":{}}`,
+	}
+	w := producer.Open(context.Background())
+	for _, event := range events {
+		require.NoError(t, w.WriteEvent([]byte(event)))
+	}
+	assert.ErrorIs(t, w.WriteEvent([]byte(`["m7"]`)), sink.ErrInvalidEvent)
+	require.NoError(t, w.Close())
+	require.NoError(t, producer.Close())
+
+	u1, u2 := int32(Partition([]byte("u1"), 3)), int32(Partition([]byte("u2"), 3))
+	require.NotEqual(t, u1, u2, "the test users go to different partitions")
+	assert.Equal(t,
+		map[int32][]string{u1: {events[0], events[3]}, u2: {events[1], events[4]}},
+		byPartition(consume(t, cluster.ListenAddrs(), "builds", 4)),
+	)
+	assert.Equal(t,
+		[]storedRecord{{0, "u1", events[2]}, {0, "u1", events[5]}},
+		consume(t, cluster.ListenAddrs(), "events", 2),
+	)
+
+	stats := w.Stats()
+	assert.Equal(t, 6, stats.Events)
+	assert.Positive(t, stats.Bytes)
+	require.Len(t, stats.Rejected, 1)
+	assert.Equal(t, []byte(`["m7"]`), stats.Rejected[0].Event)
+
+	w = producer.Open(context.Background())
+	require.NoError(t, w.WriteEvent([]byte(trackEvent("m8", "u1", "Build Started", "PipelineRun"))))
+	require.NoError(t, w.Close(), "the producer can be used again after it was closed")
+	require.NoError(t, producer.Close())
+}
+
+// failProduce makes the next produce requests to the given cluster fail with
+// the given error, for the given number of requests or for good if negative
+func failProduce(cluster *kfake.Cluster, code int16, times int) {
+	cluster.ControlKey(int16(kmsg.Produce), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		if times--; times != 0 {
+			cluster.KeepControl()
+		}
+		request := req.(*kmsg.ProduceRequest)
+		response := request.ResponseKind().(*kmsg.ProduceResponse)
+		for _, topic := range request.Topics {
+			responseTopic := kmsg.NewProduceResponseTopic()
+			responseTopic.Topic, responseTopic.TopicID = topic.Topic, topic.TopicID
+			for _, partition := range topic.Partitions {
+				responsePartition := kmsg.NewProduceResponseTopicPartition()
+				responsePartition.Partition = partition.Partition
+				responsePartition.ErrorCode = code
+				responseTopic.Partitions = append(responseTopic.Partitions, responsePartition)
+			}
+			response.Topics = append(response.Topics, responseTopic)
+		}
+		return response, nil, true
+	})
+}
+
+func TestProducer_failures(t *testing.T) {
+	tests := []struct {
+		name         string
+		fail         func(*kfake.Cluster)
+		batchSize    int
+		routes       []Route
+		wantLog      []string
+		wantEvents   int
+		wantRejected []string
+		wantErr      error
+	}{
+		{
+			name: "Transient failure",
+			fail: func(cluster *kfake.Cluster) {
+				failProduce(cluster, kerr.NotLeaderForPartition.Code, 1)
+			},
+			wantLog:    []string{"m1", "big", "m3"},
+			wantEvents: 3,
+		},
+		{
+			name:         "Refused event",
+			batchSize:    MinBatchSize,
+			wantLog:      []string{"m1", "m3"},
+			wantEvents:   2,
+			wantRejected: []string{"big"},
+		},
+		{
+			name:         "No topic",
+			routes:       []Route{{"m*", "events"}},
+			wantLog:      []string{"m1", "m3"},
+			wantEvents:   2,
+			wantRejected: []string{"big"},
+		},
+		{
+			name: "Permanent failure",
+			fail: func(cluster *kfake.Cluster) {
+				failProduce(cluster, kerr.TopicAuthorizationFailed.Code, -1)
+			},
+			wantErr: kerr.TopicAuthorizationFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster := testCluster(t, map[string]int32{"events": 1})
+			if tt.fail != nil {
+				tt.fail(cluster)
+			}
+			router := NewRouter("events")
+			if tt.routes != nil {
+				router = NewRouter("").WithRoutes(RouteByEvent, tt.routes...)
+			}
+			producer := NewProducer(cluster.ListenAddrs(), router)
+			if tt.batchSize > 0 {
+				producer.WithBatchSize(tt.batchSize)
+			}
+			defer producer.Close()
+			w := producer.Open(context.Background())
+			for _, id := range []string{"m1", "big", "m3"} {
+				kind := "PipelineRun"
+				if id == "big" {
+					kind = strings.Repeat("x", MinBatchSize)
+				}
+				err := w.WriteEvent([]byte(trackEvent(id, "u1", id, kind)))
+				if err != nil {
+					assert.ErrorIs(t, err, ErrNoTopic)
+				}
+			}
+			err := w.Close()
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			var log []string
+			for _, r := range consume(t, cluster.ListenAddrs(), "events", len(tt.wantLog)) {
+				log = append(log, strings.Split(r.value, `"`)[3])
+			}
+			assert.Equal(t, tt.wantLog, log)
+			stats := w.Stats()
+			assert.Equal(t, tt.wantEvents, stats.Events)
+			var rejected []string
+			for _, eventErr := range stats.Rejected {
+				rejected = append(rejected, strings.Split(string(eventErr.Event), `"`)[3])
+			}
+			assert.Equal(t, tt.wantRejected, rejected)
+		})
+	}
+}
+
+func TestProducer_SASL(t *testing.T) {
+	cluster := testCluster(t, map[string]int32{"events": 1},
+		kfake.EnableSASL(), kfake.Superuser("SCRAM-SHA-512", "bridge", "secret"),
+	)
+	for _, tt := range []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{"Valid credentials", "secret", false},
+		{"Invalid credentials", "wrong", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mechanism, err := SASLMechanism("SCRAM-SHA-512", "bridge", tt.password)
+			require.NoError(t, err)
+			producer := NewProducer(cluster.ListenAddrs(), NewRouter("events")).
+				WithSASL(mechanism).
+				WithRetries(1)
+			defer producer.Close()
+			// The fake cluster drops the connections of clients that fail to
+			// authenticate, which the client retries until the context is done
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			w := producer.Open(ctx)
+			require.NoError(t, w.WriteEvent([]byte(trackEvent("m1", "u1", "Build Started", "PipelineRun"))))
+			err = w.Close()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, 1, w.Stats().Events)
+		})
+	}
+}
+
+func TestSASLMechanism(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		wantName string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{"plain", "PLAIN", false},
+		{"SCRAM-SHA-256", "SCRAM-SHA-256", false},
+		{"SCRAM-SHA-512", "SCRAM-SHA-512", false},
+		{"GSSAPI", "", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mechanism, err := SASLMechanism(tt.name, "user", "password")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if tt.wantName == "" {
+				assert.Nil(t, mechanism)
+				return
+			}
+			require.Implements(t, (*sasl.Mechanism)(nil), mechanism)
+			assert.Equal(t, tt.wantName, mechanism.Name())
+		})
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	config, err := TLSConfig("", "", "")
+	require.NoError(t, err)
+	assert.Nil(t, config.RootCAs, "the system CA certificates are trusted")
+	assert.Empty(t, config.Certificates)
+
+	_, err = TLSConfig("", "client.crt", "")
+	assert.ErrorContains(t, err, "must be given together")
+	_, err = TLSConfig(t.TempDir()+"/missing.crt", "", "")
+	assert.ErrorContains(t, err, "failed to read the CA certificates")
+}
+
+func TestProducer_broker(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs a Kafka broker container")
+	}
+	kafkabroker.WithKafkaContainer(t, func(fi containerfixture.FixtureInfo) {
+		brokers := []string{kafkabroker.Address(fi)}
+		createTopic(t, brokers, "builds", 3)
+
+		producer := NewProducer(brokers, NewRouter("builds"))
+		defer producer.Close()
+		events := []string{
+			trackEvent("m1", "u1", "Build Started", "PipelineRun"),
+			trackEvent("m2", "u2", "Build Started", "PipelineRun"),
+			trackEvent("m3", "u1", "Build Completed", "PipelineRun"),
+			trackEvent("m4", "u2", "Build Completed", "PipelineRun"),
+		}
+		w := producer.Open(context.Background())
+		for _, event := range events {
+			require.NoError(t, w.WriteEvent([]byte(event)))
+		}
+		require.NoError(t, w.Close())
+		assert.Equal(t, 4, w.Stats().Events)
+
+		u1, u2 := int32(Partition([]byte("u1"), 3)), int32(Partition([]byte("u2"), 3))
+		assert.Equal(t,
+			map[int32][]string{u1: {events[0], events[2]}, u2: {events[1], events[3]}},
+			byPartition(consume(t, brokers, "builds", 4)),
+		)
+	})
+}
+
+// createTopic creates a topic with the given number of partitions
+func createTopic(t *testing.T, brokers []string, topic string, partitions int32) {
+	client, err := kgo.NewClient(kgo.SeedBrokers(brokers...))
+	require.NoError(t, err)
+	defer client.Close()
+	request := kmsg.NewPtrCreateTopicsRequest()
+	requestTopic := kmsg.NewCreateTopicsRequestTopic()
+	requestTopic.Topic = topic
+	requestTopic.NumPartitions = partitions
+	requestTopic.ReplicationFactor = 1
+	request.Topics = append(request.Topics, requestTopic)
+	response, err := request.RequestWith(context.Background(), client)
+	require.NoError(t, err)
+	require.NoError(t, kerr.ErrorForCode(response.Topics[0].ErrorCode))
+}
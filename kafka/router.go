@@ -0,0 +1,125 @@
+package kafka
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// RouteBy names the event field topics are chosen by
+type RouteBy string
+
+const (
+	// RouteByEvent routes events by their name, which is the event name of
+	// track calls and "identify" or "group" for other calls
+	RouteByEvent RouteBy = "event"
+	// RouteByKind routes events by the kind of resource they are about, as
+	// found in properties.kind
+	RouteByKind RouteBy = "kind"
+)
+
+// Route sends the events whose routing field matches Pattern, in path.Match
+// syntax, to Topic
+type Route struct {
+	Pattern string
+	Topic   string
+}
+
+// Router chooses the topic of each event by matching one of its fields
+// against a list of routes, and falls back to a default topic
+type Router struct {
+	by     RouteBy
+	routes []Route
+	topic  string
+}
+
+// NewRouter constructs a Router sending all events to the given topic
+func NewRouter(topic string) *Router {
+	return &Router{by: RouteByEvent, topic: topic}
+}
+
+// WithRoutes sets the field events are routed by and the routes to match it
+// against, where the first matching route wins
+func (r *Router) WithRoutes(by RouteBy, routes ...Route) *Router {
+	r.by = by
+	r.routes = routes
+	return r
+}
+
+// Topic returns the topic of an event with the given name and kind, or "" if
+// no route matches it and there is no default topic
+func (r *Router) Topic(name, kind string) string {
+	value := name
+	if r.by == RouteByKind {
+		value = kind
+	}
+	for _, route := range r.routes {
+		if ok, _ := path.Match(route.Pattern, value); ok {
+			return route.Topic
+		}
+	}
+	return r.topic
+}
+
+// ParseRoutes parses a comma-separated list of PATTERN=TOPIC routes
+func ParseRoutes(s string) ([]Route, error) {
+	var routes []Route
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		pattern, topic, ok := strings.Cut(item, "=")
+		pattern, topic = strings.TrimSpace(pattern), strings.TrimSpace(topic)
+		if !ok || pattern == "" || topic == "" {
+			return nil, fmt.Errorf("invalid route %q, expected PATTERN=TOPIC", item)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid route pattern %q", pattern)
+		}
+		routes = append(routes, Route{Pattern: pattern, Topic: topic})
+	}
+	return routes, nil
+}
+
+// Partition returns the partition of a topic with the given number of
+// partitions that records with the given key go to. It matches the default
+// partitioner of the Java client, so records are partitioned the same way as
+// records with the same keys produced by other clients.
+func Partition(key []byte, partitions int) int {
+	return int(murmur2(key)&0x7fffffff) % partitions
+}
+
+// murmur2 is the 32-bit MurmurHash2 variant used by the Java client
+func murmur2(data []byte) int32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	length := len(data)
+	h := uint32(seed) ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := uint32(data[i]) | uint32(data[i+1])<<8 | uint32(data[i+2])<<16 | uint32(data[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
@@ -0,0 +1,58 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_Topic(t *testing.T) {
+	routes := []Route{{"Build *", "builds"}, {"identify", "users"}, {"*Run", "runs"}}
+	tests := []struct {
+		name   string
+		router *Router
+		event  string
+		kind   string
+		want   string
+	}{
+		{"Default topic", NewRouter("events"), "Build Started", "PipelineRun", "events"},
+		{"By event", NewRouter("events").WithRoutes(RouteByEvent, routes...), "Build Started", "", "builds"},
+		{"By event, first match wins", NewRouter("events").WithRoutes(RouteByEvent, routes...), "identify", "", "users"},
+		{"By event, no match", NewRouter("events").WithRoutes(RouteByEvent, routes...), "Deployment Created", "", "events"},
+		{"By kind", NewRouter("events").WithRoutes(RouteByKind, routes...), "Build Started", "PipelineRun", "runs"},
+		{"No default topic", NewRouter("").WithRoutes(RouteByKind, routes...), "Build Started", "Component", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.router.Topic(tt.event, tt.kind))
+		})
+	}
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("Build *=builds, identify = users,,")
+	require.NoError(t, err)
+	assert.Equal(t, []Route{{"Build *", "builds"}, {"identify", "users"}}, routes)
+
+	for _, invalid := range []string{"builds", "=builds", "Build *=", "[Build=builds"} {
+		_, err := ParseRoutes(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	// The hashes the Java client computes for these keys, from its unit tests
+	for key, want := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	} {
+		assert.Equal(t, want, murmur2([]byte(key)), key)
+	}
+	assert.Equal(t, int(479470107%12), Partition([]byte("abc"), 12))
+	assert.Equal(t, int((-973932308&0x7fffffff)%12), Partition([]byte("21"), 12))
+}
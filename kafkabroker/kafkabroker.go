@@ -0,0 +1,55 @@
+package kafkabroker
+
+import (
+	"context"
+	_ "embed"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/redhat-appstudio/segment-bridge.git/containerfixture"
+)
+
+const serviceUpTimeout = 2 * time.Minute
+
+//go:embed kafkabroker_container_template.tmpl
+var kafkaServiceManifest string
+
+// Address returns the host:port address of the broker of the given fixture
+func Address(fi containerfixture.FixtureInfo) string {
+	return "localhost:" + fi.ApiPort
+}
+
+// WithKafkaContainer runs the given test function against a single node Kafka
+// cluster running in a container, once it is ready to serve requests
+func WithKafkaContainer(t *testing.T, testFunc func(containerfixture.FixtureInfo)) {
+	containerfixture.WithServiceContainer(
+		t, kafkaServiceManifest,
+		func(fi containerfixture.FixtureInfo) {
+			requireBrokerIsUp(t, Address(fi))
+			testFunc(fi)
+		})
+}
+
+// requireBrokerIsUp waits for the broker at the given address to answer
+// requests
+func requireBrokerIsUp(t *testing.T, addr string) {
+	client, err := kgo.NewClient(kgo.SeedBrokers(addr))
+	if err != nil {
+		t.Fatalf("failed to configure the Kafka client: %s", err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), serviceUpTimeout)
+	defer cancel()
+	for {
+		err := client.Ping(ctx)
+		if err == nil {
+			return
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("The Kafka broker is not up: %s", err)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,171 @@
+package querygen
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/redhat-appstudio/segment-bridge.git/queryprint"
+	"sigs.k8s.io/yaml"
+)
+
+//go:embed events.yaml
+var defaultEventDefinitions []byte
+
+// EventDefinitions is a set of user journey event definitions as loaded from a
+// YAML or JSON event definition file
+type EventDefinitions struct {
+	Events []EventDefinition `json:"events"`
+}
+
+// EventDefinition describes how to generate a Splunk query for obtaining a
+// type of user journey events
+type EventDefinition struct {
+	// Title describes the events the query generates
+	Title string `json:"title"`
+	// APIGroup and Resource specify the K8s API objects to search audit
+	// records of
+	APIGroup string `json:"apiGroup"`
+	Resource string `json:"resource"`
+	// Predicate is added to the leading search command
+	Predicate string `json:"predicate"`
+	// Filters are added to the query in the given order
+	Filters []FilterDefinition `json:"filters,omitempty"`
+	// Commands are raw Splunk commands added to the query after the filters
+	Commands []string `json:"commands,omitempty"`
+	// Event is a Splunk 'eval' expression for the event name. If not given,
+	// the default event naming logic is used.
+	Event string `json:"event,omitempty"`
+	// Fields are added to the output of the query
+	Fields []string `json:"fields,omitempty"`
+}
+
+// FilterDefinition describes a Filter. Exactly one of its members must be set.
+type FilterDefinition struct {
+	StatusCondition  *StatusConditionDefinition  `json:"statusCondition,omitempty"`
+	TektonTaskResult *TektonTaskResultDefinition `json:"tektonTaskResult,omitempty"`
+}
+
+// StatusConditionDefinition describes a StatusConditionFilter
+type StatusConditionDefinition struct {
+	Type     string   `json:"type"`
+	Reasons  []string `json:"reasons,omitempty"`
+	Statuses []string `json:"statuses,omitempty"`
+	Message  string   `json:"message,omitempty"`
+}
+
+// TektonTaskResultDefinition describes a TektonTaskResultFilter
+type TektonTaskResultDefinition struct {
+	Name string `json:"name"`
+}
+
+// DefaultEventDefinitions returns the event definitions embedded in the
+// package, which describe all the user journey events we currently generate.
+// Errors in them are reported by 'querygen lint' when the image is built.
+func DefaultEventDefinitions() (*EventDefinitions, error) {
+	defs, err := ParseEventDefinitions(defaultEventDefinitions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded event definitions: %w", err)
+	}
+	return defs, nil
+}
+
+// LoadEventDefinitions reads event definitions from the given file
+func LoadEventDefinitions(path string) (*EventDefinitions, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadEventDefinitions(f)
+}
+
+// ReadEventDefinitions reads YAML or JSON event definitions from the given
+// reader
+func ReadEventDefinitions(r io.Reader) (*EventDefinitions, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEventDefinitions(data)
+}
+
+// ParseEventDefinitions parses YAML or JSON event definitions. Unknown keys
+// are treated as errors so typos do not go unnoticed.
+func ParseEventDefinitions(data []byte) (*EventDefinitions, error) {
+	var defs EventDefinitions
+	if err := yaml.UnmarshalStrict(data, &defs); err != nil {
+		return nil, fmt.Errorf("failed to parse event definitions: %w", err)
+	}
+	for i, def := range defs.Events {
+		if err := def.check(); err != nil {
+			return nil, fmt.Errorf("invalid definition for event #%d (%q): %w", i+1, def.Title, err)
+		}
+	}
+	return &defs, nil
+}
+
+// check verifies the definition includes all the details needed for
+// generating a query
+func (d *EventDefinition) check() error {
+	if d.Title == "" {
+		return errors.New("missing title")
+	}
+	if d.Resource == "" {
+		return errors.New("missing resource")
+	}
+	for i, filter := range d.Filters {
+		if (filter.StatusCondition == nil) == (filter.TektonTaskResult == nil) {
+			return fmt.Errorf(
+				"filter #%d must specify exactly one of statusCondition or tektonTaskResult", i+1,
+			)
+		}
+	}
+	return nil
+}
+
+// Filter returns the Filter the definition describes
+func (d *FilterDefinition) Filter() Filter {
+	if d.StatusCondition != nil {
+		filter := NewStatusConditionFilter(d.StatusCondition.Type)
+		filter.opts.reasons = d.StatusCondition.Reasons
+		filter.opts.statuses = d.StatusCondition.Statuses
+		filter.opts.message = d.StatusCondition.Message
+		return filter
+	}
+	return NewTektonTaskResultFilter(d.TektonTaskResult.Name)
+}
+
+// Query returns a UserJourneyQuery builder for the event definition
+func (d *EventDefinition) Query(index string) *UserJourneyQuery {
+	q := NewUserJourneyQuery(index, K8sApiId{d.APIGroup, d.Resource}).
+		WithPredicate(d.Predicate)
+	for i := range d.Filters {
+		q.WithFilter(d.Filters[i].Filter())
+	}
+	q.WithCommands(d.Commands...)
+	if d.Event != "" {
+		q.WithEventExpr(d.Event)
+	}
+	return q.WithFields(d.Fields...)
+}
+
+// Queries generates the queries for all the event definitions along with their
+// titles
+func (d *EventDefinitions) Queries(index string) ([]queryprint.QueryDesc, error) {
+	queries := make([]queryprint.QueryDesc, 0, len(d.Events))
+	for i := range d.Events {
+		query, err := d.Events[i].Query(index).Pipeline()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate query for %q: %w", d.Events[i].Title, err)
+		}
+		queries = append(queries, queryprint.QueryDesc{
+			Title:    d.Events[i].Title,
+			Query:    query.String(),
+			Pipeline: query,
+		})
+	}
+	return queries, nil
+}
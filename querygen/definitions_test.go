@@ -0,0 +1,114 @@
+package querygen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventDefinition_Query(t *testing.T) {
+	defs, err := ReadEventDefinitions(strings.NewReader(dedent.Dedent(`
+		events:
+		  - title: Object events
+		    apiGroup: api1.com
+		    resource: objects
+		    predicate: >-
+		      verb=update
+		      "responseStatus.code"=200
+		    filters:
+		      - statusCondition:
+		          type: Ready
+		          reasons: [Done, Failed]
+		          statuses: ["True"]
+		          message: "All done*"
+		      - tektonTaskResult:
+		          name: RESULT
+		    commands:
+		      - eval foo="bar"
+		    event: '"Object updated"'
+		    fields: [name, status_reason]
+	`)))
+	require.NoError(t, err)
+	require.Len(t, defs.Events, 1)
+
+	statusFilter := NewStatusConditionFilter("Ready")
+	statusFilter.opts.reasons = []string{"Done", "Failed"}
+	statusFilter.opts.statuses = []string{"True"}
+	statusFilter.opts.message = "All done*"
+	want, err := NewUserJourneyQuery("idx", K8sApiId{"api1.com", "objects"}).
+		WithPredicate(`verb=update "responseStatus.code"=200`).
+		WithFilter(statusFilter).
+		WithFilter(NewTektonTaskResultFilter("RESULT")).
+		WithCommands(`eval foo="bar"`).
+		WithEventExpr(`"Object updated"`).
+		WithFields("name", "status_reason").
+		String()
+	require.NoError(t, err)
+
+	queries, err := defs.Queries("idx")
+	require.NoError(t, err)
+	require.Len(t, queries, 1)
+	assert.Equal(t, "Object events", queries[0].Title)
+	assert.Equal(t, want, queries[0].Query)
+}
+
+func TestParseEventDefinitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "JSON",
+			data: `{"events":[{"title":"t","apiGroup":"g","resource":"r","fields":["name"]}]}`,
+		},
+		{
+			name:    "Unknown key",
+			data:    `{"events":[{"title":"t","resource":"r","feilds":["name"]}]}`,
+			wantErr: "feilds",
+		},
+		{
+			name:    "Missing title",
+			data:    `{"events":[{"resource":"r"}]}`,
+			wantErr: "missing title",
+		},
+		{
+			name:    "Missing resource",
+			data:    `{"events":[{"title":"t"}]}`,
+			wantErr: "missing resource",
+		},
+		{
+			name:    "Empty filter",
+			data:    `{"events":[{"title":"t","resource":"r","filters":[{}]}]}`,
+			wantErr: "exactly one",
+		},
+		{
+			name: "Ambiguous filter",
+			data: `{"events":[{"title":"t","resource":"r","filters":[` +
+				`{"statusCondition":{"type":"x"},"tektonTaskResult":{"name":"y"}}]}]}`,
+			wantErr: "exactly one",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseEventDefinitions([]byte(tt.data))
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEventDefinitions_QueriesUnknownField(t *testing.T) {
+	defs, err := ParseEventDefinitions([]byte(
+		`{"events":[{"title":"t","resource":"r","fields":["not-found"]}]}`,
+	))
+	require.NoError(t, err)
+	_, err = defs.Queries("idx")
+	assert.ErrorContains(t, err, `"t"`)
+}
@@ -0,0 +1,38 @@
+package querygen
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapingInBuilders(t *testing.T) {
+	filter := NewStatusConditionFilter(`Ready"`)
+	filter.opts.reasons = []string{`a"b`}
+	filter.opts.statuses = []string{`c\d`}
+	filter.opts.message = `50% "done"`
+	assert.Equal(t, []string{
+		`eval status_condition_index=mvfind('responseObject.status.conditions{}.type',"Ready\"")`,
+		`where isnotnull(status_condition_index)` +
+			` AND mvindex('responseObject.status.conditions{}.reason',status_condition_index) IN ("a\"b")` +
+			` AND mvindex('responseObject.status.conditions{}.status',status_condition_index) IN ("c\\d")` +
+			` AND like(mvindex('responseObject.status.conditions{}.message',status_condition_index),"50% \"done\"")`,
+	}, renderCommands(filter.Commands()))
+
+	kfs := K8sAuditFieldSet{K8sApiId{}: FieldSet{
+		"odd.field/name": {srcFields: []string{"a{}/b", "it's"}},
+		"json_key":       {subObj: "properties", srcFields: []string{`quo"te`}},
+	}}
+	q, err := kfs.QueryGen(
+		`idx" OR index="*`, K8sApiId{`g"`, `r\`}, "", []string{"odd.field/name", "json_key"},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`search index="idx\" OR index=\"*" log_type=audit "objectRef.apiGroup"="g\"" "objectRef.resource"="r\\"`+
+			`|eval 'odd.field/name'=if(isnull('a{}/b'),'it\'s','a{}/b'),`+
+			`properties=json_object("json_key",'quo"te')`+
+			`|fields "odd.field/name",properties`+
+			`|`+excludeFieldsCmd,
+		q,
+	)
+}
@@ -3,7 +3,8 @@ package querygen
 import (
 	"fmt"
 	"sort"
-	"strings"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spl"
 )
 
 const (
@@ -40,69 +41,69 @@ type FieldSetSpec struct {
 // the given fields. The values for the fields and how to present them in the
 // output are determined from the FieldSet
 func (fs FieldSet) QueryGen(searchExpr string, fields []string) (string, error) {
-	var queryElements, evalElements []string
-	var err error
-	if evalElements, err = fs.collectEvalElements(fields); err != nil {
+	commands, err := fs.outputCommands(fields)
+	if err != nil {
 		return "", err
 	}
-	queryElements = append(
-		queryElements,
-		searchExpr,
-	)
-	if len(evalElements) > 0 {
-		queryElements = append(queryElements, "eval "+commaSep(evalElements))
-	}
-	queryElements = append(
-		queryElements,
-		"fields "+commaSep(fs.collectIncludeFields()),
-		excludeFieldsCmd,
-	)
-	return strings.Join(queryElements, "|"), nil
+	return append(spl.Pipeline{spl.RawCommand(searchExpr)}, commands...).String(), nil
 }
 
-func commaSep(words []string) string {
-	return strings.Join(words, ",")
+// outputCommands generates the Splunk commands for generating the given output
+// fields and removing all other fields from the output
+func (fs FieldSet) outputCommands(fields []string) (spl.Pipeline, error) {
+	var commands spl.Pipeline
+	eval, err := fs.collectEvalElements(fields)
+	if err != nil {
+		return nil, err
+	}
+	if len(eval) > 0 {
+		commands = append(commands, eval)
+	}
+	return append(
+		commands,
+		spl.Fields{Names: fs.collectIncludeFields()},
+		spl.RawCommand(excludeFieldsCmd),
+	), nil
 }
 
-// collectEvalElements generates a list of Splunk `eval` expressions for
-// generating the values for the given output fields.
-func (fs FieldSet) collectEvalElements(fields []string) ([]string, error) {
-	var evalElements, subObjects []string
-	subObjectFields := map[string][]string{}
+// collectEvalElements generates a Splunk `eval` command for generating the
+// values for the given output fields.
+func (fs FieldSet) collectEvalElements(fields []string) (spl.Eval, error) {
+	var evalElements spl.Eval
+	var subObjects []string
+	subObjectFields := map[string][]spl.Expr{}
 
 	for _, field := range fields {
 		if spec, ok := fs[field]; ok {
-			expr := spec.srcExpr
-			if expr == "" {
+			var expr spl.Expr
+			if spec.srcExpr != "" {
+				expr = spl.Raw(spec.srcExpr)
+			} else {
 				expr = mkFieldSrcEvalExpr(spec.srcFields)
 			}
 			if spec.subObj == "" {
-				if expr != "" {
-					evalElements = append(evalElements, field+"="+expr)
+				if expr != nil {
+					evalElements = append(evalElements, spl.Assignment{Field: field, Value: expr})
 				}
 				continue
 			}
-			if expr == "" {
-				expr = sQuot(field)
+			if expr == nil {
+				expr = spl.Field(field)
 			}
 			sof, ok := subObjectFields[spec.subObj]
 			if !ok {
 				subObjects = append(subObjects, spec.subObj)
 			}
-			subObjectFields[spec.subObj] = append(sof, dQuot(field), expr)
+			subObjectFields[spec.subObj] = append(sof, spl.Str(field), expr)
 		} else {
-			return []string{}, fmt.Errorf(`no field specification for: "%s"`, field)
+			return nil, fmt.Errorf(`no field specification for: "%s"`, field)
 		}
 	}
 	for _, subObject := range subObjects {
-		evalElements = append(
-			evalElements,
-			fmt.Sprintf(
-				"%s=json_object(%s)",
-				subObject,
-				commaSep(subObjectFields[subObject]),
-			),
-		)
+		evalElements = append(evalElements, spl.Assignment{
+			Field: subObject,
+			Value: spl.Call{Func: "json_object", Args: subObjectFields[subObject]},
+		})
 	}
 	return evalElements, nil
 }
@@ -125,29 +126,22 @@ func (fs FieldSet) collectIncludeFields() (fields []string) {
 
 // mkFieldSrcEvalExpr generates a Splunk `eval` expression for getting the value
 // from the given srcFields so that each field in the list is a fallback for the
-// ones before it.
+// ones before it. It returns nil if srcFields is empty.
 //
 // Example: given srcFields = {"a", "b", "c"}
 //
 //	if(isnull('a'),if(isnull('b'),'c','b'),'a')
-func mkFieldSrcEvalExpr(srcFields []string) string {
+func mkFieldSrcEvalExpr(srcFields []string) spl.Expr {
 	if len(srcFields) <= 0 {
-		return ""
+		return nil
 	}
-	expr := sQuot(srcFields[len(srcFields)-1])
+	var expr spl.Expr = spl.Field(srcFields[len(srcFields)-1])
 	for i := len(srcFields) - 2; i >= 0; i-- {
-		expr = fmt.Sprintf(
-			"if(isnull('%s'),%s,'%s')",
-			srcFields[i], expr, srcFields[i],
-		)
+		ref := spl.Field(srcFields[i])
+		expr = spl.Call{
+			Func: "if",
+			Args: []spl.Expr{spl.Call{Func: "isnull", Args: []spl.Expr{ref}}, expr, ref},
+		}
 	}
 	return expr
 }
-
-func dQuot(v string) string {
-	return fmt.Sprintf(`"%s"`, v)
-}
-
-func sQuot(v string) string {
-	return fmt.Sprintf(`'%s'`, v)
-}
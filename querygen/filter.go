@@ -2,13 +2,14 @@ package querygen
 
 import (
 	"fmt"
-	"strings"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spl"
 )
 
 // The Filter interface must be implemented by each filter.
 type Filter interface {
 	// Commands provides a sequence of Splunk commands for narrowing down search results.
-	Commands() []string
+	Commands() spl.Pipeline
 	// FieldSet returns a map of all possible fields that can be included in the output
 	// from this filter.
 	FieldSet() FieldSet
@@ -58,37 +59,38 @@ func (f *StatusConditionFilter) FieldSet() FieldSet {
 	}
 }
 
-func (f *StatusConditionFilter) Commands() []string {
-	evalCmd := fmt.Sprintf(
-		`eval %s=mvfind('responseObject.status.conditions{}.type', "%s")`,
-		f.indexField, f.cType,
-	)
-	whereCmd := fmt.Sprintf(`where isnotnull(%s)`, f.indexField)
+func (f *StatusConditionFilter) Commands() spl.Pipeline {
+	conditionsField := func(name string) spl.Expr {
+		return spl.Call{
+			Func: "mvindex",
+			Args: []spl.Expr{spl.Field("responseObject.status.conditions{}." + name), spl.Ident(f.indexField)},
+		}
+	}
+	evalCmd := spl.Eval{{
+		Field: f.indexField,
+		Value: spl.Call{
+			Func: "mvfind",
+			Args: []spl.Expr{spl.Field("responseObject.status.conditions{}.type"), spl.Regex(f.cType)},
+		},
+	}}
+	cond := spl.And{spl.Call{Func: "isnotnull", Args: []spl.Expr{spl.Ident(f.indexField)}}}
 
 	if len(f.opts.reasons) > 0 {
-		whereCmd += fmt.Sprintf(
-			` AND mvindex('responseObject.status.conditions{}.reason', %s) IN (%s)`,
-			f.indexField,
-			`"`+strings.Join(f.opts.reasons, `", "`)+`"`,
-		)
+		cond = append(cond, spl.In{Expr: conditionsField("reason"), Values: spl.Strs(f.opts.reasons...)})
 	}
 
 	if len(f.opts.statuses) > 0 {
-		whereCmd += fmt.Sprintf(
-			` AND mvindex('responseObject.status.conditions{}.status', %s) IN (%s)`,
-			f.indexField,
-			`"`+strings.Join(f.opts.statuses, `", "`)+`"`,
-		)
+		cond = append(cond, spl.In{Expr: conditionsField("status"), Values: spl.Strs(f.opts.statuses...)})
 	}
 
 	if f.opts.message != "" {
-		whereCmd += fmt.Sprintf(
-			` AND like(mvindex('responseObject.status.conditions{}.message', %s), "%s")`,
-			f.indexField, f.opts.message,
-		)
+		cond = append(cond, spl.Call{
+			Func: "like",
+			Args: []spl.Expr{conditionsField("message"), spl.Str(f.opts.message)},
+		})
 	}
 
-	return []string{evalCmd, whereCmd}
+	return spl.Pipeline{evalCmd, spl.Where{Cond: cond}}
 }
 
 // TektonTaskResultFilter will match audit records for Tekton TaskRun resources
@@ -117,12 +119,15 @@ func (f *TektonTaskResultFilter) FieldSet() FieldSet {
 	}
 }
 
-func (f *TektonTaskResultFilter) Commands() []string {
-	return []string{
-		fmt.Sprintf(
-			`eval %s=mvfind('responseObject.status.taskResults{}.name', "%s")`,
-			f.indexField, f.name,
-		),
-		fmt.Sprintf(`where isnotnull(%s)`, f.indexField),
+func (f *TektonTaskResultFilter) Commands() spl.Pipeline {
+	return spl.Pipeline{
+		spl.Eval{{
+			Field: f.indexField,
+			Value: spl.Call{
+				Func: "mvfind",
+				Args: []spl.Expr{spl.Field("responseObject.status.taskResults{}.name"), spl.Regex(f.name)},
+			},
+		}},
+		spl.Where{Cond: spl.Call{Func: "isnotnull", Args: []spl.Expr{spl.Ident(f.indexField)}}},
 	}
 }
@@ -3,9 +3,19 @@ package querygen
 import (
 	"testing"
 
+	"github.com/redhat-appstudio/segment-bridge.git/spl"
 	"github.com/stretchr/testify/assert"
 )
 
+// renderCommands renders each of the given commands in compact form
+func renderCommands(commands spl.Pipeline) []string {
+	rendered := make([]string, len(commands))
+	for i, cmd := range commands {
+		rendered[i] = cmd.String()
+	}
+	return rendered
+}
+
 func TestStatusConditionFilter(t *testing.T) {
 	f := NewStatusConditionFilter("TestType")
 	f.opts.reasons = []string{"r1", "r2"}
@@ -14,13 +24,13 @@ func TestStatusConditionFilter(t *testing.T) {
 
 	assert.Equal(t,
 		[]string{
-			`eval status_condition_index=mvfind('responseObject.status.conditions{}.type', "TestType")`,
+			`eval status_condition_index=mvfind('responseObject.status.conditions{}.type',"TestType")`,
 			`where isnotnull(status_condition_index) ` +
-				`AND mvindex('responseObject.status.conditions{}.reason', status_condition_index) IN ("r1", "r2") ` +
-				`AND mvindex('responseObject.status.conditions{}.status', status_condition_index) IN ("s1", "s2") ` +
-				`AND like(mvindex('responseObject.status.conditions{}.message', status_condition_index), "prefix % postfix")`,
+				`AND mvindex('responseObject.status.conditions{}.reason',status_condition_index) IN ("r1", "r2") ` +
+				`AND mvindex('responseObject.status.conditions{}.status',status_condition_index) IN ("s1", "s2") ` +
+				`AND like(mvindex('responseObject.status.conditions{}.message',status_condition_index),"prefix % postfix")`,
 		},
-		f.Commands(),
+		renderCommands(f.Commands()),
 	)
 }
 
@@ -29,9 +39,9 @@ func TestTektonTaskResultFilter(t *testing.T) {
 
 	assert.Equal(t,
 		[]string{
-			`eval tekton_task_result_index=mvfind('responseObject.status.taskResults{}.name', "result-a")`,
+			`eval tekton_task_result_index=mvfind('responseObject.status.taskResults{}.name',"result-a")`,
 			`where isnotnull(tekton_task_result_index)`,
 		},
-		f.Commands(),
+		renderCommands(f.Commands()),
 	)
 }
@@ -1,8 +1,7 @@
 package querygen
 
 import (
-	"fmt"
-	"strings"
+	"github.com/redhat-appstudio/segment-bridge.git/spl"
 )
 
 // K8sApiId defines a K8s API by including details about the API group and
@@ -23,16 +22,38 @@ type K8sAuditFieldSet map[K8sApiId]FieldSet
 func (kfs K8sAuditFieldSet) QueryGen(
 	index string, api K8sApiId, searchExpr string, fields []string, extra ...FieldSet,
 ) (string, error) {
-	searchCmd := strings.TrimSpace(fmt.Sprintf(
-		`search index="%s" log_type=audit `+
-			`"objectRef.apiGroup"="%s" `+
-			`"objectRef.resource"="%s" `+
-			`%s`,
-		index,
-		api.apiGroup,
-		api.resource,
-		searchExpr,
-	))
+	query, err := kfs.pipeline(index, api, searchExpr, nil, fields, extra...)
+	if err != nil {
+		return "", err
+	}
+	return query.String(), nil
+}
+
+// pipeline generates a Splunk query for audit records of the given API that
+// match the predicate, processed by the given commands. The output of the
+// query includes the given fields.
+func (kfs K8sAuditFieldSet) pipeline(
+	index string, api K8sApiId, predicate string, commands spl.Pipeline, fields []string, extra ...FieldSet,
+) (spl.Pipeline, error) {
+	search := spl.Search{
+		spl.Compare{Left: spl.SearchField("index"), Op: "=", Right: spl.Str(index)},
+		spl.Raw("log_type=audit"),
+		spl.Compare{Left: spl.SearchField("objectRef.apiGroup"), Op: "=", Right: spl.Str(api.apiGroup)},
+		spl.Compare{Left: spl.SearchField("objectRef.resource"), Op: "=", Right: spl.Str(api.resource)},
+		spl.Raw(predicate),
+	}
+	output, err := kfs.merged(api, extra...).outputCommands(fields)
+	if err != nil {
+		return nil, err
+	}
+	query := append(spl.Pipeline{search}, commands...)
+	return append(query, output...), nil
+}
+
+// merged returns the FieldSet used for querying the given API, made by adding
+// together the zero-value fields, the fields for the API and the given extra
+// fields
+func (kfs K8sAuditFieldSet) merged(api K8sApiId, extra ...FieldSet) FieldSet {
 	allFieldSets := []FieldSet{kfs[K8sApiId{}], kfs[api]}
 	allFieldSets = append(allFieldSets, extra...)
 	fieldSet := FieldSet{}
@@ -41,6 +62,5 @@ func (kfs K8sAuditFieldSet) QueryGen(
 			fieldSet[fld] = spec
 		}
 	}
-
-	return fieldSet.QueryGen(searchCmd, fields)
+	return fieldSet
 }
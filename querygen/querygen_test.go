@@ -4,43 +4,102 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Tests in this file are simply making sure we're getting queries back
 // which means we're passing in valid field names. Our query generation code
 // already makes sure that the queries we generate are valid
 
+// genQuery returns the query GenAllQueries generates with the given title
+func genQuery(t *testing.T, title string) string {
+	t.Helper()
+	queries, err := GenAllQueries("some_index")
+	require.NoError(t, err)
+	for _, query := range queries {
+		if query.Title == title {
+			return query.Query
+		}
+	}
+	require.Failf(t, "query not generated", "no query titled %q", title)
+	return ""
+}
+
 func TestGenApplicationQuery(t *testing.T) {
-	out := GenApplicationQuery("some_index")
+	out := genQuery(t, "Application events")
 	assert.NotEqual(t, "", out)
+	assert.Contains(t, out, `search index="some_index"`)
+	assert.Contains(t, out, `"objectRef.resource"="applications"`)
+}
+
+func TestGenComponentQuery(t *testing.T) {
+	out := genQuery(t, "Component events")
+	assert.NotEqual(t, "", out)
+	assert.Contains(t, out, `search index="some_index"`)
+	assert.Contains(t, out, `"objectRef.resource"="components"`)
 }
 
 func TestGenBuildPipelineRunCreatedQuery(t *testing.T) {
-	out := GenBuildPipelineRunCreatedQuery("some_index")
+	out := genQuery(t, "Build PipelineRun creation events")
 	assert.NotEqual(t, "", out)
+	assert.Contains(t, out, `search index="some_index"`)
+	assert.Contains(t, out, `event="Build PipelineRun created"`)
 }
 
 func TestGenBuildPipelineRunStartedQuery(t *testing.T) {
-	out := GenBuildPipelineRunStartedQuery("some_index")
+	out := genQuery(t, "Build PipelineRun started events")
 	assert.NotEqual(t, "", out)
+	assert.Contains(t, out, `search index="some_index"`)
+	assert.Contains(t, out, `event="Build PipelineRun started"`)
 }
 
 func TestGenClairScanCompletedQuery(t *testing.T) {
-	out := GenClairScanCompletedQuery("some_index")
+	out := genQuery(t, "Clair scan TaskRun completion events")
 	assert.NotEqual(t, "", out)
+	assert.Contains(t, out, `search index="some_index"`)
+	assert.Contains(t, out, `event="Clair scan TaskRun completed"`)
 }
 
 func TestGenBuildPipelineRunCompletedQuery(t *testing.T) {
-	out := GenBuildPipelineRunCompletedQuery("some_index")
+	out := genQuery(t, "Build PipelineRun Completed or Failed events")
 	assert.NotEqual(t, "", out)
+	assert.Contains(t, out, `search index="some_index"`)
+	assert.Contains(t, out, `event="Build PipelineRun ended"`)
 }
 
 func TestGenReleaseCompletedQuery(t *testing.T) {
-	out := GenReleaseCompletedQuery("some_index")
+	out := genQuery(t, "Release Succeeded or Failed events")
 	assert.NotEqual(t, "", out)
+	assert.Contains(t, out, `search index="some_index"`)
+	assert.Contains(t, out, `event="Release process done"`)
 }
 
 func TestGenPullRequestCreatedQuery(t *testing.T) {
-	out := GenPullRequestCreatedQuery("some_index")
+	out := genQuery(t, "Pull Request created events")
 	assert.NotEqual(t, "", out)
+	assert.Contains(t, out, `search index="some_index"`)
+	assert.Contains(t, out, `event="Pull request created"`)
+}
+
+func TestGenAllQueries(t *testing.T) {
+	queries, err := GenAllQueries("some_index")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Application events",
+		"Component events",
+		"Build PipelineRun creation events",
+		"Build PipelineRun started events",
+		"Clair scan TaskRun completion events",
+		"Build PipelineRun Completed or Failed events",
+		"Release Succeeded or Failed events",
+		"Pull Request created events",
+	}, func() (titles []string) {
+		for _, query := range queries {
+			titles = append(titles, query.Title)
+		}
+		return
+	}())
+	for _, query := range queries {
+		assert.NotEqual(t, "", query.Query, "Empty query for: %s", query.Title)
+	}
 }
@@ -2,7 +2,8 @@ package querygen
 
 import (
 	"sort"
-	"strings"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spl"
 )
 
 var UJFieldSet = K8sAuditFieldSet{
@@ -122,7 +123,7 @@ type UserJourneyQuery struct {
 
 	// Additional Splunk commands to execute in order immediately after the search
 	// command.
-	commands []string
+	commands spl.Pipeline
 
 	// Fields to return from the query
 	fields []string
@@ -160,7 +161,9 @@ func (q *UserJourneyQuery) WithPredicate(predicate string) *UserJourneyQuery {
 // WithCommands adds raw Splunk commands to the query.
 // Each call appends to the existing set of commands so order of invocation is important.
 func (q *UserJourneyQuery) WithCommands(commands ...string) *UserJourneyQuery {
-	q.commands = append(q.commands, commands...)
+	for _, command := range commands {
+		q.commands = append(q.commands, spl.RawCommand(command))
+	}
 	return q
 }
 
@@ -168,7 +171,8 @@ func (q *UserJourneyQuery) WithCommands(commands ...string) *UserJourneyQuery {
 // Each call appends to the existing set of commands so order of invocation is important.
 func (q *UserJourneyQuery) WithFilter(filter Filter) *UserJourneyQuery {
 	q.filterFieldSets = append(q.filterFieldSets, filter.FieldSet())
-	return q.WithCommands(filter.Commands()...)
+	q.commands = append(q.commands, filter.Commands()...)
+	return q
 }
 
 // WithFields adds fields to the output of the query.
@@ -188,12 +192,23 @@ func (q *UserJourneyQuery) WithEventExpr(expr string) *UserJourneyQuery {
 	return q
 }
 
-// String builds the Splunk query.
-func (q *UserJourneyQuery) String() (string, error) {
+// Pipeline builds the Splunk query.
+func (q *UserJourneyQuery) Pipeline() (spl.Pipeline, error) {
 	sort.Strings(q.fields) // To make test results predictable
 
-	commands := append([]string{q.predicate}, q.commands...)
-	query := strings.Join(commands, " | ")
+	return UJFieldSet.pipeline(q.index, q.subject, q.predicate, q.commands, q.fields, q.filterFieldSets...)
+}
+
+// String builds the Splunk query and renders it in compact form.
+func (q *UserJourneyQuery) String() (string, error) {
+	query, err := q.Pipeline()
+	if err != nil {
+		return "", err
+	}
+	return query.String(), nil
+}
 
-	return UJFieldSet.QueryGen(q.index, q.subject, query, q.fields, q.filterFieldSets...)
+// fieldSet returns the FieldSet used for generating the query output fields
+func (q *UserJourneyQuery) fieldSet() FieldSet {
+	return UJFieldSet.merged(q.subject, q.filterFieldSets...)
 }
@@ -3,6 +3,7 @@ package querygen
 import (
 	"testing"
 
+	"github.com/redhat-appstudio/segment-bridge.git/spl"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -15,8 +16,8 @@ func (f *TestFilter) FieldSet() FieldSet {
 	}
 }
 
-func (f *TestFilter) Commands() []string {
-	return []string{`eval tf1="hello"`, `eval tf2="world"`}
+func (f *TestFilter) Commands() spl.Pipeline {
+	return spl.Pipeline{spl.RawCommand(`eval tf1="hello"`), spl.RawCommand(`eval tf2="world"`)}
 }
 
 func TestUserJourneyQuery(t *testing.T) {
@@ -31,10 +32,10 @@ func TestUserJourneyQuery(t *testing.T) {
 	assert.Equal(t,
 		`search index="idx" log_type=audit `+
 			`"objectRef.apiGroup"="api1.com" "objectRef.resource"="objects" `+
-			`verb=created `+
-			`| eval foo="bar" `+
-			`| eval tf1="hello" `+
-			`| eval tf2="world"`+
+			`verb=created`+
+			`|eval foo="bar"`+
+			`|eval tf1="hello"`+
+			`|eval tf2="world"`+
 			`|eval event="Event Name",`+
 			`event_subject='objectRef.resource',`+
 			`event_verb='verb',`+
@@ -0,0 +1,164 @@
+package querygen
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spl"
+)
+
+// auditRecordFields lists the top-level fields of K8s audit records. Query
+// fields may only be generated from fields that are either found in audit
+// records or are the output of one of the commands in the query.
+var auditRecordFields = map[string]bool{
+	"annotations":              true,
+	"apiVersion":               true,
+	"auditID":                  true,
+	"impersonatedUser":         true,
+	"kind":                     true,
+	"level":                    true,
+	"objectRef":                true,
+	"requestObject":            true,
+	"requestReceivedTimestamp": true,
+	"requestURI":               true,
+	"responseObject":           true,
+	"responseStatus":           true,
+	"sourceIPs":                true,
+	"stage":                    true,
+	"stageTimestamp":           true,
+	"user":                     true,
+	"userAgent":                true,
+	"verb":                     true,
+}
+
+// exprFieldRefRx matches the field references in a Splunk 'eval' expression
+var exprFieldRefRx = regexp.MustCompile(`'([^']+)'`)
+
+// Validate checks that the query can be generated and that it only uses fields
+// that are available when it runs. It returns an error describing all the
+// problems found, or nil if there are none.
+func (q *UserJourneyQuery) Validate() error {
+	fieldSet := q.fieldSet()
+	var errs []error
+
+	for _, field := range q.fields {
+		if _, ok := fieldSet[field]; !ok {
+			errs = append(errs, fmt.Errorf("unknown field %q", field))
+		}
+	}
+
+	subObjects := map[string]bool{}
+	for _, spec := range fieldSet {
+		if spec.subObj != "" {
+			subObjects[spec.subObj] = true
+		}
+	}
+	for _, field := range sortedKeys(fieldSet) {
+		if fieldSet[field].subObj == "" && subObjects[field] {
+			errs = append(errs, fmt.Errorf("top-level field %q collides with a sub-object of the same name", field))
+		}
+	}
+
+	produced := map[string]bool{}
+	for _, command := range q.commands {
+		for _, output := range spl.Outputs(command) {
+			produced[output] = true
+		}
+	}
+	for _, field := range uniqueSorted(q.fields) {
+		spec, ok := fieldSet[field]
+		if !ok {
+			continue
+		}
+		for _, src := range spec.inputFields(field) {
+			root, _, _ := strings.Cut(src, ".")
+			if !auditRecordFields[root] && !produced[src] {
+				errs = append(errs, fmt.Errorf(
+					"field %q uses %q which is neither an audit record field nor produced by the query commands",
+					field, src,
+				))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// inputFields returns the input fields the value of the given output field is
+// generated from
+func (spec *FieldSetSpec) inputFields(field string) []string {
+	if spec.srcExpr != "" {
+		var fields []string
+		for _, m := range exprFieldRefRx.FindAllStringSubmatch(spec.srcExpr, -1) {
+			fields = append(fields, m[1])
+		}
+		return fields
+	}
+	if len(spec.srcFields) > 0 {
+		return spec.srcFields
+	}
+	return []string{field}
+}
+
+// Validate checks all the event definitions, as well as that no two
+// definitions share the same title or event name
+func (d *EventDefinitions) Validate() error {
+	var errs []error
+	titles := map[string]bool{}
+	eventNames := map[string]string{}
+	for i := range d.Events {
+		def := &d.Events[i]
+		if titles[def.Title] {
+			errs = append(errs, fmt.Errorf("duplicate event definition title %q", def.Title))
+		}
+		titles[def.Title] = true
+		if def.Event != "" {
+			if other, ok := eventNames[def.Event]; ok {
+				errs = append(errs, fmt.Errorf(
+					"%q: event name %s is already used by %q", def.Title, def.Event, other,
+				))
+			} else {
+				eventNames[def.Event] = def.Title
+			}
+		}
+		if err := def.Query("").Validate(); err != nil {
+			for _, err := range unwrapJoined(err) {
+				errs = append(errs, fmt.Errorf("%q: %w", def.Title, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// unwrapJoined returns the errors joined into err, or err itself if it is not
+// a joined error
+func unwrapJoined(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+func sortedKeys(fs FieldSet) []string {
+	keys := make([]string, 0, len(fs))
+	for key := range fs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func uniqueSorted(words []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, word := range words {
+		if !seen[word] {
+			seen[word] = true
+			unique = append(unique, word)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
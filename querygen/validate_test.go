@@ -0,0 +1,100 @@
+package querygen
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spl"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type collidingFilter struct{}
+
+func (f *collidingFilter) FieldSet() FieldSet {
+	return FieldSet{"properties": {srcFields: []string{"verb"}}}
+}
+
+func (f *collidingFilter) Commands() spl.Pipeline { return nil }
+
+func TestUserJourneyQuery_Validate(t *testing.T) {
+	api := K8sApiId{"tekton.dev", "taskruns"}
+	tests := []struct {
+		name    string
+		query   *UserJourneyQuery
+		wantErr []string
+	}{
+		{
+			name: "Valid query",
+			query: NewUserJourneyQuery("idx", api).
+				WithFilter(NewStatusConditionFilter("Succeeded")).
+				WithEventExpr(`"Something happened"`).
+				WithFields("name", "application", "status_reason"),
+		},
+		{
+			name:    "Unknown field",
+			query:   NewUserJourneyQuery("idx", api).WithFields("name", "nmae"),
+			wantErr: []string{`unknown field "nmae"`},
+		},
+		{
+			name: "Sub-object name collision",
+			query: NewUserJourneyQuery("idx", api).
+				WithFilter(&collidingFilter{}),
+			wantErr: []string{`top-level field "properties" collides`},
+		},
+		{
+			name:  "Missing intermediate output",
+			query: NewUserJourneyQuery("idx", api).WithFields("vulnerabilities_low", "merge_url"),
+			wantErr: []string{
+				`"merge_url" uses "build_status.pac.merge-url"`,
+				`"vulnerabilities_low" uses "clair_scan_result.vulnerabilities.low"`,
+			},
+		},
+		{
+			name: "Intermediate output produced",
+			query: NewUserJourneyQuery("idx", api).
+				WithCommands(
+					`eval clair_scan_result="{}"`,
+					`spath input=clair_scan_result, path=vulnerabilities.low output=clair_scan_result.vulnerabilities.low`,
+				).
+				WithFields("vulnerabilities_low"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			for _, want := range tt.wantErr {
+				assert.ErrorContains(t, err, want)
+			}
+		})
+	}
+}
+
+func TestEventDefinitions_Validate(t *testing.T) {
+	defs, err := ParseEventDefinitions([]byte(`{"events":[
+		{"title":"A","resource":"applications","event":"\"Created\"","fields":["name"]},
+		{"title":"B","resource":"components","event":"\"Created\"","fields":["merge_url"]},
+		{"title":"A","resource":"components","fields":["name"]}
+	]}`))
+	assert.NoError(t, err)
+	err = defs.Validate()
+	assert.ErrorContains(t, err, `duplicate event definition title "A"`)
+	assert.ErrorContains(t, err, `"B": event name "Created" is already used by "A"`)
+	assert.ErrorContains(t, err, `"B": field "merge_url" uses "build_status.pac.merge-url"`)
+}
+
+func TestDefaultEventDefinitions_Validate(t *testing.T) {
+	defs, err := DefaultEventDefinitions()
+	require.NoError(t, err)
+	assert.NoError(t, defs.Validate())
+}
+
+func TestUnwrapJoined(t *testing.T) {
+	err1, err2 := errors.New("one"), errors.New("two")
+	assert.Equal(t, []error{err1, err2}, unwrapJoined(errors.Join(err1, err2)))
+	assert.Equal(t, []error{err1}, unwrapJoined(err1))
+}
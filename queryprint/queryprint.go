@@ -1,13 +1,20 @@
 // Package queryprint contains utilities for printing one or more Splunk queries
 package queryprint
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/redhat-appstudio/segment-bridge.git/spl"
+)
 
 // QueryDesc includes a printable description of a Splunk query: A descriptive
 // title for it and the query string itself.
 type QueryDesc struct {
 	Title string
 	Query string
+	// Pipeline optionally includes the structure of the query. When given,
+	// it is used for pretty-printing instead of the query string.
+	Pipeline spl.Pipeline
 }
 
 // PrettyPrintQueries prints the given set of queries in a human-readable format
@@ -22,26 +29,10 @@ func PrettyPrintQueries(queries []QueryDesc) string {
 		builder.WriteString("\n")
 		builder.WriteString(strings.Repeat("-", len(query.Title)))
 		builder.WriteString("\n")
-		builder.WriteString(prettyPrintQuery(query.Query, "    "))
-	}
-	return builder.String()
-}
-
-func prettyPrintQuery(query string, indent string) string {
-	var builder strings.Builder
-	if len(query) < 60 {
-		builder.WriteString(indent)
-		builder.WriteString(query)
-	} else {
-		for i, line := range strings.Split(query, "|") {
-			if i > 0 {
-				builder.WriteString("\n")
-			}
-			builder.WriteString(indent)
-			if i > 0 {
-				builder.WriteString("|")
-			}
-			builder.WriteString(line)
+		if query.Pipeline != nil {
+			builder.WriteString(query.Pipeline.Pretty("    "))
+		} else {
+			builder.WriteString(spl.PrettyText(query.Query, "    "))
 		}
 	}
 	return builder.String()
@@ -25,9 +25,9 @@ func TestPrettyPrintQueries(t *testing.T) {
 		{
 			name: "With a few short queries",
 			queries: []QueryDesc{
-				{"foo", "search index=foo"},
-				{"foo count", "search index=foo | stats count by bar"},
-				{"foo baz", "search index=foo bar=baz | fields bar, bal"},
+				{Title: "foo", Query: "search index=foo"},
+				{Title: "foo count", Query: "search index=foo | stats count by bar"},
+				{Title: "foo baz", Query: "search index=foo bar=baz | fields bar, bal"},
 			},
 			want: strings.TrimSpace(Dedent(`
 				foo
@@ -46,8 +46,8 @@ func TestPrettyPrintQueries(t *testing.T) {
 		{
 			name: "With a long query",
 			queries: []QueryDesc{{
-				"Some long query",
-				`search index=some_long_index_name log_type=awesome match=value` +
+				Title: "Some long query",
+				Query: `search index=some_long_index_name log_type=awesome match=value` +
 					`|eval custom_field=some_expression,` +
 					`other_field=other_expression` +
 					`|fields fields,shown,in,results`,
@@ -89,9 +89,9 @@ func TestMachinePrintQueries(t *testing.T) {
 		{
 			name: "With a few short queries",
 			queries: []QueryDesc{
-				{"foo", "search index=foo"},
-				{"foo count", "search index=foo | stats count by bar"},
-				{"foo baz", "search index=foo bar=baz | fields bar, bal"},
+				{Title: "foo", Query: "search index=foo"},
+				{Title: "foo count", Query: "search index=foo | stats count by bar"},
+				{Title: "foo baz", Query: "search index=foo bar=baz | fields bar, bal"},
 			},
 			want: "search index=foo\x00" +
 				"search index=foo | stats count by bar\x00" +
@@ -100,8 +100,8 @@ func TestMachinePrintQueries(t *testing.T) {
 		{
 			name: "With a long query",
 			queries: []QueryDesc{{
-				"Some long query",
-				`search index=some_long_index_name log_type=awesome match=value` +
+				Title: "Some long query",
+				Query: `search index=some_long_index_name log_type=awesome match=value` +
 					`|eval custom_field=some_expression,` +
 					`other_field=other_expression` +
 					`|fields fields,shown,in,results`,
@@ -120,6 +120,6 @@ jq \
       userId: $ssoId,
       event: (.event // "\($evsm[0][.event_subject] // .event_subject) \($evvm[0][.event_verb] // .event_verb)"),
       properties: (.properties|fromjson|.workspaceID=$wsSsoId),
-      context: (.context|fromjson)
+      context: (.context|fromjson|.groupId=$wsSsoId)
     }
   '
@@ -11,6 +11,4 @@
 #
 set -o pipefail -o errexit -o nounset -o xtrace
 
-oc create configmap --dry-run=client -o yaml uid-map \
-  --from-file=uid-map.json=<(KUBECONFIG="$KUBECONFIG_SRC" get-uid-map.sh) \
-| oc apply -f -
+segment-bridge uid-map --kubeconfig="$KUBECONFIG_SRC" --configmap=uid-map
@@ -6,11 +6,19 @@
 #   RHTAP clusters. We also expect to have configuration in place for connecting
 #   to the local cluster.
 #
+#   The member clusters to read are given via the CONTEXTS or WS_MAP_CLUSTERS
+#   environment variables. If neither is set, the staging member clusters are
+#   read.
+#
 #   This script is meant for when running things in some background job, it may
 #   add things like monitoring and log formatting.
 #
 set -o pipefail -o errexit -o nounset -o xtrace
 
-oc create configmap --dry-run=client -o yaml ws-map \
-  --from-file=ws-map.json=<(KUBECONFIG="$KUBECONFIG_SRC" get-workspace-map.sh) \
-| oc apply -f -
+if [[ -z "${CONTEXTS:-}" ]]; then
+  export WS_MAP_CLUSTERS="${WS_MAP_CLUSTERS:-\
+api-stone-stg-m01-7ayg-p1-openshiftapps-com:6443 \
+api-stone-stg-rh01-l2vh-p1-openshiftapps-com:6443}"
+fi
+
+segment-bridge ws-map --kubeconfig="$KUBECONFIG_SRC" --configmap=ws-map
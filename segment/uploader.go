@@ -0,0 +1,310 @@
+// Package segment includes a client for uploading event records into the
+// Segment batch API
+package segment
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+)
+
+const (
+	// DefaultBatchAPI is the URL of the Segment batch API
+	DefaultBatchAPI = "https://api.segment.io/v1/batch"
+	// MaxBatchSize is the maximum request size the Segment batch API accepts
+	MaxBatchSize = 500 * 1024
+	// MaxEventSize is the maximum size of a single event record within a
+	// batch call
+	MaxEventSize = 32 * 1024
+	// DefaultBatchDataSize is the default size of a batch call payload we
+	// send. We send 490KB to leave some room for HTTP headers.
+	DefaultBatchDataSize = 490 * 1024
+	// DefaultRetries is how many times we retry a failed batch call by
+	// default
+	DefaultRetries = httpretry.DefaultRetries
+
+	batchPrefix = `{"batch":[`
+	batchSuffix = `]}`
+
+	// MinBatchSize is the size of the smallest batch call payload, which
+	// holds a single empty event
+	MinBatchSize = len(batchPrefix) + len(`{}`) + len(batchSuffix)
+)
+
+// ErrEventTooLarge is returned (wrapped in an EventError) for events that are
+// too large to be sent to Segment
+var ErrEventTooLarge = errors.New("event is larger than the allowed size")
+
+// ErrInvalidEvent is returned (wrapped in an EventError) for events that are
+// not valid JSON objects
+var ErrInvalidEvent = sink.ErrInvalidEvent
+
+// ErrEventRefused is returned (wrapped in an EventError) for events Segment
+// refused as invalid. Those are found by splitting batches Segment refused
+// until the offending events are sent on their own.
+var ErrEventRefused = errors.New("event was refused by Segment")
+
+// errBadBatch is returned by send when Segment refused a batch as invalid
+var errBadBatch = errors.New("segment refused the batch as invalid")
+
+// EventError reports an event that was rejected by the uploader and was not
+// sent to Segment
+type EventError = sink.EventError
+
+// UploadStats includes details about the events and batches sent by the
+// uploader
+type UploadStats = sink.Stats
+
+// BatchUploader packs Segment event records into batches and sends them to the
+// Segment batch API
+type BatchUploader struct {
+	apiURL       string
+	client       *http.Client
+	writeKey     string
+	batchSize    int
+	maxEventSize int
+	policy       *httpretry.Policy
+}
+
+// NewBatchUploader constructs a default BatchUploader that sends batches to
+// the given Segment batch API URL
+func NewBatchUploader(apiURL string) *BatchUploader {
+	return &BatchUploader{
+		apiURL:       apiURL,
+		client:       http.DefaultClient,
+		batchSize:    DefaultBatchDataSize,
+		maxEventSize: MaxEventSize,
+		policy:       httpretry.NewPolicy(),
+	}
+}
+
+// WithClient sets the HTTP client used for making the API calls
+func (u *BatchUploader) WithClient(client *http.Client) *BatchUploader {
+	u.client = client
+	return u
+}
+
+// WithWriteKey sets the Segment source write key used to authenticate the API
+// calls
+func (u *BatchUploader) WithWriteKey(writeKey string) *BatchUploader {
+	u.writeKey = writeKey
+	return u
+}
+
+// WithBatchSize sets the maximum size in bytes of each batch call payload.
+// Values are clamped between MinBatchSize and MaxBatchSize.
+func (u *BatchUploader) WithBatchSize(size int) *BatchUploader {
+	u.batchSize = min(max(size, MinBatchSize), MaxBatchSize)
+	return u
+}
+
+// WithRetries sets how many times a failed batch call is retried
+func (u *BatchUploader) WithRetries(retries int) *BatchUploader {
+	u.policy.WithRetries(retries)
+	return u
+}
+
+// WithRetryPolicy sets the policy for retrying failed batch calls
+func (u *BatchUploader) WithRetryPolicy(policy *httpretry.Policy) *BatchUploader {
+	u.policy = policy
+	return u
+}
+
+// Upload reads newline-delimited JSON event records from the given reader and
+// sends them to Segment in batches. Events that cannot be sent are reported in
+// the returned stats rather than causing the upload to fail. An error is
+// returned if reading the input or calling the Segment API fails.
+func (u *BatchUploader) Upload(ctx context.Context, r io.Reader) (UploadStats, error) {
+	w := u.NewWriter(ctx)
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return w.Stats(), readErr
+		}
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			if err := w.WriteEvent(data); err != nil {
+				var eventErr *EventError
+				if !errors.As(err, &eventErr) {
+					return w.Stats(), err
+				}
+				eventErr.Line = line
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+	}
+	err := w.Close()
+	return w.Stats(), err
+}
+
+// NewWriter returns an EventWriter for streaming events to Segment via this
+// uploader
+func (u *BatchUploader) NewWriter(ctx context.Context) *EventWriter {
+	return &EventWriter{ctx: ctx, uploader: u}
+}
+
+// Open makes the BatchUploader a sink.Sink
+func (u *BatchUploader) Open(ctx context.Context) sink.Writer {
+	return u.NewWriter(ctx)
+}
+
+// EventWriter accumulates events into batches and sends each batch once it is
+// full. Close must be called to send the last batch.
+type EventWriter struct {
+	ctx      context.Context
+	uploader *BatchUploader
+	// pending holds the compacted events of the current batch
+	pending [][]byte
+	// size is the size of the current batch payload without the suffix
+	size  int
+	stats UploadStats
+}
+
+// WriteEvent adds the given JSON event record to the current batch, sending
+// the batch first if the event does not fit in it. If the event cannot be sent
+// at all, an *EventError is returned and the event is recorded in the rejected
+// events list.
+func (w *EventWriter) WriteEvent(event []byte) error {
+	compact, err := sink.Compact(event)
+	if err != nil {
+		return w.reject(len(event), err, nil)
+	}
+	if len(compact) > w.maxEventSize() {
+		return w.reject(len(compact), ErrEventTooLarge, nil)
+	}
+	if len(w.pending) > 0 && w.size+1+len(compact)+len(batchSuffix) > w.uploader.batchSize {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	if len(w.pending) == 0 {
+		w.size = len(batchPrefix)
+	} else {
+		w.size++
+	}
+	w.pending = append(w.pending, compact)
+	w.size += len(compact)
+	return nil
+}
+
+// Flush sends any events accumulated in the current batch. The batch is
+// dropped if sending it fails, since part of it may have been sent after
+// splitting it, so the events are left for the caller to send again.
+func (w *EventWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	if w.stats.Statuses == nil {
+		w.stats.Statuses = map[int]int{}
+	}
+	err := w.sendBatch(w.pending)
+	w.pending, w.size = nil, 0
+	return err
+}
+
+// sendBatch sends the given events in a batch call. If Segment refuses the
+// batch as invalid, it is split in halves that are sent separately, so the
+// valid events get sent and the invalid ones are found and rejected.
+func (w *EventWriter) sendBatch(events [][]byte) error {
+	var payload bytes.Buffer
+	payload.WriteString(batchPrefix)
+	for i, event := range events {
+		if i > 0 {
+			payload.WriteByte(',')
+		}
+		payload.Write(event)
+	}
+	payload.WriteString(batchSuffix)
+	err := w.uploader.send(w.ctx, payload.Bytes(), w.stats.Statuses)
+	if errors.Is(err, errBadBatch) {
+		if len(events) == 1 {
+			_ = w.reject(len(events[0]), ErrEventRefused, events[0])
+			return nil
+		}
+		half := len(events) / 2
+		if err := w.sendBatch(events[:half]); err != nil {
+			return err
+		}
+		return w.sendBatch(events[half:])
+	}
+	if err != nil {
+		return err
+	}
+	w.stats.Events += len(events)
+	w.stats.Batches++
+	w.stats.Bytes += payload.Len()
+	return nil
+}
+
+// Close sends the last batch
+func (w *EventWriter) Close() error {
+	return w.Flush()
+}
+
+// Stats returns statistics about the events sent and rejected so far
+func (w *EventWriter) Stats() UploadStats {
+	return w.stats
+}
+
+// maxEventSize returns the size of the largest event we can send, which is
+// limited both by the Segment limit and by the configured batch size
+func (w *EventWriter) maxEventSize() int {
+	maxSize := w.uploader.batchSize - len(batchPrefix) - len(batchSuffix)
+	if w.uploader.maxEventSize < maxSize {
+		maxSize = w.uploader.maxEventSize
+	}
+	return maxSize
+}
+
+// reject records a rejected event. The event is kept if it was refused after
+// being accepted into a batch, so it can be told apart from the events that
+// were sent.
+func (w *EventWriter) reject(size int, reason error, event []byte) error {
+	err := &EventError{Size: size, Err: reason, Event: event}
+	w.stats.Rejected = append(w.stats.Rejected, err)
+	return err
+}
+
+// send POSTs the given payload to the batch API, retrying failed calls
+// according to the retry policy, and counts the HTTP status codes of the
+// responses. An error wrapping errBadBatch is returned if Segment refused the
+// batch as invalid.
+func (u *BatchUploader) send(ctx context.Context, payload []byte, statuses map[int]int) error {
+	resp, err := u.policy.Do(ctx, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.apiURL, bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if u.writeKey != "" {
+			req.SetBasicAuth(u.writeKey, "")
+		}
+		resp, err := u.client.Do(req)
+		if err == nil {
+			statuses[resp.StatusCode]++
+		}
+		return resp, err
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	err = fmt.Errorf("segment batch call failed with HTTP status: %s", resp.Status)
+	if resp.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%w: %w", errBadBatch, err)
+	}
+	return err
+}
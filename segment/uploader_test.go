@@ -1,16 +1,20 @@
-package main
+package segment
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 	"testing/quick"
 
 	"github.com/lithammer/dedent"
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
 	"github.com/redhat-appstudio/segment-bridge.git/scripts"
 	"github.com/redhat-appstudio/segment-bridge.git/stats"
 	"github.com/redhat-appstudio/segment-bridge.git/webfixture"
@@ -40,43 +44,226 @@ func TestUploader(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to find script to test: %v", err)
 	}
+	uploaders := []struct {
+		name, path string
+	}{
+		{"script", script},
+		{"binary", buildUploaderBinary(t)},
+	}
 	testCases := mkTestCases(t)
-	for _, tt := range testCases {
+	for _, uploader := range uploaders {
+		for _, tt := range testCases {
+			t.Run(uploader.name+"/"+tt.name, func(t *testing.T) {
+				testUploaderExecutable(t, uploader.path, tt)
+			})
+		}
+	}
+}
+
+func testUploaderExecutable(t *testing.T, script string, tt testCase) {
+	reqs := webfixture.TraceRequestsFrom(func(url string, _ *http.Client) {
+		t.Setenv("SEGMENT_BATCH_API", url)
+		t.Setenv("SEGMENT_BATCH_DATA_SIZE", fmt.Sprintf("%d", tt.maxBatchSize))
+
+		withScriptStdin(t, script, func(stdin io.WriteCloser) {
+			err := streamAsJsonLines(stdin, tt.data)
+			require.NoError(t, err)
+		})
+	})
+	assertBatchRequests(t, reqs, tt)
+}
+
+func TestBatchUploader_Upload(t *testing.T) {
+	for _, tt := range mkTestCases(t) {
 		t.Run(tt.name, func(t *testing.T) {
-			reqs := webfixture.TraceRequestsFrom(func(url string, _ *http.Client) {
-				t.Setenv("SEGMENT_BATCH_API", url)
-				t.Setenv("SEGMENT_BATCH_DATA_SIZE", fmt.Sprintf("%d", tt.maxBatchSize))
-
-				withScriptStdin(t, script, func(stdin io.WriteCloser) {
-					err := streamAsJsonLines(stdin, tt.data)
-					require.NoError(t, err)
-				})
+			reqs := webfixture.TraceRequestsFrom(func(url string, c *http.Client) {
+				reader, writer := io.Pipe()
+				go func() {
+					writer.CloseWithError(streamAsJsonLines(writer, tt.data))
+				}()
+				stats, err := NewBatchUploader(url).
+					WithClient(c).
+					WithBatchSize(tt.maxBatchSize).
+					Upload(context.Background(), reader)
+				require.NoError(t, err)
+				assert.Equal(t, len(tt.data), stats.Events)
+				assert.Empty(t, stats.Rejected)
 			})
+			assertBatchRequests(t, reqs, tt)
+		})
+	}
+}
 
-			if tt.shouldSplit {
-				assert.Greater(t, len(reqs), 1, "Data should be split to batches")
-			}
+func assertBatchRequests(t *testing.T, reqs []webfixture.RequestTrace, tt testCase) {
+	if tt.shouldSplit {
+		assert.Greater(t, len(reqs), 1, "Data should be split to batches")
+	}
 
-			requestRecords := 0
-			for _, request := range reqs {
-				assert.Equal(t, "POST", request.Method, "HTTP method must be POST")
+	requestRecords := 0
+	for _, request := range reqs {
+		assert.Equal(t, "POST", request.Method, "HTTP method must be POST")
 
-				var reqData segmentBatch
-				requireJSONDecode(
-					t, request.Body, &reqData,
-					"Failed to decode sent request JSON. "+
-						"Perhaps not sent with the right structure?",
-				)
+		var reqData segmentBatch
+		requireJSONDecode(
+			t, request.Body, &reqData,
+			"Failed to decode sent request JSON. "+
+				"Perhaps not sent with the right structure?",
+		)
 
-				requestRecords += len(reqData.Batch)
+		requestRecords += len(reqData.Batch)
 
-				assert.LessOrEqual(t, len(request.Body), tt.maxBatchSize)
+		assert.LessOrEqual(t, len(request.Body), tt.maxBatchSize)
+	}
+	assert.Equal(t, len(tt.data), requestRecords, "Wrong number of records sent")
+}
+
+func TestBatchUploader_RejectedEvents(t *testing.T) {
+	bigValue := strings.Repeat("x", MaxEventSize)
+	input := strings.Join([]string{
+		`{"event":"first"}`,
+		`{"event":"` + bigValue + `"}`,
+		`not json`,
+		`["not", "an", "object"]`,
+		``,
+		`{"event": "last"}`,
+	}, "\n")
+
+	var stats UploadStats
+	var err error
+	reqs := webfixture.TraceRequestsFrom(func(url string, c *http.Client) {
+		stats, err = NewBatchUploader(url).
+			WithClient(c).
+			Upload(context.Background(), strings.NewReader(input))
+	})
+	require.NoError(t, err)
+
+	require.Len(t, reqs, 1)
+	assert.Equal(t, `{"batch":[{"event":"first"},{"event":"last"}]}`, reqs[0].Body)
+	assert.Equal(t, 2, stats.Events)
+	assert.Equal(t, 1, stats.Batches)
+	assert.Equal(t, len(reqs[0].Body), stats.Bytes)
+
+	require.Len(t, stats.Rejected, 3)
+	assert.Equal(t, 2, stats.Rejected[0].Line)
+	assert.ErrorIs(t, stats.Rejected[0], ErrEventTooLarge)
+	assert.Equal(t, 3, stats.Rejected[1].Line)
+	assert.ErrorIs(t, stats.Rejected[1], ErrInvalidEvent)
+	assert.Equal(t, 4, stats.Rejected[2].Line)
+	assert.ErrorIs(t, stats.Rejected[2], ErrInvalidEvent)
+}
+
+func TestBatchUploader_Retries(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantCalls    int
+		wantRejected int
+	}{
+		{"Success", http.StatusOK, 1, 0},
+		{"Transient failure", http.StatusServiceUnavailable, 3, 0},
+		{"Refused event", http.StatusBadRequest, 1, 1},
+		{"Permanent failure", http.StatusUnauthorized, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				user, _, _ := r.BasicAuth()
+				assert.Equal(t, "some-key", user)
+				w.WriteHeader(tt.status)
+			}))
+			defer svr.Close()
+
+			stats, err := NewBatchUploader(svr.URL).
+				WithClient(svr.Client()).
+				WithWriteKey("some-key").
+				WithRetryPolicy(httpretry.NewPolicy().WithBackoff(0, 0)).
+				WithRetries(2).
+				Upload(context.Background(), strings.NewReader(`{"event":"foo"}`))
+			if tt.status == http.StatusOK || tt.wantRejected > 0 {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+			require.Len(t, stats.Rejected, tt.wantRejected)
+			for _, rejected := range stats.Rejected {
+				assert.Equal(t, `{"event":"foo"}`, string(rejected.Event))
 			}
-			assert.Equal(t, len(tt.data), requestRecords, "Wrong number of records sent")
+			assert.Equal(t, tt.wantCalls, calls)
+			assert.Equal(t, map[int]int{tt.status: tt.wantCalls}, stats.Statuses)
 		})
 	}
 }
 
+func TestBatchUploader_BadBatch(t *testing.T) {
+	var batchSizes []int
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Batch []map[string]string `json:"batch"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		batchSizes = append(batchSizes, len(body.Batch))
+		for _, event := range body.Batch {
+			if event["event"] == "bad" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+	}))
+	defer svr.Close()
+
+	input := `{"event":"a"}` + "\n" + `{"event":"bad"}` + "\n" + `{"event":"c"}` + "\n" + `{"event":"d"}`
+	stats, err := NewBatchUploader(svr.URL).
+		WithClient(svr.Client()).
+		Upload(context.Background(), strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, []int{4, 2, 1, 1, 2}, batchSizes)
+	assert.Equal(t, 3, stats.Events)
+	assert.Equal(t, 2, stats.Batches)
+	assert.Equal(t, map[int]int{http.StatusOK: 2, http.StatusBadRequest: 3}, stats.Statuses)
+	require.Len(t, stats.Rejected, 1)
+	assert.ErrorIs(t, stats.Rejected[0], ErrEventRefused)
+	assert.Equal(t, len(`{"event":"bad"}`), stats.Rejected[0].Size)
+}
+
+func TestEventWriter_FailedFlush(t *testing.T) {
+	var bodies []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer svr.Close()
+
+	w := NewBatchUploader(svr.URL).WithClient(svr.Client()).NewWriter(context.Background())
+	require.NoError(t, w.WriteEvent([]byte(`{"event":"a"}`)))
+	assert.Error(t, w.Flush())
+	require.NoError(t, w.WriteEvent([]byte(`{"event":"b"}`)))
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{`{"batch":[{"event":"a"}]}`, `{"batch":[{"event":"b"}]}`}, bodies)
+	assert.Equal(t, 1, w.Stats().Events)
+}
+
+func TestBatchUploader_WithBatchSize(t *testing.T) {
+	for _, size := range []int{-1, 0, 1} {
+		assert.Equal(t, MinBatchSize, NewBatchUploader("").WithBatchSize(size).batchSize)
+	}
+	assert.Equal(t, MaxBatchSize, NewBatchUploader("").WithBatchSize(MaxBatchSize+1).batchSize)
+
+	reqs := webfixture.TraceRequestsFrom(func(url string, c *http.Client) {
+		stats, err := NewBatchUploader(url).WithClient(c).WithBatchSize(0).
+			Upload(context.Background(), strings.NewReader("{}\n{}"))
+		require.NoError(t, err)
+		assert.Equal(t, 2, stats.Events)
+		assert.Empty(t, stats.Rejected)
+	})
+	assert.Len(t, reqs, 2)
+}
+
 func streamAsJsonLines(stream io.Writer, data []testRecord) error {
 	enc := json.NewEncoder(stream)
 	for _, record := range data {
@@ -110,6 +297,19 @@ func withScriptStdin(t *testing.T, script string, tFunc func(io.WriteCloser)) {
 	tFunc(stdin)
 }
 
+// buildUploaderBinary builds the segment-upload command into a temporary
+// directory and returns the path to the built binary
+func buildUploaderBinary(t *testing.T) string {
+	rootDir, err := scripts.GetRepoRootDir()
+	require.NoError(t, err)
+	binary := filepath.Join(t.TempDir(), "segment-upload")
+	cmd := exec.Command("go", "build", "-o", binary, "./cmd/segment-upload")
+	cmd.Dir = rootDir
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "Failed to build segment-upload: %s", output)
+	return binary
+}
+
 // Use the quick module to generate random test data
 func mkTestCases(t *testing.T) (cases []testCase) {
 	var records, bytes stats.Series[int]
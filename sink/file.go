@@ -0,0 +1,86 @@
+package sink
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultMaxFileSize is the size beyond which a RotatingFile moves on to a new
+// file by default
+const DefaultMaxFileSize = 100 * 1024 * 1024
+
+// RotatingFile is an io.WriteCloser that writes into a sequence of files,
+// moving on to the next one once the current one would grow beyond the
+// maximum size. The first file has the given path, and the following ones
+// have a sequence number inserted before the extension, e.g. events.ndjson,
+// events.1.ndjson, events.2.ndjson. Each write goes to a single file, so
+// writing whole lines at a time keeps lines from being split across files.
+// Files that exist when it is first written to are overwritten.
+type RotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+	index   int
+}
+
+// NewRotatingFile constructs a default RotatingFile with the given path
+func NewRotatingFile(path string) *RotatingFile {
+	return &RotatingFile{path: path, maxSize: DefaultMaxFileSize}
+}
+
+// WithMaxSize sets the size beyond which the next file is moved on to. Writes
+// larger than that still go into a single file.
+func (f *RotatingFile) WithMaxSize(size int64) *RotatingFile {
+	f.maxSize = size
+	return f
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file != nil && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.file.Close(); err != nil {
+			return 0, err
+		}
+		f.file = nil
+		f.index++
+	}
+	if f.file == nil {
+		file, err := os.Create(f.Name(f.index))
+		if err != nil {
+			return 0, err
+		}
+		f.file, f.size = file, 0
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Name returns the name of the file with the given sequence number
+func (f *RotatingFile) Name(index int) string {
+	if index == 0 {
+		return f.path
+	}
+	ext := filepath.Ext(f.path)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(f.path, ext), index, ext)
+}
+
+// Close closes the current file. Writing afterwards moves on to the next
+// file rather than overwriting it.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	f.index++
+	return err
+}
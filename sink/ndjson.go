@@ -0,0 +1,92 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// DefaultBufferSize is how many bytes of events an NDJSON writer buffers by
+// default before writing them out
+const DefaultBufferSize = 64 * 1024
+
+// NDJSONSink is a Sink that writes events as newline-delimited JSON into an
+// io.Writer, such as the standard output or a RotatingFile. The events of each
+// Writer are buffered and written out a batch of whole lines at a time, so
+// the lines of concurrent Writers are not interleaved.
+type NDJSONSink struct {
+	mu         sync.Mutex
+	out        io.Writer
+	bufferSize int
+}
+
+// NewNDJSONSink constructs a default NDJSONSink writing into the given writer
+func NewNDJSONSink(out io.Writer) *NDJSONSink {
+	return &NDJSONSink{out: out, bufferSize: DefaultBufferSize}
+}
+
+// WithBufferSize sets how many bytes of events each Writer buffers before
+// writing them out
+func (s *NDJSONSink) WithBufferSize(size int) *NDJSONSink {
+	s.bufferSize = size
+	return s
+}
+
+func (s *NDJSONSink) Open(_ context.Context) Writer {
+	return &ndjsonWriter{sink: s}
+}
+
+// write writes a batch of lines
+func (s *NDJSONSink) write(lines []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.out.Write(lines)
+	return err
+}
+
+type ndjsonWriter struct {
+	sink    *NDJSONSink
+	buf     bytes.Buffer
+	pending int
+	stats   Stats
+}
+
+func (w *ndjsonWriter) WriteEvent(event []byte) error {
+	compact, err := Compact(event)
+	if err != nil {
+		eventErr := &EventError{Size: len(event), Err: err}
+		w.stats.Rejected = append(w.stats.Rejected, eventErr)
+		return eventErr
+	}
+	w.buf.Write(compact)
+	w.buf.WriteByte('\n')
+	w.pending++
+	if w.buf.Len() >= w.sink.bufferSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+func (w *ndjsonWriter) Flush() error {
+	if w.pending == 0 {
+		return nil
+	}
+	if err := w.sink.write(w.buf.Bytes()); err != nil {
+		return err
+	}
+	w.stats.Events += w.pending
+	w.stats.Batches++
+	w.stats.Bytes += w.buf.Len()
+	w.buf.Reset()
+	w.pending = 0
+	return nil
+}
+
+func (w *ndjsonWriter) Close() error {
+	return w.Flush()
+}
+
+func (w *ndjsonWriter) Stats() Stats {
+	return w.stats
+}
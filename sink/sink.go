@@ -0,0 +1,105 @@
+// Package sink defines the destinations user journey events are delivered to,
+// and implements the destinations that write events as newline-delimited JSON
+// to a stream or to rotating files
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Sink is a destination events are delivered to
+type Sink interface {
+	// Open returns a Writer for delivering a stream of events, e.g. the
+	// events of a single query. Writers of the same Sink may be used
+	// concurrently.
+	Open(ctx context.Context) Writer
+}
+
+// Writer delivers a stream of events to a Sink. Writers may deliver events in
+// batches, so the outcome of writing an event may only be known once a later
+// event is written or the Writer is flushed.
+type Writer interface {
+	// WriteEvent hands the given JSON event record to the Writer. If the
+	// event cannot be delivered at all, an *EventError is returned and the
+	// event is recorded in the rejected events list.
+	WriteEvent(event []byte) error
+	// Flush delivers the events written so far
+	Flush() error
+	// Close delivers the remaining events. The Writer must not be used
+	// afterwards.
+	Close() error
+	// Stats reports the outcome of the events written so far
+	Stats() Stats
+}
+
+type queryKey struct{}
+
+// WithQuery returns a context recording the title of the query whose events
+// are written by the Writers opened with it
+func WithQuery(ctx context.Context, title string) context.Context {
+	return context.WithValue(ctx, queryKey{}, title)
+}
+
+// Query returns the title of the query recorded in the given context, which
+// sinks may use e.g. for partitioning events, or "" if none is
+func Query(ctx context.Context) string {
+	title, _ := ctx.Value(queryKey{}).(string)
+	return title
+}
+
+// Stats includes details about the events delivered by a Writer
+type Stats struct {
+	// Events is the number of events delivered
+	Events int
+	// Batches is the number of batches the events were delivered in
+	Batches int
+	// Bytes is the total size of the delivered batches
+	Bytes int
+	// Statuses counts the HTTP status codes of the responses of HTTP based
+	// destinations, including the responses of calls that were retried
+	Statuses map[int]int
+	// Rejected lists the events that were not delivered
+	Rejected []*EventError
+}
+
+// ErrInvalidEvent is returned (wrapped in an EventError) for events that are
+// not valid JSON objects
+var ErrInvalidEvent = errors.New("event is not a valid JSON object")
+
+// EventError reports an event that was rejected by a Writer and was not
+// delivered
+type EventError struct {
+	// The line number of the event in the input stream, if known
+	Line int
+	// The size of the event in bytes
+	Size int
+	// The reason why the event was rejected
+	Err error
+	// The rejected event, for Writers that keep it so it can be
+	// dead-lettered
+	Event []byte
+}
+
+func (e *EventError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("event in line %d (%d bytes): %v", e.Line, e.Size, e.Err)
+	}
+	return fmt.Sprintf("event (%d bytes): %v", e.Size, e.Err)
+}
+
+func (e *EventError) Unwrap() error { return e.Err }
+
+// Compact returns the given event with insignificant white space removed, or
+// an error wrapping ErrInvalidEvent if it is not a JSON object
+func Compact(event []byte) ([]byte, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, event); err != nil ||
+		compact.Len() == 0 || compact.Bytes()[0] != '{' {
+		return nil, ErrInvalidEvent
+	}
+	return compact.Bytes(), nil
+}
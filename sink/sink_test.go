@@ -0,0 +1,203 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNDJSONSink(t *testing.T) {
+	var out strings.Builder
+	writer := NewNDJSONSink(&out).WithBufferSize(20).Open(context.Background())
+
+	require.NoError(t, writer.WriteEvent([]byte(`{ "event": "a" }`)))
+	assert.Empty(t, out.String(), "Events are buffered")
+	require.NoError(t, writer.WriteEvent([]byte(`{"event":"b"}`)))
+	assert.Equal(t, "{\"event\":\"a\"}\n{\"event\":\"b\"}\n", out.String())
+
+	var eventErr *EventError
+	require.ErrorAs(t, writer.WriteEvent([]byte(`[1]`)), &eventErr)
+	assert.ErrorIs(t, eventErr, ErrInvalidEvent)
+	require.NoError(t, writer.WriteEvent([]byte(`{"event":"c"}`)))
+	require.NoError(t, writer.Close())
+	assert.Equal(t, "{\"event\":\"a\"}\n{\"event\":\"b\"}\n{\"event\":\"c\"}\n", out.String())
+
+	stats := writer.Stats()
+	assert.Equal(t, 3, stats.Events)
+	assert.Equal(t, 2, stats.Batches)
+	assert.Equal(t, out.Len(), stats.Bytes)
+	require.Len(t, stats.Rejected, 1)
+	assert.Equal(t, 3, stats.Rejected[0].Size)
+}
+
+func TestNDJSONSink_concurrentWriters(t *testing.T) {
+	var out strings.Builder
+	sink := NewNDJSONSink(&out).WithBufferSize(30)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			writer := sink.Open(context.Background())
+			for j := 0; j < 50; j++ {
+				assert.NoError(t, writer.WriteEvent([]byte(fmt.Sprintf(`{"writer":%d,"event":%d}`, i, j))))
+			}
+			assert.NoError(t, writer.Close())
+		}(i)
+	}
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	assert.Len(t, lines, 200)
+	for _, line := range lines {
+		assert.Regexp(t, `^\{"writer":\d,"event":\d+\}$`, line)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	file := NewRotatingFile(path).WithMaxSize(10)
+	for _, data := range []string{"12345\n", "678\n", "9\n", "a very long line\n", "b\n"} {
+		_, err := file.Write([]byte(data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, file.Close())
+	_, err := file.Write([]byte("after close\n"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	for name, want := range map[string]string{
+		"events.ndjson":   "12345\n678\n",
+		"events.1.ndjson": "9\n",
+		"events.2.ndjson": "a very long line\n",
+		"events.3.ndjson": "b\n",
+		"events.4.ndjson": "after close\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(filepath.Dir(path), name))
+		require.NoError(t, err, name)
+		assert.Equal(t, want, string(data), name)
+	}
+}
+
+// batchingSink is a stand-in for sinks delivering events in batches. It
+// rejects events containing "skip" right away, and those containing "refuse"
+// when flushing them, and fails to deliver batches with events containing
+// "fail".
+type batchingSink struct{ delivered *strings.Builder }
+
+func (s batchingSink) Open(context.Context) Writer {
+	return &batchingWriter{delivered: s.delivered}
+}
+
+type batchingWriter struct {
+	delivered *strings.Builder
+	pending   []string
+	stats     Stats
+}
+
+func (w *batchingWriter) WriteEvent(event []byte) error {
+	if strings.Contains(string(event), "skip") {
+		err := &EventError{Size: len(event), Err: ErrInvalidEvent}
+		w.stats.Rejected = append(w.stats.Rejected, err)
+		return err
+	}
+	w.pending = append(w.pending, string(event))
+	return nil
+}
+
+func (w *batchingWriter) Flush() error {
+	pending := w.pending
+	w.pending = nil
+	for _, event := range pending {
+		if strings.Contains(event, "fail") {
+			return errors.New("delivery failed")
+		}
+	}
+	for _, event := range pending {
+		if strings.Contains(event, "refuse") {
+			eventErr := &EventError{Size: len(event), Err: ErrInvalidEvent, Event: []byte(event)}
+			w.stats.Rejected = append(w.stats.Rejected, eventErr)
+			continue
+		}
+		w.delivered.WriteString(event + "\n")
+		w.stats.Events++
+	}
+	return nil
+}
+
+func (w *batchingWriter) Close() error { return w.Flush() }
+
+func (w *batchingWriter) Stats() Stats { return w.stats }
+
+// failingSink is a sink whose Writers fail to write any event
+type failingSink struct{}
+
+func (failingSink) Open(context.Context) Writer { return failingWriter{} }
+
+type failingWriter struct{}
+
+func (failingWriter) WriteEvent([]byte) error { return errors.New("write failed") }
+func (failingWriter) Flush() error            { return nil }
+func (failingWriter) Close() error            { return nil }
+func (failingWriter) Stats() Stats            { return Stats{} }
+
+func TestTee(t *testing.T) {
+	var primary, secondary strings.Builder
+	writer := NewTee(batchingSink{&primary}, NewNDJSONSink(&secondary)).
+		Open(context.Background())
+
+	for _, event := range []string{`{"event":"a"}`, `{"event":"refuse"}`, `{ "event": "b" }`} {
+		require.NoError(t, writer.WriteEvent([]byte(event)))
+	}
+	assert.Error(t, writer.WriteEvent([]byte(`{"event":"skip"}`)))
+	require.NoError(t, writer.Flush())
+	require.NoError(t, writer.WriteEvent([]byte(`{"event":"fail"}`)))
+	assert.Error(t, writer.Flush())
+	require.NoError(t, writer.WriteEvent([]byte(`{"event":"c"}`)))
+	require.NoError(t, writer.Close())
+
+	assert.Equal(t, "{\"event\":\"a\"}\n{ \"event\": \"b\" }\n{\"event\":\"c\"}\n", primary.String())
+	assert.Equal(t, "{\"event\":\"a\"}\n{\"event\":\"b\"}\n{\"event\":\"c\"}\n", secondary.String())
+	assert.Equal(t, 3, writer.Stats().Events)
+	assert.Len(t, writer.Stats().Rejected, 2)
+}
+
+func TestTee_bufferSize(t *testing.T) {
+	var primary, secondary strings.Builder
+	writer := NewTee(batchingSink{&primary}, NewNDJSONSink(&secondary)).
+		WithBufferSize(1).
+		Open(context.Background())
+
+	require.NoError(t, writer.WriteEvent([]byte(`{"event":"a"}`)))
+	assert.Equal(t, "{\"event\":\"a\"}\n", primary.String(), "flushed once the buffer is full")
+	assert.Equal(t, primary.String(), secondary.String())
+}
+
+func TestTee_secondaryFailure(t *testing.T) {
+	var primary strings.Builder
+	tee := NewTee(batchingSink{&primary}, failingSink{})
+	writer := tee.Open(context.Background())
+	require.NoError(t, writer.WriteEvent([]byte(`{"event":"a"}`)))
+	assert.Error(t, writer.Close())
+
+	var handled []error
+	writer = tee.WithErrorHandler(func(err error) { handled = append(handled, err) }).
+		Open(context.Background())
+	require.NoError(t, writer.WriteEvent([]byte(`{"event":"b"}`)))
+	require.NoError(t, writer.Close())
+	assert.Len(t, handled, 1)
+	assert.Equal(t, "{\"event\":\"a\"}\n{\"event\":\"b\"}\n", primary.String())
+}
+
+func TestQuery(t *testing.T) {
+	assert.Equal(t, "", Query(context.Background()))
+	assert.Equal(t, "Builds", Query(WithQuery(context.Background(), "Builds")))
+}
@@ -0,0 +1,147 @@
+package sink
+
+import (
+	"context"
+	"errors"
+)
+
+// DefaultTeeBufferSize is how many bytes of events a Tee Writer holds by
+// default before flushing the primary sink to find out which events were
+// delivered
+const DefaultTeeBufferSize = 16 * 1024 * 1024
+
+// Tee is a Sink that delivers events to a primary sink, and also writes the
+// events the primary sink delivered into a secondary one, e.g. for archiving
+// what was sent. The Stats of its Writers are those of the primary sink.
+//
+// Events are held until the primary sink is flushed successfully, and the
+// events it rejected meanwhile are left out. Primary sinks must therefore keep
+// the events they reject after accepting them in their EventErrors. Events
+// held when the primary sink fails are dropped, as the caller is expected to
+// deliver them again.
+type Tee struct {
+	primary, secondary Sink
+	bufferSize         int
+	handleError        func(error)
+}
+
+// NewTee constructs a Tee delivering events to the given sinks
+func NewTee(primary, secondary Sink) *Tee {
+	return &Tee{primary: primary, secondary: secondary, bufferSize: DefaultTeeBufferSize}
+}
+
+// WithBufferSize sets how many bytes of events a Writer holds before flushing
+// the primary sink
+func (t *Tee) WithBufferSize(size int) *Tee {
+	t.bufferSize = size
+	return t
+}
+
+// WithErrorHandler sets a function that failures to write into the secondary
+// sink are passed to instead of being returned, so they do not fail the
+// delivery of events the primary sink already accepted
+func (t *Tee) WithErrorHandler(handle func(error)) *Tee {
+	t.handleError = handle
+	return t
+}
+
+func (t *Tee) Open(ctx context.Context) Writer {
+	return &teeWriter{tee: t, primary: t.primary.Open(ctx), secondary: t.secondary.Open(ctx)}
+}
+
+type teeWriter struct {
+	tee                *Tee
+	primary, secondary Writer
+	// held lists the events the primary sink accepted since it was last
+	// flushed, and size is their total size
+	held [][]byte
+	size int
+	// rejected is the number of rejected events of the primary sink that
+	// were already left out
+	rejected int
+}
+
+// WriteEvent writes the event into the primary sink and, unless that sink
+// rejected it right away, holds it for the secondary sink
+func (w *teeWriter) WriteEvent(event []byte) error {
+	if err := w.primary.WriteEvent(event); err != nil {
+		var eventErr *EventError
+		if !errors.As(err, &eventErr) {
+			w.drop()
+		}
+		return err
+	}
+	compact, err := Compact(event)
+	if err != nil {
+		return nil
+	}
+	w.held = append(w.held, compact)
+	w.size += len(compact)
+	if w.size >= w.tee.bufferSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+func (w *teeWriter) Flush() error {
+	if err := w.primary.Flush(); err != nil {
+		w.drop()
+		return err
+	}
+	return w.release(w.secondary.Flush)
+}
+
+func (w *teeWriter) Close() error {
+	if err := w.primary.Close(); err != nil {
+		w.drop()
+		return errors.Join(err, w.secondaryError(w.secondary.Close()))
+	}
+	return w.release(w.secondary.Close)
+}
+
+func (w *teeWriter) Stats() Stats {
+	return w.primary.Stats()
+}
+
+// release writes the held events the primary sink did not reject into the
+// secondary sink, and then flushes or closes it with the given function
+func (w *teeWriter) release(flush func() error) error {
+	refused := map[string]int{}
+	rejected := w.primary.Stats().Rejected
+	for _, eventErr := range rejected[w.rejected:] {
+		if compact, err := Compact(eventErr.Event); err == nil {
+			refused[string(compact)]++
+		}
+	}
+	w.rejected = len(rejected)
+
+	var errs []error
+	for _, event := range w.held {
+		if refused[string(event)] > 0 {
+			refused[string(event)]--
+			continue
+		}
+		if err := w.secondary.WriteEvent(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	w.held, w.size = nil, 0
+	errs = append(errs, flush())
+	return w.secondaryError(errors.Join(errs...))
+}
+
+// drop forgets the held events after the primary sink failed
+func (w *teeWriter) drop() {
+	w.held, w.size = nil, 0
+	w.rejected = len(w.primary.Stats().Rejected)
+}
+
+// secondaryError passes the given failure to write into the secondary sink to
+// the error handler, if one is set, or returns it
+func (w *teeWriter) secondaryError(err error) error {
+	if err != nil && w.tee.handleError != nil {
+		w.tee.handleError(err)
+		return nil
+	}
+	return err
+}
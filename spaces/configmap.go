@@ -0,0 +1,63 @@
+package spaces
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redhat-appstudio/segment-bridge.git/configmap"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ConfigMapKey is the ConfigMap data key the space map is stored under
+	ConfigMapKey = "space-map.json"
+	// GroupsConfigMapKey is the ConfigMap data key the groups last sent to
+	// Segment are stored under
+	GroupsConfigMapKey = "ws-groups.json"
+)
+
+// WriteConfigMap stores the given space map in the ConfigMap with the given
+// namespace and name, creating it if needed. Other keys in the ConfigMap are
+// left intact.
+func WriteConfigMap(
+	ctx context.Context, client kubernetes.Interface, namespace, name string, spaces Map,
+) error {
+	return writeConfigMapKey(ctx, client, namespace, name, ConfigMapKey, spaces)
+}
+
+// ReadConfigMapGroups reads the groups stored in the ConfigMap with the given
+// namespace and name. A missing ConfigMap or key yields an empty map.
+func ReadConfigMapGroups(
+	ctx context.Context, client kubernetes.Interface, namespace, name string,
+) (map[string]Group, error) {
+	groups := map[string]Group{}
+	data, err := configmap.Read(ctx, client, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if stored, ok := data[GroupsConfigMapKey]; ok {
+		if err := json.Unmarshal([]byte(stored), &groups); err != nil {
+			return nil, err
+		}
+	}
+	return groups, nil
+}
+
+// WriteConfigMapGroups stores the given groups in the ConfigMap with the given
+// namespace and name, creating it if needed. Other keys in the ConfigMap are
+// left intact.
+func WriteConfigMapGroups(
+	ctx context.Context, client kubernetes.Interface, namespace, name string, groups map[string]Group,
+) error {
+	return writeConfigMapKey(ctx, client, namespace, name, GroupsConfigMapKey, groups)
+}
+
+func writeConfigMapKey(
+	ctx context.Context, client kubernetes.Interface, namespace, name, key string, value any,
+) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return configmap.UpdateKeys(ctx, client, namespace, name, map[string]string{key: string(data)})
+}
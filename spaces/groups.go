@@ -0,0 +1,142 @@
+package spaces
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	wsmap "github.com/redhat-appstudio/segment-bridge.git/ws_map"
+)
+
+// Group describes a workspace as a Segment group
+type Group struct {
+	// Owner is the cluster username of the owner of the workspace
+	Owner string `json:"owner"`
+	// Members lists the cluster usernames of the users with access to the
+	// workspace, sorted
+	Members []string `json:"members"`
+	// Traits describe the workspace, e.g. the cluster it is on
+	Traits map[string]string `json:"traits"`
+}
+
+// Groups models the workspaces of the given workspace map entries as groups.
+// The owner of each workspace is always a member, as are the users the
+// workspace is shared with via SpaceBindings. The traits include the cluster,
+// tier and creation time of the workspace when known.
+func Groups(entries map[string]wsmap.Entry, spaces Map) map[string]Group {
+	clusters := map[string][]string{}
+	for _, entry := range entries {
+		clusters[entry.Workspace] = append(clusters[entry.Workspace], entry.Clusters...)
+	}
+	groups := map[string]Group{}
+	for workspace, wsClusters := range clusters {
+		group := Group{Owner: workspace, Traits: map[string]string{}}
+		slices.Sort(wsClusters)
+		if cluster := slices.Compact(wsClusters); len(cluster) == 1 {
+			group.Traits["cluster"] = cluster[0]
+		}
+		if space, ok := spaces[workspace]; ok {
+			group.Owner = space.Owner()
+			for _, binding := range space.Bindings {
+				group.Members = append(group.Members, binding.Username)
+			}
+			if space.TargetCluster != "" {
+				group.Traits["cluster"] = space.TargetCluster
+			}
+			if space.Tier != "" {
+				group.Traits["tier"] = space.Tier
+			}
+			if !space.CreatedAt.IsZero() {
+				group.Traits["createdAt"] = space.CreatedAt.UTC().Format(time.RFC3339)
+			}
+		}
+		group.Members = append(group.Members, group.Owner)
+		slices.Sort(group.Members)
+		group.Members = slices.Compact(group.Members)
+		groups[workspace] = group
+	}
+	return groups
+}
+
+// Resolve returns the given groups with only the members that have SSO user
+// IDs in the given UID map. Groups whose owner has no SSO user ID are left
+// out, since the owner ID is used as the group ID.
+func Resolve(groups map[string]Group, uids map[string]string) map[string]Group {
+	resolved := map[string]Group{}
+	for workspace, group := range groups {
+		if uids[group.Owner] == "" {
+			continue
+		}
+		members := []string{}
+		for _, member := range group.Members {
+			if uids[member] != "" {
+				members = append(members, member)
+			}
+		}
+		resolved[workspace] = Group{Owner: group.Owner, Members: members, Traits: group.Traits}
+	}
+	return resolved
+}
+
+// ChangedGroups returns the groups whose traits differ from the previous ones,
+// e.g. the ones sent on the last run, and the members added to the others
+func ChangedGroups(current, previous map[string]Group) map[string]Group {
+	changed := map[string]Group{}
+	for workspace, group := range current {
+		before, ok := previous[workspace]
+		if !ok || group.Owner != before.Owner || !maps.Equal(group.Traits, before.Traits) {
+			changed[workspace] = group
+			continue
+		}
+		var added []string
+		for _, member := range group.Members {
+			if !slices.Contains(before.Members, member) {
+				added = append(added, member)
+			}
+		}
+		if len(added) > 0 {
+			changed[workspace] = Group{Owner: group.Owner, Members: added, Traits: group.Traits}
+		}
+	}
+	return changed
+}
+
+// GroupEvents returns Segment group events associating the members of the
+// given resolved groups with their workspaces, sorted by group and user ID.
+// The group ID is the SSO user ID of the workspace owner, matching the
+// workspaceID property of track events. The message IDs are derived from the
+// IDs and traits, so Segment discards the events if they are sent again.
+func GroupEvents(
+	groups map[string]Group, uids map[string]string, at time.Time,
+) []transform.SegmentGroupEvent {
+	var events []transform.SegmentGroupEvent
+	for _, group := range groups {
+		groupID := uids[group.Owner]
+		// Map keys are marshalled in sorted order, so the ID is stable
+		traits, _ := json.Marshal(group.Traits)
+		for _, member := range group.Members {
+			userID := uids[member]
+			hash := sha256.Sum256([]byte(userID + "\x00" + groupID + "\x00" + string(traits)))
+			events = append(events, transform.SegmentGroupEvent{
+				MessageID: "group-" + hex.EncodeToString(hash[:16]),
+				Timestamp: at.UTC(),
+				Type:      "group",
+				UserID:    userID,
+				GroupID:   groupID,
+				Traits:    group.Traits,
+			})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].GroupID != events[j].GroupID {
+			return events[i].GroupID < events[j].GroupID
+		}
+		return events[i].UserID < events[j].UserID
+	})
+	return events
+}
@@ -0,0 +1,126 @@
+package spaces
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	wsmap "github.com/redhat-appstudio/segment-bridge.git/ws_map"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGroups(t *testing.T) {
+	entries := map[string]wsmap.Entry{
+		"user1-tenant": {Workspace: "user1", Clusters: []string{"m01"}},
+		"user2-tenant": {Workspace: "user2", Clusters: []string{"m01"}},
+		"user2-extra":  {Workspace: "user2", Clusters: []string{"m01"}},
+		"user5-tenant": {Workspace: "user5", Clusters: []string{"m01", "rh01"}},
+		"team-tenant":  {Workspace: "team", Clusters: []string{"m01"}},
+	}
+	spaces := map[string]*Space{
+		"user1": {
+			Name: "user1", TargetCluster: "member1", Tier: "appstudio", CreatedAt: created,
+			Bindings: []Binding{{"user1", "admin"}, {"user3", "contributor"}},
+		},
+		"team": {
+			Name: "team", Creator: "user6",
+			Bindings: []Binding{{"user6", "admin"}, {"user7", "contributor"}},
+		},
+		"deleted": {Name: "deleted", Bindings: []Binding{{"user4", "admin"}}},
+	}
+
+	assert.Equal(t, map[string]Group{
+		"user1": {
+			Owner:   "user1",
+			Members: []string{"user1", "user3"},
+			Traits: map[string]string{
+				"cluster": "member1", "tier": "appstudio", "createdAt": "2023-11-20T07:59:03Z",
+			},
+		},
+		"user2": {Owner: "user2", Members: []string{"user2"}, Traits: map[string]string{"cluster": "m01"}},
+		"user5": {Owner: "user5", Members: []string{"user5"}, Traits: map[string]string{}},
+		"team": {
+			Owner:   "user6",
+			Members: []string{"user6", "user7"},
+			Traits:  map[string]string{"cluster": "m01"},
+		},
+	}, Groups(entries, spaces))
+}
+
+func TestResolve(t *testing.T) {
+	groups := map[string]Group{
+		"user1": {Owner: "user1", Members: []string{"user1", "user3"}, Traits: map[string]string{"tier": "base"}},
+		"user2": {Owner: "user2", Members: []string{"user2"}},
+	}
+	uids := map[string]string{"user1": "111"}
+	assert.Equal(t, map[string]Group{
+		"user1": {Owner: "user1", Members: []string{"user1"}, Traits: map[string]string{"tier": "base"}},
+	}, Resolve(groups, uids))
+}
+
+func TestChangedGroups(t *testing.T) {
+	previous := map[string]Group{
+		"user1": {Members: []string{"user1"}, Traits: map[string]string{"tier": "base"}},
+		"user2": {Members: []string{"user2", "user3"}, Traits: map[string]string{"tier": "base"}},
+		"user3": {Members: []string{"user3"}, Traits: map[string]string{"tier": "base"}},
+		"team":  {Owner: "user6", Members: []string{"user6"}, Traits: map[string]string{}},
+	}
+	current := map[string]Group{
+		"user1": {Members: []string{"user1"}, Traits: map[string]string{"tier": "base"}},
+		"user2": {Members: []string{"user2", "user4"}, Traits: map[string]string{"tier": "base"}},
+		"user3": {Members: []string{"user3"}, Traits: map[string]string{"tier": "appstudio"}},
+		"user5": {Members: []string{"user5"}, Traits: map[string]string{}},
+		"team":  {Owner: "user7", Members: []string{"user6"}, Traits: map[string]string{}},
+	}
+	assert.Equal(t, map[string]Group{
+		"user2": {Members: []string{"user4"}, Traits: map[string]string{"tier": "base"}},
+		"user3": {Members: []string{"user3"}, Traits: map[string]string{"tier": "appstudio"}},
+		"user5": {Members: []string{"user5"}, Traits: map[string]string{}},
+		"team":  {Owner: "user7", Members: []string{"user6"}, Traits: map[string]string{}},
+	}, ChangedGroups(current, previous))
+}
+
+func TestGroupEvents(t *testing.T) {
+	at := time.Date(2023, 11, 20, 7, 59, 3, 0, time.UTC)
+	groups := map[string]Group{
+		"team": {Owner: "user1", Members: []string{"user1", "user3"}, Traits: map[string]string{"tier": "base"}},
+	}
+	uids := map[string]string{"user1": "111", "user3": "333"}
+
+	events := GroupEvents(groups, uids, at)
+	require.Len(t, events, 2)
+	assert.Equal(t, "111", events[0].UserID)
+	assert.Equal(t, "333", events[1].UserID)
+	for _, event := range events {
+		assert.Equal(t, "group", event.Type)
+		assert.Equal(t, "111", event.GroupID)
+		assert.Equal(t, at, event.Timestamp)
+		assert.Equal(t, map[string]string{"tier": "base"}, event.Traits)
+	}
+	assert.NotEqual(t, events[0].MessageID, events[1].MessageID)
+	again := GroupEvents(groups, uids, at.Add(time.Hour))
+	assert.Equal(t, events[0].MessageID, again[0].MessageID, "message IDs do not depend on time")
+}
+
+func TestConfigMapGroups(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+
+	groups, err := ReadConfigMapGroups(ctx, client, "ns", "ws-map")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+
+	stored := map[string]Group{"user1": {Members: []string{"user1"}, Traits: map[string]string{}}}
+	require.NoError(t, WriteConfigMapGroups(ctx, client, "ns", "ws-map", stored))
+	require.NoError(t, WriteConfigMapGroups(ctx, client, "ns", "ws-map", stored))
+	groups, err = ReadConfigMapGroups(ctx, client, "ns", "ws-map")
+	require.NoError(t, err)
+	assert.Equal(t, stored, groups)
+
+	require.NoError(t, WriteConfigMap(ctx, client, "ns", "ws-map", Map{"user1": {Name: "user1"}}))
+	groups, err = ReadConfigMapGroups(ctx, client, "ns", "ws-map")
+	require.NoError(t, err)
+	assert.Equal(t, stored, groups, "other keys are left intact")
+}
@@ -0,0 +1,73 @@
+package spaces
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// Map holds spaces by name. It implements transform.Memberships.
+type Map map[string]*Space
+
+func (m Map) WorkspaceOwner(workspace string) (string, bool) {
+	space, ok := m[workspace]
+	if !ok {
+		return "", false
+	}
+	return space.Owner(), true
+}
+
+func (m Map) MemberRole(workspace, username string) (string, bool) {
+	space, ok := m[workspace]
+	if !ok {
+		return "", false
+	}
+	return space.Role(username)
+}
+
+// Workspaces maps the namespaces provisioned for the spaces to the spaces, in
+// the format of the workspace map. Namespaces claimed by several spaces are
+// left out.
+func (m Map) Workspaces() map[string]string {
+	workspaces := map[string]string{}
+	conflicts := map[string]bool{}
+	for name, space := range m {
+		for _, namespace := range space.Namespaces {
+			if ws, ok := workspaces[namespace]; ok && ws != name {
+				conflicts[namespace] = true
+			}
+			workspaces[namespace] = name
+		}
+	}
+	for namespace := range conflicts {
+		delete(workspaces, namespace)
+	}
+	return workspaces
+}
+
+// WriteJSON writes the map as a JSON object
+func (m Map) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(m)
+}
+
+// ReadMap reads a Map in JSON format
+func ReadMap(r io.Reader) (Map, error) {
+	m := Map{}
+	if err := json.NewDecoder(r).Decode(&m); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if m == nil {
+		m = Map{}
+	}
+	return m, nil
+}
+
+// LoadMap loads a Map from the given JSON file
+func LoadMap(path string) (Map, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadMap(file)
+}
@@ -0,0 +1,210 @@
+// Package spaces reads the Space and SpaceBinding objects of the host cluster,
+// which describe the workspaces and the users they are shared with
+package spaces
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// DefaultNamespace is the namespace Space and SpaceBinding objects live in
+	// on the host cluster
+	DefaultNamespace = "toolchain-host-operator"
+	// DefaultPageSize is the amount of objects fetched per List call
+	DefaultPageSize = 500
+	// CreatorLabel is the Space label holding the username of the user the
+	// space was created for
+	CreatorLabel = "toolchain.dev.openshift.com/creator"
+	// AdminRole is the SpaceBinding role of users who manage the space
+	AdminRole = "admin"
+)
+
+var (
+	// SpaceResource identifies the Space K8s API resource
+	SpaceResource = schema.GroupVersionResource{
+		Group:    "toolchain.dev.openshift.com",
+		Version:  "v1alpha1",
+		Resource: "spaces",
+	}
+	// SpaceBindingResource identifies the SpaceBinding K8s API resource
+	SpaceBindingResource = schema.GroupVersionResource{
+		Group:    "toolchain.dev.openshift.com",
+		Version:  "v1alpha1",
+		Resource: "spacebindings",
+	}
+)
+
+// Binding grants a user access to a workspace
+type Binding struct {
+	// Username is the cluster username (the MasterUserRecord name) of the user
+	Username string `json:"username"`
+	// Role is the role the user has in the workspace, e.g. admin
+	Role string `json:"role"`
+}
+
+// Space describes a workspace
+type Space struct {
+	Name string `json:"name"`
+	// Creator is the username of the user the space was created for, if known
+	Creator       string    `json:"creator,omitempty"`
+	TargetCluster string    `json:"targetCluster,omitempty"`
+	Tier          string    `json:"tier,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+	// Namespaces lists the namespaces provisioned for the space
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Bindings lists the users with access to the workspace, sorted by
+	// username
+	Bindings []Binding `json:"bindings,omitempty"`
+}
+
+// SpaceOf returns the space described by the given Space object, without
+// its bindings
+func SpaceOf(obj *unstructured.Unstructured) Space {
+	space := Space{
+		Name:      obj.GetName(),
+		Creator:   obj.GetLabels()[CreatorLabel],
+		CreatedAt: obj.GetCreationTimestamp().UTC(),
+	}
+	space.TargetCluster, _, _ = unstructured.NestedString(obj.Object, "spec", "targetCluster")
+	space.Tier, _, _ = unstructured.NestedString(obj.Object, "spec", "tierName")
+	namespaces, _, _ := unstructured.NestedSlice(obj.Object, "status", "provisionedNamespaces")
+	for _, ns := range namespaces {
+		if ns, ok := ns.(map[string]any); ok {
+			if name, ok := ns["name"].(string); ok && name != "" {
+				space.Namespaces = append(space.Namespaces, name)
+			}
+		}
+	}
+	return space
+}
+
+// Owner returns the username of the owner of the space. That is its creator
+// if known, or else its only admin. Failing both, the space is assumed to be
+// named after its owner, as the spaces created for new users are.
+func (s *Space) Owner() string {
+	if s.Creator != "" {
+		return s.Creator
+	}
+	owner := ""
+	for _, binding := range s.Bindings {
+		if binding.Role == AdminRole {
+			if owner != "" {
+				return s.Name
+			}
+			owner = binding.Username
+		}
+	}
+	if owner != "" {
+		return owner
+	}
+	return s.Name
+}
+
+// Role returns the role the given user has in the space
+func (s *Space) Role(username string) (string, bool) {
+	for _, binding := range s.Bindings {
+		if binding.Username == username {
+			return binding.Role, true
+		}
+	}
+	return "", false
+}
+
+// Builder reads the Space and SpaceBinding objects of a host cluster
+type Builder struct {
+	client    dynamic.Interface
+	namespace string
+	pageSize  int64
+}
+
+// NewBuilder constructs a Builder that reads objects via the given client
+func NewBuilder(client dynamic.Interface) *Builder {
+	return &Builder{client: client, namespace: DefaultNamespace, pageSize: DefaultPageSize}
+}
+
+// WithNamespace sets the namespace to read objects from
+func (b *Builder) WithNamespace(namespace string) *Builder {
+	b.namespace = namespace
+	return b
+}
+
+// WithPageSize sets the amount of objects fetched per List call
+func (b *Builder) WithPageSize(pageSize int64) *Builder {
+	b.pageSize = pageSize
+	return b
+}
+
+// Build lists all the Space and SpaceBinding objects and returns the spaces
+// by name. Bindings of spaces that do not exist are returned as spaces with
+// only a name and bindings.
+func (b *Builder) Build(ctx context.Context) (Map, error) {
+	spaces := Map{}
+	err := b.list(ctx, SpaceResource, func(obj *unstructured.Unstructured) {
+		space := SpaceOf(obj)
+		spaces[space.Name] = &space
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = b.list(ctx, SpaceBindingResource, func(obj *unstructured.Unstructured) {
+		binding, name, ok := BindingOf(obj)
+		if ok {
+			space := spaceOf(spaces, name)
+			space.Bindings = append(space.Bindings, binding)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, space := range spaces {
+		sort.Slice(space.Bindings, func(i, j int) bool {
+			return space.Bindings[i].Username < space.Bindings[j].Username
+		})
+	}
+	return spaces, nil
+}
+
+// list lists the objects of the given resource one page at a time
+func (b *Builder) list(
+	ctx context.Context, resource schema.GroupVersionResource, each func(*unstructured.Unstructured),
+) error {
+	opts := metav1.ListOptions{Limit: b.pageSize}
+	for {
+		list, err := b.client.Resource(resource).Namespace(b.namespace).List(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", resource.Resource, err)
+		}
+		for i := range list.Items {
+			each(&list.Items[i])
+		}
+		if opts.Continue = list.GetContinue(); opts.Continue == "" {
+			return nil
+		}
+	}
+}
+
+func spaceOf(spaces Map, name string) *Space {
+	space, ok := spaces[name]
+	if !ok {
+		space = &Space{Name: name}
+		spaces[name] = space
+	}
+	return space
+}
+
+// BindingOf returns the binding described by the given SpaceBinding and the
+// name of the space it binds to
+func BindingOf(obj *unstructured.Unstructured) (binding Binding, space string, ok bool) {
+	binding.Username, _, _ = unstructured.NestedString(obj.Object, "spec", "masterUserRecord")
+	binding.Role, _, _ = unstructured.NestedString(obj.Object, "spec", "spaceRole")
+	space, _, _ = unstructured.NestedString(obj.Object, "spec", "space")
+	return binding, space, binding.Username != "" && space != ""
+}
@@ -0,0 +1,157 @@
+package spaces
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+var created = time.Date(2023, 11, 20, 7, 59, 3, 0, time.UTC)
+
+func mkSpace(name, cluster, tier string) *unstructured.Unstructured {
+	space := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "toolchain.dev.openshift.com/v1alpha1",
+		"kind":       "Space",
+		"metadata":   map[string]any{"name": name, "namespace": DefaultNamespace},
+		"spec":       map[string]any{"targetCluster": cluster, "tierName": tier},
+	}}
+	space.SetCreationTimestamp(metav1.NewTime(created))
+	return space
+}
+
+func mkBinding(name, mur, space, role string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "toolchain.dev.openshift.com/v1alpha1",
+		"kind":       "SpaceBinding",
+		"metadata":   map[string]any{"name": name, "namespace": DefaultNamespace},
+		"spec":       map[string]any{"masterUserRecord": mur, "space": space, "spaceRole": role},
+	}}
+}
+
+// fakeClient returns a fake dynamic client serving the given Space and
+// SpaceBinding objects
+func fakeClient(objects ...runtime.Object) dynamic.Interface {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			SpaceResource:        "SpaceList",
+			SpaceBindingResource: "SpaceBindingList",
+		},
+		objects...,
+	)
+}
+
+func TestBuilder_Build(t *testing.T) {
+	team := mkSpace("team", "member1", "appstudio")
+	team.SetLabels(map[string]string{CreatorLabel: "user2"})
+	require.NoError(t, unstructured.SetNestedSlice(team.Object, []any{
+		map[string]any{"name": "team-tenant", "type": "default"},
+		map[string]any{"name": "team-extra"},
+	}, "status", "provisionedNamespaces"))
+	client := fakeClient(
+		team,
+		mkBinding("team-user1", "user1", "team", "contributor"),
+		mkSpace("user1", "member1", "appstudio"),
+		mkSpace("user2", "member2", "base"),
+		mkBinding("user1-user1", "user1", "user1", "admin"),
+		mkBinding("user1-user3", "user3", "user1", "contributor"),
+		mkBinding("user2-user2", "user2", "user2", "admin"),
+		mkBinding("deleted-user4", "user4", "deleted", "admin"),
+		mkBinding("broken", "", "user2", "admin"),
+	)
+
+	spaces, err := NewBuilder(client).Build(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, Map{
+		"user1": {
+			Name: "user1", TargetCluster: "member1", Tier: "appstudio", CreatedAt: created,
+			Bindings: []Binding{{"user1", "admin"}, {"user3", "contributor"}},
+		},
+		"user2": {
+			Name: "user2", TargetCluster: "member2", Tier: "base", CreatedAt: created,
+			Bindings: []Binding{{"user2", "admin"}},
+		},
+		"team": {
+			Name: "team", Creator: "user2", TargetCluster: "member1", Tier: "appstudio", CreatedAt: created,
+			Namespaces: []string{"team-tenant", "team-extra"},
+			Bindings:   []Binding{{"user1", "contributor"}},
+		},
+		"deleted": {Name: "deleted", Bindings: []Binding{{"user4", "admin"}}},
+	}, spaces)
+}
+
+func TestSpace_Owner(t *testing.T) {
+	tests := []struct {
+		name  string
+		space Space
+		want  string
+	}{
+		{
+			name:  "creator",
+			space: Space{Name: "team", Creator: "user2", Bindings: []Binding{{"user1", "admin"}}},
+			want:  "user2",
+		},
+		{
+			name:  "only admin",
+			space: Space{Name: "team", Bindings: []Binding{{"user1", "admin"}, {"user2", "viewer"}}},
+			want:  "user1",
+		},
+		{
+			name:  "several admins",
+			space: Space{Name: "team", Bindings: []Binding{{"user1", "admin"}, {"user2", "admin"}}},
+			want:  "team",
+		},
+		{
+			name:  "no bindings",
+			space: Space{Name: "user1"},
+			want:  "user1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.space.Owner())
+		})
+	}
+}
+
+func TestMap(t *testing.T) {
+	m := Map{
+		"team": {
+			Name: "team", Creator: "user2",
+			Namespaces: []string{"team-tenant", "shared"},
+			Bindings:   []Binding{{"user1", "contributor"}, {"user2", "admin"}},
+		},
+		"user3": {Name: "user3", Namespaces: []string{"user3-tenant", "shared"}},
+	}
+
+	owner, ok := m.WorkspaceOwner("team")
+	assert.True(t, ok)
+	assert.Equal(t, "user2", owner)
+	_, ok = m.WorkspaceOwner("no-such-space")
+	assert.False(t, ok)
+
+	role, ok := m.MemberRole("team", "user1")
+	assert.True(t, ok)
+	assert.Equal(t, "contributor", role)
+	_, ok = m.MemberRole("team", "user3")
+	assert.False(t, ok)
+
+	assert.Equal(t, map[string]string{"team-tenant": "team", "user3-tenant": "user3"}, m.Workspaces())
+
+	var buf bytes.Buffer
+	require.NoError(t, m.WriteJSON(&buf))
+	read, err := ReadMap(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, m, read)
+}
@@ -0,0 +1,140 @@
+package spl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Command is an SPL command. String returns its compact SPL rendering.
+type Command interface {
+	String() string
+}
+
+// Search is a 'search' command. Its terms are implicitly ANDed together.
+type Search []Expr
+
+func (s Search) String() string {
+	return strings.TrimSpace("search " + joinExprs(s, " "))
+}
+
+// Assignment sets a field to the value of an expression in an Eval command
+type Assignment struct {
+	Field string
+	Value Expr
+}
+
+func (a Assignment) String() string {
+	return FieldName(a.Field) + "=" + a.Value.String()
+}
+
+// Eval is an 'eval' command
+type Eval []Assignment
+
+func (e Eval) String() string {
+	return "eval " + joinAssignments(e, ",")
+}
+
+// Where is a 'where' command
+type Where struct {
+	Cond Expr
+}
+
+func (w Where) String() string {
+	return "where " + w.Cond.String()
+}
+
+// Spath is an 'spath' command extracting the value at Path from the JSON in
+// the Input field into the Output field
+type Spath struct {
+	Input  string
+	Path   string
+	Output string
+}
+
+func (s Spath) String() string {
+	return "spath input=" + SearchField(s.Input).String() +
+		", path=" + s.Path +
+		" output=" + SearchField(s.Output).String()
+}
+
+// Dedup is a 'dedup' command removing events with duplicate values for
+// Fields. The kept events are chosen by sorting according to SortBy, which
+// lists field names prefixed with '+' or '-'.
+type Dedup struct {
+	Fields []string
+	SortBy []string
+}
+
+func (d Dedup) String() string {
+	s := "dedup " + joinFields(d.Fields, " ")
+	if len(d.SortBy) > 0 {
+		s += " sortby " + strings.Join(d.SortBy, " ")
+	}
+	return s
+}
+
+// Fields is a 'fields' command selecting the given fields for the output, or
+// removing them from it if Remove is set
+type Fields struct {
+	Remove bool
+	Names  []string
+}
+
+func (f Fields) String() string {
+	if f.Remove {
+		return "fields - " + joinFields(f.Names, ",")
+	}
+	return "fields " + joinFields(f.Names, ",")
+}
+
+// RawCommand is a command given as SPL text, e.g. by query authors
+type RawCommand string
+
+func (r RawCommand) String() string {
+	return string(r)
+}
+
+var (
+	// rawEvalOutputRx matches the field assigned by a raw 'eval' command
+	rawEvalOutputRx = regexp.MustCompile(`^eval\s+'?([^'=\s]+)'?\s*=`)
+	// rawSpathOutputRx matches the output field of a raw 'spath' command
+	rawSpathOutputRx = regexp.MustCompile(`^spath\s.*\boutput\s*=\s*"?([^"\s,]+)"?`)
+)
+
+// Outputs returns the names of the fields the given command creates. For raw
+// commands, the output of simple 'eval' and 'spath' commands is recognized.
+func Outputs(cmd Command) []string {
+	switch cmd := cmd.(type) {
+	case Eval:
+		outputs := make([]string, len(cmd))
+		for i, assignment := range cmd {
+			outputs[i] = assignment.Field
+		}
+		return outputs
+	case Spath:
+		return []string{cmd.Output}
+	case RawCommand:
+		for _, rx := range []*regexp.Regexp{rawEvalOutputRx, rawSpathOutputRx} {
+			if m := rx.FindStringSubmatch(strings.TrimSpace(string(cmd))); m != nil {
+				return []string{m[1]}
+			}
+		}
+	}
+	return nil
+}
+
+func joinFields(names []string, sep string) string {
+	rendered := make([]string, len(names))
+	for i, name := range names {
+		rendered[i] = SearchField(name).String()
+	}
+	return strings.Join(rendered, sep)
+}
+
+func joinAssignments(assignments []Assignment, sep string) string {
+	rendered := make([]string, len(assignments))
+	for i, assignment := range assignments {
+		rendered[i] = assignment.String()
+	}
+	return strings.Join(rendered, sep)
+}
@@ -0,0 +1,119 @@
+// Package spl provides a typed representation of Splunk Processing Language
+// (SPL) queries. Queries are built as a Pipeline of commands made of typed
+// expressions, which take care of quoting and escaping the values placed in
+// them, and can be rendered in either a compact or a human-readable form.
+package spl
+
+import (
+	"strings"
+)
+
+// Expr is an SPL expression. String returns its compact SPL rendering.
+type Expr interface {
+	String() string
+}
+
+// Str is a string literal, rendered with QuoteString
+type Str string
+
+func (s Str) String() string {
+	return QuoteString(string(s))
+}
+
+// Regex is a string literal containing a regular expression that matches the
+// given value literally, rendered with QuoteRegex
+type Regex string
+
+func (r Regex) String() string {
+	return QuoteRegex(string(r))
+}
+
+// Field is a reference to the value of a field in an 'eval' or 'where'
+// expression, rendered with QuoteField
+type Field string
+
+func (f Field) String() string {
+	return QuoteField(string(f))
+}
+
+// Ident is a field name used without quoting. It is meant for the names of
+// fields created by the query itself.
+type Ident string
+
+func (i Ident) String() string {
+	return string(i)
+}
+
+// SearchField is a field name in a 'search' command or in a command that
+// takes a list of field names, rendered with SearchFieldName
+type SearchField string
+
+func (f SearchField) String() string {
+	return SearchFieldName(string(f))
+}
+
+// Raw is an SPL fragment that is rendered as-is. It is used for expressions
+// and commands provided by query authors.
+type Raw string
+
+func (r Raw) String() string {
+	return string(r)
+}
+
+// Call is a function call expression
+type Call struct {
+	Func string
+	Args []Expr
+}
+
+func (c Call) String() string {
+	return c.Func + "(" + joinExprs(c.Args, ",") + ")"
+}
+
+// Compare is a comparison of two expressions using the given operator, e.g.
+// '=' or '!='
+type Compare struct {
+	Left  Expr
+	Op    string
+	Right Expr
+}
+
+func (c Compare) String() string {
+	return c.Left.String() + c.Op + c.Right.String()
+}
+
+// In tests whether an expression is equal to one of a list of values
+type In struct {
+	Expr   Expr
+	Values []Expr
+}
+
+func (in In) String() string {
+	return in.Expr.String() + " IN (" + joinExprs(in.Values, ", ") + ")"
+}
+
+// And is a boolean conjunction of expressions
+type And []Expr
+
+func (a And) String() string {
+	return joinExprs(a, " AND ")
+}
+
+// Strs converts the given values into a list of string literals
+func Strs(values ...string) []Expr {
+	exprs := make([]Expr, len(values))
+	for i, value := range values {
+		exprs[i] = Str(value)
+	}
+	return exprs
+}
+
+func joinExprs(exprs []Expr, sep string) string {
+	rendered := make([]string, 0, len(exprs))
+	for _, expr := range exprs {
+		if s := expr.String(); s != "" {
+			rendered = append(rendered, s)
+		}
+	}
+	return strings.Join(rendered, sep)
+}
@@ -0,0 +1,58 @@
+package spl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExprString(t *testing.T) {
+	tests := []struct {
+		name string
+		expr Expr
+		want string
+	}{
+		{"Plain string", Str("hello"), `"hello"`},
+		{"Empty string", Str(""), `""`},
+		{"String with double quotes", Str(`say "hi"`), `"say \"hi\""`},
+		{"String with backslashes", Str(`C:\dir\`), `"C:\\dir\\"`},
+		{"String with escaped quote", Str(`\"`), `"\\\""`},
+		{"String injection attempt", Str(`x" OR index="*`), `"x\" OR index=\"*"`},
+		{"String with wildcards", Str("app*"), `"app*"`},
+		{"String with single quotes", Str("it's"), `"it's"`},
+		{"String with pipe", Str("a | delete"), `"a | delete"`},
+		{"Plain regex", Regex("Succeeded"), `"Succeeded"`},
+		{"Regex with metacharacters", Regex("a.b*"), `"a\\.b\\*"`},
+		{"Regex with quote", Regex(`\"`), `"\\\\\""`},
+		{"Plain field", Field("verb"), `'verb'`},
+		{"Dotted field", Field("objectRef.resource"), `'objectRef.resource'`},
+		{"Multi-value field", Field("a.conditions{}.type"), `'a.conditions{}.type'`},
+		{"Field with slash", Field("labels.appstudio.openshift.io/component"), `'labels.appstudio.openshift.io/component'`},
+		{"Field with single quote", Field("it's"), `'it\'s'`},
+		{"Field with backslash", Field(`a\b`), `'a\\b'`},
+		{"Field with wildcard", Field("a*"), `'a*'`},
+		{"Simple search field", SearchField("index"), `index`},
+		{"Dotted search field", SearchField("objectRef.apiGroup"), `"objectRef.apiGroup"`},
+		{"Search field with braces and slash", SearchField("a{}/b"), `"a{}/b"`},
+		{"Search field with quote", SearchField(`e"f`), `"e\"f"`},
+		{"Ident", Ident("status_condition_index"), `status_condition_index`},
+		{"Raw", Raw(`a | b`), `a | b`},
+		{
+			"Call",
+			Call{Func: "if", Args: []Expr{Call{Func: "isnull", Args: []Expr{Field("a")}}, Field("b"), Field("a")}},
+			`if(isnull('a'),'b','a')`,
+		},
+		{"Compare", Compare{Left: SearchField("index"), Op: "=", Right: Str("idx")}, `index="idx"`},
+		{"In", In{Expr: Field("a"), Values: Strs("x", `y"`)}, `'a' IN ("x", "y\"")`},
+		{
+			"And",
+			And{Call{Func: "isnotnull", Args: []Expr{Ident("i")}}, Compare{Left: Field("a"), Op: "!=", Right: Str("b")}},
+			`isnotnull(i) AND 'a'!="b"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.expr.String())
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package spl
+
+import (
+	"strings"
+)
+
+// prettyMinLength is the length below which queries are pretty-printed in a
+// single line
+const prettyMinLength = 60
+
+// Pipeline is an SPL query made of a sequence of commands, where the output of
+// each command is piped into the next one
+type Pipeline []Command
+
+// String returns the compact rendering of the query
+func (p Pipeline) String() string {
+	commands := make([]string, len(p))
+	for i, cmd := range p {
+		commands[i] = cmd.String()
+	}
+	return strings.Join(commands, "|")
+}
+
+// Pretty returns a human-readable rendering of the query where each command
+// is placed in its own line and the assignments of 'eval' commands are placed
+// in lines of their own. Each line is prefixed with the given indent. Short
+// queries are rendered in a single line.
+func (p Pipeline) Pretty(indent string) string {
+	if compact := p.String(); len(compact) < prettyMinLength {
+		return indent + compact
+	}
+	var builder strings.Builder
+	for i, cmd := range p {
+		if i > 0 {
+			builder.WriteString("\n")
+		}
+		prefix := indent
+		if i > 0 {
+			prefix += "|"
+		}
+		builder.WriteString(prefix)
+		if eval, ok := cmd.(Eval); ok && len(eval) > 1 {
+			builder.WriteString(
+				"eval " + joinAssignments(eval, ",\n"+indent+strings.Repeat(" ", len(prefix)-len(indent)+5)),
+			)
+		} else {
+			builder.WriteString(cmd.String())
+		}
+	}
+	return builder.String()
+}
+
+// PrettyText pretty-prints a query given as SPL text in the same way as
+// Pipeline.Pretty, except that it does not split 'eval' assignments
+func PrettyText(query string, indent string) string {
+	if len(query) < prettyMinLength {
+		return indent + query
+	}
+	commands := SplitCommands(query)
+	p := make(Pipeline, len(commands))
+	for i, cmd := range commands {
+		p[i] = RawCommand(cmd)
+	}
+	return p.Pretty(indent)
+}
+
+// SplitCommands splits a query given as SPL text into its commands. Pipe
+// characters within quoted strings, quoted field names or subsearches do not
+// split commands. Whitespace around the commands is removed.
+func SplitCommands(query string) []string {
+	var commands []string
+	var quote rune
+	escaped := false
+	depth := 0
+	start := 0
+	for i, c := range query {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if c == '\\' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case c == '|' && depth == 0:
+			commands = append(commands, strings.TrimSpace(query[start:i]))
+			start = i + 1
+		}
+	}
+	return append(commands, strings.TrimSpace(query[start:]))
+}
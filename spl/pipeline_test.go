@@ -0,0 +1,112 @@
+package spl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/stretchr/testify/assert"
+)
+
+var testPipeline = Pipeline{
+	Search{
+		Compare{Left: SearchField("index"), Op: "=", Right: Str("idx")},
+		Raw(`verb=create`),
+	},
+	Eval{
+		{Field: "repo", Value: Raw(`replace('repo',"^([^|?]*)(.*)?","\1")`)},
+		{Field: "merge-url", Value: Field("build_status.pac.merge-url")},
+	},
+	Where{Cond: In{Expr: Field("reason"), Values: Strs("Succeeded", "Failed")}},
+	Spath{Input: "responseObject.status", Path: "pac.state", Output: "build_status.pac.state"},
+	Dedup{Fields: []string{"build_status.pac.merge-url"}, SortBy: []string{"+_time"}},
+	Fields{Names: []string{"repo", "merge-url"}},
+	Fields{Remove: true, Names: []string{"_raw"}},
+}
+
+func TestPipeline_String(t *testing.T) {
+	assert.Equal(t,
+		`search index="idx" verb=create`+
+			`|eval repo=replace('repo',"^([^|?]*)(.*)?","\1"),'merge-url'='build_status.pac.merge-url'`+
+			`|where 'reason' IN ("Succeeded", "Failed")`+
+			`|spath input="responseObject.status", path=pac.state output="build_status.pac.state"`+
+			`|dedup "build_status.pac.merge-url" sortby +_time`+
+			`|fields repo,"merge-url"`+
+			`|fields - _raw`,
+		testPipeline.String(),
+	)
+	assert.Equal(t, "search", Pipeline{Search{Raw("")}}.String())
+}
+
+func TestPipeline_Pretty(t *testing.T) {
+	assert.Equal(t, strings.Trim(dedent.Dedent(`
+		search index="idx" verb=create
+		|eval repo=replace('repo',"^([^|?]*)(.*)?","\1"),
+		      'merge-url'='build_status.pac.merge-url'
+		|where 'reason' IN ("Succeeded", "Failed")
+		|spath input="responseObject.status", path=pac.state output="build_status.pac.state"
+		|dedup "build_status.pac.merge-url" sortby +_time
+		|fields repo,"merge-url"
+		|fields - _raw
+	`), "\n"), testPipeline.Pretty(""))
+
+	short := Pipeline{Search{Raw("index=foo")}, Fields{Names: []string{"a", "b"}}}
+	assert.Equal(t, "  search index=foo|fields a,b", short.Pretty("  "))
+}
+
+func TestPrettyText(t *testing.T) {
+	assert.Equal(t, strings.Trim(dedent.Dedent(`
+		search index="idx" verb=create
+		|eval repo=replace('repo',"^([^|?]*)(.*)?","\1"),'merge-url'='build_status.pac.merge-url'
+		|where 'reason' IN ("Succeeded", "Failed")
+		|spath input="responseObject.status", path=pac.state output="build_status.pac.state"
+		|dedup "build_status.pac.merge-url" sortby +_time
+		|fields repo,"merge-url"
+		|fields - _raw
+	`), "\n"), PrettyText(testPipeline.String(), ""))
+}
+
+func TestSplitCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"Single command", "search index=foo", []string{"search index=foo"}},
+		{"Spaced pipes", "search a | stats count by b", []string{"search a", "stats count by b"}},
+		{"Pipe in double quotes", `search a="x|y"|fields a`, []string{`search a="x|y"`, "fields a"}},
+		{"Pipe in single quotes", `eval a='x|y'|fields a`, []string{`eval a='x|y'`, "fields a"}},
+		{"Escaped quote", `eval a="x\"|y"|fields a`, []string{`eval a="x\"|y"`, "fields a"}},
+		{"Subsearch", `search a [search b | fields c]|fields a`, []string{`search a [search b | fields c]`, "fields a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SplitCommands(tt.query))
+		})
+	}
+}
+
+func TestOutputs(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  Command
+		want []string
+	}{
+		{"Eval", Eval{{Field: "a", Value: Str("x")}, {Field: "b.c", Value: Str("y")}}, []string{"a", "b.c"}},
+		{"Spath", Spath{Input: "a", Path: "p", Output: "b.p"}, []string{"b.p"}},
+		{"Where", Where{Cond: Raw("true()")}, nil},
+		{"Raw eval", RawCommand(`eval clair_scan_result=mvindex('x', 0)`), []string{"clair_scan_result"}},
+		{"Raw quoted eval", RawCommand(`eval 'a.b'=1`), []string{"a.b"}},
+		{
+			"Raw spath",
+			RawCommand(`spath input="x", path=pac.merge-url output=build_status.pac.merge-url`),
+			[]string{"build_status.pac.merge-url"},
+		},
+		{"Raw other", RawCommand(`dedup a`), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Outputs(tt.cmd))
+		})
+	}
+}
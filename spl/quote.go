@@ -0,0 +1,63 @@
+package spl
+
+import (
+	"regexp"
+	"strings"
+)
+
+// This file contains the functions used for safely placing values into SPL
+// queries. Any value that is not meant to be interpreted as SPL should go
+// through one of these functions before being added to a query.
+
+// bareFieldNameRx matches field names that can be used in SPL without quoting
+var bareFieldNameRx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var (
+	// stringLiteralEscaper escapes the characters that have special meaning
+	// inside SPL double-quoted strings
+	stringLiteralEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	// fieldRefEscaper escapes the characters that have special meaning inside
+	// SPL single-quoted field names
+	fieldRefEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+)
+
+// QuoteString returns the given value as an SPL double-quoted string literal.
+// When used in a 'search' command, '*' characters in the value still act as
+// wildcards, as Splunk provides no way to escape them there.
+func QuoteString(value string) string {
+	return `"` + stringLiteralEscaper.Replace(value) + `"`
+}
+
+// QuoteRegex returns an SPL string literal containing a regular expression
+// that matches the given value literally, for use with functions such as
+// mvfind
+func QuoteRegex(value string) string {
+	return QuoteString(regexp.QuoteMeta(value))
+}
+
+// QuoteField returns an SPL reference to the value of the given field for use
+// in 'eval' and 'where' expressions. The name is always quoted, since field
+// names containing characters like '.', '{}' or '/' would otherwise be parsed
+// as expressions.
+func QuoteField(name string) string {
+	return `'` + fieldRefEscaper.Replace(name) + `'`
+}
+
+// FieldName returns the given field name as it should be written when
+// assigning to the field in an 'eval' command. Simple names are left as-is.
+func FieldName(name string) string {
+	if bareFieldNameRx.MatchString(name) {
+		return name
+	}
+	return QuoteField(name)
+}
+
+// SearchFieldName returns the given field name as it should be written in a
+// 'search' command or in commands like 'fields' that take a list of field
+// names. Names that are not simple are double-quoted.
+func SearchFieldName(name string) string {
+	if bareFieldNameRx.MatchString(name) {
+		return name
+	}
+	return QuoteString(name)
+}
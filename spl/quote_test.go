@@ -0,0 +1,76 @@
+package spl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteString(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"Plain", "hello", `"hello"`},
+		{"Empty", "", `""`},
+		{"Double quotes", `say "hi"`, `"say \"hi\""`},
+		{"Backslashes", `C:\dir\`, `"C:\\dir\\"`},
+		{"Escaped quote", `\"`, `"\\\""`},
+		{"Injection attempt", `x" OR index="*`, `"x\" OR index=\"*"`},
+		{"Wildcards", "app*", `"app*"`},
+		{"Single quotes", "it's", `"it's"`},
+		{"Pipe", "a | delete", `"a | delete"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, QuoteString(tt.value))
+		})
+	}
+}
+
+func TestQuoteRegex(t *testing.T) {
+	assert.Equal(t, `"Succeeded"`, QuoteRegex("Succeeded"))
+	assert.Equal(t, `"a\\.b\\*"`, QuoteRegex("a.b*"))
+	assert.Equal(t, `"\\\\\""`, QuoteRegex(`\"`))
+}
+
+func TestQuoteField(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		want  string
+	}{
+		{"Plain", "verb", `'verb'`},
+		{"Dotted", "objectRef.resource", `'objectRef.resource'`},
+		{"Multi-value", "responseObject.status.conditions{}.type", `'responseObject.status.conditions{}.type'`},
+		{"Slash", "labels.appstudio.openshift.io/component", `'labels.appstudio.openshift.io/component'`},
+		{"Single quote", "it's", `'it\'s'`},
+		{"Backslash", `a\b`, `'a\\b'`},
+		{"Wildcard", "a*", `'a*'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, QuoteField(tt.field))
+		})
+	}
+}
+
+func TestFieldName(t *testing.T) {
+	assert.Equal(t, "userId", FieldName("userId"))
+	assert.Equal(t, "event_verb", FieldName("event_verb"))
+	assert.Equal(t, `'build_status.pac.merge-url'`, FieldName("build_status.pac.merge-url"))
+	assert.Equal(t, `'a{}/b'`, FieldName("a{}/b"))
+	assert.Equal(t, `'1st'`, FieldName("1st"))
+}
+
+func TestSearchFieldName(t *testing.T) {
+	for name, want := range map[string]string{
+		"userId": "userId",
+		"a.b":    `"a.b"`,
+		"c{}/d":  `"c{}/d"`,
+		`e"f`:    `"e\"f"`,
+	} {
+		assert.Equal(t, want, SearchFieldName(name))
+	}
+}
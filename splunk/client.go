@@ -0,0 +1,238 @@
+package splunk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+)
+
+// Client runs searches via the Splunk search export API and streams back their
+// results
+type Client struct {
+	appAPIEndpoint string
+	client         *http.Client
+	username       string
+	password       string
+	token          string
+	policy         *httpretry.Policy
+}
+
+// NewClient constructs a default Client for the given Splunk app API endpoint
+// (As returned by GetSplunkAppAPIEndpoint)
+func NewClient(appAPIEndpoint string) *Client {
+	return &Client{
+		appAPIEndpoint: appAPIEndpoint,
+		client:         http.DefaultClient,
+		policy:         httpretry.NewPolicy(),
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for making the API calls
+func (c *Client) WithHTTPClient(client *http.Client) *Client {
+	c.client = client
+	return c
+}
+
+// WithRetryPolicy sets the policy for retrying failed search submissions.
+// Failures while streaming back results are not retried, since the stream
+// cannot be resumed, but streaming is given up on once the time budget of
+// the policy runs out.
+func (c *Client) WithRetryPolicy(policy *httpretry.Policy) *Client {
+	c.policy = policy
+	return c
+}
+
+// WithBasicAuth makes the client authenticate with the given username and
+// password
+func (c *Client) WithBasicAuth(username, password string) *Client {
+	c.username = username
+	c.password = password
+	return c
+}
+
+// WithToken makes the client authenticate with the given Splunk authentication
+// token. A token takes precedence over basic authentication credentials.
+func (c *Client) WithToken(token string) *Client {
+	c.token = token
+	return c
+}
+
+// Search describes a Splunk search to run
+type Search struct {
+	// Query is the SPL query string
+	Query string
+	// EarliestTime is a Splunk time string specifying the earliest time to
+	// retrieve records from
+	EarliestTime string
+	// LatestTime is a Splunk time string specifying the latest time to
+	// retrieve records from
+	LatestTime string
+}
+
+// Message is a diagnostic message Splunk embeds in API responses
+type Message struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// IsError determines if the message reports an error
+func (m Message) IsError() bool {
+	return m.Type == "ERROR" || m.Type == "FATAL"
+}
+
+// SearchError is returned when Splunk reports errors about a search
+type SearchError struct {
+	// The HTTP status code of the response, if the error was reported via a
+	// failed API call
+	StatusCode int
+	// The error messages Splunk reported
+	Messages []Message
+}
+
+func (e *SearchError) Error() string {
+	texts := make([]string, 0, len(e.Messages))
+	for _, msg := range e.Messages {
+		texts = append(texts, fmt.Sprintf("%s: %s", msg.Type, msg.Text))
+	}
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("splunk search failed (HTTP %d): %s", e.StatusCode, strings.Join(texts, "; "))
+	}
+	return fmt.Sprintf("splunk search failed: %s", strings.Join(texts, "; "))
+}
+
+// ExportRow is a single row of the newline-delimited JSON response returned by
+// the search export API
+type ExportRow struct {
+	// Preview is true for rows containing preview results that may later be
+	// replaced by final results
+	Preview bool `json:"preview"`
+	// Offset is the offset of the result in the result set
+	Offset int `json:"offset"`
+	// LastRow is true for the last row of a result set
+	LastRow bool `json:"lastrow"`
+	// Result is the search result, rows carrying only status data have no
+	// result
+	Result json.RawMessage `json:"result,omitempty"`
+	// Messages includes diagnostic messages Splunk embedded in the stream
+	Messages []Message `json:"messages,omitempty"`
+}
+
+// HasResult determines if the row carries a search result
+func (r *ExportRow) HasResult() bool {
+	return len(r.Result) > 0 && string(r.Result) != "null"
+}
+
+// Export returns an iterator over the final result rows of the given search,
+// which is submitted to the export API when iteration starts. Preview rows and
+// rows that carry no result are skipped. Failing to submit the search, read
+// the results or errors Splunk embedded in the stream end the iteration with
+// a zero row and the error. The response is released once iteration ends,
+// including when the caller stops early.
+func (c *Client) Export(ctx context.Context, search Search) iter.Seq2[ExportRow, error] {
+	return func(yield func(ExportRow, error) bool) {
+		ctx, cancel := c.policy.Context(ctx)
+		defer cancel()
+		body, err := c.export(ctx, search)
+		if err != nil {
+			yield(ExportRow{}, err)
+			return
+		}
+		defer body.Close()
+		decoder := json.NewDecoder(body)
+		for {
+			var row ExportRow
+			if err := decoder.Decode(&row); err != nil {
+				if cause := context.Cause(ctx); cause != nil {
+					err = cause
+				}
+				if !errors.Is(err, io.EOF) {
+					yield(ExportRow{}, fmt.Errorf("failed to decode splunk export stream: %w", err))
+				}
+				return
+			}
+			var errMessages []Message
+			for _, msg := range row.Messages {
+				if msg.IsError() {
+					errMessages = append(errMessages, msg)
+				}
+			}
+			if len(errMessages) > 0 {
+				yield(ExportRow{}, &SearchError{Messages: errMessages})
+				return
+			}
+			if !row.HasResult() || row.Preview {
+				continue
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+// export submits the given search and returns the body of the response
+func (c *Client) export(ctx context.Context, search Search) (io.ReadCloser, error) {
+	form := url.Values{
+		"search":      {search.Query},
+		"output_mode": {"json"},
+	}
+	if search.EarliestTime != "" {
+		form.Set("earliest_time", search.EarliestTime)
+	}
+	if search.LatestTime != "" {
+		form.Set("latest_time", search.LatestTime)
+	}
+	resp, err := c.policy.Do(ctx, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(
+			ctx, http.MethodPost,
+			GetSearchAPIEndpoint(c.appAPIEndpoint),
+			strings.NewReader(form.Encode()),
+		)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		} else if c.username != "" {
+			req.SetBasicAuth(c.username, c.password)
+		}
+		return c.client.Do(req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp.Body, nil
+}
+
+// responseError generates an error from a failed API call response, including
+// the error messages Splunk placed in the response body if there are any
+func responseError(resp *http.Response) error {
+	searchErr := &SearchError{StatusCode: resp.StatusCode}
+	var body struct {
+		Messages []Message `json:"messages"`
+	}
+	if data, err := io.ReadAll(resp.Body); err == nil {
+		if json.Unmarshal(data, &body) == nil && len(body.Messages) > 0 {
+			searchErr.Messages = body.Messages
+		} else if text := strings.TrimSpace(string(data)); text != "" {
+			searchErr.Messages = []Message{{Type: "ERROR", Text: text}}
+		}
+	}
+	if len(searchErr.Messages) == 0 {
+		searchErr.Messages = []Message{{Type: "ERROR", Text: resp.Status}}
+	}
+	return searchErr
+}
@@ -0,0 +1,220 @@
+package splunk
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lithammer/dedent"
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collectResults returns the results of the given rows until an error is
+// yielded, along with the error
+func collectResults(rows iter.Seq2[ExportRow, error]) ([]string, error) {
+	var results []string
+	for row, err := range rows {
+		if err != nil {
+			return results, err
+		}
+		results = append(results, string(row.Result))
+	}
+	return results, nil
+}
+
+func TestClient_Export(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		response    string
+		wantResults []string
+		wantErr     bool
+	}{
+		{
+			name:   "Results and status rows",
+			status: http.StatusOK,
+			response: dedent.Dedent(`
+				{"preview":false,"offset":0,"lastrow":true,"result":{"a":"1"}}
+				{"preview":false,"offset":0,"lastrow":true,"result":{"a":"2"}}
+				{"preview":false,"lastrow":true}
+			`),
+			wantResults: []string{`{"a":"1"}`, `{"a":"2"}`},
+		},
+		{
+			name:   "Preview rows are skipped",
+			status: http.StatusOK,
+			response: dedent.Dedent(`
+				{"preview":true,"offset":0,"result":{"a":"p1"}}
+				{"preview":true,"offset":1,"lastrow":true,"result":{"a":"p2"}}
+				{"preview":false,"offset":0,"result":{"a":"1"}}
+				{"preview":false,"offset":1,"lastrow":true,"result":{"a":"2"}}
+			`),
+			wantResults: []string{`{"a":"1"}`, `{"a":"2"}`},
+		},
+		{
+			name:   "Informational messages",
+			status: http.StatusOK,
+			response: dedent.Dedent(`
+				{"preview":false,"messages":[{"type":"INFO","text":"some info"}]}
+				{"preview":false,"offset":0,"lastrow":true,"result":{"a":"1"}}
+			`),
+			wantResults: []string{`{"a":"1"}`},
+		},
+		{
+			name:   "Error message embedded in stream",
+			status: http.StatusOK,
+			response: dedent.Dedent(`
+				{"preview":false,"offset":0,"result":{"a":"1"}}
+				{"preview":false,"messages":[{"type":"FATAL","text":"bad search"}]}
+				{"preview":false,"offset":1,"result":{"a":"2"}}
+			`),
+			wantResults: []string{`{"a":"1"}`},
+			wantErr:     true,
+		},
+		{
+			name:        "Truncated stream",
+			status:      http.StatusOK,
+			response:    `{"preview":false,"offset":0,"result":{"a":"1"}}` + "\n" + `{"preview":fa`,
+			wantResults: []string{`{"a":"1"}`},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer svr.Close()
+
+			results, err := collectResults(NewClient(svr.URL).WithHTTPClient(svr.Client()).
+				Export(context.Background(), Search{Query: "search *"}))
+			assert.Equal(t, tt.wantResults, results)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClient_ExportRequest(t *testing.T) {
+	var form url.Values
+	var path, user, password string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		path = r.URL.Path
+		form = r.PostForm
+		user, password, _ = r.BasicAuth()
+	}))
+	defer svr.Close()
+
+	results, err := collectResults(NewClient(svr.URL+"/servicesNS/nobody/app").
+		WithHTTPClient(svr.Client()).
+		WithBasicAuth("admin", "secret").
+		Export(context.Background(), Search{
+			Query:        `search index="foo" | fields bar`,
+			EarliestTime: "-4hours",
+			LatestTime:   "-0hours",
+		}))
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	assert.Equal(t, "/servicesNS/nobody/app/search/v2/jobs/export", path)
+	assert.Equal(t, url.Values{
+		"search":        {`search index="foo" | fields bar`},
+		"output_mode":   {"json"},
+		"earliest_time": {"-4hours"},
+		"latest_time":   {"-0hours"},
+	}, form)
+	assert.Equal(t, "admin", user)
+	assert.Equal(t, "secret", password)
+}
+
+func TestClient_ExportFailure(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"messages": []Message{{"FATAL", "Unknown search command 'foo'."}},
+		})
+	}))
+	defer svr.Close()
+
+	_, err := collectResults(NewClient(svr.URL).WithHTTPClient(svr.Client()).
+		Export(context.Background(), Search{Query: "foo"}))
+	var searchErr *SearchError
+	require.ErrorAs(t, err, &searchErr)
+	assert.Equal(t, http.StatusBadRequest, searchErr.StatusCode)
+	assert.Equal(t, []Message{{"FATAL", "Unknown search command 'foo'."}}, searchErr.Messages)
+	assert.True(t, strings.Contains(err.Error(), "Unknown search command"))
+}
+
+func TestClient_ExportRetries(t *testing.T) {
+	calls := 0
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = io.WriteString(w, `{"preview":false,"offset":0,"lastrow":true,"result":{"a":"1"}}`)
+	}))
+	defer svr.Close()
+
+	results, err := collectResults(NewClient(svr.URL).WithHTTPClient(svr.Client()).
+		WithRetryPolicy(httpretry.NewPolicy().WithBackoff(time.Millisecond, time.Millisecond)).
+		Export(context.Background(), Search{Query: "search *"}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"a":"1"}`}, results)
+	assert.Equal(t, 3, calls)
+}
+
+func TestClient_ExportBudget(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"preview":false,"offset":0,"result":{"a":"1"}}`+"\n")
+		w.(http.Flusher).Flush()
+		// A search that keeps streaming results past the budget
+		<-r.Context().Done()
+	}))
+	defer svr.Close()
+
+	results, err := collectResults(NewClient(svr.URL).WithHTTPClient(svr.Client()).
+		WithRetryPolicy(httpretry.NewPolicy().WithBudget(httpretry.NewBudget(100*time.Millisecond))).
+		Export(context.Background(), Search{Query: "search *"}))
+	assert.Equal(t, []string{`{"a":"1"}`}, results)
+	assert.ErrorIs(t, err, httpretry.ErrBudgetExhausted)
+}
+
+func TestClient_ExportStop(t *testing.T) {
+	released := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, `{"preview":false,"offset":0,"result":{"a":"1"}}`+"\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(released)
+	}))
+	defer svr.Close()
+
+	for row, err := range NewClient(svr.URL).WithHTTPClient(svr.Client()).
+		Export(context.Background(), Search{Query: "search *"}) {
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"a":"1"}`, string(row.Result))
+		break
+	}
+	select {
+	case <-released:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the response was not released when iteration stopped")
+	}
+}
@@ -3,6 +3,7 @@ package splunk
 import (
 	_ "embed"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/redhat-appstudio/segment-bridge.git/containerfixture"
@@ -17,6 +18,12 @@ func GetSplunkAppAPIEndpoint(host, port, ownerName, appName string) string {
 	return fmt.Sprintf("http://%s:%s/servicesNS/%s/%s", host, port, ownerName, appName)
 }
 
+// GetSplunkAppAPIEndpointFromURL builds a API URL for a specific Splunk app
+// given the base URL of the Splunk API
+func GetSplunkAppAPIEndpointFromURL(apiURL, ownerName, appName string) string {
+	return fmt.Sprintf("%s/servicesNS/%s/%s", strings.TrimSuffix(apiURL, "/"), ownerName, appName)
+}
+
 // GetSearchAPIEndpoint builds a valid endpoint to be used against a
 // Splunk Search API service
 func GetSearchAPIEndpoint(appAPIEndpoint string) string {
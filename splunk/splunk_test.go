@@ -1,7 +1,9 @@
 package splunk
 
 import (
+	"context"
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os/exec"
@@ -64,3 +66,22 @@ func TestGetRecordsCount(t *testing.T) {
 		}
 	})
 }
+
+func TestClientExportFromContainer(t *testing.T) {
+	WithSplunkContainer(t, func(deployment containerfixture.FixtureInfo) {
+		splunkAppApiURL := GetSplunkAppAPIEndpoint("localhost", deployment.ApiPort, "nobody", "-")
+		client := NewClient(splunkAppApiURL).WithBasicAuth("admin", "Password")
+
+		var results []map[string]string
+		for row, err := range client.Export(context.Background(), Search{
+			Query:        "search index=test_index | stats count",
+			EarliestTime: "0",
+		}) {
+			require.NoError(t, err)
+			var result map[string]string
+			require.NoError(t, json.Unmarshal(row.Result, &result))
+			results = append(results, result)
+		}
+		assert.Equal(t, []map[string]string{{"count": "10"}}, results)
+	})
+}
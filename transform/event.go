@@ -0,0 +1,66 @@
+// Package transform converts user journey records fetched from Splunk into
+// events that can be sent to Segment
+package transform
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SplunkUJRecord is a user journey record as returned by the queries generated
+// by the querygen package. Nested JSON objects are returned from Splunk encoded
+// as strings.
+type SplunkUJRecord struct {
+	MessageID    string `json:"messageId"`
+	Timestamp    string `json:"timestamp"`
+	Namespace    string `json:"namespace"`
+	Type         string `json:"type"`
+	UserID       string `json:"userId,omitempty"`
+	Event        string `json:"event,omitempty"`
+	EventVerb    string `json:"event_verb,omitempty"`
+	EventSubject string `json:"event_subject,omitempty"`
+	Properties   string `json:"properties"`
+	Context      string `json:"context"`
+}
+
+// ParseSplunkUJRecord decodes a single Splunk search result into a
+// SplunkUJRecord
+func ParseSplunkUJRecord(result json.RawMessage) (SplunkUJRecord, error) {
+	var record SplunkUJRecord
+	err := json.Unmarshal(result, &record)
+	return record, err
+}
+
+// SegmentTrackEvent is a Segment "track" call record as sent to the Segment
+// batch API
+type SegmentTrackEvent struct {
+	MessageID  string         `json:"messageId"`
+	Timestamp  time.Time      `json:"timestamp"`
+	Namespace  string         `json:"namespace"`
+	Type       string         `json:"type"`
+	UserID     string         `json:"userId"`
+	Event      string         `json:"event"`
+	Properties map[string]any `json:"properties"`
+	Context    map[string]any `json:"context"`
+}
+
+// SegmentIdentifyEvent is a Segment "identify" call record as sent to the
+// Segment batch API
+type SegmentIdentifyEvent struct {
+	MessageID string            `json:"messageId"`
+	Timestamp time.Time         `json:"timestamp"`
+	Type      string            `json:"type"`
+	UserID    string            `json:"userId"`
+	Traits    map[string]string `json:"traits"`
+}
+
+// SegmentGroupEvent is a Segment "group" call record as sent to the Segment
+// batch API
+type SegmentGroupEvent struct {
+	MessageID string            `json:"messageId"`
+	Timestamp time.Time         `json:"timestamp"`
+	Type      string            `json:"type"`
+	UserID    string            `json:"userId"`
+	GroupID   string            `json:"groupId"`
+	Traits    map[string]string `json:"traits"`
+}
@@ -0,0 +1,113 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// IdentityResolver resolves the cluster identities found in audit log records
+// into the identities we report to Segment
+type IdentityResolver interface {
+	// Workspace returns the name of the workspace the given namespace belongs
+	// to
+	Workspace(namespace string) (string, bool)
+	// UserID returns the SSO user ID of the given cluster username
+	UserID(username string) (string, bool)
+}
+
+// TimedIdentityResolver is an IdentityResolver that can also resolve
+// identities as they were at a given time. The Transformer uses it for
+// resolving the identities of records as of their timestamps.
+type TimedIdentityResolver interface {
+	IdentityResolver
+	// WorkspaceAt returns the name of the workspace the given namespace
+	// belonged to at the given time
+	WorkspaceAt(namespace string, t time.Time) (string, bool)
+	// UserIDAt returns the SSO user ID the given cluster username had at the
+	// given time
+	UserIDAt(username string, t time.Time) (string, bool)
+}
+
+// Memberships resolves the owners of workspaces and the roles of their
+// members, for workspaces that are shared or not named after their owner
+type Memberships interface {
+	// WorkspaceOwner returns the cluster username of the owner of the given
+	// workspace
+	WorkspaceOwner(workspace string) (string, bool)
+	// MemberRole returns the role the given cluster username has in the given
+	// workspace
+	MemberRole(workspace, username string) (string, bool)
+}
+
+// StaticMaps is an IdentityResolver that is based on static maps, such as the
+// ones generated by get-uid-map.sh and get-workspace-map.sh
+type StaticMaps struct {
+	// UIDs maps cluster usernames to SSO user IDs
+	UIDs map[string]string
+	// Workspaces maps namespace names to workspace names
+	Workspaces map[string]string
+}
+
+func (m *StaticMaps) Workspace(namespace string) (string, bool) {
+	ws, ok := m.Workspaces[namespace]
+	return ws, ok && ws != ""
+}
+
+func (m *StaticMaps) UserID(username string) (string, bool) {
+	uid, ok := m.UIDs[username]
+	return uid, ok && uid != ""
+}
+
+// LoadStaticMaps loads the UID and workspace maps from the given JSON files. An
+// empty path results in an empty map.
+func LoadStaticMaps(uidMapFile, wsMapFile string) (*StaticMaps, error) {
+	uids, err := loadMapFile(uidMapFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load UID map: %w", err)
+	}
+	workspaces, err := loadMapFile(wsMapFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workspace map: %w", err)
+	}
+	return &StaticMaps{UIDs: uids, Workspaces: workspaces}, nil
+}
+
+func loadMapFile(path string) (map[string]string, error) {
+	if path == "" {
+		return map[string]string{}, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadStringMap(file)
+}
+
+// ReadStringMap reads a JSON object mapping strings to strings. Numeric values
+// are converted to strings, since get-uid-map.sh emits SSO IDs as numbers. An
+// empty input yields an empty map.
+func ReadStringMap(r io.Reader) (map[string]string, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil && err != io.EOF {
+		return nil, err
+	}
+	m := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case string:
+			m[key] = v
+		case json.Number:
+			m[key] = v.String()
+		case nil:
+		default:
+			return nil, fmt.Errorf(`unexpected value type for key "%s": %T`, key, value)
+		}
+	}
+	return m, nil
+}
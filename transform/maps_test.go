@@ -0,0 +1,64 @@
+package transform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStringMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"Empty input", "", map[string]string{}, false},
+		{"String values", `{"a-tenant":"a","b-tenant":"b"}`, map[string]string{"a-tenant": "a", "b-tenant": "b"}, false},
+		{"Numeric values", `{"user1":52542471,"user2":"52542472"}`, map[string]string{"user1": "52542471", "user2": "52542472"}, false},
+		{"Null values are skipped", `{"user1":null}`, map[string]string{}, false},
+		{"Object values", `{"user1":{}}`, nil, true},
+		{"Not an object", `[1, 2]`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadStringMap(strings.NewReader(tt.input))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadStaticMaps(t *testing.T) {
+	maps, err := LoadStaticMaps(
+		"../splunk-to-segment/sample/getuid",
+		"../splunk-to-segment/sample/getworkspace",
+	)
+	require.NoError(t, err)
+	ws, ok := maps.Workspace("user1-tenant")
+	assert.True(t, ok)
+	assert.Equal(t, "user1", ws)
+	uid, ok := maps.UserID(ws)
+	assert.True(t, ok)
+	assert.Equal(t, "52542471", uid)
+	_, ok = maps.UserID("no-such-user")
+	assert.False(t, ok)
+
+	_, err = LoadStaticMaps(filepath.Join(t.TempDir(), "no-such-file"), "")
+	assert.Error(t, err)
+
+	emptyFile := filepath.Join(t.TempDir(), "empty")
+	require.NoError(t, os.WriteFile(emptyFile, nil, 0o600))
+	maps, err = LoadStaticMaps(emptyFile, "")
+	require.NoError(t, err)
+	assert.Empty(t, maps.UIDs)
+	assert.Empty(t, maps.Workspaces)
+}
@@ -0,0 +1,258 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DropReason describes why a record was dropped by the Transformer
+type DropReason string
+
+const (
+	// DropInvalidRecord is used for records missing mandatory fields
+	DropInvalidRecord DropReason = "invalid-record"
+	// DropInvalidTimestamp is used for records with a timestamp that cannot
+	// be parsed
+	DropInvalidTimestamp DropReason = "invalid-timestamp"
+	// DropMissingWorkspace is used for records in namespaces that could not be
+	// mapped to a workspace
+	DropMissingWorkspace DropReason = "missing-workspace"
+	// DropMissingWorkspaceOwnerUID is used for records in workspaces whose
+	// owner could not be mapped to an SSO user ID
+	DropMissingWorkspaceOwnerUID DropReason = "missing-workspace-owner-uid"
+	// DropMissingUID is used for records whose actor could not be mapped to an
+	// SSO user ID
+	DropMissingUID DropReason = "missing-uid"
+	// DropInvalidProperties is used for records with properties that are not
+	// a JSON object
+	DropInvalidProperties DropReason = "invalid-properties"
+	// DropInvalidContext is used for records with a context that is not a JSON
+	// object
+	DropInvalidContext DropReason = "invalid-context"
+)
+
+// DropError is returned by the Transformer for records that cannot be
+// converted into Segment events
+type DropError struct {
+	Reason DropReason
+	// Detail includes more information about the specific record, such as
+	// the value that could not be mapped
+	Detail string
+}
+
+func (e *DropError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("record dropped: %s", e.Reason)
+	}
+	return fmt.Sprintf("record dropped: %s: %s", e.Reason, e.Detail)
+}
+
+// eventVerbMap is used for converting present tense K8s API server verbs to
+// past tense
+var eventVerbMap = map[string]string{
+	"create":           "created",
+	"delete":           "deleted",
+	"deletecollection": "collection deleted",
+	"get":              "fetched",
+	"head":             "headers fetched",
+	"list":             "listed",
+	"patch":            "patched",
+	"update":           "updated",
+	"watch":            "watch started",
+}
+
+// eventSubjectMap is used for converting the plural resource names found in
+// the audit log to the singular, capitalized names users are used to seeing
+var eventSubjectMap = map[string]string{
+	"applications":                "Application",
+	"bannedusers":                 "BannedUser",
+	"buildpipelineselectors":      "BuildPipelineSelector",
+	"componentdetectionqueries":   "ComponentDetectionQuery",
+	"components":                  "Component",
+	"customruns":                  "CustomRun",
+	"deploymenttargetclaims":      "DeploymentTargetClaim",
+	"deploymenttargets":           "DeploymentTarget",
+	"enterprisecontractpolicies":  "EnterpriseContractPolicy",
+	"environments":                "Environment",
+	"integrationtestscenarios":    "IntegrationTestScenario",
+	"internalrequests":            "InternalRequest",
+	"masteruserrecords":           "MasterUserRecord",
+	"memberoperatorconfigs":       "MemberOperatorConfig",
+	"memberstatuses":              "MemberStatus",
+	"notifications":               "Notification",
+	"nstemplatesets":              "NSTemplateSet",
+	"nstemplatetiers":             "NSTemplateTier",
+	"pipelineresources":           "PipelineResource",
+	"pipelineruns":                "PipelineRun",
+	"pipelines":                   "Pipeline",
+	"promotionruns":               "PromotionRun",
+	"proxyplugins":                "ProxyPlugin",
+	"releaseplanadmissions":       "ReleasePlanAdmission",
+	"releaseplans":                "ReleasePlan",
+	"releases":                    "Release",
+	"releasestrategies":           "ReleaseStrategy",
+	"remotesecrets":               "RemoteSecret",
+	"runs":                        "Run",
+	"snapshotenvironmentbindings": "SnapshotEnvironmentBinding",
+	"snapshots":                   "Snapshot",
+	"socialevents":                "SocialEvent",
+	"spacebindings":               "SpaceBinding",
+	"spacerequests":               "SpaceRequest",
+	"spaces":                      "Space",
+	"spiaccesschecks":             "SPIAccessCheck",
+	"spiaccesstokenbindings":      "SPIAccessTokenBinding",
+	"spiaccesstokendataupdates":   "SPIAccessTokenDataUpdate",
+	"spiaccesstokens":             "SPIAccessToken",
+	"spifilecontentrequests":      "SPIFileContentRequest",
+	"taskruns":                    "TaskRun",
+	"tasks":                       "Task",
+	"tiertemplates":               "TierTemplate",
+	"toolchainclusters":           "ToolChainCluster",
+	"toolchainconfigs":            "ToolChainConfig",
+	"toolchainstatuses":           "ToolChainStatus",
+	"useraccounts":                "UserAccount",
+	"usersignups":                 "UserSignup",
+	"usertiers":                   "UserTier",
+	"verificationpolicies":        "VerificationPolicy",
+}
+
+// Transformer converts SplunkUJRecords into SegmentTrackEvents:
+//   - Cluster usernames are mapped to SSO user IDs
+//   - Nested JSON objects are converted from strings to actual objects
+//   - The event_* fields are combined into a single UI-flavoured event string
+//   - The workspace is set as the group of the event via context.groupId
+//
+// Not all event records have a userId field necessary for attribution in
+// Segment. In such cases, the owner of the workspace is used instead. Unless
+// Memberships are given, workspaces are assumed to be named after the
+// username of their owner.
+type Transformer struct {
+	resolver    IdentityResolver
+	memberships Memberships
+}
+
+// NewTransformer constructs a Transformer that uses the given resolver for
+// mapping cluster identities
+func NewTransformer(resolver IdentityResolver) *Transformer {
+	return &Transformer{resolver: resolver}
+}
+
+// WithMemberships sets the Memberships used for resolving workspace owners
+// and the roles of the users events are attributed to
+func (t *Transformer) WithMemberships(memberships Memberships) *Transformer {
+	t.memberships = memberships
+	return t
+}
+
+// Transform converts the given record into a Segment event. If the record
+// cannot be converted a *DropError is returned.
+func (t *Transformer) Transform(record SplunkUJRecord) (SegmentTrackEvent, error) {
+	if record.MessageID == "" || record.Timestamp == "" {
+		return SegmentTrackEvent{}, &DropError{DropInvalidRecord, "missing messageId or timestamp"}
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, record.Timestamp)
+	if err != nil {
+		return SegmentTrackEvent{}, &DropError{DropInvalidTimestamp, record.Timestamp}
+	}
+	workspace, ok := t.workspace(record.Namespace, timestamp)
+	if !ok {
+		return SegmentTrackEvent{}, &DropError{DropMissingWorkspace, record.Namespace}
+	}
+	wsUserName := t.owner(workspace)
+	wsSsoID, ok := t.userID(wsUserName, timestamp)
+	if !ok {
+		return SegmentTrackEvent{}, &DropError{DropMissingWorkspaceOwnerUID, wsUserName}
+	}
+	userName := record.UserID
+	if userName == "" {
+		userName = wsUserName
+	}
+	ssoID, ok := t.userID(userName, timestamp)
+	if !ok {
+		return SegmentTrackEvent{}, &DropError{DropMissingUID, userName}
+	}
+	properties, err := parseJSONObject(record.Properties)
+	if err != nil {
+		return SegmentTrackEvent{}, &DropError{DropInvalidProperties, err.Error()}
+	}
+	properties["workspaceID"] = wsSsoID
+	if t.memberships != nil {
+		if role, ok := t.memberships.MemberRole(workspace, userName); ok {
+			properties["workspaceRole"] = role
+		}
+	}
+	context, err := parseJSONObject(record.Context)
+	if err != nil {
+		return SegmentTrackEvent{}, &DropError{DropInvalidContext, err.Error()}
+	}
+	// Workspaces are modelled as Segment groups identified by the owner ID
+	context["groupId"] = wsSsoID
+	return SegmentTrackEvent{
+		MessageID:  record.MessageID,
+		Timestamp:  timestamp,
+		Namespace:  record.Namespace,
+		Type:       record.Type,
+		UserID:     ssoID,
+		Event:      eventName(record),
+		Properties: properties,
+		Context:    context,
+	}, nil
+}
+
+// workspace resolves the workspace of the given namespace as of the given
+// time if the resolver supports it, or as it is now otherwise
+func (t *Transformer) workspace(namespace string, at time.Time) (string, bool) {
+	if timed, ok := t.resolver.(TimedIdentityResolver); ok {
+		return timed.WorkspaceAt(namespace, at)
+	}
+	return t.resolver.Workspace(namespace)
+}
+
+// owner returns the username of the owner of the given workspace
+func (t *Transformer) owner(workspace string) string {
+	if t.memberships != nil {
+		if owner, ok := t.memberships.WorkspaceOwner(workspace); ok && owner != "" {
+			return owner
+		}
+	}
+	return workspace
+}
+
+// userID resolves the SSO user ID of the given username as of the given time
+// if the resolver supports it, or as it is now otherwise
+func (t *Transformer) userID(username string, at time.Time) (string, bool) {
+	if timed, ok := t.resolver.(TimedIdentityResolver); ok {
+		return timed.UserIDAt(username, at)
+	}
+	return t.resolver.UserID(username)
+}
+
+// eventName returns the explicit event name of the record if it has one, or
+// generates one from the event_subject and event_verb fields otherwise
+func eventName(record SplunkUJRecord) string {
+	if record.Event != "" {
+		return record.Event
+	}
+	subject, ok := eventSubjectMap[record.EventSubject]
+	if !ok {
+		subject = record.EventSubject
+	}
+	verb, ok := eventVerbMap[record.EventVerb]
+	if !ok {
+		verb = record.EventVerb
+	}
+	return subject + " " + verb
+}
+
+// parseJSONObject parses a string containing a JSON object
+func parseJSONObject(data string) (map[string]any, error) {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(data), &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("not a JSON object: %s", data)
+	}
+	return obj, nil
+}
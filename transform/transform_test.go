@@ -0,0 +1,307 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMaps = &StaticMaps{
+	UIDs: map[string]string{
+		"user1": "52542471",
+		"user2": "52542472",
+		"user3": "",
+	},
+	Workspaces: map[string]string{
+		"user1-tenant": "user1",
+		"user2-tenant": "user2",
+		"user3-tenant": "user3",
+		"user4-tenant": "user4",
+	},
+}
+
+func mkRecord(modify func(*SplunkUJRecord)) SplunkUJRecord {
+	record := SplunkUJRecord{
+		MessageID:    "9f655485-2c89-4162-81fe-01931a396767",
+		Timestamp:    "2023-11-20T07:59:03.061790Z",
+		Namespace:    "user1-tenant",
+		Type:         "track",
+		UserID:       "user2",
+		EventVerb:    "create",
+		EventSubject: "applications",
+		Properties:   `{"apiGroup":"appstudio.redhat.com","kind":"applications","name":"app"}`,
+		Context:      `{"userAgent":"kubectl/v1.28.4"}`,
+	}
+	if modify != nil {
+		modify(&record)
+	}
+	return record
+}
+
+func TestTransformer_Transform(t *testing.T) {
+	timestamp := time.Date(2023, 11, 20, 7, 59, 3, 61790000, time.UTC)
+	tests := []struct {
+		name       string
+		record     SplunkUJRecord
+		want       SegmentTrackEvent
+		wantReason DropReason
+	}{
+		{
+			name:   "Record with actor",
+			record: mkRecord(nil),
+			want: SegmentTrackEvent{
+				MessageID: "9f655485-2c89-4162-81fe-01931a396767",
+				Timestamp: timestamp,
+				Namespace: "user1-tenant",
+				Type:      "track",
+				UserID:    "52542472",
+				Event:     "Application created",
+				Properties: map[string]any{
+					"apiGroup":    "appstudio.redhat.com",
+					"kind":        "applications",
+					"name":        "app",
+					"workspaceID": "52542471",
+				},
+				Context: map[string]any{"userAgent": "kubectl/v1.28.4", "groupId": "52542471"},
+			},
+		},
+		{
+			name: "Record without actor is attributed to workspace owner",
+			record: mkRecord(func(r *SplunkUJRecord) {
+				r.UserID = ""
+				r.EventVerb = "watch"
+				r.EventSubject = "pipelineruns"
+			}),
+			want: SegmentTrackEvent{
+				MessageID: "9f655485-2c89-4162-81fe-01931a396767",
+				Timestamp: timestamp,
+				Namespace: "user1-tenant",
+				Type:      "track",
+				UserID:    "52542471",
+				Event:     "PipelineRun watch started",
+				Properties: map[string]any{
+					"apiGroup":    "appstudio.redhat.com",
+					"kind":        "applications",
+					"name":        "app",
+					"workspaceID": "52542471",
+				},
+				Context: map[string]any{"userAgent": "kubectl/v1.28.4", "groupId": "52542471"},
+			},
+		},
+		{
+			name: "Explicit event name",
+			record: mkRecord(func(r *SplunkUJRecord) {
+				r.Event = "Build PipelineRun created"
+			}),
+			want: SegmentTrackEvent{
+				MessageID: "9f655485-2c89-4162-81fe-01931a396767",
+				Timestamp: timestamp,
+				Namespace: "user1-tenant",
+				Type:      "track",
+				UserID:    "52542472",
+				Event:     "Build PipelineRun created",
+				Properties: map[string]any{
+					"apiGroup":    "appstudio.redhat.com",
+					"kind":        "applications",
+					"name":        "app",
+					"workspaceID": "52542471",
+				},
+				Context: map[string]any{"userAgent": "kubectl/v1.28.4", "groupId": "52542471"},
+			},
+		},
+		{
+			name: "Unknown subject and verb are used as-is",
+			record: mkRecord(func(r *SplunkUJRecord) {
+				r.EventVerb = "approve"
+				r.EventSubject = "widgets"
+			}),
+			want: SegmentTrackEvent{
+				MessageID: "9f655485-2c89-4162-81fe-01931a396767",
+				Timestamp: timestamp,
+				Namespace: "user1-tenant",
+				Type:      "track",
+				UserID:    "52542472",
+				Event:     "widgets approve",
+				Properties: map[string]any{
+					"apiGroup":    "appstudio.redhat.com",
+					"kind":        "applications",
+					"name":        "app",
+					"workspaceID": "52542471",
+				},
+				Context: map[string]any{"userAgent": "kubectl/v1.28.4", "groupId": "52542471"},
+			},
+		},
+		{
+			name:       "Missing messageId",
+			record:     mkRecord(func(r *SplunkUJRecord) { r.MessageID = "" }),
+			wantReason: DropInvalidRecord,
+		},
+		{
+			name:       "Invalid timestamp",
+			record:     mkRecord(func(r *SplunkUJRecord) { r.Timestamp = "2023-10-25T056:43:13.3455114Z" }),
+			wantReason: DropInvalidTimestamp,
+		},
+		{
+			name:       "Unknown namespace",
+			record:     mkRecord(func(r *SplunkUJRecord) { r.Namespace = "foo" }),
+			wantReason: DropMissingWorkspace,
+		},
+		{
+			name:       "Unknown workspace owner",
+			record:     mkRecord(func(r *SplunkUJRecord) { r.Namespace = "user4-tenant" }),
+			wantReason: DropMissingWorkspaceOwnerUID,
+		},
+		{
+			name:       "Workspace owner with empty UID",
+			record:     mkRecord(func(r *SplunkUJRecord) { r.Namespace = "user3-tenant" }),
+			wantReason: DropMissingWorkspaceOwnerUID,
+		},
+		{
+			name:       "Unknown actor",
+			record:     mkRecord(func(r *SplunkUJRecord) { r.UserID = "system:serviceaccount:foo" }),
+			wantReason: DropMissingUID,
+		},
+		{
+			name:       "Unparsable properties",
+			record:     mkRecord(func(r *SplunkUJRecord) { r.Properties = `{"apiGroup":` }),
+			wantReason: DropInvalidProperties,
+		},
+		{
+			name:       "Properties not an object",
+			record:     mkRecord(func(r *SplunkUJRecord) { r.Properties = `null` }),
+			wantReason: DropInvalidProperties,
+		},
+		{
+			name:       "Missing context",
+			record:     mkRecord(func(r *SplunkUJRecord) { r.Context = "" }),
+			wantReason: DropInvalidContext,
+		},
+	}
+	transformer := NewTransformer(testMaps)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := transformer.Transform(tt.record)
+			if tt.wantReason != "" {
+				var dropErr *DropError
+				require.ErrorAs(t, err, &dropErr)
+				assert.Equal(t, tt.wantReason, dropErr.Reason)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// timedMaps is a TimedIdentityResolver where user2 had a different SSO user
+// ID before the given time
+type timedMaps struct {
+	*StaticMaps
+	changedAt time.Time
+}
+
+func (m *timedMaps) WorkspaceAt(namespace string, _ time.Time) (string, bool) {
+	return m.Workspace(namespace)
+}
+
+func (m *timedMaps) UserIDAt(username string, t time.Time) (string, bool) {
+	if username == "user2" && t.Before(m.changedAt) {
+		return "old-id", true
+	}
+	return m.UserID(username)
+}
+
+func TestTransformer_TransformAsOfTimestamp(t *testing.T) {
+	changedAt := time.Date(2023, 11, 20, 8, 0, 0, 0, time.UTC)
+	transformer := NewTransformer(&timedMaps{StaticMaps: testMaps, changedAt: changedAt})
+
+	before, err := transformer.Transform(mkRecord(nil))
+	require.NoError(t, err)
+	assert.Equal(t, "old-id", before.UserID)
+
+	after, err := transformer.Transform(mkRecord(func(r *SplunkUJRecord) {
+		r.Timestamp = "2023-11-20T08:00:01Z"
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "52542472", after.UserID)
+}
+
+// testMemberships implements Memberships for a workspace owned by user2 and
+// shared with user1
+type testMemberships struct{}
+
+func (testMemberships) WorkspaceOwner(workspace string) (string, bool) {
+	if workspace == "team" {
+		return "user2", true
+	}
+	return "", false
+}
+
+func (testMemberships) MemberRole(workspace, username string) (string, bool) {
+	roles := map[string]string{"user1": "contributor", "user2": "admin"}
+	role, ok := roles[username]
+	return role, ok && workspace == "team"
+}
+
+func TestTransformer_TransformSharedWorkspace(t *testing.T) {
+	maps := &StaticMaps{UIDs: testMaps.UIDs, Workspaces: map[string]string{
+		"team-tenant":  "team",
+		"user1-tenant": "user1",
+	}}
+	transformer := NewTransformer(maps).WithMemberships(testMemberships{})
+
+	collaborator, err := transformer.Transform(mkRecord(func(r *SplunkUJRecord) {
+		r.Namespace = "team-tenant"
+		r.UserID = "user1"
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "52542471", collaborator.UserID)
+	assert.Equal(t, "52542472", collaborator.Context["groupId"])
+	assert.Equal(t, "52542472", collaborator.Properties["workspaceID"])
+	assert.Equal(t, "contributor", collaborator.Properties["workspaceRole"])
+
+	owner, err := transformer.Transform(mkRecord(func(r *SplunkUJRecord) {
+		r.Namespace = "team-tenant"
+		r.UserID = ""
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "52542472", owner.UserID)
+	assert.Equal(t, "admin", owner.Properties["workspaceRole"])
+
+	unknown, err := transformer.Transform(mkRecord(func(r *SplunkUJRecord) { r.UserID = "user2" }))
+	require.NoError(t, err)
+	assert.Equal(t, "52542471", unknown.Properties["workspaceID"], "owner defaults to the workspace name")
+	assert.NotContains(t, unknown.Properties, "workspaceRole")
+}
+
+func TestSegmentTrackEventJSON(t *testing.T) {
+	record, err := ParseSplunkUJRecord(json.RawMessage(`{
+		"context":"{\"userAgent\":\"kubectl/v1.28.4\"}",
+		"event_subject":"applications",
+		"event_verb":"create",
+		"messageId":"9f655485-2c89-4162-81fe-01931a396767",
+		"namespace":"user1-tenant",
+		"properties":"{\"apiGroup\":\"appstudio.redhat.com\"}",
+		"timestamp":"2023-11-20T07:59:03.061790Z",
+		"type":"track",
+		"userId":"user1"
+	}`))
+	require.NoError(t, err)
+	event, err := NewTransformer(testMaps).Transform(record)
+	require.NoError(t, err)
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"messageId":"9f655485-2c89-4162-81fe-01931a396767",
+		"timestamp":"2023-11-20T07:59:03.06179Z",
+		"namespace":"user1-tenant",
+		"type":"track",
+		"userId":"52542471",
+		"event":"Application created",
+		"properties":{"apiGroup":"appstudio.redhat.com","workspaceID":"52542471"},
+		"context":{"userAgent":"kubectl/v1.28.4","groupId":"52542471"}
+	}`, string(data))
+}
@@ -0,0 +1,83 @@
+package uidmap
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/redhat-appstudio/segment-bridge.git/configmap"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ConfigMapKey is the ConfigMap data key the UID map is stored under. It
+	// matches the key used by uid-map-maker-job.sh.
+	ConfigMapKey = "uid-map.json"
+	// TraitsConfigMapKey is the ConfigMap data key the user traits last sent
+	// to Segment are stored under
+	TraitsConfigMapKey = "uid-traits.json"
+)
+
+// WriteConfigMap stores the given UID map in the ConfigMap with the given
+// namespace and name, creating it if needed. Other keys in the ConfigMap are
+// left intact.
+func WriteConfigMap(
+	ctx context.Context, client kubernetes.Interface, namespace, name string, uids map[string]string,
+) error {
+	return writeConfigMapKey(ctx, client, namespace, name, ConfigMapKey, uids)
+}
+
+// ReadConfigMap reads the UID map stored in the ConfigMap with the given
+// namespace and name. A missing ConfigMap or key yields an empty map.
+func ReadConfigMap(
+	ctx context.Context, client kubernetes.Interface, namespace, name string,
+) (map[string]string, error) {
+	data, err := configmap.Read(ctx, client, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if uids, ok := data[ConfigMapKey]; ok {
+		return transform.ReadStringMap(strings.NewReader(uids))
+	}
+	return map[string]string{}, nil
+}
+
+// ReadConfigMapTraits reads the user traits stored in the ConfigMap with the
+// given namespace and name. A missing ConfigMap or key yields an empty map.
+func ReadConfigMapTraits(
+	ctx context.Context, client kubernetes.Interface, namespace, name string,
+) (map[string]map[string]string, error) {
+	traits := map[string]map[string]string{}
+	data, err := configmap.Read(ctx, client, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if stored, ok := data[TraitsConfigMapKey]; ok {
+		if err := json.Unmarshal([]byte(stored), &traits); err != nil {
+			return nil, err
+		}
+	}
+	return traits, nil
+}
+
+// WriteConfigMapTraits stores the given user traits in the ConfigMap with the
+// given namespace and name, creating it if needed. Other keys in the ConfigMap
+// are left intact.
+func WriteConfigMapTraits(
+	ctx context.Context, client kubernetes.Interface, namespace, name string,
+	traits map[string]map[string]string,
+) error {
+	return writeConfigMapKey(ctx, client, namespace, name, TraitsConfigMapKey, traits)
+}
+
+func writeConfigMapKey(
+	ctx context.Context, client kubernetes.Interface, namespace, name, key string, value any,
+) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return configmap.UpdateKeys(ctx, client, namespace, name, map[string]string{key: string(data)})
+}
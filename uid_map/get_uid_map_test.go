@@ -1,7 +1,9 @@
 package uidmap
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"testing"
 
 	"github.com/redhat-appstudio/segment-bridge.git/containerfixture"
@@ -9,6 +11,9 @@ import (
 	"github.com/redhat-appstudio/segment-bridge.git/scripts"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 func TestGetUIDMap(t *testing.T) {
@@ -40,3 +45,26 @@ func TestGetUIDMap(t *testing.T) {
 		}
 	})
 }
+
+func TestBuilder_BuildFromCluster(t *testing.T) {
+	containerfixture.WithServiceContainer(t, kwok.KwokServiceManifest, func(deployment containerfixture.FixtureInfo) {
+		kwok.SetKubeconfig()
+		restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{},
+		).ClientConfig()
+		require.NoError(t, err)
+		client, err := dynamic.NewForConfig(restConfig)
+		require.NoError(t, err)
+
+		result, err := NewBuilder(client).WithPageSize(4).Build(context.Background())
+
+		require.NoError(t, err)
+		expected := map[string]string{}
+		for i := 1; i <= 9; i++ {
+			expected[fmt.Sprintf("user%d", i)] = fmt.Sprintf("5254247%d", i)
+		}
+		assert.Equal(t, expected, result.UIDs)
+		assert.Empty(t, result.Skipped)
+		assert.Empty(t, result.Conflicts)
+	})
+}
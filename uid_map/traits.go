@@ -0,0 +1,132 @@
+package uidmap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"sort"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// StateLabel is the UserSignup label holding the signup approval state
+	StateLabel = "toolchain.dev.openshift.com/state"
+	// TargetClusterAnnotation is the UserSignup annotation holding the member
+	// cluster the user was last provisioned to
+	TargetClusterAnnotation = "toolchain.dev.openshift.com/last-target-cluster"
+	// ActivationCounterAnnotation is the UserSignup annotation counting the
+	// times the user was activated
+	ActivationCounterAnnotation = "toolchain.dev.openshift.com/activation-counter"
+)
+
+// Traits maps the names of the user traits that can be sent to Segment to
+// functions reading them from a UserSignup. Only traits listed here can be
+// sent, so personal information such as the user email annotation never is.
+var Traits = map[string]func(signup *unstructured.Unstructured) string{
+	"createdAt": func(signup *unstructured.Unstructured) string {
+		if created := signup.GetCreationTimestamp(); !created.IsZero() {
+			return created.UTC().Format(time.RFC3339)
+		}
+		return ""
+	},
+	"state": func(signup *unstructured.Unstructured) string {
+		return signup.GetLabels()[StateLabel]
+	},
+	"targetCluster": func(signup *unstructured.Unstructured) string {
+		return signup.GetAnnotations()[TargetClusterAnnotation]
+	},
+	"activations": func(signup *unstructured.Unstructured) string {
+		return signup.GetAnnotations()[ActivationCounterAnnotation]
+	},
+}
+
+// DefaultTraits lists the traits sent when no other traits are configured
+var DefaultTraits = []string{"createdAt", "state", "targetCluster"}
+
+// CheckTraits returns an error if any of the given trait names is not one of
+// the known Traits
+func CheckTraits(names []string) error {
+	for _, name := range names {
+		if _, ok := Traits[name]; !ok {
+			return fmt.Errorf("unknown trait %q", name)
+		}
+	}
+	return nil
+}
+
+// signupTraits reads the given traits from a UserSignup, leaving out the ones
+// it does not have
+func signupTraits(signup *unstructured.Unstructured, names []string) map[string]string {
+	traits := map[string]string{}
+	for _, name := range names {
+		if value := Traits[name](signup); value != "" {
+			traits[name] = value
+		}
+	}
+	return traits
+}
+
+// ChangedTraits returns the traits of the users whose traits differ from the
+// previous ones, e.g. the ones sent on the last run
+func ChangedTraits(current, previous map[string]map[string]string) map[string]map[string]string {
+	changed := map[string]map[string]string{}
+	for uid, traits := range current {
+		if !equalTraits(traits, previous[uid]) {
+			changed[uid] = traits
+		}
+	}
+	return changed
+}
+
+// KeepPreviousTraits returns a copy of the current traits where the given
+// users have their previous traits instead, or none if they had none, e.g. so
+// the traits of users whose identify events were rejected are sent again
+func KeepPreviousTraits(current, previous map[string]map[string]string, uids []string) map[string]map[string]string {
+	kept := maps.Clone(current)
+	for _, uid := range uids {
+		if traits, ok := previous[uid]; ok {
+			kept[uid] = traits
+		} else {
+			delete(kept, uid)
+		}
+	}
+	return kept
+}
+
+func equalTraits(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// IdentifyEvents returns Segment identify events for the given traits, sorted
+// by user ID. The message IDs are derived from the user IDs and traits, so
+// Segment discards the events if they are sent again.
+func IdentifyEvents(traits map[string]map[string]string, at time.Time) []transform.SegmentIdentifyEvent {
+	events := make([]transform.SegmentIdentifyEvent, 0, len(traits))
+	for uid, userTraits := range traits {
+		// Map keys are marshalled in sorted order, so the ID is stable
+		data, _ := json.Marshal(userTraits)
+		hash := sha256.Sum256(append([]byte(uid+"\x00"), data...))
+		events = append(events, transform.SegmentIdentifyEvent{
+			MessageID: "identify-" + hex.EncodeToString(hash[:16]),
+			Timestamp: at.UTC(),
+			Type:      "identify",
+			UserID:    uid,
+			Traits:    userTraits,
+		})
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].UserID < events[j].UserID })
+	return events
+}
@@ -0,0 +1,115 @@
+package uidmap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestBuilder_BuildTraits(t *testing.T) {
+	signup := mkSignup("user1", "111", "user1")
+	signup.SetCreationTimestamp(metav1.NewTime(time.Date(2023, 11, 20, 7, 59, 3, 0, time.UTC)))
+	signup.SetLabels(map[string]string{StateLabel: "approved"})
+	signup.SetAnnotations(map[string]string{
+		SSOUserIDAnnotation:                      "111",
+		TargetClusterAnnotation:                  "member1",
+		"toolchain.dev.openshift.com/user-email": "user1@example.com",
+	})
+	client, _ := pagedServer(t, signup, mkSignup("user2", "222", "user2"))
+
+	result, err := NewBuilder(client).WithTraits(DefaultTraits...).Build(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]string{
+		"111": {"createdAt": "2023-11-20T07:59:03Z", "state": "approved", "targetCluster": "member1"},
+		"222": {},
+	}, result.Traits)
+
+	result, err = NewBuilder(client).Build(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, result.Traits)
+
+	_, err = NewBuilder(client).WithTraits("state", "email").Build(context.Background())
+	assert.EqualError(t, err, `unknown trait "email"`)
+}
+
+func TestChangedTraits(t *testing.T) {
+	previous := map[string]map[string]string{
+		"111": {"state": "approved"},
+		"222": {"state": "pending"},
+		"333": {"state": "approved", "targetCluster": "member1"},
+		"444": {"state": "approved"},
+	}
+	current := map[string]map[string]string{
+		"111": {"state": "approved"},
+		"222": {"state": "approved"},
+		"333": {"state": "approved"},
+		"555": {"state": "pending"},
+	}
+	assert.Equal(t, map[string]map[string]string{
+		"222": {"state": "approved"},
+		"333": {"state": "approved"},
+		"555": {"state": "pending"},
+	}, ChangedTraits(current, previous))
+}
+
+func TestKeepPreviousTraits(t *testing.T) {
+	previous := map[string]map[string]string{
+		"111": {"state": "approved"},
+		"222": {"state": "pending"},
+	}
+	current := map[string]map[string]string{
+		"111": {"state": "approved"},
+		"222": {"state": "approved"},
+		"333": {"state": "pending"},
+	}
+	assert.Equal(t, map[string]map[string]string{
+		"111": {"state": "approved"},
+		"222": {"state": "pending"},
+	}, KeepPreviousTraits(current, previous, []string{"222", "333"}))
+	assert.Equal(t, current["222"], map[string]string{"state": "approved"}, "the current traits are kept as-is")
+}
+
+func TestIdentifyEvents(t *testing.T) {
+	at := time.Date(2023, 11, 20, 7, 59, 3, 0, time.UTC)
+	traits := map[string]map[string]string{
+		"222": {"state": "approved"},
+		"111": {"state": "approved"},
+	}
+	events := IdentifyEvents(traits, at)
+	require.Len(t, events, 2)
+	assert.Equal(t, "111", events[0].UserID)
+	assert.Equal(t, "identify", events[0].Type)
+	assert.Equal(t, at, events[0].Timestamp)
+	assert.Equal(t, map[string]string{"state": "approved"}, events[0].Traits)
+	assert.NotEqual(t, events[0].MessageID, events[1].MessageID)
+
+	again := IdentifyEvents(traits, at.Add(time.Hour))
+	assert.Equal(t, events[0].MessageID, again[0].MessageID, "message IDs do not depend on time")
+	changed := IdentifyEvents(map[string]map[string]string{"111": {"state": "pending"}}, at)
+	assert.NotEqual(t, events[0].MessageID, changed[0].MessageID)
+}
+
+func TestConfigMapTraits(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+
+	traits, err := ReadConfigMapTraits(ctx, client, "ns", "uid-map")
+	require.NoError(t, err)
+	assert.Empty(t, traits)
+
+	require.NoError(t, WriteConfigMap(ctx, client, "ns", "uid-map", map[string]string{"user1": "111"}))
+	stored := map[string]map[string]string{"111": {"state": "approved"}}
+	require.NoError(t, WriteConfigMapTraits(ctx, client, "ns", "uid-map", stored))
+	traits, err = ReadConfigMapTraits(ctx, client, "ns", "uid-map")
+	require.NoError(t, err)
+	assert.Equal(t, stored, traits)
+
+	uids, err := ReadConfigMap(ctx, client, "ns", "uid-map")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"user1": "111"}, uids, "the UID map is left intact")
+}
@@ -0,0 +1,192 @@
+package uidmap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// DefaultNamespace is the namespace UserSignup objects live in on the
+	// host cluster
+	DefaultNamespace = "toolchain-host-operator"
+	// DefaultPageSize is the amount of UserSignup objects fetched per List
+	// call
+	DefaultPageSize = 500
+	// SSOUserIDAnnotation is the UserSignup annotation holding the SSO user ID
+	SSOUserIDAnnotation = "toolchain.dev.openshift.com/sso-user-id"
+)
+
+// UserSignupResource identifies the UserSignup K8s API resource
+var UserSignupResource = schema.GroupVersionResource{
+	Group:    "toolchain.dev.openshift.com",
+	Version:  "v1alpha1",
+	Resource: "usersignups",
+}
+
+// Builder builds a UID map from the UserSignup objects of a host cluster
+type Builder struct {
+	client    dynamic.Interface
+	namespace string
+	pageSize  int64
+	traits    []string
+}
+
+// NewBuilder constructs a Builder that reads UserSignup objects via the given
+// client
+func NewBuilder(client dynamic.Interface) *Builder {
+	return &Builder{
+		client:    client,
+		namespace: DefaultNamespace,
+		pageSize:  DefaultPageSize,
+	}
+}
+
+// WithNamespace sets the namespace to read UserSignup objects from
+func (b *Builder) WithNamespace(namespace string) *Builder {
+	b.namespace = namespace
+	return b
+}
+
+// WithPageSize sets the amount of UserSignup objects fetched per List call
+func (b *Builder) WithPageSize(pageSize int64) *Builder {
+	b.pageSize = pageSize
+	return b
+}
+
+// WithTraits sets the names of the Traits to read from the UserSignup objects
+func (b *Builder) WithTraits(names ...string) *Builder {
+	b.traits = names
+	return b
+}
+
+// SkippedSignup describes a UserSignup that was left out of the map
+type SkippedSignup struct {
+	Name   string
+	Reason string
+}
+
+// Conflict describes a username that several UserSignup objects map to
+// different SSO user IDs. Conflicting usernames are left out of the map since
+// we cannot tell which ID is the right one.
+type Conflict struct {
+	Username string
+	// UserIDs maps each conflicting ID to the names of the signups it came from
+	UserIDs map[string][]string
+}
+
+// Result is the outcome of building a UID map
+type Result struct {
+	// UIDs maps cluster usernames to SSO user IDs
+	UIDs map[string]string
+	// Traits maps SSO user IDs to the traits configured for the Builder
+	Traits    map[string]map[string]string
+	Skipped   []SkippedSignup
+	Conflicts []Conflict
+}
+
+// Build lists all the UserSignup objects, one page at a time, and maps their
+// compliant usernames to their SSO user IDs. The configured traits are read
+// from the signups that are mapped.
+func (b *Builder) Build(ctx context.Context) (*Result, error) {
+	if err := CheckTraits(b.traits); err != nil {
+		return nil, err
+	}
+	sources := map[string]map[string][]string{}
+	traits := map[string]map[string]string{}
+	result := &Result{UIDs: map[string]string{}, Traits: map[string]map[string]string{}}
+	opts := metav1.ListOptions{Limit: b.pageSize}
+	for {
+		list, err := b.client.Resource(UserSignupResource).Namespace(b.namespace).List(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list UserSignups: %w", err)
+		}
+		for i := range list.Items {
+			name := list.Items[i].GetName()
+			username, uid, reason := SignupIdentity(&list.Items[i])
+			if reason != "" {
+				result.Skipped = append(result.Skipped, SkippedSignup{Name: name, Reason: reason})
+				continue
+			}
+			if sources[username] == nil {
+				sources[username] = map[string][]string{}
+			}
+			sources[username][uid] = append(sources[username][uid], name)
+			if len(b.traits) > 0 {
+				traits[uid] = signupTraits(&list.Items[i], b.traits)
+			}
+		}
+		if opts.Continue = list.GetContinue(); opts.Continue == "" {
+			break
+		}
+	}
+	for username, uids := range sources {
+		if len(uids) > 1 {
+			result.Conflicts = append(result.Conflicts, Conflict{Username: username, UserIDs: uids})
+			continue
+		}
+		for uid := range uids {
+			result.UIDs[username] = uid
+			if traits[uid] != nil {
+				result.Traits[uid] = traits[uid]
+			}
+		}
+	}
+	sort.Slice(result.Conflicts, func(i, j int) bool {
+		return result.Conflicts[i].Username < result.Conflicts[j].Username
+	})
+	return result, nil
+}
+
+// SignupIdentity returns the compliant username and SSO user ID of the given
+// UserSignup, or the reason it cannot be mapped
+func SignupIdentity(signup *unstructured.Unstructured) (username, uid, reason string) {
+	uid = signup.GetAnnotations()[SSOUserIDAnnotation]
+	if uid == "" {
+		return "", "", "missing " + SSOUserIDAnnotation + " annotation"
+	}
+	username, _, err := unstructured.NestedString(signup.Object, "status", "compliantUsername")
+	if err != nil {
+		return "", "", err.Error()
+	}
+	if username == "" {
+		return "", "", "missing status.compliantUsername"
+	}
+	return username, uid, ""
+}
+
+// WriteJSON writes the UID map as a JSON object
+func (r *Result) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r.UIDs)
+}
+
+// WriteReport writes a human-readable description of the signups that were
+// skipped and the conflicts that were found
+func (r *Result) WriteReport(w io.Writer) {
+	fmt.Fprintf(
+		w, "Mapped %d usernames, skipped %d signups, found %d conflicts\n",
+		len(r.UIDs), len(r.Skipped), len(r.Conflicts),
+	)
+	for _, skipped := range r.Skipped {
+		fmt.Fprintf(w, "Skipped signup %s: %s\n", skipped.Name, skipped.Reason)
+	}
+	for _, conflict := range r.Conflicts {
+		uids := make([]string, 0, len(conflict.UserIDs))
+		for uid := range conflict.UserIDs {
+			uids = append(uids, uid)
+		}
+		sort.Strings(uids)
+		fmt.Fprintf(w, "Conflicting IDs for username %s:", conflict.Username)
+		for _, uid := range uids {
+			fmt.Fprintf(w, " %s (%v)", uid, conflict.UserIDs[uid])
+		}
+		fmt.Fprintln(w)
+	}
+}
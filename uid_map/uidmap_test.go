@@ -0,0 +1,134 @@
+package uidmap
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func mkSignup(name, uid, username string) *unstructured.Unstructured {
+	signup := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "toolchain.dev.openshift.com/v1alpha1",
+		"kind":       "UserSignup",
+		"metadata":   map[string]any{"name": name, "namespace": DefaultNamespace},
+	}}
+	if uid != "" {
+		signup.SetAnnotations(map[string]string{SSOUserIDAnnotation: uid})
+	}
+	if username != "" {
+		signup.Object["status"] = map[string]any{"compliantUsername": username}
+	}
+	return signup
+}
+
+// pagedServer serves the given signups via a fake K8s API server, in pages
+// according to the List call limits. It returns a dynamic client for the
+// server and a pointer to the count of List calls made.
+func pagedServer(t *testing.T, signups ...*unstructured.Unstructured) (dynamic.Interface, *int) {
+	calls := 0
+	path := "/apis/toolchain.dev.openshift.com/v1alpha1/namespaces/" + DefaultNamespace + "/usersignups"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		calls++
+		start, _ := strconv.Atoi(r.URL.Query().Get("continue"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		end := len(signups)
+		if limit > 0 && start+limit < end {
+			end = start + limit
+		}
+		list := &unstructured.UnstructuredList{Object: map[string]any{
+			"apiVersion": "toolchain.dev.openshift.com/v1alpha1",
+			"kind":       "UserSignupList",
+		}}
+		for _, signup := range signups[start:end] {
+			list.Items = append(list.Items, *signup)
+		}
+		if end < len(signups) {
+			list.SetContinue(strconv.Itoa(end))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		data, err := list.MarshalJSON()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	client, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+	return client, &calls
+}
+
+func TestBuilder_Build(t *testing.T) {
+	client, calls := pagedServer(t,
+		mkSignup("user1", "111", "user1"),
+		mkSignup("user2", "222", "user2"),
+		mkSignup("no-uid", "", "user3"),
+		mkSignup("no-username", "444", ""),
+		mkSignup("user5", "555", "user5"),
+		mkSignup("user5-again", "555", "user5"),
+		mkSignup("user6", "666", "user6"),
+		mkSignup("user6-other", "667", "user6"),
+	)
+
+	result, err := NewBuilder(client).WithPageSize(3).Build(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, *calls)
+	assert.Equal(t, map[string]string{"user1": "111", "user2": "222", "user5": "555"}, result.UIDs)
+	assert.Equal(t, []SkippedSignup{
+		{Name: "no-uid", Reason: "missing " + SSOUserIDAnnotation + " annotation"},
+		{Name: "no-username", Reason: "missing status.compliantUsername"},
+	}, result.Skipped)
+	assert.Equal(t, []Conflict{
+		{Username: "user6", UserIDs: map[string][]string{"666": {"user6"}, "667": {"user6-other"}}},
+	}, result.Conflicts)
+
+	var report bytes.Buffer
+	result.WriteReport(&report)
+	assert.Equal(t,
+		"Mapped 3 usernames, skipped 2 signups, found 1 conflicts\n"+
+			"Skipped signup no-uid: missing toolchain.dev.openshift.com/sso-user-id annotation\n"+
+			"Skipped signup no-username: missing status.compliantUsername\n"+
+			"Conflicting IDs for username user6: 666 ([user6]) 667 ([user6-other])\n",
+		report.String(),
+	)
+
+	var out bytes.Buffer
+	require.NoError(t, result.WriteJSON(&out))
+	assert.JSONEq(t, `{"user1":"111","user2":"222","user5":"555"}`, out.String())
+}
+
+func TestWriteConfigMap(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "uid-map", Namespace: "ns"},
+		Data:       map[string]string{"other": "data"},
+	})
+
+	require.NoError(t, WriteConfigMap(ctx, client, "ns", "uid-map", map[string]string{"user1": "111"}))
+	require.NoError(t, WriteConfigMap(ctx, client, "ns", "new-map", map[string]string{"user2": "222"}))
+
+	cm, err := client.CoreV1().ConfigMaps("ns").Get(ctx, "uid-map", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"other": "data", ConfigMapKey: `{"user1":"111"}`}, cm.Data)
+	cm, err = client.CoreV1().ConfigMaps("ns").Get(ctx, "new-map", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{ConfigMapKey: `{"user2":"222"}`}, cm.Data)
+}
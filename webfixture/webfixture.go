@@ -26,13 +26,16 @@ func TraceRequestsFrom(test_func func(url string, c *http.Client)) (requests []R
 		}
 		requests_chan <- RequestTrace{r.Method, r.URL.Path, string(body)}
 	}))
-	defer svr.Close()
-	defer close(requests_chan)
+	done := make(chan struct{})
 	go func() {
+		defer close(done)
 		for request := range requests_chan {
 			requests = append(requests, request)
 		}
 	}()
 	test_func(svr.URL, svr.Client())
+	svr.Close()
+	close(requests_chan)
+	<-done
 	return
 }
@@ -0,0 +1,118 @@
+// Package webhook implements a sink that POSTs events as CloudEvents to HTTP
+// endpoints of internal consumers
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+)
+
+const (
+	// SpecVersion is the version of the CloudEvents specification we send
+	// events in
+	SpecVersion = "1.0"
+	// DefaultSource is the CloudEvents source of the events by default
+	DefaultSource = "/segment-bridge"
+	// TypePrefix is the prefix of the CloudEvents types of the events, which
+	// are followed by the Segment call type, e.g. TypePrefix + ".track"
+	TypePrefix = "com.redhat.appstudio.userjourney"
+
+	// ContentTypeStructured is the content type of requests holding a single
+	// event in the structured mode
+	ContentTypeStructured = "application/cloudevents+json"
+	// ContentTypeBatch is the content type of requests holding a batch of
+	// events
+	ContentTypeBatch = "application/cloudevents-batch+json"
+
+	// SignatureHeader holds the HMAC signature of signed requests
+	SignatureHeader = "X-Webhook-Signature"
+	// TimestampHeader holds the Unix time signed requests were signed at
+	TimestampHeader = "X-Webhook-Timestamp"
+)
+
+// CloudEvent is an event in the CloudEvents 1.0 JSON format, with the
+// transformed Segment call as its data
+type CloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject,omitempty"`
+	Time            time.Time `json:"time,omitzero"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            any       `json:"data"`
+}
+
+// Name returns the name endpoint filters match the event by, which is the
+// event name of track calls and the call type of other calls
+func (e CloudEvent) Name() string {
+	if track, ok := e.Data.(transform.SegmentTrackEvent); ok {
+		return track.Event
+	}
+	return e.Type[len(TypePrefix)+1:]
+}
+
+// FromSegment decodes the given Segment call record into the typed event
+// model of the transformer, and wraps it in a CloudEvent from the given
+// source. The message ID becomes the event ID, so consumers can deduplicate
+// events, and the subject is the event name of track calls, the user of
+// identify calls and the workspace of group calls.
+func FromSegment(data []byte, source string) (CloudEvent, error) {
+	var call struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &call); err != nil {
+		return CloudEvent{}, sink.ErrInvalidEvent
+	}
+	event := CloudEvent{
+		SpecVersion:     SpecVersion,
+		Source:          source,
+		Type:            TypePrefix + "." + call.Type,
+		DataContentType: "application/json",
+	}
+	var err error
+	switch call.Type {
+	case "track":
+		var track transform.SegmentTrackEvent
+		err = json.Unmarshal(data, &track)
+		event.ID, event.Time, event.Subject, event.Data = track.MessageID, track.Timestamp, track.Event, track
+	case "identify":
+		var identify transform.SegmentIdentifyEvent
+		err = json.Unmarshal(data, &identify)
+		event.ID, event.Time, event.Subject, event.Data = identify.MessageID, identify.Timestamp, identify.UserID, identify
+	case "group":
+		var group transform.SegmentGroupEvent
+		err = json.Unmarshal(data, &group)
+		event.ID, event.Time, event.Subject, event.Data = group.MessageID, group.Timestamp, group.GroupID, group
+	default:
+		return CloudEvent{}, fmt.Errorf("%w: unknown call type %q", sink.ErrInvalidEvent, call.Type)
+	}
+	if err != nil {
+		return CloudEvent{}, fmt.Errorf("%w: %w", sink.ErrInvalidEvent, err)
+	}
+	if event.ID == "" {
+		return CloudEvent{}, fmt.Errorf("%w: missing messageId", sink.ErrInvalidEvent)
+	}
+	return event, nil
+}
+
+// Sign returns the signature of a request body sent at the given time, which
+// is the hex-encoded HMAC-SHA256 of the Unix time, a dot and the body, keyed
+// by the secret of the endpoint. Requests carry it in the SignatureHeader as
+// "sha256=SIGNATURE", along with the time in the TimestampHeader, so
+// consumers can verify requests and refuse old ones.
+func Sign(secret []byte, at time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strconv.FormatInt(at.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
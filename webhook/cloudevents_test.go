@@ -0,0 +1,142 @@
+package webhook
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+	"github.com/redhat-appstudio/segment-bridge.git/transform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromSegment(t *testing.T) {
+	timestamp := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		event    string
+		want     CloudEvent
+		wantName string
+		wantErr  error
+	}{
+		{
+			name: "Track",
+			event: `{"messageId":"m1","timestamp":"2024-05-01T10:00:00Z","type":"track","userId":"u1",
+				"event":"Build Started","namespace":"ns1","properties":{"kind":"PipelineRun"},"context":{}}`,
+			want: CloudEvent{
+				SpecVersion:     SpecVersion,
+				ID:              "m1",
+				Source:          "/test",
+				Type:            TypePrefix + ".track",
+				Subject:         "Build Started",
+				Time:            timestamp,
+				DataContentType: "application/json",
+				Data: transform.SegmentTrackEvent{
+					MessageID:  "m1",
+					Timestamp:  timestamp,
+					Namespace:  "ns1",
+					Type:       "track",
+					UserID:     "u1",
+					Event:      "Build Started",
+					Properties: map[string]any{"kind": "PipelineRun"},
+					Context:    map[string]any{},
+				},
+			},
+			wantName: "Build Started",
+		},
+		{
+			name:  "Identify",
+			event: `{"messageId":"m2","timestamp":"2024-05-01T10:00:00Z","type":"identify","userId":"u1","traits":{"company":"Acme"}}`,
+			want: CloudEvent{
+				SpecVersion:     SpecVersion,
+				ID:              "m2",
+				Source:          "/test",
+				Type:            TypePrefix + ".identify",
+				Subject:         "u1",
+				Time:            timestamp,
+				DataContentType: "application/json",
+				Data: transform.SegmentIdentifyEvent{
+					MessageID: "m2",
+					Timestamp: timestamp,
+					Type:      "identify",
+					UserID:    "u1",
+					Traits:    map[string]string{"company": "Acme"},
+				},
+			},
+			wantName: "identify",
+		},
+		{
+			name:     "Group",
+			event:    `{"messageId":"m3","type":"group","userId":"u1","groupId":"ws1"}`,
+			wantName: "group",
+			want: CloudEvent{
+				SpecVersion:     SpecVersion,
+				ID:              "m3",
+				Source:          "/test",
+				Type:            TypePrefix + ".group",
+				Subject:         "ws1",
+				DataContentType: "application/json",
+				Data:            transform.SegmentGroupEvent{MessageID: "m3", Type: "group", UserID: "u1", GroupID: "ws1"},
+			},
+		},
+		{
+			name:    "Unknown type",
+			event:   `{"messageId":"m4","type":"page"}`,
+			wantErr: sink.ErrInvalidEvent,
+		},
+		{
+			name:    "Missing message ID",
+			event:   `{"type":"track","event":"Build Started"}`,
+			wantErr: sink.ErrInvalidEvent,
+		},
+		{
+			name:    "Invalid field",
+			event:   `{"messageId":"m5","type":"track","timestamp":"yesterday"}`,
+			wantErr: sink.ErrInvalidEvent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := FromSegment([]byte(tt.event), "/test")
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, event)
+			assert.Equal(t, tt.wantName, event.Name())
+		})
+	}
+}
+
+func TestCloudEvent_JSON(t *testing.T) {
+	event, err := FromSegment([]byte(`{"messageId":"m3","type":"group","userId":"u1","groupId":"ws1"}`), "/test")
+	require.NoError(t, err)
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"specversion": "1.0",
+		"id": "m3",
+		"source": "/test",
+		"type": "com.redhat.appstudio.userjourney.group",
+		"subject": "ws1",
+		"datacontenttype": "application/json",
+		"data": {
+			"messageId": "m3",
+			"timestamp": "0001-01-01T00:00:00Z",
+			"type": "group",
+			"userId": "u1",
+			"groupId": "ws1",
+			"traits": null
+		}
+	}`, string(data))
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1714557600.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t,
+		"1a93cfcd5bd60288e12dd4d9101efd1c3de905185e81811ee6545dfffb059e25",
+		Sign([]byte("secret"), time.Unix(1714557600, 0), []byte("{}")),
+	)
+}
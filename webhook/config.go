@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Mode is how events are sent to an endpoint
+type Mode string
+
+const (
+	// ModeStructured sends each event in a request of its own
+	ModeStructured Mode = "structured"
+	// ModeBatched sends events in batches, as JSON arrays of events
+	ModeBatched Mode = "batched"
+)
+
+// Config is a set of endpoints as loaded from a YAML or JSON configuration
+// file
+type Config struct {
+	Endpoints []Endpoint `json:"endpoints"`
+}
+
+// Endpoint describes an HTTP endpoint to send events to
+type Endpoint struct {
+	// URL is the URL events are POSTed to
+	URL string `json:"url"`
+	// Mode is how events are sent, structured by default
+	Mode Mode `json:"mode"`
+	// Events lists patterns, in path.Match syntax, of the names of the
+	// events to send, which are the event names of track calls and
+	// "identify" or "group" for other calls. All events are sent if empty.
+	Events []string `json:"events"`
+	// SecretEnv names the environment variable holding the secret requests
+	// are signed with. Requests are not signed if empty.
+	SecretEnv string `json:"secretEnv"`
+	// Secret is the secret requests are signed with, as read from SecretEnv
+	Secret []byte `json:"-"`
+}
+
+// ParseConfig parses a YAML or JSON endpoint configuration, reading the
+// secrets of the endpoints from their environment variables. Unknown fields
+// are treated as errors so typos do not go unnoticed.
+func ParseConfig(data []byte) (*Config, error) {
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook configuration: %w", err)
+	}
+	for i := range config.Endpoints {
+		endpoint := &config.Endpoints[i]
+		if err := endpoint.check(); err != nil {
+			return nil, fmt.Errorf("invalid webhook endpoint #%d (%q): %w", i+1, endpoint.URL, err)
+		}
+	}
+	return &config, nil
+}
+
+// LoadConfig reads and parses the endpoint configuration file at the given
+// path
+func LoadConfig(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// check verifies the endpoint is complete, applies defaults and reads its
+// secret
+func (e *Endpoint) check() error {
+	if u, err := url.Parse(e.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.New("missing or invalid URL")
+	}
+	switch e.Mode {
+	case "":
+		e.Mode = ModeStructured
+	case ModeStructured, ModeBatched:
+	default:
+		return fmt.Errorf("unknown mode %q", e.Mode)
+	}
+	for _, pattern := range e.Events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid event pattern %q", pattern)
+		}
+	}
+	if e.SecretEnv != "" {
+		e.Secret = []byte(os.Getenv(e.SecretEnv))
+		if len(e.Secret) == 0 {
+			return fmt.Errorf("the secret environment variable %s is not set", e.SecretEnv)
+		}
+	}
+	return nil
+}
+
+// Matches returns true if events of the given name are sent to the endpoint
+func (e *Endpoint) Matches(name string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, pattern := range e.Events {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	t.Setenv("ONBOARDING_SECRET", "s3cret")
+	config, err := ParseConfig([]byte(`
+endpoints:
+- url: https://onboarding.example.com/events
+  mode: batched
+  events: ["Build *", identify]
+  secretEnv: ONBOARDING_SECRET
+- url: http://digest.example.com
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []Endpoint{
+		{
+			URL:       "https://onboarding.example.com/events",
+			Mode:      ModeBatched,
+			Events:    []string{"Build *", "identify"},
+			SecretEnv: "ONBOARDING_SECRET",
+			Secret:    []byte("s3cret"),
+		},
+		{URL: "http://digest.example.com", Mode: ModeStructured},
+	}, config.Endpoints)
+
+	for _, invalid := range []string{
+		`endpoints: [{url: "ftp://example.com"}]`,
+		`endpoints: [{url: "https://example.com", mode: streaming}]`,
+		`endpoints: [{url: "https://example.com", events: ["[Build"]}]`,
+		`endpoints: [{url: "https://example.com", secretEnv: MISSING_SECRET}]`,
+		`endpoints: [{url: "https://example.com", filter: "Build"}]`,
+	} {
+		_, err := ParseConfig([]byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestEndpoint_Matches(t *testing.T) {
+	endpoint := Endpoint{Events: []string{"Build *", "identify"}}
+	assert.True(t, endpoint.Matches("Build Started"))
+	assert.True(t, endpoint.Matches("identify"))
+	assert.False(t, endpoint.Matches("Deployment Created"))
+	assert.True(t, (&Endpoint{}).Matches("Deployment Created"))
+}
@@ -0,0 +1,350 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+	"github.com/redhat-appstudio/segment-bridge.git/sink"
+)
+
+const (
+	// DefaultBatchEvents is the maximum number of events in each batch sent
+	// to endpoints in the batched mode by default
+	DefaultBatchEvents = 100
+	// DefaultBatchSize is the maximum size in bytes of each batch sent to
+	// endpoints in the batched mode by default
+	DefaultBatchSize = 1024 * 1024
+	// DefaultRetries is how many times we retry a failed call by default
+	DefaultRetries = httpretry.DefaultRetries
+)
+
+// ErrEventRefused is returned (wrapped in an EndpointError) for events an
+// endpoint refused as invalid
+var ErrEventRefused = errors.New("event was refused by the webhook endpoint")
+
+// EndpointError tags the reason why an event was not delivered with the URL
+// of the endpoint it concerns
+type EndpointError struct {
+	URL string
+	Err error
+}
+
+func (e *EndpointError) Error() string {
+	return fmt.Sprintf("%s: %v", e.URL, e.Err)
+}
+
+func (e *EndpointError) Unwrap() error { return e.Err }
+
+// Sink is a sink.Sink that POSTs events as CloudEvents to a set of HTTP
+// endpoints, sending each endpoint the events that match its filter.
+//
+// The Stats of its Writers count each event once: as delivered once all the
+// endpoints it matches accepted it, or as rejected, with an EndpointError for
+// each endpoint that refused it, once they all responded. Events that match
+// no endpoint count as delivered. The batches, bytes and statuses are those
+// of all the calls made, and Writer.EndpointStats reports them per endpoint.
+//
+// Events are delivered to the endpoints independently, so an endpoint failing
+// does not keep the others from receiving the event. The failure is returned
+// after the event was delivered to them, so delivering it again sends it to
+// them again, and endpoints are expected to deduplicate events by their ID.
+type Sink struct {
+	endpoints   []Endpoint
+	client      *http.Client
+	source      string
+	batchEvents int
+	batchSize   int
+	policy      *httpretry.Policy
+	// now returns the time requests are signed at
+	now func() time.Time
+}
+
+// NewSink constructs a default Sink sending events to the given endpoints
+func NewSink(endpoints ...Endpoint) *Sink {
+	return &Sink{
+		endpoints:   endpoints,
+		client:      http.DefaultClient,
+		source:      DefaultSource,
+		batchEvents: DefaultBatchEvents,
+		batchSize:   DefaultBatchSize,
+		policy:      httpretry.NewPolicy(),
+		now:         time.Now,
+	}
+}
+
+// WithClient sets the HTTP client used for making the calls
+func (s *Sink) WithClient(client *http.Client) *Sink {
+	s.client = client
+	return s
+}
+
+// WithSource sets the CloudEvents source of the events
+func (s *Sink) WithSource(source string) *Sink {
+	s.source = source
+	return s
+}
+
+// WithBatch sets the maximum number of events and the maximum size in bytes
+// of each batch sent to endpoints in the batched mode
+func (s *Sink) WithBatch(events, size int) *Sink {
+	s.batchEvents = events
+	s.batchSize = size
+	return s
+}
+
+// WithRetryPolicy sets the policy for retrying failed calls
+func (s *Sink) WithRetryPolicy(policy *httpretry.Policy) *Sink {
+	s.policy = policy
+	return s
+}
+
+func (s *Sink) Open(ctx context.Context) sink.Writer {
+	return &Writer{
+		ctx:         ctx,
+		sink:        s,
+		pending:     make([][]pendingEvent, len(s.endpoints)),
+		sizes:       make([]int, len(s.endpoints)),
+		endpoints:   make([]sink.Stats, len(s.endpoints)),
+		outstanding: map[int]*outcome{},
+	}
+}
+
+// pendingEvent is an encoded event waiting to be sent, along with the
+// sequence number of the event it was encoded from
+type pendingEvent struct {
+	seq  int
+	data []byte
+}
+
+// outcome tracks the deliveries of an event to the endpoints it matches,
+// keeping the event so it can be dead-lettered if an endpoint refuses it
+type outcome struct {
+	event []byte
+	// remaining is the number of endpoints that did not respond yet
+	remaining int
+	// refused lists the errors of the endpoints that refused the event
+	refused []error
+}
+
+// Writer is the sink.Writer of a Sink
+type Writer struct {
+	ctx  context.Context
+	sink *Sink
+	// pending holds the encoded events of the current batch of each
+	// endpoint in the batched mode, and sizes the sizes of the batches
+	pending [][]pendingEvent
+	sizes   []int
+	// endpoints holds the Stats of each endpoint
+	endpoints []sink.Stats
+	// outstanding tracks the events by sequence number until all the
+	// endpoints they match responded
+	outstanding map[int]*outcome
+	seq         int
+	stats       sink.Stats
+}
+
+func (w *Writer) WriteEvent(data []byte) error {
+	event, err := FromSegment(data, w.sink.source)
+	if err != nil {
+		return w.reject(data, err)
+	}
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return w.reject(data, fmt.Errorf("%w: %w", sink.ErrInvalidEvent, err))
+	}
+	name := event.Name()
+	var matching []int
+	for i := range w.sink.endpoints {
+		if w.sink.endpoints[i].Matches(name) {
+			matching = append(matching, i)
+		}
+	}
+	if len(matching) == 0 {
+		w.stats.Events++
+		return nil
+	}
+	pending := pendingEvent{seq: w.seq, data: encoded}
+	w.outstanding[w.seq] = &outcome{event: data, remaining: len(matching)}
+	w.seq++
+
+	var errs []error
+	for _, i := range matching {
+		if w.sink.endpoints[i].Mode == ModeStructured {
+			errs = append(errs, w.deliver(i, []pendingEvent{pending}))
+			continue
+		}
+		if len(w.pending[i]) > 0 &&
+			(len(w.pending[i]) >= w.sink.batchEvents || w.sizes[i]+len(encoded)+1 > w.sink.batchSize) {
+			errs = append(errs, w.flushEndpoint(i))
+		}
+		w.pending[i] = append(w.pending[i], pending)
+		w.sizes[i] += len(encoded) + 1
+	}
+	return errors.Join(errs...)
+}
+
+// Flush sends the pending batches of the endpoints in the batched mode
+func (w *Writer) Flush() error {
+	var errs []error
+	for i := range w.sink.endpoints {
+		errs = append(errs, w.flushEndpoint(i))
+	}
+	return errors.Join(errs...)
+}
+
+// flushEndpoint sends the pending batch of the given endpoint. The batch is
+// dropped if sending it fails, leaving the events for the caller to deliver
+// again.
+func (w *Writer) flushEndpoint(i int) error {
+	if len(w.pending[i]) == 0 {
+		return nil
+	}
+	err := w.deliver(i, w.pending[i])
+	w.pending[i] = nil
+	w.sizes[i] = 0
+	return err
+}
+
+func (w *Writer) Close() error {
+	return w.Flush()
+}
+
+// Stats reports the outcome of the events written so far, and the calls made
+// to all the endpoints
+func (w *Writer) Stats() sink.Stats {
+	stats := w.stats
+	for _, endpoint := range w.endpoints {
+		stats.Batches += endpoint.Batches
+		stats.Bytes += endpoint.Bytes
+		for status, count := range endpoint.Statuses {
+			if stats.Statuses == nil {
+				stats.Statuses = map[int]int{}
+			}
+			stats.Statuses[status] += count
+		}
+	}
+	return stats
+}
+
+// EndpointStats reports the outcome of the deliveries to each endpoint, in
+// the order the endpoints were given to the Sink. Their Events count the
+// events the endpoint accepted, and their Rejected the events it refused.
+func (w *Writer) EndpointStats() []sink.Stats {
+	return append([]sink.Stats(nil), w.endpoints...)
+}
+
+// reject records the given event as rejected, keeping it so it can be
+// dead-lettered
+func (w *Writer) reject(event []byte, reason error) error {
+	err := &sink.EventError{Size: len(event), Err: reason, Event: event}
+	w.stats.Rejected = append(w.stats.Rejected, err)
+	return err
+}
+
+// settle records that an endpoint responded to the delivery of the event with
+// the given sequence number, refusing it with the given error if not nil, and
+// records the outcome of the event once all its endpoints responded
+func (w *Writer) settle(seq int, refused error) {
+	outcome := w.outstanding[seq]
+	if refused != nil {
+		outcome.refused = append(outcome.refused, refused)
+	}
+	if outcome.remaining--; outcome.remaining > 0 {
+		return
+	}
+	delete(w.outstanding, seq)
+	if len(outcome.refused) == 0 {
+		w.stats.Events++
+		return
+	}
+	_ = w.reject(outcome.event, errors.Join(outcome.refused...))
+}
+
+// deliver sends the given events to the endpoint with the given index. If the
+// endpoint refuses a batch as invalid, it is split in halves that are sent
+// separately, so the valid events get delivered and the invalid ones are found
+// and rejected.
+func (w *Writer) deliver(i int, events []pendingEvent) error {
+	endpoint, stats := &w.sink.endpoints[i], &w.endpoints[i]
+	body, contentType := events[0].data, ContentTypeStructured
+	if endpoint.Mode == ModeBatched {
+		encoded := make([][]byte, len(events))
+		for j, event := range events {
+			encoded[j] = event.data
+		}
+		body, contentType = append(append([]byte{'['}, bytes.Join(encoded, []byte{','})...), ']'), ContentTypeBatch
+	}
+	if stats.Statuses == nil {
+		stats.Statuses = map[int]int{}
+	}
+	status, err := w.sink.send(w.ctx, endpoint, contentType, body, stats.Statuses)
+	if err != nil {
+		return fmt.Errorf("webhook call to %s failed: %w", endpoint.URL, err)
+	}
+	switch {
+	case status >= 200 && status < 300:
+		stats.Events += len(events)
+		stats.Batches++
+		stats.Bytes += len(body)
+		for _, event := range events {
+			w.settle(event.seq, nil)
+		}
+		return nil
+	case status == http.StatusBadRequest ||
+		status == http.StatusRequestEntityTooLarge ||
+		status == http.StatusUnprocessableEntity:
+		if len(events) == 1 {
+			refused := &EndpointError{URL: endpoint.URL, Err: ErrEventRefused}
+			event := w.outstanding[events[0].seq].event
+			stats.Rejected = append(stats.Rejected, &sink.EventError{Size: len(event), Err: refused, Event: event})
+			w.settle(events[0].seq, refused)
+			return nil
+		}
+		half := len(events) / 2
+		if err := w.deliver(i, events[:half]); err != nil {
+			return err
+		}
+		return w.deliver(i, events[half:])
+	}
+	return fmt.Errorf("webhook call to %s failed with HTTP status %d", endpoint.URL, status)
+}
+
+// send POSTs the given body to the given endpoint, signing the request if
+// the endpoint has a secret and retrying failed calls according to the retry
+// policy, counts the HTTP status codes of the responses, and returns the
+// status of the last one
+func (s *Sink) send(
+	ctx context.Context, endpoint *Endpoint, contentType string, body []byte, statuses map[int]int,
+) (int, error) {
+	resp, err := s.policy.Do(ctx, func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		if len(endpoint.Secret) > 0 {
+			at := s.now()
+			req.Header.Set(TimestampHeader, strconv.FormatInt(at.Unix(), 10))
+			req.Header.Set(SignatureHeader, "sha256="+Sign(endpoint.Secret, at, body))
+		}
+		resp, err := s.client.Do(req)
+		if err == nil {
+			statuses[resp.StatusCode]++
+		}
+		return resp, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
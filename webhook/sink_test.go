@@ -0,0 +1,247 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/redhat-appstudio/segment-bridge.git/httpretry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// received is a request received by a test endpoint
+type received struct {
+	contentType string
+	ids         []string
+}
+
+// testEndpoint starts an endpoint that records the IDs of the events it
+// receives, verifies signatures if given a secret, and responds with the
+// status returned by the given function
+func testEndpoint(t *testing.T, secret string, respond func(ids []string) int) (*httptest.Server, *[]received) {
+	var requests []received
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		if secret != "" {
+			unix, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+			require.NoError(t, err)
+			assert.Equal(t,
+				"sha256="+Sign([]byte(secret), time.Unix(unix, 0), body),
+				r.Header.Get(SignatureHeader),
+			)
+		} else {
+			assert.Empty(t, r.Header.Get(SignatureHeader))
+		}
+
+		var events []CloudEvent
+		request := received{contentType: r.Header.Get("Content-Type")}
+		if request.contentType == ContentTypeBatch {
+			require.NoError(t, json.Unmarshal(body, &events))
+		} else {
+			events = make([]CloudEvent, 1)
+			require.NoError(t, json.Unmarshal(body, &events[0]))
+		}
+		for _, event := range events {
+			assert.Equal(t, SpecVersion, event.SpecVersion)
+			request.ids = append(request.ids, event.ID)
+		}
+		requests = append(requests, request)
+		w.WriteHeader(respond(request.ids))
+	}))
+	t.Cleanup(svr.Close)
+	return svr, &requests
+}
+
+func accept([]string) int { return http.StatusAccepted }
+
+func trackEvent(id, name string) []byte {
+	return fmt.Appendf(nil, `{"messageId":"%s","type":"track","userId":"u1","event":"%s"}`, id, name)
+}
+
+func TestSink(t *testing.T) {
+	structured, structuredRequests := testEndpoint(t, "s3cret", accept)
+	batched, batchedRequests := testEndpoint(t, "", accept)
+	s := NewSink(
+		Endpoint{URL: structured.URL, Mode: ModeStructured, Events: []string{"Build *"}, Secret: []byte("s3cret")},
+		Endpoint{URL: batched.URL, Mode: ModeBatched},
+	).WithBatch(2, DefaultBatchSize)
+
+	w := s.Open(context.Background())
+	for _, event := range [][]byte{
+		trackEvent("m1", "Build Started"),
+		trackEvent("m2", "Deployment Created"),
+		[]byte(`{"messageId":"m3","type":"identify","userId":"u1"}`),
+		trackEvent("m4", "Build Completed"),
+	} {
+		require.NoError(t, w.WriteEvent(event))
+	}
+	assert.Error(t, w.WriteEvent([]byte(`{"type":"page"}`)))
+	require.NoError(t, w.Close())
+
+	assert.Equal(t, []received{
+		{ContentTypeStructured, []string{"m1"}},
+		{ContentTypeStructured, []string{"m4"}},
+	}, *structuredRequests)
+	assert.Equal(t, []received{
+		{ContentTypeBatch, []string{"m1", "m2"}},
+		{ContentTypeBatch, []string{"m3", "m4"}},
+	}, *batchedRequests)
+	stats := w.Stats()
+	assert.Equal(t, 4, stats.Events, "each event counts once")
+	assert.Equal(t, 4, stats.Batches)
+	assert.Equal(t, map[int]int{http.StatusAccepted: 4}, stats.Statuses)
+	assert.Len(t, stats.Rejected, 1)
+	endpoints := w.(*Writer).EndpointStats()
+	require.Len(t, endpoints, 2)
+	assert.Equal(t, 2, endpoints[0].Events)
+	assert.Equal(t, 4, endpoints[1].Events)
+}
+
+func TestSink_partialDelivery(t *testing.T) {
+	good, goodRequests := testEndpoint(t, "", accept)
+	picky, _ := testEndpoint(t, "", func(ids []string) int {
+		if ids[0] == "bad" {
+			return http.StatusBadRequest
+		}
+		return http.StatusOK
+	})
+	down, downRequests := testEndpoint(t, "", func([]string) int { return http.StatusServiceUnavailable })
+	policy := httpretry.NewPolicy().WithRetries(1).WithBackoff(time.Millisecond, time.Millisecond)
+
+	w := NewSink(
+		Endpoint{URL: good.URL, Mode: ModeStructured},
+		Endpoint{URL: picky.URL, Mode: ModeStructured},
+	).
+		WithRetryPolicy(policy).
+		Open(context.Background())
+	require.NoError(t, w.WriteEvent(trackEvent("m1", "Build Started")))
+	require.NoError(t, w.WriteEvent(trackEvent("bad", "Build Started")))
+	require.NoError(t, w.Close())
+	assert.Len(t, *goodRequests, 2, "the good endpoint received all the events")
+	stats := w.Stats()
+	assert.Equal(t, 1, stats.Events)
+	require.Len(t, stats.Rejected, 1)
+	assert.ErrorIs(t, stats.Rejected[0], ErrEventRefused)
+	var endpointErr *EndpointError
+	require.ErrorAs(t, stats.Rejected[0], &endpointErr)
+	assert.Equal(t, picky.URL, endpointErr.URL)
+	assert.Equal(t, trackEvent("bad", "Build Started"), stats.Rejected[0].Event, "refused events are kept")
+	endpoints := w.(*Writer).EndpointStats()
+	assert.Equal(t, 2, endpoints[0].Events)
+	assert.Empty(t, endpoints[0].Rejected)
+	assert.Equal(t, 1, endpoints[1].Events)
+	assert.Len(t, endpoints[1].Rejected, 1)
+
+	w = NewSink(
+		Endpoint{URL: down.URL, Mode: ModeStructured},
+		Endpoint{URL: good.URL, Mode: ModeStructured},
+	).
+		WithRetryPolicy(policy).
+		Open(context.Background())
+	assert.ErrorContains(t, w.WriteEvent(trackEvent("m2", "Build Started")), down.URL)
+	assert.Len(t, *downRequests, 2)
+	assert.Len(t, *goodRequests, 3, "an endpoint failing does not keep the event from the others")
+	assert.Equal(t, 0, w.Stats().Events, "the event is not delivered to all its endpoints")
+	assert.Equal(t, 1, w.(*Writer).EndpointStats()[1].Events)
+}
+
+func TestSink_failures(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         Mode
+		respond      func(calls int, ids []string) int
+		wantRequests [][]string
+		wantEvents   int
+		wantRejected int
+		wantErr      bool
+	}{
+		{
+			name: "Refused batch",
+			mode: ModeBatched,
+			respond: func(_ int, ids []string) int {
+				for _, id := range ids {
+					if id == "bad" {
+						return http.StatusUnprocessableEntity
+					}
+				}
+				return http.StatusOK
+			},
+			wantRequests: [][]string{{"m1", "bad", "m3"}, {"m1"}, {"bad", "m3"}, {"bad"}, {"m3"}},
+			wantEvents:   2,
+			wantRejected: 1,
+		},
+		{
+			name: "Refused event",
+			mode: ModeStructured,
+			respond: func(_ int, ids []string) int {
+				if ids[0] == "bad" {
+					return http.StatusBadRequest
+				}
+				return http.StatusOK
+			},
+			wantRequests: [][]string{{"m1"}, {"bad"}, {"m3"}},
+			wantEvents:   2,
+			wantRejected: 1,
+		},
+		{
+			name: "Transient failure",
+			mode: ModeBatched,
+			respond: func(calls int, _ []string) int {
+				if calls == 1 {
+					return http.StatusServiceUnavailable
+				}
+				return http.StatusOK
+			},
+			wantRequests: [][]string{{"m1", "bad", "m3"}, {"m1", "bad", "m3"}},
+			wantEvents:   3,
+		},
+		{
+			name:         "Permanent failure",
+			mode:         ModeStructured,
+			respond:      func(int, []string) int { return http.StatusNotFound },
+			wantRequests: [][]string{{"m1"}},
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			svr, requests := testEndpoint(t, "", func(ids []string) int {
+				calls++
+				return tt.respond(calls, ids)
+			})
+			w := NewSink(Endpoint{URL: svr.URL, Mode: tt.mode}).
+				WithRetryPolicy(httpretry.NewPolicy().WithBackoff(time.Millisecond, time.Millisecond)).
+				Open(context.Background())
+			var err error
+			for _, id := range []string{"m1", "bad", "m3"} {
+				if err = w.WriteEvent(trackEvent(id, "Build Started")); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = w.Close()
+			}
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			var ids [][]string
+			for _, request := range *requests {
+				ids = append(ids, request.ids)
+			}
+			assert.Equal(t, tt.wantRequests, ids)
+			assert.Equal(t, tt.wantEvents, w.Stats().Events)
+			assert.Len(t, w.Stats().Rejected, tt.wantRejected)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package wsmap
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redhat-appstudio/segment-bridge.git/configmap"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ConfigMapKey is the ConfigMap data key the map from namespaces to
+	// workspaces is stored under. It matches the key used by
+	// ws-map-maker-job.sh.
+	ConfigMapKey = "ws-map.json"
+	// EntriesConfigMapKey is the ConfigMap data key the map entries,
+	// including the clusters each namespace was found in, are stored under
+	EntriesConfigMapKey = "ws-map-entries.json"
+)
+
+// ReadConfigMapEntries reads the map entries stored in the ConfigMap with the
+// given namespace and name. A missing ConfigMap or key yields an empty map.
+func ReadConfigMapEntries(
+	ctx context.Context, client kubernetes.Interface, namespace, name string,
+) (map[string]Entry, error) {
+	entries := map[string]Entry{}
+	data, err := configmap.Read(ctx, client, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if stored, ok := data[EntriesConfigMapKey]; ok {
+		if err := json.Unmarshal([]byte(stored), &entries); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// WriteConfigMap stores the workspace map and its entries in the ConfigMap
+// with the given namespace and name, creating it if needed. Other keys in the
+// ConfigMap are left intact.
+func WriteConfigMap(
+	ctx context.Context, client kubernetes.Interface, namespace, name string, result *Result,
+) error {
+	workspaces, err := json.Marshal(result.Workspaces())
+	if err != nil {
+		return err
+	}
+	entries, err := json.Marshal(result.Entries)
+	if err != nil {
+		return err
+	}
+	return configmap.UpdateKeys(ctx, client, namespace, name, map[string]string{
+		ConfigMapKey:        string(workspaces),
+		EntriesConfigMapKey: string(entries),
+	})
+}
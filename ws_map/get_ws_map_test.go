@@ -1,6 +1,7 @@
 package wsmap
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"testing"
@@ -9,6 +10,8 @@ import (
 	"github.com/redhat-appstudio/segment-bridge.git/kwok"
 	"github.com/redhat-appstudio/segment-bridge.git/scripts"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 func TestGetWSMap(t *testing.T) {
@@ -62,3 +65,24 @@ func TestGetWSMap(t *testing.T) {
 		}
 	})
 }
+
+func TestBuilder_BuildFromClusters(t *testing.T) {
+	containerfixture.WithServiceContainer(t, kwok.KwokServiceManifest, func(deployment containerfixture.FixtureInfo) {
+		kwok.SetKubeconfig()
+		config, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
+		require.NoError(t, err)
+		clusters, err := ClustersFromConfig(config, []string{"kwok-rh01", "kwok-m01"}, nil)
+		require.NoError(t, err)
+
+		result := NewBuilder(clusters...).Build(context.Background())
+
+		assert.Equal(t, map[string]Entry{
+			"date-masamune-tenant": {Workspace: "date-masamune", Clusters: []string{"kwok-m01"}},
+			"koyasu-tenant":        {Workspace: "koyasu", Clusters: []string{"kwok-m01"}},
+			"nobu-tenant":          {Workspace: "nobu", Clusters: []string{"kwok-rh01", "kwok-m01"}},
+			"ieyasu-tenant":        {Workspace: "ieyasu", Clusters: []string{"kwok-rh01"}},
+		}, result.Entries)
+		assert.Empty(t, result.Errors)
+		assert.Empty(t, result.Conflicts)
+	})
+}
@@ -0,0 +1,76 @@
+package wsmap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// ClustersFromConfig returns the clusters specified by the given kubeconfig
+// context names and cluster URLs. A cluster URL is resolved to a context
+// whose cluster has that server URL or that name, so the kubeconfig must
+// include a context for each URL.
+func ClustersFromConfig(config *clientcmdapi.Config, contexts, urls []string) ([]Cluster, error) {
+	clusters := make([]Cluster, 0, len(contexts)+len(urls))
+	for _, contextName := range contexts {
+		cluster, err := clusterForContext(config, contextName, contextName)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cluster)
+	}
+	for _, url := range urls {
+		contextName, err := contextForURL(config, url)
+		if err != nil {
+			return nil, err
+		}
+		cluster, err := clusterForContext(config, contextName, url)
+		if err != nil {
+			return nil, err
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+func clusterForContext(config *clientcmdapi.Config, contextName, name string) (Cluster, error) {
+	if _, ok := config.Contexts[contextName]; !ok {
+		return Cluster{}, fmt.Errorf("context %q not found in kubeconfig", contextName)
+	}
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(
+		*config, contextName, &clientcmd.ConfigOverrides{}, nil,
+	).ClientConfig()
+	if err != nil {
+		return Cluster{}, fmt.Errorf("invalid configuration for context %q: %w", contextName, err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return Cluster{}, err
+	}
+	return Cluster{Name: name, Client: client}, nil
+}
+
+// contextForURL returns the name of the first context, in alphabetical order,
+// whose cluster matches the given URL
+func contextForURL(config *clientcmdapi.Config, url string) (string, error) {
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		clusterName := config.Contexts[name].Cluster
+		if clusterName == url {
+			return name, nil
+		}
+		if cluster, ok := config.Clusters[clusterName]; ok &&
+			strings.TrimSuffix(cluster.Server, "/") == strings.TrimSuffix(url, "/") {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no kubeconfig context found for cluster %q", url)
+}
@@ -0,0 +1,203 @@
+package wsmap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// TenantSelector selects the namespaces that belong to workspaces
+	TenantSelector = "toolchain.dev.openshift.com/type=tenant"
+	// SpaceLabel is the namespace label holding the workspace name
+	SpaceLabel = "toolchain.dev.openshift.com/space"
+)
+
+// Cluster is a member cluster to read tenant namespaces from
+type Cluster struct {
+	// Name identifies the cluster in the results, e.g. the kubeconfig context
+	// or URL the cluster was specified by
+	Name   string
+	Client kubernetes.Interface
+}
+
+// Entry describes the workspace a namespace belongs to
+type Entry struct {
+	Workspace string `json:"workspace"`
+	// Clusters lists the clusters the namespace was found in
+	Clusters []string `json:"clusters"`
+}
+
+// ClusterError describes a cluster that could not be read
+type ClusterError struct {
+	Cluster string
+	Err     error
+}
+
+func (e ClusterError) Error() string {
+	return fmt.Sprintf("cluster %s: %v", e.Cluster, e.Err)
+}
+
+func (e ClusterError) Unwrap() error {
+	return e.Err
+}
+
+// Conflict describes a namespace that is claimed by different workspaces in
+// different clusters. Conflicting namespaces are left out of the map since we
+// cannot tell which workspace is the right one.
+type Conflict struct {
+	Namespace string
+	// Claims maps each workspace claiming the namespace to the clusters the
+	// claim was found in
+	Claims map[string][]string
+}
+
+// Result is the outcome of building a workspace map
+type Result struct {
+	// Entries maps namespace names to the workspaces they belong to
+	Entries   map[string]Entry
+	Errors    []ClusterError
+	Conflicts []Conflict
+}
+
+// Builder builds a workspace map from the tenant namespaces of a set of
+// member clusters
+type Builder struct {
+	clusters []Cluster
+}
+
+// NewBuilder constructs a Builder that reads the given clusters
+func NewBuilder(clusters ...Cluster) *Builder {
+	return &Builder{clusters: clusters}
+}
+
+// Build reads the tenant namespaces of all the clusters concurrently. A
+// cluster that cannot be read is reported in the result's Errors while the
+// namespaces of the other clusters are still mapped.
+func (b *Builder) Build(ctx context.Context) *Result {
+	clusterMaps := make([]map[string]string, len(b.clusters))
+	clusterErrs := make([]error, len(b.clusters))
+	var wg sync.WaitGroup
+	for i, cluster := range b.clusters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clusterMaps[i], clusterErrs[i] = readCluster(ctx, cluster.Client)
+		}()
+	}
+	wg.Wait()
+
+	claims := map[string]map[string][]string{}
+	result := &Result{Entries: map[string]Entry{}}
+	for i, cluster := range b.clusters {
+		if clusterErrs[i] != nil {
+			result.Errors = append(result.Errors, ClusterError{Cluster: cluster.Name, Err: clusterErrs[i]})
+			continue
+		}
+		for namespace, workspace := range clusterMaps[i] {
+			if claims[namespace] == nil {
+				claims[namespace] = map[string][]string{}
+			}
+			claims[namespace][workspace] = append(claims[namespace][workspace], cluster.Name)
+		}
+	}
+	for namespace, workspaces := range claims {
+		if len(workspaces) > 1 {
+			result.Conflicts = append(result.Conflicts, Conflict{Namespace: namespace, Claims: workspaces})
+			continue
+		}
+		for workspace, clusters := range workspaces {
+			result.Entries[namespace] = Entry{Workspace: workspace, Clusters: clusters}
+		}
+	}
+	sort.Slice(result.Conflicts, func(i, j int) bool {
+		return result.Conflicts[i].Namespace < result.Conflicts[j].Namespace
+	})
+	return result
+}
+
+// readCluster returns a map from the tenant namespaces of a cluster to their
+// workspaces
+func readCluster(ctx context.Context, client kubernetes.Interface) (map[string]string, error) {
+	m := map[string]string{}
+	opts := metav1.ListOptions{LabelSelector: TenantSelector}
+	for {
+		list, err := client.CoreV1().Namespaces().List(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range list.Items {
+			if workspace := ns.Labels[SpaceLabel]; workspace != "" {
+				m[ns.Name] = workspace
+			}
+		}
+		if opts.Continue = list.Continue; opts.Continue == "" {
+			return m, nil
+		}
+	}
+}
+
+// KeepPrevious copies entries from a previously built map for namespaces that
+// are missing from the result and were found in clusters that could not be
+// read this time, so a temporary cluster failure does not drop them
+func (r *Result) KeepPrevious(previous map[string]Entry) {
+	var failed []string
+	for _, clusterErr := range r.Errors {
+		failed = append(failed, clusterErr.Cluster)
+	}
+	for namespace, entry := range previous {
+		if _, ok := r.Entries[namespace]; ok {
+			continue
+		}
+		if slices.ContainsFunc(entry.Clusters, func(c string) bool { return slices.Contains(failed, c) }) {
+			r.Entries[namespace] = entry
+		}
+	}
+}
+
+// Workspaces returns a map from namespace names to workspace names, in the
+// format produced by get-workspace-map.sh
+func (r *Result) Workspaces() map[string]string {
+	m := make(map[string]string, len(r.Entries))
+	for namespace, entry := range r.Entries {
+		m[namespace] = entry.Workspace
+	}
+	return m
+}
+
+// WriteJSON writes the map from namespace names to workspace names as a JSON
+// object
+func (r *Result) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r.Workspaces())
+}
+
+// WriteReport writes a human-readable description of the clusters that could
+// not be read and the conflicts that were found
+func (r *Result) WriteReport(w io.Writer) {
+	fmt.Fprintf(
+		w, "Mapped %d namespaces, failed to read %d clusters, found %d conflicts\n",
+		len(r.Entries), len(r.Errors), len(r.Conflicts),
+	)
+	for _, clusterErr := range r.Errors {
+		fmt.Fprintf(w, "Failed to read %v\n", clusterErr)
+	}
+	for _, conflict := range r.Conflicts {
+		workspaces := make([]string, 0, len(conflict.Claims))
+		for workspace := range conflict.Claims {
+			workspaces = append(workspaces, workspace)
+		}
+		sort.Strings(workspaces)
+		fmt.Fprintf(w, "Conflicting workspaces for namespace %s:", conflict.Namespace)
+		for _, workspace := range workspaces {
+			fmt.Fprintf(w, " %s (%v)", workspace, conflict.Claims[workspace])
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,140 @@
+package wsmap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func mkNamespace(name, nsType, space string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name: name,
+		Labels: map[string]string{
+			"toolchain.dev.openshift.com/type": nsType,
+			SpaceLabel:                         space,
+		},
+	}}
+}
+
+func failingClient() *fake.Clientset {
+	client := fake.NewClientset()
+	client.PrependReactor("list", "namespaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("connection refused")
+	})
+	return client
+}
+
+func TestBuilder_Build(t *testing.T) {
+	result := NewBuilder(
+		Cluster{Name: "m01", Client: fake.NewClientset(
+			mkNamespace("alice-tenant", "tenant", "alice"),
+			mkNamespace("bob-tenant", "tenant", "bob"),
+			mkNamespace("shared-tenant", "tenant", "carol"),
+			mkNamespace("not-a-tenant", "other", "dave"),
+		)},
+		Cluster{Name: "down", Client: failingClient()},
+		Cluster{Name: "rh01", Client: fake.NewClientset(
+			mkNamespace("bob-tenant", "tenant", "bob"),
+			mkNamespace("shared-tenant", "tenant", "eve"),
+			mkNamespace("frank-tenant", "tenant", "frank"),
+		)},
+	).Build(context.Background())
+
+	assert.Equal(t, map[string]Entry{
+		"alice-tenant": {Workspace: "alice", Clusters: []string{"m01"}},
+		"bob-tenant":   {Workspace: "bob", Clusters: []string{"m01", "rh01"}},
+		"frank-tenant": {Workspace: "frank", Clusters: []string{"rh01"}},
+	}, result.Entries)
+	assert.Equal(t, map[string]string{
+		"alice-tenant": "alice",
+		"bob-tenant":   "bob",
+		"frank-tenant": "frank",
+	}, result.Workspaces())
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, "down", result.Errors[0].Cluster)
+	assert.EqualError(t, result.Errors[0], "cluster down: connection refused")
+	assert.Equal(t, []Conflict{{
+		Namespace: "shared-tenant",
+		Claims:    map[string][]string{"carol": {"m01"}, "eve": {"rh01"}},
+	}}, result.Conflicts)
+
+	var report bytes.Buffer
+	result.WriteReport(&report)
+	assert.Equal(t,
+		"Mapped 3 namespaces, failed to read 1 clusters, found 1 conflicts\n"+
+			"Failed to read cluster down: connection refused\n"+
+			"Conflicting workspaces for namespace shared-tenant: carol ([m01]) eve ([rh01])\n",
+		report.String(),
+	)
+}
+
+func TestResult_KeepPrevious(t *testing.T) {
+	result := &Result{
+		Entries: map[string]Entry{"a-tenant": {Workspace: "a", Clusters: []string{"m01"}}},
+		Errors:  []ClusterError{{Cluster: "down", Err: errors.New("timeout")}},
+	}
+	result.KeepPrevious(map[string]Entry{
+		"a-tenant": {Workspace: "old-a", Clusters: []string{"down"}},
+		"b-tenant": {Workspace: "b", Clusters: []string{"m01", "down"}},
+		"c-tenant": {Workspace: "c", Clusters: []string{"m01"}},
+	})
+	assert.Equal(t, map[string]Entry{
+		"a-tenant": {Workspace: "a", Clusters: []string{"m01"}},
+		"b-tenant": {Workspace: "b", Clusters: []string{"m01", "down"}},
+	}, result.Entries)
+}
+
+func TestConfigMap(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+
+	entries, err := ReadConfigMapEntries(ctx, client, "ns", "ws-map")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	result := &Result{Entries: map[string]Entry{"a-tenant": {Workspace: "a", Clusters: []string{"m01"}}}}
+	require.NoError(t, WriteConfigMap(ctx, client, "ns", "ws-map", result))
+	result.Entries["b-tenant"] = Entry{Workspace: "b", Clusters: []string{"rh01"}}
+	require.NoError(t, WriteConfigMap(ctx, client, "ns", "ws-map", result))
+
+	cm, err := client.CoreV1().ConfigMaps("ns").Get(ctx, "ws-map", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a-tenant":"a","b-tenant":"b"}`, cm.Data[ConfigMapKey])
+	entries, err = ReadConfigMapEntries(ctx, client, "ns", "ws-map")
+	require.NoError(t, err)
+	assert.Equal(t, result.Entries, entries)
+}
+
+func TestClustersFromConfig(t *testing.T) {
+	config := clientcmdapi.NewConfig()
+	config.Clusters["api-m01:6443"] = &clientcmdapi.Cluster{Server: "https://api.m01.example.com:6443"}
+	config.Clusters["api-rh01:6443"] = &clientcmdapi.Cluster{Server: "https://api.rh01.example.com:6443/"}
+	config.Contexts["m01"] = &clientcmdapi.Context{Cluster: "api-m01:6443"}
+	config.Contexts["rh01"] = &clientcmdapi.Context{Cluster: "api-rh01:6443"}
+
+	clusters, err := ClustersFromConfig(
+		config, []string{"m01"}, []string{"https://api.rh01.example.com:6443", "api-m01:6443"},
+	)
+	require.NoError(t, err)
+	names := []string{}
+	for _, cluster := range clusters {
+		names = append(names, cluster.Name)
+		assert.NotNil(t, cluster.Client)
+	}
+	assert.Equal(t, []string{"m01", "https://api.rh01.example.com:6443", "api-m01:6443"}, names)
+
+	_, err = ClustersFromConfig(config, []string{"nope"}, nil)
+	assert.EqualError(t, err, `context "nope" not found in kubeconfig`)
+	_, err = ClustersFromConfig(config, nil, []string{"https://unknown:6443"})
+	assert.EqualError(t, err, `no kubeconfig context found for cluster "https://unknown:6443"`)
+}